@@ -53,6 +53,23 @@ func (a *BlockValidatorAPI) LatestValidatedBlockHash(ctx context.Context) (commo
 	return hash, nil
 }
 
+type EncryptedMempoolAPI struct {
+	sequencer *Sequencer
+}
+
+func (a *EncryptedMempoolAPI) SendEncryptedTransaction(ctx context.Context, etx EncryptedTransaction) (EncryptedTxCommitment, error) {
+	return a.sequencer.PublishEncryptedTransaction(ctx, etx)
+}
+
+// CurrentEpoch returns the earliest epoch transactions can still be encrypted for
+func (a *EncryptedMempoolAPI) CurrentEpoch(ctx context.Context) (uint64, error) {
+	keyper := a.sequencer.EncryptedMempoolKeyper()
+	if keyper == nil {
+		return 0, ErrEncryptedMempoolDisabled
+	}
+	return keyper.CurrentEpoch(), nil
+}
+
 type ArbDebugAPI struct {
 	blockchain *core.BlockChain
 }
@@ -254,6 +271,119 @@ func (api *ArbDebugAPI) PricingModel(ctx context.Context, start, end rpc.BlockNu
 	return history, nil
 }
 
+// The most samples a single PricingModelSeries response may contain
+const maxPricingModelSamples = 1024
+
+// The most aggregators whose compression ratios a PricingModelSeries request may ask for
+const maxPricingModelAggregators = 16
+
+type PricingModelSample struct {
+	BlockNumber              uint64                    `json:"blockNumber"`
+	Timestamp                uint64                    `json:"timestamp"`
+	BaseFee                  *big.Int                  `json:"baseFee"`
+	GasUsed                  uint64                    `json:"gasUsed"` // by the sampled block only, not the blocks skipped until the next sample
+	GasBacklog               uint64                    `json:"gasBacklog"`
+	MinBaseFee               *big.Int                  `json:"minBaseFee"`
+	SpeedLimit               uint64                    `json:"speedLimit"`
+	MaxPerBlockGasLimit      uint64                    `json:"maxPerBlockGasLimit"`
+	PricingInertia           uint64                    `json:"pricingInertia"`
+	BacklogTolerance         uint64                    `json:"backlogTolerance"`
+	L1BaseFeeEstimate        *big.Int                  `json:"l1BaseFeeEstimate"`
+	L1BaseFeeEstimateInertia uint64                    `json:"l1BaseFeeEstimateInertia"`
+	L1BaseFeeUpdateTime      uint64                    `json:"l1BaseFeeUpdateTime"`
+	DefaultAggregator        common.Address            `json:"defaultAggregator"`
+	CompressionRatios        map[common.Address]uint64 `json:"compressionRatios"` // in bips, for each aggregator requested and the default one
+}
+
+type PricingModelSeries struct {
+	Samples []PricingModelSample `json:"samples"`
+	Next    *uint64              `json:"next,omitempty"` // the block to request next, if the range didn't fit in this response
+}
+
+// PricingModelSeries samples the L1 and L2 pricing models every step blocks in the range [start, end).
+// Only the sampled blocks' states and headers are read, so long ranges can be plotted cheaply with a large step.
+// A response holds at most maxPricingModelSamples samples; the rest of the range is requested from Next.
+func (api *ArbDebugAPI) PricingModelSeries(
+	ctx context.Context, start, end rpc.BlockNumber, step uint64, aggregators *[]common.Address,
+) (PricingModelSeries, error) {
+	start, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, start)
+	end, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, end)
+
+	series := PricingModelSeries{Samples: []PricingModelSample{}}
+	if end.Int64() <= start.Int64() {
+		return series, fmt.Errorf("invalid block range: %v to %v", start.Int64(), end.Int64())
+	}
+	if step == 0 {
+		step = 1
+	}
+	if blocks := uint64(end) - uint64(start); step > blocks {
+		// A single sample covers the whole range, and block+step can't overflow
+		step = blocks
+	}
+	var requested []common.Address
+	if aggregators != nil {
+		requested = *aggregators
+	}
+	if len(requested) > maxPricingModelAggregators {
+		return series, fmt.Errorf("too many aggregators requested: %v, the maximum is %v", len(requested), maxPricingModelAggregators)
+	}
+
+	for block := uint64(start); block < uint64(end); block += step {
+		if len(series.Samples) == maxPricingModelSamples {
+			next := block
+			series.Next = &next
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return series, err
+		}
+		state, header, err := stateAndHeader(api.blockchain, block)
+		if err != nil {
+			return series, err
+		}
+		l1Pricing := state.L1PricingState()
+		l2Pricing := state.L2PricingState()
+
+		sample := PricingModelSample{
+			BlockNumber:       block,
+			Timestamp:         header.Time,
+			BaseFee:           header.BaseFee,
+			GasUsed:           header.GasUsed,
+			CompressionRatios: make(map[common.Address]uint64),
+		}
+
+		if state.FormatVersion() >= l2pricing.FirstExponentialPricingVersion {
+			sample.GasBacklog, _ = l2Pricing.GasBacklog()
+			sample.PricingInertia, _ = l2Pricing.PricingInertia()
+			sample.BacklogTolerance, _ = l2Pricing.BacklogTolerance()
+		}
+		sample.MinBaseFee, _ = l2Pricing.MinBaseFeeWei()
+		sample.SpeedLimit, _ = l2Pricing.SpeedLimitPerSecond()
+		sample.MaxPerBlockGasLimit, _ = l2Pricing.MaxPerBlockGasLimit()
+
+		sample.L1BaseFeeEstimate, _ = l1Pricing.L1BaseFeeEstimateWei()
+		sample.L1BaseFeeEstimateInertia, _ = l1Pricing.L1BaseFeeEstimateInertia()
+		sample.L1BaseFeeUpdateTime, err = l1Pricing.LastL1BaseFeeUpdateTime()
+		if err != nil {
+			return series, err
+		}
+		sample.DefaultAggregator, err = l1Pricing.DefaultAggregator()
+		if err != nil {
+			return series, err
+		}
+		for _, aggregator := range append([]common.Address{sample.DefaultAggregator}, requested...) {
+			ratio, err := l1Pricing.AggregatorCompressionRatio(aggregator)
+			if err != nil {
+				return series, err
+			}
+			sample.CompressionRatios[aggregator] = uint64(ratio)
+		}
+		series.Samples = append(series.Samples, sample)
+	}
+
+	return series, nil
+}
+
 func (api *ArbDebugAPI) TimeoutQueueHistory(ctx context.Context, start, end rpc.BlockNumber) ([]uint64, error) {
 	start, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, start)
 	end, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, end)
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math"
 	"math/big"
 	"time"
 
@@ -16,12 +17,16 @@ import (
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/offchainlabs/nitro/arbcompress"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/das"
@@ -30,6 +35,8 @@ import (
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
+var trackerBehindCounter = metrics.NewRegisteredCounter("arb/batchposter/trackerbehind", nil)
+
 type BatchPoster struct {
 	stopwaiter.StopWaiter
 	l1Reader            *headerreader.HeaderReader
@@ -43,18 +50,29 @@ type BatchPoster struct {
 	pendingMsgTimestamp time.Time
 	lastBatchCount      uint64
 	das                 das.DataAvailabilityService
+	db                  ethdb.Database
+	inFlight            []*pendingBatch // batches sent but not yet read by the inbox tracker, in order
+	reconciled          bool            // whether inFlight was checked after loading it from the database
+	wellSavingsEstimate float64         // the fraction of its size a batch shrinks by when recompressed at the highest level
+	batchBaseGas        uint64          // the gas of the last batch that could be estimated, less its calldata gas, or 0 if none has been
 }
 
 type BatchPosterConfig struct {
-	Enable               bool          `koanf:"enable"`
-	MaxBatchSize         int           `koanf:"max-size"`
-	MaxBatchPostInterval time.Duration `koanf:"max-interval"`
-	BatchPollDelay       time.Duration `koanf:"poll-delay"`
-	PostingErrorDelay    time.Duration `koanf:"error-delay"`
-	CompressionLevel     int           `koanf:"compression-level"`
-	DASRetentionPeriod   time.Duration `koanf:"das-retention-period"`
-	HighGasThreshold     float32       `koanf:"high-gas-threshold"`
-	HighGasDelay         time.Duration `koanf:"high-gas-delay"`
+	Enable               bool                      `koanf:"enable"`
+	MaxBatchSize         int                       `koanf:"max-size"`
+	MaxBatchPostInterval time.Duration             `koanf:"max-interval"`
+	BatchPollDelay       time.Duration             `koanf:"poll-delay"`
+	PostingErrorDelay    time.Duration             `koanf:"error-delay"`
+	CompressionLevel     int                       `koanf:"compression-level"`
+	DASRetentionPeriod   time.Duration             `koanf:"das-retention-period"`
+	HighGasThreshold     float32                   `koanf:"high-gas-threshold"`
+	HighGasDelay         time.Duration             `koanf:"high-gas-delay"`
+	MaxInFlightBatches   int                       `koanf:"max-in-flight"`
+	FeeBumpInterval      time.Duration             `koanf:"fee-bump-interval"`
+	FeeBumpPercent       uint64                    `koanf:"fee-bump-percent"`
+	MaxFeeCap            float64                   `koanf:"max-fee-cap"`
+	StatsRetention       uint64                    `koanf:"stats-retention"`
+	AdaptiveCompression  AdaptiveCompressionConfig `koanf:"adaptive-compression"`
 }
 
 func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -67,6 +85,12 @@ func BatchPosterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".das-retention-period", DefaultBatchPosterConfig.DASRetentionPeriod, "In AnyTrust mode, the period which DASes are requested to retain the stored batches.")
 	f.Float32(prefix+".high-gas-threshold", DefaultBatchPosterConfig.HighGasThreshold, "If the gas price in gwei is above this amount, delay posting a batch")
 	f.Duration(prefix+".high-gas-delay", DefaultBatchPosterConfig.HighGasDelay, "The maximum delay while waiting for the gas price to go below the high gas threshold")
+	f.Int(prefix+".max-in-flight", DefaultBatchPosterConfig.MaxInFlightBatches, "maximum number of batches sent to L1 but not yet read back by the inbox tracker")
+	f.Duration(prefix+".fee-bump-interval", DefaultBatchPosterConfig.FeeBumpInterval, "how long to wait for a batch transaction to be included before replacing it with higher fees (0 to disable)")
+	f.Uint64(prefix+".fee-bump-percent", DefaultBatchPosterConfig.FeeBumpPercent, "percentage by which each replacement raises the gas fee cap and tip cap (L1 nodes require at least 10)")
+	f.Float64(prefix+".max-fee-cap", DefaultBatchPosterConfig.MaxFeeCap, "maximum gas fee cap in gwei that replacements may raise a batch transaction to")
+	f.Uint64(prefix+".stats-retention", DefaultBatchPosterConfig.StatsRetention, "number of most recent batches to keep size and fee stats of (0 to keep all)")
+	AdaptiveCompressionConfigAddOptions(prefix+".adaptive-compression", f)
 }
 
 var DefaultBatchPosterConfig = BatchPosterConfig{
@@ -79,6 +103,12 @@ var DefaultBatchPosterConfig = BatchPosterConfig{
 	DASRetentionPeriod:   time.Hour * 24 * 15,
 	HighGasThreshold:     150.,
 	HighGasDelay:         14 * time.Hour,
+	MaxInFlightBatches:   4,
+	FeeBumpInterval:      5 * time.Minute,
+	FeeBumpPercent:       20,
+	MaxFeeCap:            500.,
+	StatsRetention:       100000,
+	AdaptiveCompression:  DefaultAdaptiveCompressionConfig,
 }
 
 var TestBatchPosterConfig = BatchPosterConfig{
@@ -91,13 +121,23 @@ var TestBatchPosterConfig = BatchPosterConfig{
 	DASRetentionPeriod:   time.Hour * 24 * 15,
 	HighGasThreshold:     0.,
 	HighGasDelay:         0,
+	MaxInFlightBatches:   4,
+	FeeBumpInterval:      time.Second,
+	FeeBumpPercent:       20,
+	MaxFeeCap:            500.,
+	StatsRetention:       1000,
+	AdaptiveCompression:  DefaultAdaptiveCompressionConfig,
 }
 
-func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, streamer *TransactionStreamer, config *BatchPosterConfig, contractAddress common.Address, refunder common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService) (*BatchPoster, error) {
+func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, streamer *TransactionStreamer, db ethdb.Database, config *BatchPosterConfig, contractAddress common.Address, refunder common.Address, transactOpts *bind.TransactOpts, das das.DataAvailabilityService) (*BatchPoster, error) {
 	inboxContract, err := bridgegen.NewSequencerInbox(contractAddress, l1Reader.Client())
 	if err != nil {
 		return nil, err
 	}
+	inFlight, err := loadPendingBatches(db)
+	if err != nil {
+		return nil, err
+	}
 	return &BatchPoster{
 		l1Reader:      l1Reader,
 		inbox:         inbox,
@@ -107,6 +147,10 @@ func NewBatchPoster(l1Reader *headerreader.HeaderReader, inbox *InboxTracker, st
 		transactOpts:  transactOpts,
 		gasRefunder:   refunder,
 		das:           das,
+		db:            db,
+		inFlight:      inFlight,
+
+		wellSavingsEstimate: initialWellSavingsEstimate,
 	}, nil
 }
 
@@ -161,6 +205,22 @@ func (s *batchSegments) recompressAll() error {
 	return nil
 }
 
+// Once a batch has segments, changing its compression level recompresses them, so its level
+// is then only raised, and only by at least this much
+const compressionLevelHysteresis = 2
+
+// setCompressionLevel changes the level segments are compressed at, recompressing those added so far
+func (s *batchSegments) setCompressionLevel(level int) error {
+	if s.isDone || level == s.compressionLevel {
+		return nil
+	}
+	if len(s.rawSegments) > 0 && level < s.compressionLevel+compressionLevelHysteresis {
+		return nil
+	}
+	s.compressionLevel = level
+	return s.recompressAll()
+}
+
 func (s *batchSegments) testForOverflow() (bool, error) {
 	// there is room, no need to flush
 	if (s.lastCompressedSize + s.newUncompressedSize) < s.sizeLimit {
@@ -299,6 +359,35 @@ func (s *batchSegments) IsEmpty() bool {
 	return len(s.rawSegments) == 0
 }
 
+// rawSize returns the size of the segments before compression
+func (s *batchSegments) rawSize() int {
+	size := 0
+	for _, segment := range s.rawSegments {
+		size += len(segment)
+	}
+	return size
+}
+
+// compressWell returns the closed batch recompressed at the highest brotli level
+func (s *batchSegments) compressWell() ([]byte, error) {
+	var uncompressed []byte
+	for _, segment := range s.rawSegments {
+		encoded, err := rlp.EncodeToBytes(segment)
+		if err != nil {
+			return nil, err
+		}
+		uncompressed = append(uncompressed, encoded...)
+	}
+	compressedBytes, err := arbcompress.CompressWell(uncompressed)
+	if err != nil {
+		return nil, err
+	}
+	fullMsg := make([]byte, 1, len(compressedBytes)+1)
+	fullMsg[0] = 0 // Header
+	fullMsg = append(fullMsg, compressedBytes...)
+	return fullMsg, nil
+}
+
 func (s *batchSegments) CloseAndGetBytes() ([]byte, error) {
 	if !s.isDone {
 		err := s.close()
@@ -320,23 +409,152 @@ func (s *batchSegments) CloseAndGetBytes() ([]byte, error) {
 	return fullMsg, nil
 }
 
-func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum uint64) (*types.Transaction, error) {
-	inboxContractCount, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx, Pending: true})
+// updateInFlight forgets batches the inbox tracker has read, recovers batches whose
+// transactions were dropped from, or reorged out of, L1, and bumps the fees of batches
+// waiting too long to be included. It returns the L1 contract's batch count.
+func (b *BatchPoster) updateInFlight(ctx context.Context, trackerCount uint64) (uint64, error) {
+	client := b.l1Reader.Client()
+	// Read the nonce before the batch count, so a transaction included in between isn't mistaken as dropped
+	confirmedNonce, err := client.NonceAt(ctx, b.transactOpts.From, nil)
+	if err != nil {
+		return 0, err
+	}
+	contractCountBig, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return 0, err
+	}
+	if !contractCountBig.IsUint64() {
+		return 0, fmt.Errorf("invalid inbox contract batch count %v", contractCountBig)
+	}
+	contractCount := contractCountBig.Uint64()
+	for len(b.inFlight) > 0 && b.inFlight[0].seqNum < trackerCount {
+		if !b.inFlight[0].included {
+			b.recordInclusion(ctx, b.inFlight[0])
+		}
+		if err := b.deletePendingBatch(b.inFlight[0]); err != nil {
+			return 0, err
+		}
+		b.inFlight = b.inFlight[1:]
+	}
+	for i, batch := range b.inFlight {
+		if batch.seqNum < contractCount {
+			// included in L1, waiting for the inbox tracker
+			if !batch.included {
+				b.recordInclusion(ctx, batch)
+			}
+			continue
+		}
+		batch.included = false
+		if batch.tx.Nonce() < confirmedNonce {
+			// The nonce was used without posting this batch, e.g. because the transaction reverted.
+			// All later batches depend on this one, so they need to be rebuilt and reposted.
+			log.Warn("BatchPoster: batch transaction nonce used without posting batch, reposting", "tx", batch.tx.Hash(), "sequence nr.", batch.seqNum, "nonce", batch.tx.Nonce())
+			for _, dropped := range b.inFlight[i:] {
+				if err := b.deletePendingBatch(dropped); err != nil {
+					return 0, err
+				}
+			}
+			b.inFlight = b.inFlight[:i]
+			b.building = nil
+			break
+		}
+		known, err := b.isBatchTxKnown(ctx, batch)
+		if err != nil {
+			return 0, err
+		}
+		if !known {
+			log.Warn("BatchPoster: batch transaction dropped from L1, resending", "tx", batch.tx.Hash(), "sequence nr.", batch.seqNum)
+			if err := client.SendTransaction(ctx, batch.tx); err != nil {
+				// Resending is retried next time, which mustn't keep later batches from being checked
+				log.Warn("BatchPoster: error resending batch transaction", "tx", batch.tx.Hash(), "sequence nr.", batch.seqNum, "err", err)
+				continue
+			}
+		}
+		if err := b.maybeBumpFee(ctx, batch); err != nil {
+			return 0, err
+		}
+	}
+	return contractCount, nil
+}
+
+// isBatchTxKnown returns whether L1 knows of a batch's transaction, or of any transaction it replaced
+func (b *BatchPoster) isBatchTxKnown(ctx context.Context, batch *pendingBatch) (bool, error) {
+	client := b.l1Reader.Client()
+	hashes := append([]common.Hash{batch.tx.Hash()}, batch.replaced...)
+	for _, hash := range hashes {
+		_, _, err := client.TransactionByHash(ctx, hash)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// nextNonce returns the nonce for the batch transaction after the ones in flight
+func (b *BatchPoster) nextNonce(ctx context.Context) (uint64, error) {
+	client := b.l1Reader.Client()
+	if len(b.inFlight) == 0 {
+		return client.PendingNonceAt(ctx, b.transactOpts.From)
+	}
+	nonce := b.inFlight[len(b.inFlight)-1].tx.Nonce() + 1
+	confirmedNonce, err := client.NonceAt(ctx, b.transactOpts.From, nil)
+	if err != nil {
+		return 0, err
+	}
+	if confirmedNonce > nonce {
+		// The in flight transactions' nonces were used by other transactions
+		nonce = confirmedNonce
+	}
+	return nonce, nil
+}
+
+// batchCalldataGas is the intrinsic gas of a batch's data in calldata
+func batchCalldataGas(data []byte) uint64 {
+	var gas uint64
+	for _, b := range data {
+		if b == 0 {
+			gas += params.TxDataZeroGas
+		} else {
+			gas += params.TxDataNonZeroGasEIP2028
+		}
+	}
+	return gas
+}
+
+func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, trackerCount uint64) (*types.Transaction, error) {
+	contractCount, err := b.updateInFlight(ctx, trackerCount)
 	if err != nil {
 		return nil, err
 	}
+	batchSeqNum := trackerCount
+	if len(b.inFlight) > 0 {
+		batchSeqNum = b.inFlight[len(b.inFlight)-1].seqNum + 1
+	}
 	timeSinceNextMessage := time.Since(b.pendingMsgTimestamp)
-	if !arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum)) {
-		// If it's been under a minute since the last batch was posted, and the inbox tracker is exactly one batch behind,
-		// then there isn't an error. We're just waiting for the inbox tracker to read the most recently posted batch.
-		if timeSinceNextMessage <= time.Minute && arbmath.BigEquals(inboxContractCount, arbmath.UintToBig(batchSeqNum+1)) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("inbox tracker not synced: contract has %v batches but inbox tracker has %v", inboxContractCount, batchSeqNum)
+	if contractCount < trackerCount || contractCount > batchSeqNum {
+		// The inbox tracker hasn't read batches we don't know about, or an L1 reorg it hasn't seen yet.
+		// Either way, the batch to post next isn't known until it catches up.
+		log.Info("BatchPoster: waiting for inbox tracker to sync", "contractBatchCount", contractCount, "trackerBatchCount", trackerCount, "inFlight", len(b.inFlight))
+		trackerBehindCounter.Inc(1)
+		return nil, nil
+	}
+	if len(b.inFlight) >= b.config.MaxInFlightBatches {
+		return nil, nil
+	}
+	if batchSeqNum != contractCount && b.batchBaseGas == 0 {
+		// The gas of a batch behind others in flight is derived from an earlier estimate, see below
+		log.Info("BatchPoster: waiting for batches in flight before estimating batch gas", "inFlight", len(b.inFlight))
+		return nil, nil
 	}
 	var prevBatchMeta BatchMetadata
-	if batchSeqNum > 0 {
-		var err error
+	if len(b.inFlight) > 0 {
+		lastInFlight := b.inFlight[len(b.inFlight)-1]
+		prevBatchMeta.MessageCount = lastInFlight.msgCount
+		prevBatchMeta.DelayedMessageCount = lastInFlight.delayedCount
+	} else if batchSeqNum > 0 {
 		prevBatchMeta, err = b.inbox.GetBatchMetadata(batchSeqNum - 1)
 		if err != nil {
 			return nil, err
@@ -349,6 +567,22 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum u
 			batchSeqNum: batchSeqNum,
 		}
 	}
+	var baseFeeGwei, headroom float64
+	if b.config.AdaptiveCompression.Enable {
+		header, err := b.l1Reader.LastHeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if header.BaseFee != nil {
+			baseFeeGwei = float64(header.BaseFee.Uint64()) / params.GWei
+		}
+		headroom = cpuHeadroom()
+		level := b.config.AdaptiveCompression.fillLevel(b.config.CompressionLevel, timeSinceNextMessage, baseFeeGwei, headroom)
+		err = b.building.segments.setCompressionLevel(level)
+		if err != nil {
+			return nil, err
+		}
+	}
 	msgCount, err := b.streamer.GetMessageCount()
 	if err != nil {
 		return nil, err
@@ -390,23 +624,65 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum u
 		b.building = nil // a closed batchSegments can't be reused
 		return nil, nil
 	}
+	compressionLevel := b.building.segments.compressionLevel
+	// With DAS, only a certificate is posted to L1, so there are no calldata savings to be had
+	if b.config.AdaptiveCompression.Enable && b.das == nil && compressionLevel < arbcompress.LEVEL_WELL &&
+		b.config.AdaptiveCompression.shouldCompressWell(len(sequencerMsg), baseFeeGwei, headroom, b.wellSavingsEstimate) {
+		wellMsg, err := b.building.segments.compressWell()
+		if err != nil {
+			return nil, err
+		}
+		savings := 1 - float64(len(wellMsg))/float64(len(sequencerMsg))
+		b.wellSavingsEstimate = b.wellSavingsEstimate*0.8 + math.Max(savings, 0)*0.2
+		log.Debug("BatchPoster: recompressed batch", "sequence nr.", batchSeqNum, "size", len(sequencerMsg), "recompressedSize", len(wellMsg), "level", compressionLevel)
+		if len(wellMsg) < len(sequencerMsg) {
+			sequencerMsg = wellMsg
+			compressionLevel = arbcompress.LEVEL_WELL
+		}
+	}
 
+	stats := &BatchStats{
+		SequenceNumber:   batchSeqNum,
+		RawBytes:         uint64(b.building.segments.rawSize()),
+		CompressedBytes:  uint64(len(sequencerMsg)),
+		L2Messages:       uint64(b.building.msgCount-prevBatchMeta.MessageCount) - (b.building.segments.delayedMsg - prevBatchMeta.DelayedMessageCount),
+		DelayedMessages:  b.building.segments.delayedMsg - prevBatchMeta.DelayedMessageCount,
+		CompressionLevel: uint64(compressionLevel),
+	}
 	if b.das != nil {
 		cert, err := b.das.Store(ctx, sequencerMsg, uint64(time.Now().Add(b.config.DASRetentionPeriod).Unix()), []byte{}) // b.das will append signature if enabled
 		if err != nil {
 			log.Warn("Unable to batch to DAS, falling back to storing data on chain", "err", err)
 		} else {
 			sequencerMsg = das.Serialize(cert)
+			stats.UsedDAS = true
 		}
 	}
 
+	nonce, err := b.nextNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
 	txOpts := *b.transactOpts
 	txOpts.Context = ctx
 	txOpts.NoSend = true
-	tx, err := b.inboxContract.AddSequencerL2BatchFromOrigin(&txOpts, new(big.Int).SetUint64(batchSeqNum), sequencerMsg, new(big.Int).SetUint64(b.building.segments.delayedMsg), b.gasRefunder)
+	txOpts.Nonce = new(big.Int).SetUint64(nonce)
+	delayedMsg := new(big.Int).SetUint64(b.building.segments.delayedMsg)
+	if batchSeqNum != contractCount {
+		// This batch can't be simulated until the batches in flight are included, as it would revert.
+		// Instead, its gas is the last estimated batch's gas less that batch's calldata gas, plus this
+		// batch's calldata gas. The rest of a batch's cost is mostly fixed, and what does grow with its size,
+		// hashing and copying the data, costs well under a fifth of the calldata gas, which the margin covers.
+		gas := b.batchBaseGas + batchCalldataGas(sequencerMsg)
+		txOpts.GasLimit = gas + gas/5
+	}
+	tx, err := b.inboxContract.AddSequencerL2BatchFromOrigin(&txOpts, new(big.Int).SetUint64(batchSeqNum), sequencerMsg, delayedMsg, b.gasRefunder)
 	if err != nil {
 		return nil, err
 	}
+	if batchSeqNum == contractCount {
+		b.batchBaseGas = arbmath.SaturatingUSub(tx.Gas(), batchCalldataGas(sequencerMsg))
+	}
 	highGasThreshold := new(big.Int).SetUint64(uint64(b.config.HighGasThreshold * params.GWei))
 	if b.config.HighGasThreshold != 0 && tx.GasFeeCap().Cmp(highGasThreshold) >= 0 && timeSinceNextMessage < b.config.HighGasDelay {
 		// The gas fee cap abigen recommended is above the high gas threshold. Check if this is necessary:
@@ -442,17 +718,38 @@ func (b *BatchPoster) maybePostSequencerBatch(ctx context.Context, batchSeqNum u
 			}
 		}
 	}
-	err = b.l1Reader.Client().SendTransaction(ctx, tx)
+	postingMsgCount := b.building.msgCount
+	batch := &pendingBatch{
+		seqNum:           batchSeqNum,
+		prevMsgCount:     prevBatchMeta.MessageCount,
+		prevDelayedCount: prevBatchMeta.DelayedMessageCount,
+		msgCount:         postingMsgCount,
+		delayedCount:     b.building.segments.delayedMsg,
+		tx:               tx,
+		sentAt:           time.Now(),
+	}
+	// Persist before sending, so that a restarted poster can't post the batch again
+	err = b.persistPendingBatch(batch)
 	if err != nil {
 		return nil, err
 	}
-	postingMsgCount := b.building.msgCount
-	log.Info("BatchPoster: batch sent", "tx", tx.Hash(), "sequence nr.", batchSeqNum, "from", prevBatchMeta.MessageCount, "to", postingMsgCount, "prev delayed", prevBatchMeta.DelayedMessageCount, "current delayed", b.building.segments.delayedMsg, "total segments", len(b.building.segments.rawSegments))
-	b.building = nil
-	_, err = b.l1Reader.WaitForTxApproval(ctx, tx)
+	stats.PostedBytes = uint64(len(sequencerMsg))
+	stats.PostedAt = uint64(batch.sentAt.Unix())
+	stats.TxHash = tx.Hash()
+	err = b.persistBatchStats(stats)
 	if err != nil {
-		return tx, err
+		log.Warn("BatchPoster: error recording batch stats", "sequence nr.", batchSeqNum, "err", err)
+	}
+	b.inFlight = append(b.inFlight, batch)
+	err = b.l1Reader.Client().SendTransaction(ctx, tx)
+	if err != nil {
+		// The transaction may have been sent regardless, so keep it in flight.
+		// If it wasn't, it'll be resent as a dropped transaction.
+		b.building = nil
+		return nil, err
 	}
+	log.Info("BatchPoster: batch sent", "tx", tx.Hash(), "sequence nr.", batchSeqNum, "from", prevBatchMeta.MessageCount, "to", postingMsgCount, "prev delayed", prevBatchMeta.DelayedMessageCount, "current delayed", b.building.segments.delayedMsg, "total segments", len(b.building.segments.rawSegments), "in flight", len(b.inFlight))
+	b.building = nil
 	if postingMsgCount < msgCount {
 		msg, err := b.streamer.GetMessage(postingMsgCount)
 		if err != nil {
@@ -496,25 +793,38 @@ func (b *BatchPoster) recomputePendingMsgTimestamp(ctx context.Context, batchCou
 func (b *BatchPoster) Start(ctxIn context.Context) {
 	b.StopWaiter.Start(ctxIn)
 	b.CallIteratively(func(ctx context.Context) time.Duration {
+		if !b.reconciled {
+			err := b.reconcilePendingBatches(ctx)
+			if err != nil {
+				log.Error("error reconciling batches in flight", "err", err)
+				return b.config.PostingErrorDelay
+			}
+			b.reconciled = true
+		}
 		batchSeqNum, err := b.inbox.GetBatchCount()
 		if err != nil {
 			log.Error("error getting inbox batch count", "err", err)
 			return b.config.PostingErrorDelay
 		}
-		if batchSeqNum != b.lastBatchCount {
+		// While batches are in flight, pendingMsgTimestamp is kept up to date as they're sent
+		if batchSeqNum != b.lastBatchCount && len(b.inFlight) == 0 {
 			err := b.recomputePendingMsgTimestamp(ctx, batchSeqNum)
 			if err != nil {
 				log.Error("error getting next message time", "err", err)
 				return b.config.PostingErrorDelay
 			}
-			b.lastBatchCount = batchSeqNum
 		}
-		_, err = b.maybePostSequencerBatch(ctx, batchSeqNum)
+		b.lastBatchCount = batchSeqNum
+		tx, err := b.maybePostSequencerBatch(ctx, batchSeqNum)
 		if err != nil {
 			b.building = nil
 			log.Error("error posting batch", "err", err)
 			return b.config.PostingErrorDelay
 		}
+		if tx != nil {
+			// Immediately try to post the next batch, in case there's a backlog
+			return 0
+		}
 		return b.config.BatchPollDelay
 	})
 }
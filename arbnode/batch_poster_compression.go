@@ -0,0 +1,89 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"math"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/shirou/gopsutil/cpu"
+	flag "github.com/spf13/pflag"
+)
+
+type AdaptiveCompressionConfig struct {
+	Enable           bool          `koanf:"enable"`
+	MinLevel         int           `koanf:"min-level"`
+	FullLevelAge     time.Duration `koanf:"full-level-age"`
+	FullLevelBaseFee float64       `koanf:"full-level-base-fee"`
+	MinCPUHeadroom   float64       `koanf:"min-cpu-headroom"`
+	CompressWell     bool          `koanf:"compress-well"`
+	MinWellSavings   float64       `koanf:"min-well-savings"`
+}
+
+var DefaultAdaptiveCompressionConfig = AdaptiveCompressionConfig{
+	Enable:           false,
+	MinLevel:         1,
+	FullLevelAge:     10 * time.Minute,
+	FullLevelBaseFee: 100.,
+	MinCPUHeadroom:   0.25,
+	CompressWell:     true,
+	MinWellSavings:   100000.,
+}
+
+func AdaptiveCompressionConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultAdaptiveCompressionConfig.Enable, "pick the batch compression level based on the batch's age, the L1 base fee, and CPU headroom, up to compression-level")
+	f.Int(prefix+".min-level", DefaultAdaptiveCompressionConfig.MinLevel, "compression level used while a batch fills quickly and the L1 base fee is low")
+	f.Duration(prefix+".full-level-age", DefaultAdaptiveCompressionConfig.FullLevelAge, "age of the oldest message in a batch at which the full compression level is used")
+	f.Float64(prefix+".full-level-base-fee", DefaultAdaptiveCompressionConfig.FullLevelBaseFee, "L1 base fee in gwei at which the full compression level is used")
+	f.Float64(prefix+".min-cpu-headroom", DefaultAdaptiveCompressionConfig.MinCPUHeadroom, "fraction of CPU time that must be idle to compress above the minimum level")
+	f.Bool(prefix+".compress-well", DefaultAdaptiveCompressionConfig.CompressWell, "recompress batches posted on chain at the highest brotli level before posting, when the calldata savings are worth it")
+	f.Float64(prefix+".min-well-savings", DefaultAdaptiveCompressionConfig.MinWellSavings, "L1 calldata savings in gwei the highest level recompression must be expected to make")
+}
+
+// The fraction of its size a batch is assumed to shrink by when recompressed at the
+// highest level, until a recompression has been measured
+const initialWellSavingsEstimate = 0.1
+
+// cpuHeadroom returns the fraction of CPU time that was idle since it was last called
+func cpuHeadroom() float64 {
+	percent, err := cpu.Percent(0, false)
+	if err != nil || len(percent) == 0 {
+		log.Debug("BatchPoster: unable to measure CPU usage", "err", err)
+		return 1
+	}
+	return 1 - percent[0]/100
+}
+
+// fillLevel returns the compression level to fill a batch at. Batches that have been
+// accumulating for a while fill slowly, so compressing them harder is cheap, and a high
+// L1 base fee makes every byte saved worth more.
+func (c *AdaptiveCompressionConfig) fillLevel(maxLevel int, age time.Duration, baseFee float64, headroom float64) int {
+	if maxLevel <= c.MinLevel {
+		return maxLevel
+	}
+	if headroom < c.MinCPUHeadroom {
+		return c.MinLevel
+	}
+	fraction := 0.
+	if c.FullLevelAge > 0 {
+		fraction = float64(age) / float64(c.FullLevelAge)
+	}
+	if c.FullLevelBaseFee > 0 {
+		fraction = math.Max(fraction, baseFee/c.FullLevelBaseFee)
+	}
+	fraction = math.Min(fraction, 1)
+	return c.MinLevel + int(math.Round(fraction*float64(maxLevel-c.MinLevel)))
+}
+
+// shouldCompressWell returns whether recompressing a batch of the given size at the
+// highest level is expected to save more than it costs
+func (c *AdaptiveCompressionConfig) shouldCompressWell(size int, baseFee float64, headroom float64, savingsEstimate float64) bool {
+	if !c.CompressWell || headroom < c.MinCPUHeadroom {
+		return false
+	}
+	savings := float64(size) * savingsEstimate * float64(params.TxDataNonZeroGasEIP2028) * baseFee
+	return savings >= c.MinWellSavings
+}
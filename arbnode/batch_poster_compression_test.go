@@ -0,0 +1,68 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptiveCompressionLevel(t *testing.T) {
+	config := DefaultAdaptiveCompressionConfig
+	config.MinLevel = 1
+	config.FullLevelAge = 10 * time.Minute
+	config.FullLevelBaseFee = 100
+	config.MinCPUHeadroom = 0.25
+
+	if level := config.fillLevel(11, 0, 0, 1); level != 1 {
+		Fail(t, "new batch at low base fee compressed at level", level)
+	}
+	if level := config.fillLevel(11, 5*time.Minute, 10, 1); level != 6 {
+		Fail(t, "half aged batch compressed at level", level)
+	}
+	if level := config.fillLevel(11, time.Minute, 200, 1); level != 11 {
+		Fail(t, "batch at high base fee compressed at level", level)
+	}
+	if level := config.fillLevel(11, time.Hour, 200, 0.1); level != 1 {
+		Fail(t, "batch compressed at level", level, "without CPU headroom")
+	}
+	if level := config.fillLevel(0, time.Hour, 200, 1); level != 0 {
+		Fail(t, "batch compressed above maximum level at level", level)
+	}
+
+	config.MinWellSavings = 100000
+	// 100KB shrinking by 10% saves 160k gas
+	if !config.shouldCompressWell(100000, 1, 1, 0.1) {
+		Fail(t, "didn't recompress when savings outweigh the cost")
+	}
+	if config.shouldCompressWell(100000, 0.5, 1, 0.1) {
+		Fail(t, "recompressed when savings are too low")
+	}
+	if config.shouldCompressWell(100000, 100, 0.1, 0.1) {
+		Fail(t, "recompressed without CPU headroom")
+	}
+}
+
+func TestCompressionLevelHysteresis(t *testing.T) {
+	config := TestBatchPosterConfig
+	config.CompressionLevel = 11
+	segments := newBatchSegments(0, &config)
+
+	// An empty batch's level changes freely
+	Require(t, segments.setCompressionLevel(1))
+	if segments.compressionLevel != 1 {
+		Fail(t, "empty batch kept compression level", segments.compressionLevel)
+	}
+
+	segments.rawSegments = append(segments.rawSegments, []byte("segment"))
+	Require(t, segments.setCompressionLevel(0))
+	Require(t, segments.setCompressionLevel(2))
+	if segments.compressionLevel != 1 {
+		Fail(t, "batch with segments recompressed for a small change, at level", segments.compressionLevel)
+	}
+	Require(t, segments.setCompressionLevel(3))
+	if segments.compressionLevel != 3 {
+		Fail(t, "batch with segments not recompressed for a large increase, at level", segments.compressionLevel)
+	}
+}
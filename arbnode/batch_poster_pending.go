@@ -0,0 +1,336 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/util/arbmath"
+)
+
+var (
+	batchInclusionTimer = metrics.NewRegisteredTimer("arb/batchposter/inclusion", nil)
+	batchFeeHistogram   = metrics.NewRegisteredHistogram("arb/batchposter/fee/perbatch", nil, metrics.NewExpDecaySample(1028, 0.015))
+	batchFeesCounter    = metrics.NewRegisteredCounter("arb/batchposter/fee/total", nil)
+	feeBumpCounter      = metrics.NewRegisteredCounter("arb/batchposter/feebumps", nil)
+)
+
+// pendingBatch is a batch whose transaction was sent to L1
+type pendingBatch struct {
+	seqNum           uint64
+	prevMsgCount     arbutil.MessageIndex // message count before this batch
+	prevDelayedCount uint64               // delayed message count before this batch
+	msgCount         arbutil.MessageIndex // message count after this batch
+	delayedCount     uint64               // delayed message count after this batch
+	tx               *types.Transaction   // the latest signed transaction
+	replaced         []common.Hash        // earlier transactions replaced by fee bumps, any of which may be included
+	sentAt           time.Time
+	bumpedAt         time.Time
+	included         bool
+}
+
+type persistedPendingBatch struct {
+	SeqNum           uint64
+	PrevMsgCount     uint64
+	PrevDelayedCount uint64
+	MsgCount         uint64
+	DelayedCount     uint64
+	Tx               []byte
+	Replaced         []common.Hash
+	SentAt           uint64
+	BumpedAt         uint64
+}
+
+func unixOrZero(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.Unix())
+}
+
+func timeOrZero(unix uint64) time.Time {
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(unix), 0)
+}
+
+func (b *BatchPoster) persistPendingBatch(batch *pendingBatch) error {
+	txBytes, err := batch.tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	value, err := rlp.EncodeToBytes(persistedPendingBatch{
+		SeqNum:           batch.seqNum,
+		PrevMsgCount:     uint64(batch.prevMsgCount),
+		PrevDelayedCount: batch.prevDelayedCount,
+		MsgCount:         uint64(batch.msgCount),
+		DelayedCount:     batch.delayedCount,
+		Tx:               txBytes,
+		Replaced:         batch.replaced,
+		SentAt:           unixOrZero(batch.sentAt),
+		BumpedAt:         unixOrZero(batch.bumpedAt),
+	})
+	if err != nil {
+		return err
+	}
+	return b.db.Put(dbKey(pendingBatchPrefix, batch.seqNum), value)
+}
+
+func (b *BatchPoster) deletePendingBatch(batch *pendingBatch) error {
+	return b.db.Delete(dbKey(pendingBatchPrefix, batch.seqNum))
+}
+
+// loadPendingBatches reads the batches in flight when the poster last stopped, in order
+func loadPendingBatches(db ethdb.Database) ([]*pendingBatch, error) {
+	iter := db.NewIterator(pendingBatchPrefix, nil)
+	defer iter.Release()
+	var batches []*pendingBatch
+	for iter.Next() {
+		var persisted persistedPendingBatch
+		if err := rlp.DecodeBytes(iter.Value(), &persisted); err != nil {
+			return nil, err
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(persisted.Tx); err != nil {
+			return nil, err
+		}
+		batches = append(batches, &pendingBatch{
+			seqNum:           persisted.SeqNum,
+			prevMsgCount:     arbutil.MessageIndex(persisted.PrevMsgCount),
+			prevDelayedCount: persisted.PrevDelayedCount,
+			msgCount:         arbutil.MessageIndex(persisted.MsgCount),
+			delayedCount:     persisted.DelayedCount,
+			tx:               tx,
+			replaced:         persisted.Replaced,
+			sentAt:           timeOrZero(persisted.SentAt),
+			bumpedAt:         timeOrZero(persisted.BumpedAt),
+		})
+	}
+	return batches, iter.Error()
+}
+
+// reconcilePendingBatches checks the batches loaded from the database against the inbox tracker
+// and the inbox contract, keeping those that continue where the inbox tracker or the contract
+// leaves off, so the poster resumes waiting for them instead of posting them again.
+func (b *BatchPoster) reconcilePendingBatches(ctx context.Context) error {
+	trackerCount, err := b.inbox.GetBatchCount()
+	if err != nil {
+		return err
+	}
+	contractCountBig, err := b.inboxContract.BatchCount(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return err
+	}
+	contractCount := arbmath.BigToUintSaturating(contractCountBig)
+	var prevBatchMeta BatchMetadata
+	if trackerCount > 0 {
+		prevBatchMeta, err = b.inbox.GetBatchMetadata(trackerCount - 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	var kept []*pendingBatch
+	var discarded []*pendingBatch
+	inconsistent := false
+	for _, batch := range b.inFlight {
+		if batch.seqNum < trackerCount {
+			// already read by the inbox tracker
+			discarded = append(discarded, batch)
+			continue
+		}
+		if !inconsistent {
+			if len(kept) > 0 {
+				prev := kept[len(kept)-1]
+				inconsistent = batch.seqNum != prev.seqNum+1 || batch.prevMsgCount != prev.msgCount || batch.prevDelayedCount != prev.delayedCount
+			} else if batch.seqNum == trackerCount {
+				inconsistent = batch.prevMsgCount != prevBatchMeta.MessageCount || batch.prevDelayedCount != prevBatchMeta.DelayedMessageCount
+			} else {
+				// The batches before this one must be in L1 for the inbox tracker to read
+				inconsistent = batch.seqNum > contractCount
+			}
+		}
+		if inconsistent {
+			// Later batches build on this one, so they're discarded as well
+			log.Warn("BatchPoster: discarding batch in flight inconsistent with inbox", "tx", batch.tx.Hash(), "sequence nr.", batch.seqNum, "trackerBatchCount", trackerCount, "contractBatchCount", contractCount)
+			discarded = append(discarded, batch)
+			continue
+		}
+		kept = append(kept, batch)
+	}
+	for _, batch := range discarded {
+		if err := b.deletePendingBatch(batch); err != nil {
+			return err
+		}
+	}
+	b.inFlight = kept
+	if len(kept) == 0 {
+		return nil
+	}
+
+	included := 0
+	for _, batch := range kept {
+		if batch.seqNum < contractCount {
+			included++
+		}
+	}
+	last := kept[len(kept)-1]
+	log.Info("BatchPoster: resuming batches in flight", "from", kept[0].seqNum, "to", last.seqNum, "included", included)
+	msgCount, err := b.streamer.GetMessageCount()
+	if err != nil {
+		return err
+	}
+	if last.msgCount < msgCount {
+		msg, err := b.streamer.GetMessage(last.msgCount)
+		if err != nil {
+			return err
+		}
+		b.pendingMsgTimestamp = time.Unix(int64(msg.Message.Header.Timestamp), 0)
+	} else {
+		b.pendingMsgTimestamp = time.Now()
+	}
+	return nil
+}
+
+// recordInclusion updates the metrics of a batch included in L1
+func (b *BatchPoster) recordInclusion(ctx context.Context, batch *pendingBatch) {
+	batch.included = true
+	client := b.l1Reader.Client()
+	hashes := append([]common.Hash{batch.tx.Hash()}, batch.replaced...)
+	for i, hash := range hashes {
+		receipt, err := client.TransactionReceipt(ctx, hash)
+		if err != nil || receipt.BlockNumber == nil {
+			continue
+		}
+		header, err := client.HeaderByNumber(ctx, receipt.BlockNumber)
+		if err != nil {
+			log.Warn("BatchPoster: error getting header of included batch", "sequence nr.", batch.seqNum, "err", err)
+			return
+		}
+		tx := batch.tx
+		if i > 0 {
+			tx, _, err = client.TransactionByHash(ctx, hash)
+			if err != nil {
+				log.Warn("BatchPoster: error getting included batch transaction", "sequence nr.", batch.seqNum, "err", err)
+				return
+			}
+		}
+		gasPrice := tx.GasPrice()
+		if header.BaseFee != nil {
+			gasPrice = arbmath.BigAdd(header.BaseFee, tx.GasTipCap())
+			if gasPrice.Cmp(tx.GasFeeCap()) > 0 {
+				gasPrice = tx.GasFeeCap()
+			}
+		}
+		fee := arbmath.BigMulByUint(gasPrice, receipt.GasUsed)
+		feeGwei := arbmath.BigDivByUint(fee, params.GWei).Int64()
+		timeToInclusion := time.Since(batch.sentAt)
+		batchInclusionTimer.Update(timeToInclusion)
+		batchFeeHistogram.Update(feeGwei)
+		batchFeesCounter.Inc(feeGwei)
+		b.recordBatchFee(batch.seqNum, hash, receipt.GasUsed, fee)
+		log.Info("BatchPoster: batch included", "tx", hash, "sequence nr.", batch.seqNum, "timeToInclusion", timeToInclusion, "feeGwei", feeGwei, "bumps", len(batch.replaced))
+		return
+	}
+	log.Warn("BatchPoster: no receipt found for included batch", "sequence nr.", batch.seqNum)
+}
+
+// L1 nodes by default only accept a replacement transaction whose fees are this much higher
+const minFeeBumpPercent = 10
+
+func bumpFee(fee *big.Int, percent uint64) *big.Int {
+	bumped := arbmath.BigMulByUfrac(fee, 100+percent, 100)
+	if bumped.Cmp(fee) <= 0 {
+		bumped = arbmath.BigAdd(fee, common.Big1)
+	}
+	return bumped
+}
+
+// maybeBumpFee replaces a batch's transaction with one paying higher fees,
+// if it's been waiting for longer than the fee bump interval
+func (b *BatchPoster) maybeBumpFee(ctx context.Context, batch *pendingBatch) error {
+	if b.config.FeeBumpInterval == 0 {
+		return nil
+	}
+	lastSent := batch.sentAt
+	if batch.bumpedAt.After(lastSent) {
+		lastSent = batch.bumpedAt
+	}
+	if time.Since(lastSent) < b.config.FeeBumpInterval {
+		return nil
+	}
+	maxFeeCap := new(big.Int).SetUint64(uint64(b.config.MaxFeeCap * params.GWei))
+	oldTx := batch.tx
+	if oldTx.GasFeeCap().Cmp(maxFeeCap) >= 0 {
+		log.Warn("BatchPoster: batch transaction stuck at maximum fee cap", "tx", oldTx.Hash(), "sequence nr.", batch.seqNum, "maxFeeCap", b.config.MaxFeeCap)
+		batch.bumpedAt = time.Now()
+		return nil
+	}
+	header, err := b.l1Reader.LastHeader(ctx)
+	if err != nil {
+		return err
+	}
+	tipCap := bumpFee(oldTx.GasTipCap(), b.config.FeeBumpPercent)
+	feeCap := bumpFee(oldTx.GasFeeCap(), b.config.FeeBumpPercent)
+	if header.BaseFee != nil {
+		// Make sure the new transaction can be included in the next few blocks
+		minFeeCap := arbmath.BigAdd(arbmath.BigMulByUint(header.BaseFee, 2), tipCap)
+		if feeCap.Cmp(minFeeCap) < 0 {
+			feeCap = minFeeCap
+		}
+	}
+	if feeCap.Cmp(maxFeeCap) > 0 {
+		feeCap = maxFeeCap
+	}
+	if tipCap.Cmp(feeCap) > 0 {
+		tipCap = feeCap
+	}
+	if feeCap.Cmp(bumpFee(oldTx.GasFeeCap(), minFeeBumpPercent)) < 0 || tipCap.Cmp(bumpFee(oldTx.GasTipCap(), minFeeBumpPercent)) < 0 {
+		// The maximum fee cap leaves too little room for a replacement to be accepted
+		log.Warn("BatchPoster: batch transaction stuck at maximum fee cap", "tx", oldTx.Hash(), "sequence nr.", batch.seqNum, "maxFeeCap", b.config.MaxFeeCap)
+		batch.bumpedAt = time.Now()
+		return nil
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:    oldTx.ChainId(),
+		Nonce:      oldTx.Nonce(),
+		GasTipCap:  tipCap,
+		GasFeeCap:  feeCap,
+		Gas:        oldTx.Gas(),
+		To:         oldTx.To(),
+		Value:      oldTx.Value(),
+		Data:       oldTx.Data(),
+		AccessList: oldTx.AccessList(),
+	})
+	tx, err = b.transactOpts.Signer(b.transactOpts.From, tx)
+	if err != nil {
+		return err
+	}
+	feeBumpCounter.Inc(1)
+	log.Info("BatchPoster: bumping batch transaction fee", "tx", tx.Hash(), "replaces", oldTx.Hash(), "sequence nr.", batch.seqNum, "gasFeeCap", feeCap, "gasTipCap", tipCap)
+	batch.bumpedAt = time.Now()
+	err = b.l1Reader.Client().SendTransaction(ctx, tx)
+	if err != nil {
+		// The old transaction is kept until a replacement is accepted, so it's resent if it was dropped.
+		// The next bump is tried after the interval.
+		log.Warn("BatchPoster: error sending fee bump", "tx", tx.Hash(), "sequence nr.", batch.seqNum, "err", err)
+		return nil
+	}
+	batch.replaced = append(batch.replaced, oldTx.Hash())
+	batch.tx = tx
+	return b.persistPendingBatch(batch)
+}
@@ -0,0 +1,156 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// The most batches a single stats query may cover
+const maxBatchStatsQueryRange = 10000
+
+// BatchStats describes the contents of a posted batch and what posting it cost
+type BatchStats struct {
+	SequenceNumber   uint64      `json:"sequenceNumber"`
+	RawBytes         uint64      `json:"rawBytes"`        // size of the segments before compression
+	CompressedBytes  uint64      `json:"compressedBytes"` // size of the brotli compressed batch
+	PostedBytes      uint64      `json:"postedBytes"`     // size of the data posted to L1, which is a certificate if DAS was used
+	L2Messages       uint64      `json:"l2Messages"`
+	DelayedMessages  uint64      `json:"delayedMessages"`
+	UsedDAS          bool        `json:"usedDAS"`
+	CompressionLevel uint64      `json:"compressionLevel"`
+	PostedAt         uint64      `json:"postedAt"`
+	TxHash           common.Hash `json:"txHash"` // the included transaction once known, otherwise the first one sent
+	Included         bool        `json:"included"`
+	L1GasUsed        uint64      `json:"l1GasUsed"`
+	L1Fee            *big.Int    `json:"l1Fee"` // in wei
+}
+
+func (b *BatchPoster) persistBatchStats(stats *BatchStats) error {
+	value, err := rlp.EncodeToBytes(stats)
+	if err != nil {
+		return err
+	}
+	batch := b.db.NewBatch()
+	if err := batch.Put(dbKey(batchStatsPrefix, stats.SequenceNumber), value); err != nil {
+		return err
+	}
+	retention := b.config.StatsRetention
+	if retention > 0 && stats.SequenceNumber >= retention {
+		if err := batch.Delete(dbKey(batchStatsPrefix, stats.SequenceNumber-retention)); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+func readBatchStats(db ethdb.Database, seqNum uint64) (*BatchStats, error) {
+	value, err := db.Get(dbKey(batchStatsPrefix, seqNum))
+	if err != nil {
+		return nil, err
+	}
+	var stats BatchStats
+	if err := rlp.DecodeBytes(value, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// recordBatchFee adds what L1 charged for an included batch to its stats
+func (b *BatchPoster) recordBatchFee(seqNum uint64, txHash common.Hash, gasUsed uint64, fee *big.Int) {
+	stats, err := readBatchStats(b.db, seqNum)
+	if err != nil {
+		// stats aren't kept for batches posted before upgrading, or past the retention
+		log.Debug("BatchPoster: no stats for included batch", "sequence nr.", seqNum, "err", err)
+		return
+	}
+	stats.TxHash = txHash
+	stats.Included = true
+	stats.L1GasUsed = gasUsed
+	stats.L1Fee = fee
+	if err := b.persistBatchStats(stats); err != nil {
+		log.Warn("BatchPoster: error recording batch fee", "sequence nr.", seqNum, "err", err)
+	}
+}
+
+type BatchPosterAPI struct {
+	db ethdb.Database
+}
+
+// BatchStats returns the stats of the posted batches in the range [start, end),
+// skipping batches that no stats were kept for
+func (api *BatchPosterAPI) BatchStats(ctx context.Context, start, end uint64) ([]BatchStats, error) {
+	if end <= start || end-start > maxBatchStatsQueryRange {
+		return nil, fmt.Errorf("invalid batch range: %v to %v", start, end)
+	}
+	iter := api.db.NewIterator(batchStatsPrefix, uint64ToBytes(start))
+	defer iter.Release()
+	stats := []BatchStats{}
+	for iter.Next() {
+		var batch BatchStats
+		if err := rlp.DecodeBytes(iter.Value(), &batch); err != nil {
+			return nil, err
+		}
+		if batch.SequenceNumber >= end {
+			break
+		}
+		stats = append(stats, batch)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return stats, iter.Error()
+}
+
+type BatchStatsSummary struct {
+	Batches          uint64   `json:"batches"`
+	DASBatches       uint64   `json:"dasBatches"`
+	RawBytes         uint64   `json:"rawBytes"`
+	CompressedBytes  uint64   `json:"compressedBytes"`
+	PostedBytes      uint64   `json:"postedBytes"`
+	L2Messages       uint64   `json:"l2Messages"`
+	DelayedMessages  uint64   `json:"delayedMessages"`
+	CompressionRatio float64  `json:"compressionRatio"` // raw bytes per compressed byte
+	IncludedBatches  uint64   `json:"includedBatches"`
+	L1GasUsed        uint64   `json:"l1GasUsed"`
+	L1Fee            *big.Int `json:"l1Fee"`
+}
+
+// BatchStatsSummary totals the stats of the posted batches in the range [start, end)
+func (api *BatchPosterAPI) BatchStatsSummary(ctx context.Context, start, end uint64) (BatchStatsSummary, error) {
+	summary := BatchStatsSummary{L1Fee: new(big.Int)}
+	stats, err := api.BatchStats(ctx, start, end)
+	if err != nil {
+		return summary, err
+	}
+	for _, batch := range stats {
+		summary.Batches++
+		if batch.UsedDAS {
+			summary.DASBatches++
+		}
+		summary.RawBytes += batch.RawBytes
+		summary.CompressedBytes += batch.CompressedBytes
+		summary.PostedBytes += batch.PostedBytes
+		summary.L2Messages += batch.L2Messages
+		summary.DelayedMessages += batch.DelayedMessages
+		if batch.Included {
+			summary.IncludedBatches++
+			summary.L1GasUsed += batch.L1GasUsed
+			if batch.L1Fee != nil {
+				summary.L1Fee.Add(summary.L1Fee, batch.L1Fee)
+			}
+		}
+	}
+	if summary.CompressedBytes > 0 {
+		summary.CompressionRatio = float64(summary.RawBytes) / float64(summary.CompressedBytes)
+	}
+	return summary, nil
+}
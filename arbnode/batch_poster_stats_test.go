@@ -0,0 +1,51 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+)
+
+func TestBatchStatsRangeQuery(t *testing.T) {
+	ctx := context.Background()
+	config := TestBatchPosterConfig
+	config.StatsRetention = 4
+	poster := &BatchPoster{db: rawdb.NewMemoryDatabase(), config: &config}
+	for i := uint64(0); i < 6; i++ {
+		Require(t, poster.persistBatchStats(&BatchStats{
+			SequenceNumber:  i,
+			RawBytes:        1000,
+			CompressedBytes: 250,
+			PostedBytes:     250,
+			L2Messages:      i,
+		}))
+	}
+	poster.recordBatchFee(5, common.Hash{1}, 21000, big.NewInt(7))
+
+	api := &BatchPosterAPI{db: poster.db}
+	stats, err := api.BatchStats(ctx, 0, 5)
+	Require(t, err)
+	// batches 0 and 1 are past the retention
+	if len(stats) != 3 || stats[0].SequenceNumber != 2 || stats[2].SequenceNumber != 4 {
+		Fail(t, "unexpected stats", stats)
+	}
+
+	summary, err := api.BatchStatsSummary(ctx, 2, 10)
+	Require(t, err)
+	if summary.Batches != 4 || summary.L2Messages != 14 || summary.CompressionRatio != 4 {
+		Fail(t, "unexpected summary", summary)
+	}
+	if summary.IncludedBatches != 1 || summary.L1GasUsed != 21000 || summary.L1Fee.Cmp(big.NewInt(7)) != 0 {
+		Fail(t, "unexpected fees in summary", summary)
+	}
+
+	if _, err := api.BatchStats(ctx, 3, 3); err == nil {
+		Fail(t, "accepted empty range")
+	}
+}
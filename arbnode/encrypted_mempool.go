@@ -0,0 +1,447 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbos/arbosState"
+	"github.com/pkg/errors"
+	flag "github.com/spf13/pflag"
+)
+
+// At most this many encrypted transactions wait for their epoch's decryption key
+const maxPendingEncryptedTxs = 4096
+
+// Each commitment in an L2MessageKind_EncryptedTxCommitments message is its epoch, index,
+// commitment, and ciphertext length, followed by the ciphertext
+const encryptedCommitmentOverhead = 8 + 8 + 32 + 8
+
+var (
+	ErrEncryptedMempoolDisabled = errors.New("encrypted mempool not enabled")
+	ErrEpochKeyReleased         = errors.New("decryption key for epoch already released")
+	ErrEncryptedMempoolFull     = errors.New("encrypted mempool full")
+	ErrEncryptedMempoolInactive = errors.New("encrypted mempool needs a newer ArbOS version")
+)
+
+type EncryptedMempoolConfig struct {
+	Enable        bool          `koanf:"enable"`
+	EpochDuration time.Duration `koanf:"epoch-duration"`
+}
+
+var DefaultEncryptedMempoolConfig = EncryptedMempoolConfig{
+	Enable:        false,
+	EpochDuration: 2 * time.Second,
+}
+
+func EncryptedMempoolConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultEncryptedMempoolConfig.Enable, "accept transactions encrypted for an epoch, sequenced in committed order once the epoch's key is released (development only, the keys are held by an in-process keyper)")
+	f.Duration(prefix+".epoch-duration", DefaultEncryptedMempoolConfig.EpochDuration, "how often the in-process keyper ends the current epoch and releases its key (0 to disable)")
+}
+
+// EpochKey is the decryption key for all transactions encrypted for an epoch
+type EpochKey struct {
+	Epoch uint64
+	Key   []byte
+}
+
+// Keyper delivers epoch decryption keys, e.g. from a threshold committee of keypers
+// which only releases an epoch's key once the epoch is over.
+type Keyper interface {
+	// CurrentEpoch returns the earliest epoch whose key hasn't been released
+	CurrentEpoch() uint64
+	// DecryptionKeys delivers each epoch's key once it's released, in increasing epoch order
+	DecryptionKeys() <-chan EpochKey
+	Decrypt(key EpochKey, ciphertext []byte) ([]byte, error)
+}
+
+// EncryptedTransaction is a transaction, in its binary encoding, encrypted for an epoch
+type EncryptedTransaction struct {
+	Epoch      uint64        `json:"epoch"`
+	Ciphertext hexutil.Bytes `json:"ciphertext"`
+}
+
+// EncryptedTxCommitment is the sequencer's commitment to the position of an encrypted
+// transaction in its epoch. Commitment chains the hashes of all the epoch's ciphertexts
+// up to and including this one, so it also commits to the transactions ordered before it.
+type EncryptedTxCommitment struct {
+	Epoch      uint64      `json:"epoch"`
+	Index      uint64      `json:"index"`
+	Commitment common.Hash `json:"commitment"`
+}
+
+type encryptedTxResult struct {
+	commitment EncryptedTxCommitment
+	err        error
+}
+
+type encryptedQueueItem struct {
+	etx        EncryptedTransaction
+	resultChan chan<- encryptedTxResult
+	ctx        context.Context
+}
+
+func (i *encryptedQueueItem) returnResult(commitment EncryptedTxCommitment, err error) {
+	i.resultChan <- encryptedTxResult{commitment, err}
+	close(i.resultChan)
+}
+
+type encryptedEpoch struct {
+	ciphertexts [][]byte
+	commitment  common.Hash
+}
+
+// encryptedMempool holds encrypted transactions in their committed order until
+// their epoch's decryption key is released. The ciphertexts are persisted so they
+// survive a restart, and it's only accessed from the sequencer's thread.
+type encryptedMempool struct {
+	keyper Keyper
+	db     ethdb.Database
+
+	epochs       map[uint64]*encryptedEpoch
+	pending      int
+	hasReleased  bool
+	lastReleased uint64
+}
+
+func encryptedTxKey(epoch uint64, index uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, epoch)
+	binary.BigEndian.PutUint64(key[8:], index)
+	return key
+}
+
+func newEncryptedMempool(keyper Keyper, db ethdb.Database) (*encryptedMempool, error) {
+	m := &encryptedMempool{
+		keyper: keyper,
+		db:     rawdb.NewTable(db, string(encryptedTxPrefix)),
+		epochs: make(map[uint64]*encryptedEpoch),
+	}
+	// Keys are ordered by epoch then index, so the commitments are rebuilt in committed order
+	iter := m.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if len(iter.Key()) != 16 {
+			return nil, errors.Errorf("invalid encrypted transaction key %v", hexutil.Encode(iter.Key()))
+		}
+		epochNum := binary.BigEndian.Uint64(iter.Key())
+		epoch, ok := m.epochs[epochNum]
+		if !ok {
+			epoch = &encryptedEpoch{}
+			m.epochs[epochNum] = epoch
+		}
+		ciphertext := common.CopyBytes(iter.Value())
+		epoch.commitment = crypto.Keccak256Hash(epoch.commitment.Bytes(), crypto.Keccak256(ciphertext))
+		epoch.ciphertexts = append(epoch.ciphertexts, ciphertext)
+		m.pending++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	if m.pending > 0 {
+		log.Info("loaded encrypted transactions awaiting decryption", "count", m.pending, "epochs", len(m.epochs))
+	}
+	return m, nil
+}
+
+// nextCommitments returns the commitments etxs would get by being committed to next, in order,
+// or the reason each can't be. It doesn't change the mempool, see add.
+func (m *encryptedMempool) nextCommitments(etxs []EncryptedTransaction) ([]EncryptedTxCommitment, []error) {
+	commitments := make([]EncryptedTxCommitment, len(etxs))
+	errs := make([]error, len(etxs))
+	pending := m.pending
+	heads := make(map[uint64]EncryptedTxCommitment)
+	currentEpoch := m.keyper.CurrentEpoch()
+	for i, etx := range etxs {
+		if (m.hasReleased && etx.Epoch <= m.lastReleased) || etx.Epoch < currentEpoch {
+			errs[i] = ErrEpochKeyReleased
+			continue
+		}
+		if pending >= maxPendingEncryptedTxs {
+			errs[i] = ErrEncryptedMempoolFull
+			continue
+		}
+		head, ok := heads[etx.Epoch]
+		if ok {
+			head.Index++
+		} else {
+			head.Epoch = etx.Epoch
+			if epoch, ok := m.epochs[etx.Epoch]; ok {
+				head.Index = uint64(len(epoch.ciphertexts))
+				head.Commitment = epoch.commitment
+			}
+		}
+		head.Commitment = crypto.Keccak256Hash(head.Commitment.Bytes(), crypto.Keccak256(etx.Ciphertext))
+		heads[etx.Epoch] = head
+		commitments[i] = head
+		pending++
+	}
+	return commitments, errs
+}
+
+// add commits to etxs, which must have been given commitments by the last call to nextCommitments
+func (m *encryptedMempool) add(etxs []EncryptedTransaction, commitments []EncryptedTxCommitment) error {
+	for i, etx := range etxs {
+		epoch, ok := m.epochs[etx.Epoch]
+		if !ok {
+			epoch = &encryptedEpoch{}
+			m.epochs[etx.Epoch] = epoch
+		}
+		epoch.ciphertexts = append(epoch.ciphertexts, etx.Ciphertext)
+		epoch.commitment = commitments[i].Commitment
+		m.pending++
+	}
+	batch := m.db.NewBatch()
+	for i, etx := range etxs {
+		if err := batch.Put(encryptedTxKey(etx.Epoch, commitments[i].Index), etx.Ciphertext); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+func (m *encryptedMempool) deleteEpoch(batch ethdb.Batch, epochNum uint64, epoch *encryptedEpoch) {
+	for i := range epoch.ciphertexts {
+		if err := batch.Delete(encryptedTxKey(epochNum, uint64(i))); err != nil {
+			log.Error("failed to delete encrypted transaction", "epoch", epochNum, "index", i, "err", err)
+		}
+	}
+	m.pending -= len(epoch.ciphertexts)
+	delete(m.epochs, epochNum)
+}
+
+// release decrypts the transactions of the key's epoch, returning them in committed order.
+// Transactions that fail to decrypt or decode are dropped.
+func (m *encryptedMempool) release(key EpochKey) []txQueueItem {
+	if m.hasReleased && key.Epoch <= m.lastReleased {
+		log.Warn("ignoring decryption key for already released epoch", "epoch", key.Epoch, "lastReleased", m.lastReleased)
+		return nil
+	}
+	m.hasReleased = true
+	m.lastReleased = key.Epoch
+	batch := m.db.NewBatch()
+	for epochNum, epoch := range m.epochs {
+		// Keys for skipped epochs will never arrive, as they're delivered in increasing order
+		if epochNum < key.Epoch {
+			log.Warn("dropping encrypted transactions of epoch without decryption key", "epoch", epochNum, "count", len(epoch.ciphertexts))
+			m.deleteEpoch(batch, epochNum, epoch)
+		}
+	}
+	var released [][]byte
+	if epoch, ok := m.epochs[key.Epoch]; ok {
+		released = epoch.ciphertexts
+		m.deleteEpoch(batch, key.Epoch, epoch)
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("failed to delete released encrypted transactions", "epoch", key.Epoch, "err", err)
+	}
+
+	var queueItems []txQueueItem
+	for i, ciphertext := range released {
+		plaintext, err := m.keyper.Decrypt(key, ciphertext)
+		if err != nil {
+			log.Info("dropping encrypted transaction that failed to decrypt", "epoch", key.Epoch, "index", i, "err", err)
+			continue
+		}
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(plaintext); err != nil {
+			log.Info("dropping encrypted transaction that failed to decode", "epoch", key.Epoch, "index", i, "err", err)
+			continue
+		}
+		// Nothing waits on the result, which is only logged if the transaction isn't sequenced
+		queueItems = append(queueItems, txQueueItem{
+			tx:        tx,
+			ctx:       context.Background(),
+			committed: true,
+		})
+	}
+	return queueItems
+}
+
+func (m *encryptedMempool) decryptionKeys() <-chan EpochKey {
+	if m == nil {
+		return nil
+	}
+	return m.keyper.DecryptionKeys()
+}
+
+// encryptedCommitmentsMessage is the L2 message recording the commitments to etxs,
+// including the ciphertexts so the order can be checked against the decrypted transactions.
+func encryptedCommitmentsMessage(etxs []EncryptedTransaction, commitments []EncryptedTxCommitment) []byte {
+	l2Message := []byte{arbos.L2MessageKind_EncryptedTxCommitments}
+	buf := make([]byte, 8)
+	for i, etx := range etxs {
+		binary.BigEndian.PutUint64(buf, commitments[i].Epoch)
+		l2Message = append(l2Message, buf...)
+		binary.BigEndian.PutUint64(buf, commitments[i].Index)
+		l2Message = append(l2Message, buf...)
+		l2Message = append(l2Message, commitments[i].Commitment.Bytes()...)
+		binary.BigEndian.PutUint64(buf, uint64(len(etx.Ciphertext)))
+		l2Message = append(l2Message, buf...)
+		l2Message = append(l2Message, etx.Ciphertext...)
+	}
+	return l2Message
+}
+
+// EncryptedMempoolKeyper returns the keyper of the encrypted mempool, or nil if it isn't enabled
+func (s *Sequencer) EncryptedMempoolKeyper() Keyper {
+	if s.encryptedMempool == nil {
+		return nil
+	}
+	return s.encryptedMempool.keyper
+}
+
+// EnableEncryptedMempool makes the sequencer accept encrypted transactions through
+// PublishEncryptedTransaction, which are sequenced in the order they were received,
+// ahead of other transactions, once keyper releases their epoch's key.
+// It must be called before Start.
+func (s *Sequencer) EnableEncryptedMempool(keyper Keyper) error {
+	mempool, err := newEncryptedMempool(keyper, s.txStreamer.db)
+	if err != nil {
+		return err
+	}
+	s.encryptedMempool = mempool
+	s.encryptedQueue = make(chan encryptedQueueItem, 128)
+	return nil
+}
+
+// PublishEncryptedTransaction commits to the ordering of an encrypted transaction.
+// It returns once the commitment is sequenced, not once the transaction is executed.
+// With admission control, each IP address is rate limited as it is for plain transactions.
+func (s *Sequencer) PublishEncryptedTransaction(ctx context.Context, etx EncryptedTransaction) (EncryptedTxCommitment, error) {
+	if s.encryptedMempool == nil {
+		return EncryptedTxCommitment{}, ErrEncryptedMempoolDisabled
+	}
+	if s.ForwardTarget() != "" {
+		// Only the main sequencer can commit to the ordering
+		return EncryptedTxCommitment{}, ErrNotMainSequencer
+	}
+	if encryptedCommitmentOverhead+len(etx.Ciphertext) > int(maxTxDataSize) {
+		return EncryptedTxCommitment{}, core.ErrOversizedData
+	}
+	statedb, err := s.txStreamer.bc.State()
+	if err != nil {
+		return EncryptedTxCommitment{}, err
+	}
+	if arbosState.ArbOSVersion(statedb) < arbos.FirstEncryptedTxCommitmentsVersion {
+		// Earlier versions don't parse the commitments message
+		return EncryptedTxCommitment{}, ErrEncryptedMempoolInactive
+	}
+	if err := s.admission.admitEncrypted(ctx); err != nil {
+		return EncryptedTxCommitment{}, err
+	}
+	resultChan := make(chan encryptedTxResult, 1)
+	queueItem := encryptedQueueItem{
+		etx:        etx,
+		resultChan: resultChan,
+		ctx:        ctx,
+	}
+	select {
+	case s.encryptedQueue <- queueItem:
+	case <-ctx.Done():
+		return EncryptedTxCommitment{}, ctx.Err()
+	}
+	select {
+	case res := <-resultChan:
+		return res.commitment, res.err
+	case <-ctx.Done():
+		return EncryptedTxCommitment{}, ctx.Err()
+	}
+}
+
+// sequenceEncryptedCommitments sequences a message committing to the queued encrypted
+// transactions, then adds them to the encrypted mempool
+func (s *Sequencer) sequenceEncryptedCommitments() {
+	var queueItems []encryptedQueueItem
+	var totalSize int
+	for len(s.encryptedPending) > 0 {
+		queueItem := s.encryptedPending[0]
+		if err := queueItem.ctx.Err(); err != nil {
+			queueItem.returnResult(EncryptedTxCommitment{}, err)
+			s.encryptedPending = s.encryptedPending[1:]
+			continue
+		}
+		size := encryptedCommitmentOverhead + len(queueItem.etx.Ciphertext)
+		if totalSize+size > int(maxTxDataSize) {
+			// Left for the next message
+			break
+		}
+		totalSize += size
+		queueItems = append(queueItems, queueItem)
+		s.encryptedPending = s.encryptedPending[1:]
+	}
+	if len(queueItems) == 0 {
+		return
+	}
+	if s.ForwardTarget() != "" {
+		for _, queueItem := range queueItems {
+			queueItem.returnResult(EncryptedTxCommitment{}, ErrNotMainSequencer)
+		}
+		return
+	}
+
+	etxs := make([]EncryptedTransaction, 0, len(queueItems))
+	for _, queueItem := range queueItems {
+		etxs = append(etxs, queueItem.etx)
+	}
+	commitments, errs := s.encryptedMempool.nextCommitments(etxs)
+	var committedItems []encryptedQueueItem
+	var committedEtxs []EncryptedTransaction
+	var committed []EncryptedTxCommitment
+	for i, queueItem := range queueItems {
+		if errs[i] != nil {
+			queueItem.returnResult(EncryptedTxCommitment{}, errs[i])
+			continue
+		}
+		committedItems = append(committedItems, queueItem)
+		committedEtxs = append(committedEtxs, etxs[i])
+		committed = append(committed, commitments[i])
+	}
+	if len(committedItems) == 0 {
+		return
+	}
+
+	header, err := s.sequencingHeader()
+	if err == nil {
+		err = s.txStreamer.SequenceL2Message(header, encryptedCommitmentsMessage(committedEtxs, committed))
+	}
+	if err != nil {
+		log.Error("error sequencing encrypted transaction commitments", "err", err)
+		for _, queueItem := range committedItems {
+			queueItem.returnResult(EncryptedTxCommitment{}, err)
+		}
+		return
+	}
+	// The commitments are sequenced, so the transactions are now owed a place in their epoch
+	// even if persisting them fails, in which case they're only lost on restart.
+	if err := s.encryptedMempool.add(committedEtxs, committed); err != nil {
+		log.Error("failed to persist encrypted transactions", "err", err)
+	}
+	for i, queueItem := range committedItems {
+		queueItem.returnResult(committed[i], nil)
+	}
+}
+
+// releaseLocalKeys ends the local keyper's current epoch, releasing its key
+func (s *Sequencer) releaseLocalKeys(ctx context.Context) time.Duration {
+	keyper, ok := s.encryptedMempool.keyper.(*LocalKeyper)
+	if !ok {
+		return s.config.EncryptedMempool.EpochDuration
+	}
+	if err := keyper.ReleaseKey(ctx, keyper.CurrentEpoch()); err != nil && ctx.Err() == nil {
+		log.Error("failed to release epoch key", "err", err)
+	}
+	return s.config.EncryptedMempool.EpochDuration
+}
@@ -0,0 +1,94 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+func commitEncrypted(t *testing.T, mempool *encryptedMempool, etx EncryptedTransaction) (EncryptedTxCommitment, error) {
+	t.Helper()
+	etxs := []EncryptedTransaction{etx}
+	commitments, errs := mempool.nextCommitments(etxs)
+	if errs[0] != nil {
+		return EncryptedTxCommitment{}, errs[0]
+	}
+	Require(t, mempool.add(etxs, commitments))
+	return commitments[0], nil
+}
+
+func TestEncryptedMempoolReleasesInCommittedOrder(t *testing.T) {
+	ctx := context.Background()
+	signer := types.LatestSignerForChainID(big.NewInt(412346))
+	sender := newOrderingTestSenders(t, 1)[0]
+	keyper := NewLocalKeyper()
+	db := rawdb.NewMemoryDatabase()
+	mempool, err := newEncryptedMempool(keyper, db)
+	Require(t, err)
+
+	var expected []txQueueItem
+	var lastCommitment EncryptedTxCommitment
+	for i := 0; i < 3; i++ {
+		item := newOrderingTestItem(t, signer, sender, int64(i))
+		expected = append(expected, item)
+		txBytes, err := item.tx.MarshalBinary()
+		Require(t, err)
+		ciphertext, err := keyper.Encrypt(0, txBytes)
+		Require(t, err)
+		commitment, err := commitEncrypted(t, mempool, EncryptedTransaction{Epoch: 0, Ciphertext: ciphertext})
+		Require(t, err)
+		if commitment.Index != uint64(i) || commitment.Commitment == lastCommitment.Commitment {
+			Fail(t, "unexpected commitment", commitment)
+		}
+		lastCommitment = commitment
+	}
+	// Garbage is committed to, but dropped on release
+	garbageCommitment, err := commitEncrypted(t, mempool, EncryptedTransaction{Epoch: 0, Ciphertext: []byte("garbage")})
+	Require(t, err)
+	// Transactions for a later epoch stay encrypted
+	_, err = commitEncrypted(t, mempool, EncryptedTransaction{Epoch: 1, Ciphertext: []byte("later")})
+	Require(t, err)
+
+	// A restarted mempool has the same commitments
+	mempool, err = newEncryptedMempool(keyper, db)
+	Require(t, err)
+	if mempool.pending != 5 || mempool.epochs[0].commitment != garbageCommitment.Commitment {
+		Fail(t, "unexpected mempool after restart, pending", mempool.pending)
+	}
+
+	Require(t, keyper.ReleaseKey(ctx, 0))
+	released := mempool.release(<-keyper.DecryptionKeys())
+	if len(released) != len(expected) {
+		Fail(t, "expected", len(expected), "released transactions, got", len(released))
+	}
+	for i, item := range released {
+		if item.tx.Hash() != expected[i].tx.Hash() || !item.committed {
+			Fail(t, "unexpected released transaction at position", i)
+		}
+	}
+	if mempool.pending != 1 {
+		Fail(t, "expected 1 pending transaction, got", mempool.pending)
+	}
+
+	_, err = commitEncrypted(t, mempool, EncryptedTransaction{Epoch: 0, Ciphertext: []byte("late")})
+	if !errors.Is(err, ErrEpochKeyReleased) {
+		Fail(t, "committed to transaction for released epoch, err", err)
+	}
+	if len(mempool.release(EpochKey{Epoch: 0})) != 0 {
+		Fail(t, "released epoch twice")
+	}
+
+	// Only the later epoch's transaction is left after a restart
+	mempool, err = newEncryptedMempool(keyper, db)
+	Require(t, err)
+	if mempool.pending != 1 || len(mempool.epochs[1].ciphertexts) != 1 {
+		Fail(t, "unexpected mempool after release and restart, pending", mempool.pending)
+	}
+}
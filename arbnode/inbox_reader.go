@@ -439,7 +439,8 @@ func (r *InboxReader) getNextBlockToRead() (*big.Int, error) {
 	return msgBlock, nil
 }
 
-func (r *InboxReader) GetSequencerMessageBytes(ctx context.Context, seqNum uint64) ([]byte, error) {
+// GetSequencerBatch looks up the L1 event of a batch the inbox tracker has read
+func (r *InboxReader) GetSequencerBatch(ctx context.Context, seqNum uint64) (*SequencerInboxBatch, error) {
 	metadata, err := r.tracker.GetBatchMetadata(seqNum)
 	if err != nil {
 		return nil, err
@@ -451,12 +452,20 @@ func (r *InboxReader) GetSequencerMessageBytes(ctx context.Context, seqNum uint6
 	}
 	for _, batch := range seqBatches {
 		if batch.SequenceNumber == seqNum {
-			return batch.Serialize(ctx, r.client)
+			return batch, nil
 		}
 	}
 	return nil, errors.New("sequencer batch not found")
 }
 
+func (r *InboxReader) GetSequencerMessageBytes(ctx context.Context, seqNum uint64) ([]byte, error) {
+	batch, err := r.GetSequencerBatch(ctx, seqNum)
+	if err != nil {
+		return nil, err
+	}
+	return batch.Serialize(ctx, r.client)
+}
+
 func (r *InboxReader) GetLastReadBlockAndBatchCount() (uint64, uint64) {
 	r.lastReadMutex.RLock()
 	defer r.lastReadMutex.RUnlock()
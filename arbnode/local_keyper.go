@@ -0,0 +1,110 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// LocalKeyper is an in-process stand-in for a keyper committee, holding every epoch's
+// key itself. It's meant for tests and development, as it can decrypt at any time.
+type LocalKeyper struct {
+	mutex        sync.Mutex
+	keys         map[uint64][]byte
+	currentEpoch uint64
+	released     chan EpochKey
+}
+
+func NewLocalKeyper() *LocalKeyper {
+	return &LocalKeyper{
+		keys:     make(map[uint64][]byte),
+		released: make(chan EpochKey, 16),
+	}
+}
+
+func (k *LocalKeyper) epochKey(epoch uint64) ([]byte, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	key, ok := k.keys[epoch]
+	if !ok {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		k.keys[epoch] = key
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext for epoch, as a user submitting a transaction would
+func (k *LocalKeyper) Encrypt(epoch uint64, plaintext []byte) ([]byte, error) {
+	key, err := k.epochKey(epoch)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newEpochCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// ReleaseKey ends epoch, delivering its decryption key
+func (k *LocalKeyper) ReleaseKey(ctx context.Context, epoch uint64) error {
+	key, err := k.epochKey(epoch)
+	if err != nil {
+		return err
+	}
+	k.mutex.Lock()
+	if epoch >= k.currentEpoch {
+		k.currentEpoch = epoch + 1
+	}
+	k.mutex.Unlock()
+	select {
+	case k.released <- EpochKey{Epoch: epoch, Key: key}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (k *LocalKeyper) CurrentEpoch() uint64 {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	return k.currentEpoch
+}
+
+func (k *LocalKeyper) DecryptionKeys() <-chan EpochKey {
+	return k.released
+}
+
+func (k *LocalKeyper) Decrypt(key EpochKey, ciphertext []byte) ([]byte, error) {
+	aead, err := newEpochCipher(key.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], nil)
+}
+
+func newEpochCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -45,6 +45,7 @@ import (
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcastclients"
 	"github.com/offchainlabs/nitro/broadcaster"
 	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/das/dasrpc"
@@ -400,6 +401,7 @@ type Config struct {
 	SeqCoordinator       SeqCoordinatorConfig           `koanf:"seq-coordinator"`
 	DataAvailability     das.DataAvailabilityConfig     `koanf:"data-availability"`
 	Wasm                 WasmConfig                     `koanf:"wasm"`
+	RetryableRedeemer    RetryableRedeemerConfig        `koanf:"retryable-redeemer"`
 	Dangerous            DangerousConfig                `koanf:"dangerous"`
 	Archive              bool                           `koanf:"archive"`
 }
@@ -426,6 +428,7 @@ func ConfigAddOptions(prefix string, f *flag.FlagSet, feedInputEnable bool, feed
 	SeqCoordinatorConfigAddOptions(prefix+".seq-coordinator", f)
 	das.DataAvailabilityConfigAddOptions(prefix+".data-availability", f)
 	WasmConfigAddOptions(prefix+".wasm", f)
+	RetryableRedeemerConfigAddOptions(prefix+".retryable-redeemer", f)
 	DangerousConfigAddOptions(prefix+".dangerous", f)
 	f.Bool(prefix+".archive", ConfigDefault.Archive, "retain past block state")
 }
@@ -444,6 +447,7 @@ var ConfigDefault = Config{
 	SeqCoordinator:       DefaultSeqCoordinatorConfig,
 	DataAvailability:     das.DefaultDataAvailabilityConfig,
 	Wasm:                 DefaultWasmConfig,
+	RetryableRedeemer:    DefaultRetryableRedeemerConfig,
 	Dangerous:            DefaultDangerousConfig,
 	Archive:              false,
 }
@@ -458,6 +462,7 @@ func ConfigDefaultL1Test() *Config {
 	config.SeqCoordinator = TestSeqCoordinatorConfig
 	config.Wasm.RootPath = validator.DefaultNitroMachineConfig.RootPath
 	config.BlockValidator = validator.TestBlockValidatorConfig
+	config.RetryableRedeemer = TestRetryableRedeemerConfig
 
 	return &config
 }
@@ -467,6 +472,7 @@ func ConfigDefaultL2Test() *Config {
 	config.Sequencer = TestSequencerConfig
 	config.L1Reader.Enable = false
 	config.SeqCoordinator = TestSeqCoordinatorConfig
+	config.RetryableRedeemer = TestRetryableRedeemerConfig
 
 	return &config
 }
@@ -504,6 +510,9 @@ type SequencerConfig struct {
 	MaxBlockSpeed               time.Duration            `koanf:"max-block-speed"`
 	MaxRevertGasReject          uint64                   `koanf:"max-revert-gas-reject"`
 	MaxAcceptableTimestampDelta time.Duration            `koanf:"max-acceptable-timestamp-delta"`
+	TxOrderingPolicy            string                   `koanf:"tx-ordering-policy"`
+	Admission                   TxAdmissionConfig        `koanf:"admission"`
+	EncryptedMempool            EncryptedMempoolConfig   `koanf:"encrypted-mempool"`
 	Dangerous                   DangerousSequencerConfig `koanf:"dangerous"`
 }
 
@@ -512,6 +521,9 @@ var DefaultSequencerConfig = SequencerConfig{
 	MaxBlockSpeed:               time.Millisecond * 100,
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
+	TxOrderingPolicy:            TxOrderingFifo,
+	Admission:                   DefaultTxAdmissionConfig,
+	EncryptedMempool:            DefaultEncryptedMempoolConfig,
 	Dangerous:                   DefaultDangerousSequencerConfig,
 }
 
@@ -520,6 +532,9 @@ var TestSequencerConfig = SequencerConfig{
 	MaxBlockSpeed:               time.Millisecond * 10,
 	MaxRevertGasReject:          params.TxGas + 10000,
 	MaxAcceptableTimestampDelta: time.Hour,
+	TxOrderingPolicy:            TxOrderingFifo,
+	Admission:                   DefaultTxAdmissionConfig,
+	EncryptedMempool:            DefaultEncryptedMempoolConfig,
 	Dangerous:                   TestDangerousSequencerConfig,
 }
 
@@ -528,6 +543,9 @@ func SequencerConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Duration(prefix+".max-block-speed", DefaultSequencerConfig.MaxBlockSpeed, "minimum delay between blocks (sets a maximum speed of block production)")
 	f.Uint64(prefix+".max-revert-gas-reject", DefaultSequencerConfig.MaxRevertGasReject, "maximum gas executed in a revert for the sequencer to reject the transaction instead of posting it (anti-DOS)")
 	f.Duration(prefix+".max-acceptable-timestamp-delta", DefaultSequencerConfig.MaxAcceptableTimestampDelta, "maximum acceptable time difference between the local time and the latest L1 block's timestamp")
+	f.String(prefix+".tx-ordering-policy", DefaultSequencerConfig.TxOrderingPolicy, "order in which queued transactions are sequenced (fifo, priority-fee, or fair)")
+	TxAdmissionConfigAddOptions(prefix+".admission", f)
+	EncryptedMempoolConfigAddOptions(prefix+".encrypted-mempool", f)
 	DangerousSequencerConfigAddOptions(prefix+".dangerous", f)
 }
 
@@ -557,9 +575,10 @@ type Node struct {
 	BlockValidator      *validator.BlockValidator
 	Staker              *validator.Staker
 	BroadcastServer     *broadcaster.Broadcaster
-	BroadcastClients    []*broadcastclient.BroadcastClient
+	BroadcastClients    *broadcastclients.BroadcastClients
 	SeqCoordinator      *SeqCoordinator
 	DASLifecycleManager *das.LifecycleManager
+	RetryableRedeemer   *RetryableRedeemer
 }
 
 func createNodeImpl(
@@ -575,7 +594,26 @@ func createNodeImpl(
 ) (*Node, error) {
 	var broadcastServer *broadcaster.Broadcaster
 	if config.Feed.Output.Enable {
-		broadcastServer = broadcaster.NewBroadcaster(config.Feed.Output)
+		var feedSigner broadcaster.FeedSigner
+		feedSigningKey, err := broadcaster.LoadFeedSigningKey(config.Feed.Output.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		if feedSigningKey != nil {
+			feedSigner = broadcaster.FeedSignerFromPrivateKey(feedSigningKey)
+		}
+		if config.Feed.Output.CatchupBuffer.Persistent {
+			catchupBuffer, err := broadcaster.NewPersistentCatchupBuffer(rawdb.NewTable(chainDb, feedCatchupPrefix), config.Feed.Output.CatchupBuffer.Retention)
+			if err != nil {
+				return nil, err
+			}
+			broadcastServer = broadcaster.NewBroadcasterWithCatchupBuffer(config.Feed.Output, feedSigner, catchupBuffer)
+		} else {
+			broadcastServer = broadcaster.NewBroadcaster(config.Feed.Output, feedSigner)
+		}
+		if config.Feed.Output.EnableFilters {
+			broadcastServer.EnableSubscriptionFilters(l2BlockChain.Config().ChainID)
+		}
 	}
 
 	var l1Reader *headerreader.HeaderReader
@@ -634,14 +672,26 @@ func createNodeImpl(
 		return nil, err
 	}
 
-	var broadcastClients []*broadcastclient.BroadcastClient
+	var broadcastClients *broadcastclients.BroadcastClients
 	if config.Feed.Input.Enable() {
-		for _, address := range config.Feed.Input.URLs {
-			broadcastClients = append(broadcastClients, broadcastclient.NewBroadcastClient(address, nil, config.Feed.Input.Timeout, txStreamer))
+		currentMessageCount, err := txStreamer.GetMessageCount()
+		if err != nil {
+			return nil, err
+		}
+		broadcastClients, err = broadcastclients.NewBroadcastClients(config.Feed.Input, currentMessageCount, txStreamer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var retryableRedeemer *RetryableRedeemer
+	if config.RetryableRedeemer.Enable {
+		retryableRedeemer, err = NewRetryableRedeemer(backend, l2BlockChain, &config.RetryableRedeemer)
+		if err != nil {
+			return nil, err
 		}
 	}
 	if !config.L1Reader.Enable {
-		return &Node{backend, arbInterface, nil, txStreamer, txPublisher, nil, nil, nil, nil, nil, nil, nil, broadcastServer, broadcastClients, coordinator, nil}, nil
+		return &Node{backend, arbInterface, nil, txStreamer, txPublisher, nil, nil, nil, nil, nil, nil, nil, broadcastServer, broadcastClients, coordinator, nil, retryableRedeemer}, nil
 	}
 
 	if deployInfo == nil {
@@ -655,7 +705,7 @@ func createNodeImpl(
 	if err != nil {
 		return nil, err
 	}
-	dataAvailabilityService, dasLifecycleManager, err := SetUpDataAvailability(ctx, &config.DataAvailability, l1client, deployInfo)
+	dataAvailabilityService, dasLifecycleManager, err := SetUpDataAvailability(ctx, &config.DataAvailability, l1client, deployInfo, daSigner)
 	if err != nil {
 		return nil, err
 	}
@@ -723,7 +773,7 @@ func createNodeImpl(
 		if txOpts == nil {
 			return nil, errors.New("batchposter, but no TxOpts")
 		}
-		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, &config.BatchPoster, deployInfo.SequencerInbox, common.Address{}, txOpts, dataAvailabilityService)
+		batchPoster, err = NewBatchPoster(l1Reader, inboxTracker, txStreamer, rawdb.NewTable(chainDb, batchPosterPrefix), &config.BatchPoster, deployInfo.SequencerInbox, common.Address{}, txOpts, dataAvailabilityService)
 		if err != nil {
 			return nil, err
 		}
@@ -737,7 +787,7 @@ func createNodeImpl(
 		return nil, errors.New("sequencer and l1 reader, without delayed sequencer")
 	}
 
-	return &Node{backend, arbInterface, l1Reader, txStreamer, txPublisher, deployInfo, inboxReader, inboxTracker, delayedSequencer, batchPoster, blockValidator, staker, broadcastServer, broadcastClients, coordinator, dasLifecycleManager}, nil
+	return &Node{backend, arbInterface, l1Reader, txStreamer, txPublisher, deployInfo, inboxReader, inboxTracker, delayedSequencer, batchPoster, blockValidator, staker, broadcastServer, broadcastClients, coordinator, dasLifecycleManager, retryableRedeemer}, nil
 }
 
 // Set up a das.DataAvailabilityService stack without relying on any
@@ -746,16 +796,18 @@ func SetUpDataAvailabilityWithoutNode(
 	ctx context.Context,
 	config *das.DataAvailabilityConfig,
 ) (das.DataAvailabilityService, *das.LifecycleManager, error) {
-	return SetUpDataAvailability(ctx, config, nil, nil)
+	return SetUpDataAvailability(ctx, config, nil, nil, nil)
 }
 
 // Set up a das.DataAvailabilityService stack allowing some dependencies
-// that were created for the Node to be injected.
+// that were created for the Node to be injected. The batch poster's daSigner,
+// if given, signs the erasure coding manifests an RPC aggregator sends.
 func SetUpDataAvailability(
 	ctx context.Context,
 	config *das.DataAvailabilityConfig,
 	l1Client arbutil.L1Interface,
 	deployInfo *RollupAddresses,
+	daSigner das.DasSigner,
 ) (das.DataAvailabilityService, *das.LifecycleManager, error) {
 	if !config.Enable {
 		return nil, nil, nil
@@ -831,7 +883,7 @@ func SetUpDataAvailability(
 
 		// Wrap the primary storage service with the fallback to the restful aggregator
 		if hasPersistentStorage {
-			syncConf := &config.RestfulClientAggregatorConfig.SyncToStorageConfig
+			syncConf := config.RestfulClientAggregatorConfig.SyncToStorageConfig
 			var retentionPeriodSeconds uint64
 			if uint64(syncConf.RetentionPeriod) == math.MaxUint64 {
 				retentionPeriodSeconds = math.MaxUint64
@@ -842,6 +894,9 @@ func SetUpDataAvailability(
 				if l1Client == nil || seqInboxAddress == nil {
 					return nil, nil, errors.New("l1-node-url and sequencer-inbox-address must be specified along with sync-to-storage.eager")
 				}
+				if syncConf.StateDir == "" && config.LocalFileStorageConfig.Enable {
+					syncConf.StateDir = config.LocalFileStorageConfig.DataDir
+				}
 				topLevelStorageService, err = das.NewSyncingFallbackStorageService(
 					ctx,
 					topLevelStorageService,
@@ -851,9 +906,8 @@ func SetUpDataAvailability(
 					true,
 					l1Client,
 					*seqInboxAddress,
-					&syncConf.EagerLowerBoundBlock,
+					&syncConf,
 					retentionPeriodSeconds,
-					syncConf.EagerStopsWhenCaughtUp,
 				)
 				if err != nil {
 					return nil, nil, err
@@ -869,16 +923,24 @@ func SetUpDataAvailability(
 	}
 
 	var topLevelDas das.DataAvailabilityService
+	var rpcAggregator *das.Aggregator
 	// Create the RPC aggregator. None of the the above storage types can be enabled in combination with it.
 	// Its use for read-only purposes will be deprecated when the REST DAS servers have been rolled out.
 	if config.AggregatorConfig.Enable {
 		if topLevelStorageService != nil {
 			return nil, nil, errors.New("If rpc-aggregator is enabled, none of rest-aggregator or any -storage mode can be specified")
 		}
-		rpcAggregator, err := dasrpc.NewRPCAggregatorWithSeqInboxCaller(config.AggregatorConfig, seqInboxCaller)
+		rpcAggregator, err = dasrpc.NewRPCAggregatorWithSeqInboxCaller(config.AggregatorConfig, l1Client, seqInboxCaller)
 		if err != nil {
 			return nil, nil, err
 		}
+		if daSigner != nil {
+			rpcAggregator.SetManifestSigner(daSigner)
+		}
+		if err := rpcAggregator.Start(ctx); err != nil {
+			return nil, nil, err
+		}
+		dasLifecycleManager.Register(rpcAggregator)
 
 		topLevelDas = rpcAggregator
 	} else if hasPersistentStorage && (config.KeyConfig.KeyDir != "" || config.KeyConfig.PrivKey != "") {
@@ -887,6 +949,7 @@ func SetUpDataAvailability(
 		topLevelDas, err = das.NewSignAfterStoreDASWithSeqInboxCaller(
 			ctx,
 			config.KeyConfig,
+			config.ErasureShare,
 			seqInboxCaller,
 			topLevelStorageService,
 		)
@@ -916,10 +979,17 @@ func SetUpDataAvailability(
 	}
 
 	if topLevelDas != nil && seqInbox != nil {
-		topLevelDas, err = das.NewChainFetchDASWithSeqInbox(topLevelDas, seqInbox)
+		chainFetchDas, err := das.NewChainFetchDASWithSeqInbox(topLevelDas, seqInbox)
 		if err != nil {
 			return nil, nil, err
 		}
+		// batches of both keysets of a rotation are read back without looking the keysets up
+		if rpcAggregator != nil {
+			for _, keyset := range rpcAggregator.Keysets() {
+				chainFetchDas.AddKeyset(keyset)
+			}
+		}
+		topLevelDas = chainFetchDas
 	}
 
 	if topLevelDas == nil {
@@ -957,25 +1027,53 @@ func CreateNode(
 	if err != nil {
 		return nil, err
 	}
+	stack.RegisterAPIs(currentNode.APIs())
+
+	stack.RegisterLifecycle(arbNodeLifecycle{currentNode})
+	return currentNode, nil
+}
+
+// APIs returns the node's own RPC APIs, which CreateNode registers on the stack
+func (n *Node) APIs() []rpc.API {
 	var apis []rpc.API
-	if currentNode.BlockValidator != nil {
+	if n.BlockValidator != nil {
 		apis = append(apis, rpc.API{
 			Namespace: "arb",
 			Version:   "1.0",
-			Service:   &BlockValidatorAPI{val: currentNode.BlockValidator, blockchain: l2BlockChain},
+			Service:   &BlockValidatorAPI{val: n.BlockValidator, blockchain: n.ArbInterface.BlockChain()},
 			Public:    false,
 		})
 	}
 	apis = append(apis, rpc.API{
 		Namespace: "arbdebug",
 		Version:   "1.0",
-		Service:   &ArbDebugAPI{blockchain: l2BlockChain},
+		Service:   &ArbDebugAPI{blockchain: n.ArbInterface.BlockChain()},
 		Public:    false,
 	})
-	stack.RegisterAPIs(apis)
-
-	stack.RegisterLifecycle(arbNodeLifecycle{currentNode})
-	return currentNode, nil
+	apis = append(apis, rpc.API{
+		Namespace: "arbretryable",
+		Version:   "1.0",
+		Service:   &RetryableAPI{blockchain: n.ArbInterface.BlockChain()},
+		Public:    false,
+	})
+	if sequencer, ok := n.TxPublisher.(*Sequencer); ok && sequencer.encryptedMempool != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "arbencrypted",
+			Version:   "1.0",
+			Service:   &EncryptedMempoolAPI{sequencer: sequencer},
+			// Commitments are free and posted to L1, so they're only public with admission control
+			Public: sequencer.admission != nil,
+		})
+	}
+	if n.BatchPoster != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "arbbatchposter",
+			Version:   "1.0",
+			Service:   &BatchPosterAPI{db: n.BatchPoster.db},
+			Public:    false,
+		})
+	}
+	return apis
 }
 
 func (n *Node) Start(ctx context.Context) error {
@@ -1046,15 +1144,21 @@ func (n *Node) Start(ctx context.Context) error {
 			return err
 		}
 	}
-	for _, client := range n.BroadcastClients {
-		client.Start(ctx)
+	if n.BroadcastClients != nil {
+		n.BroadcastClients.Start(ctx)
+	}
+	if n.RetryableRedeemer != nil {
+		n.RetryableRedeemer.Start(ctx)
 	}
 	return nil
 }
 
 func (n *Node) StopAndWait() {
-	for _, client := range n.BroadcastClients {
-		client.StopAndWait()
+	if n.RetryableRedeemer != nil {
+		n.RetryableRedeemer.StopAndWait()
+	}
+	if n.BroadcastClients != nil {
+		n.BroadcastClients.StopAndWait()
 	}
 	if n.BroadcastServer != nil {
 		n.BroadcastServer.StopAndWait()
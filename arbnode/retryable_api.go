@@ -0,0 +1,259 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/arbitrum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/offchainlabs/nitro/arbos/arbosState"
+	"github.com/offchainlabs/nitro/arbos/retryables"
+)
+
+// The most retryables a single Retryables response may contain
+const maxRetryablesListed = 1000
+
+// The most blocks a single RedeemHistory response may scan
+const maxRedeemHistoryBlocks = 10000
+
+// RetryableAPI lets support tooling inspect retryable tickets without an eth_call per field
+type RetryableAPI struct {
+	blockchain *core.BlockChain
+}
+
+type RetryableDetails struct {
+	TicketId      common.Hash     `json:"ticketId"`
+	From          common.Address  `json:"from"`
+	To            *common.Address `json:"to"` // nil for contract creations
+	Callvalue     *big.Int        `json:"callvalue"`
+	CalldataSize  uint64          `json:"calldataSize"`
+	Beneficiary   common.Address  `json:"beneficiary"`
+	Timeout       uint64          `json:"timeout"`
+	NumTries      uint64          `json:"numTries"`
+	EscrowAddress common.Address  `json:"escrowAddress"`
+	EscrowBalance *big.Int        `json:"escrowBalance"`
+}
+
+type RetryableFilter struct {
+	From        *common.Address `json:"from"`
+	Beneficiary *common.Address `json:"beneficiary"`
+	Start       uint64          `json:"start"` // the timeout queue position to continue from, as returned in next
+	Limit       uint64          `json:"limit"` // the most retryables to list, or 0 for maxRetryablesListed
+}
+
+type RetryableList struct {
+	BlockNumber uint64             `json:"blockNumber"`
+	Retryables  []RetryableDetails `json:"retryables"`
+	Next        *uint64            `json:"next,omitempty"` // the start to request next, if more retryables may match
+}
+
+func (api *RetryableAPI) openState(blockNum rpc.BlockNumber) (*state.StateDB, *arbosState.ArbosState, *types.Header, error) {
+	blockNum, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, blockNum)
+	var header *types.Header
+	if blockNum == rpc.LatestBlockNumber || blockNum == rpc.PendingBlockNumber {
+		header = api.blockchain.CurrentHeader()
+	} else {
+		header = api.blockchain.GetHeaderByNumber(uint64(blockNum))
+	}
+	if header == nil {
+		return nil, nil, nil, fmt.Errorf("block %v not found", blockNum)
+	}
+	statedb, err := api.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	arbState, err := arbosState.OpenSystemArbosState(statedb, nil, true)
+	return statedb, arbState, header, err
+}
+
+func retryableDetails(statedb *state.StateDB, ticket common.Hash, retryable *retryables.Retryable) (RetryableDetails, error) {
+	details := RetryableDetails{
+		TicketId:      ticket,
+		EscrowAddress: retryables.RetryableEscrowAddress(ticket),
+	}
+	details.EscrowBalance = statedb.GetBalance(details.EscrowAddress)
+	var err error
+	if details.From, err = retryable.From(); err != nil {
+		return details, err
+	}
+	if details.To, err = retryable.To(); err != nil {
+		return details, err
+	}
+	if details.Callvalue, err = retryable.Callvalue(); err != nil {
+		return details, err
+	}
+	if details.CalldataSize, err = retryable.CalldataSize(); err != nil {
+		return details, err
+	}
+	if details.Beneficiary, err = retryable.Beneficiary(); err != nil {
+		return details, err
+	}
+	if details.Timeout, err = retryable.CalculateTimeout(); err != nil {
+		return details, err
+	}
+	details.NumTries, err = retryable.NumTries()
+	return details, err
+}
+
+// Retryable returns the details of a retryable that hasn't expired as of the block
+func (api *RetryableAPI) Retryable(ctx context.Context, ticket common.Hash, blockNum rpc.BlockNumber) (RetryableDetails, error) {
+	statedb, arbState, header, err := api.openState(blockNum)
+	if err != nil {
+		return RetryableDetails{}, err
+	}
+	retryable, err := arbState.RetryableState().OpenRetryable(ticket, header.Time)
+	if err != nil {
+		return RetryableDetails{}, err
+	}
+	if retryable == nil {
+		return RetryableDetails{}, fmt.Errorf("no live retryable with id %v", ticket)
+	}
+	return retryableDetails(statedb, ticket, retryable)
+}
+
+// Retryables lists the retryables that haven't expired as of the block, optionally only those
+// from a sender or to a beneficiary, in timeout queue order. A response holds at most
+// maxRetryablesListed retryables, and the next page continues from where it stopped in the queue.
+// A retryable that's been kept alive is queued once per lifetime, so pages may both list it.
+func (api *RetryableAPI) Retryables(ctx context.Context, blockNum rpc.BlockNumber, filter *RetryableFilter) (RetryableList, error) {
+	if filter == nil {
+		filter = &RetryableFilter{}
+	}
+	return api.matchingRetryables(ctx, blockNum, filter.Start, filter.Limit, func(from, beneficiary common.Address) bool {
+		if filter.From != nil && from != *filter.From {
+			return false
+		}
+		return filter.Beneficiary == nil || beneficiary == *filter.Beneficiary
+	})
+}
+
+// matchingRetryables lists the live retryables whose sender and beneficiary match, from a timeout queue position
+func (api *RetryableAPI) matchingRetryables(
+	ctx context.Context,
+	blockNum rpc.BlockNumber,
+	start uint64,
+	limit uint64,
+	match func(from, beneficiary common.Address) bool,
+) (RetryableList, error) {
+	if limit == 0 || limit > maxRetryablesListed {
+		limit = maxRetryablesListed
+	}
+	statedb, arbState, header, err := api.openState(blockNum)
+	if err != nil {
+		return RetryableList{}, err
+	}
+	list := RetryableList{
+		BlockNumber: header.Number.Uint64(),
+		Retryables:  []RetryableDetails{},
+	}
+	retryableState := arbState.RetryableState()
+	seen := make(map[common.Hash]bool)
+	err = retryableState.TimeoutQueue.ForEachFrom(start, func(position uint64, ticket common.Hash) (bool, error) {
+		if uint64(len(list.Retryables)) == limit {
+			list.Next = &position
+			return true, nil
+		}
+		if seen[ticket] {
+			return false, nil
+		}
+		seen[ticket] = true
+		if err := ctx.Err(); err != nil {
+			return true, err
+		}
+		retryable, err := retryableState.OpenRetryable(ticket, header.Time)
+		if err != nil || retryable == nil {
+			return err != nil, err
+		}
+		from, err := retryable.From()
+		if err != nil {
+			return true, err
+		}
+		beneficiary, err := retryable.Beneficiary()
+		if err != nil {
+			return true, err
+		}
+		if !match(from, beneficiary) {
+			return false, nil
+		}
+		details, err := retryableDetails(statedb, ticket, retryable)
+		if err != nil {
+			return true, err
+		}
+		list.Retryables = append(list.Retryables, details)
+		return false, nil
+	})
+	return list, err
+}
+
+type RedeemAttempt struct {
+	TxHash      common.Hash    `json:"txHash"`
+	BlockNumber uint64         `json:"blockNumber"`
+	Timestamp   uint64         `json:"timestamp"`
+	Status      uint64         `json:"status"`
+	Gas         uint64         `json:"gas"`
+	GasUsed     uint64         `json:"gasUsed"`
+	RefundTo    common.Address `json:"refundTo"`
+}
+
+type RedeemHistory struct {
+	Attempts []RedeemAttempt `json:"attempts"`
+	Next     *uint64         `json:"next,omitempty"` // the block to continue scanning from, if the range was too long
+}
+
+// RedeemHistory scans the blocks in the range [start, end) for attempts to redeem the retryable,
+// whether automatic or manual. A response covers at most maxRedeemHistoryBlocks blocks.
+func (api *RetryableAPI) RedeemHistory(ctx context.Context, ticket common.Hash, start, end rpc.BlockNumber) (RedeemHistory, error) {
+	start, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, start)
+	end, _ = arbitrum.ClipToPostNitroGenesis(api.blockchain, end)
+
+	history := RedeemHistory{Attempts: []RedeemAttempt{}}
+	if end.Int64() <= start.Int64() {
+		return history, fmt.Errorf("invalid block range: %v to %v", start.Int64(), end.Int64())
+	}
+	last := uint64(end)
+	if uint64(end)-uint64(start) > maxRedeemHistoryBlocks {
+		last = uint64(start) + maxRedeemHistoryBlocks
+		history.Next = &last
+	}
+
+	for number := uint64(start); number < last; number++ {
+		if err := ctx.Err(); err != nil {
+			return history, err
+		}
+		block := api.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return history, fmt.Errorf("block %v not found", number)
+		}
+		var receipts types.Receipts
+		for i, tx := range block.Transactions() {
+			retry, ok := tx.GetInner().(*types.ArbitrumRetryTx)
+			if !ok || retry.TicketId != ticket {
+				continue
+			}
+			if receipts == nil {
+				receipts = api.blockchain.GetReceiptsByHash(block.Hash())
+				if len(receipts) != len(block.Transactions()) {
+					return history, fmt.Errorf("missing receipts for block %v", number)
+				}
+			}
+			history.Attempts = append(history.Attempts, RedeemAttempt{
+				TxHash:      tx.Hash(),
+				BlockNumber: number,
+				Timestamp:   block.Time(),
+				Status:      receipts[i].Status,
+				Gas:         retry.Gas,
+				GasUsed:     receipts[i].GasUsed,
+				RefundTo:    retry.RefundTo,
+			})
+		}
+	}
+	return history, nil
+}
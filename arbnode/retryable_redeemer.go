@@ -0,0 +1,303 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/arbitrum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rpc"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/cmd/genericconf"
+	"github.com/offchainlabs/nitro/cmd/util"
+	"github.com/offchainlabs/nitro/solgen/go/precompilesgen"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+var (
+	watchedRetryablesGauge  = metrics.NewRegisteredGauge("arb/redeemer/watched", nil)
+	redeemSuccessCounter    = metrics.NewRegisteredCounter("arb/redeemer/redeem/success", nil)
+	redeemFailureCounter    = metrics.NewRegisteredCounter("arb/redeemer/redeem/failure", nil)
+	keepaliveSuccessCounter = metrics.NewRegisteredCounter("arb/redeemer/keepalive/success", nil)
+	keepaliveFailureCounter = metrics.NewRegisteredCounter("arb/redeemer/keepalive/failure", nil)
+)
+
+type RetryableRedeemerConfig struct {
+	Enable            bool                     `koanf:"enable"`
+	Addresses         []string                 `koanf:"addresses"`
+	Wallet            genericconf.WalletConfig `koanf:"wallet"`
+	RedeemGas         uint64                   `koanf:"redeem-gas"`
+	RedeemInterval    time.Duration            `koanf:"redeem-interval"`
+	MaxRedeemAttempts uint64                   `koanf:"max-redeem-attempts"`
+	Keepalive         bool                     `koanf:"keepalive"`
+	KeepaliveWindow   time.Duration            `koanf:"keepalive-window"`
+	KeepaliveBackoff  time.Duration            `koanf:"keepalive-backoff"`
+	PollInterval      time.Duration            `koanf:"poll-interval"`
+}
+
+var DefaultRetryableRedeemerConfig = RetryableRedeemerConfig{
+	Enable:            false,
+	Addresses:         []string{},
+	Wallet:            genericconf.WalletConfigDefault,
+	RedeemGas:         1000000,
+	RedeemInterval:    time.Hour,
+	MaxRedeemAttempts: 5,
+	Keepalive:         false,
+	KeepaliveWindow:   24 * time.Hour,
+	KeepaliveBackoff:  10 * time.Minute,
+	PollInterval:      time.Minute,
+}
+
+var TestRetryableRedeemerConfig = RetryableRedeemerConfig{
+	Enable:            false,
+	Addresses:         []string{},
+	Wallet:            genericconf.WalletConfigDefault,
+	RedeemGas:         1000000,
+	RedeemInterval:    time.Second,
+	MaxRedeemAttempts: 5,
+	Keepalive:         false,
+	KeepaliveWindow:   24 * time.Hour,
+	KeepaliveBackoff:  time.Second,
+	PollInterval:      time.Second / 10,
+}
+
+func RetryableRedeemerConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultRetryableRedeemerConfig.Enable, "redeem retryables sent from or to the watched addresses whose auto-redeem failed")
+	f.StringSlice(prefix+".addresses", DefaultRetryableRedeemerConfig.Addresses, "addresses whose retryables are watched, as either the sender or the beneficiary")
+	genericconf.WalletConfigAddOptions(prefix+".wallet", f, "")
+	f.Uint64(prefix+".redeem-gas", DefaultRetryableRedeemerConfig.RedeemGas, "gas donated to each retry, on top of what the redeem transaction itself needs")
+	f.Duration(prefix+".redeem-interval", DefaultRetryableRedeemerConfig.RedeemInterval, "minimum time between redeem attempts of a retryable")
+	f.Uint64(prefix+".max-redeem-attempts", DefaultRetryableRedeemerConfig.MaxRedeemAttempts, "redeem attempts to make for a retryable before giving up on it (0 = unlimited)")
+	f.Bool(prefix+".keepalive", DefaultRetryableRedeemerConfig.Keepalive, "extend the lifetime of watched retryables that are about to expire")
+	f.Duration(prefix+".keepalive-window", DefaultRetryableRedeemerConfig.KeepaliveWindow, "how long before its timeout a retryable's lifetime is extended")
+	f.Duration(prefix+".keepalive-backoff", DefaultRetryableRedeemerConfig.KeepaliveBackoff, "how long to wait before trying again to keep a retryable alive after failing to")
+	f.Duration(prefix+".poll-interval", DefaultRetryableRedeemerConfig.PollInterval, "how often to check the watched retryables")
+}
+
+type redeemerTicket struct {
+	attempts         uint64
+	lastAttempt      time.Time
+	keepaliveFailure time.Time
+}
+
+// RetryableRedeemer retries the redemption of watched retryables, and keeps them alive if configured
+type RetryableRedeemer struct {
+	stopwaiter.StopWaiter
+	config      *RetryableRedeemerConfig
+	explorer    *RetryableAPI
+	client      *ethclient.Client
+	retryableTx *precompilesgen.ArbRetryableTx
+	auth        *bind.TransactOpts
+	watched     map[common.Address]bool
+	tickets     map[common.Hash]*redeemerTicket
+}
+
+func NewRetryableRedeemer(backend *arbitrum.Backend, blockchain *core.BlockChain, config *RetryableRedeemerConfig) (*RetryableRedeemer, error) {
+	watched := make(map[common.Address]bool)
+	for _, address := range config.Addresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("invalid retryable redeemer address %v", address)
+		}
+		watched[common.HexToAddress(address)] = true
+	}
+	if len(watched) == 0 {
+		return nil, errors.New("retryable redeemer enabled, but no addresses to watch")
+	}
+	auth, err := util.GetTransactOptsFromWallet(&config.Wallet, blockchain.Config().ChainID)
+	if err != nil {
+		return nil, err
+	}
+
+	// talk to our own node in-process
+	inproc := rpc.NewServer()
+	for _, api := range backend.APIBackend().GetAPIs() {
+		if err := inproc.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, err
+		}
+	}
+	client := ethclient.NewClient(rpc.DialInProc(inproc))
+	retryableTx, err := precompilesgen.NewArbRetryableTx(types.ArbRetryableTxAddress, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetryableRedeemer{
+		config:      config,
+		explorer:    &RetryableAPI{blockchain: blockchain},
+		client:      client,
+		retryableTx: retryableTx,
+		auth:        auth,
+		watched:     watched,
+		tickets:     make(map[common.Hash]*redeemerTicket),
+	}, nil
+}
+
+// watchedRetryables lists the live retryables sent from or to a watched address
+func (r *RetryableRedeemer) watchedRetryables(ctx context.Context) ([]RetryableDetails, error) {
+	var watched []RetryableDetails
+	blockNum := rpc.LatestBlockNumber
+	start := uint64(0)
+	isWatched := func(from, beneficiary common.Address) bool {
+		return r.watched[from] || r.watched[beneficiary]
+	}
+	for {
+		list, err := r.explorer.matchingRetryables(ctx, blockNum, start, 0, isWatched)
+		if err != nil {
+			return nil, err
+		}
+		for _, details := range list.Retryables {
+			watched = append(watched, details)
+		}
+		if list.Next == nil {
+			return watched, nil
+		}
+		// read every page from the same block
+		blockNum = rpc.BlockNumber(list.BlockNumber)
+		start = *list.Next
+	}
+}
+
+func (r *RetryableRedeemer) transactOpts(ctx context.Context) *bind.TransactOpts {
+	auth := *r.auth
+	auth.Context = ctx
+	return &auth
+}
+
+// redeem schedules a retry of the retryable, and returns whether the retry succeeded
+func (r *RetryableRedeemer) redeem(ctx context.Context, ticket common.Hash) (bool, error) {
+	// the estimate only covers scheduling the retry, so the budget is donated on top of it
+	auth := r.transactOpts(ctx)
+	auth.NoSend = true
+	estimate, err := r.retryableTx.Redeem(auth, ticket)
+	if err != nil {
+		return false, err
+	}
+	auth = r.transactOpts(ctx)
+	auth.GasLimit = estimate.Gas() + r.config.RedeemGas
+	tx, err := r.retryableTx.Redeem(auth, ticket)
+	if err != nil {
+		return false, err
+	}
+	receipt, err := bind.WaitMined(ctx, r.client, tx)
+	if err != nil {
+		return false, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return false, fmt.Errorf("redeem transaction %v failed", tx.Hash())
+	}
+	for _, txLog := range receipt.Logs {
+		if txLog.Address != types.ArbRetryableTxAddress || len(txLog.Topics) == 0 || txLog.Topics[0] != arbos.RedeemScheduledEventID {
+			continue
+		}
+		event, err := r.retryableTx.ParseRedeemScheduled(*txLog)
+		if err != nil {
+			return false, err
+		}
+		retryReceipt, err := r.client.TransactionReceipt(ctx, event.RetryTxHash)
+		if err != nil {
+			return false, err
+		}
+		return retryReceipt.Status == types.ReceiptStatusSuccessful, nil
+	}
+	return false, fmt.Errorf("redeem transaction %v scheduled no retry", tx.Hash())
+}
+
+func (r *RetryableRedeemer) keepalive(ctx context.Context, ticket common.Hash) error {
+	tx, err := r.retryableTx.Keepalive(r.transactOpts(ctx), ticket)
+	if err != nil {
+		return err
+	}
+	receipt, err := bind.WaitMined(ctx, r.client, tx)
+	if err != nil {
+		return err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return fmt.Errorf("keepalive transaction %v failed", tx.Hash())
+	}
+	return nil
+}
+
+func (r *RetryableRedeemer) update(ctx context.Context) error {
+	retryables, err := r.watchedRetryables(ctx)
+	if err != nil {
+		return err
+	}
+	watchedRetryablesGauge.Update(int64(len(retryables)))
+
+	live := make(map[common.Hash]bool)
+	for _, details := range retryables {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		id := details.TicketId
+		if live[id] {
+			continue
+		}
+		live[id] = true
+		ticket := r.tickets[id]
+		if ticket == nil {
+			ticket = &redeemerTicket{}
+			r.tickets[id] = ticket
+		}
+
+		keepaliveDue := time.Until(time.Unix(int64(details.Timeout), 0)) < r.config.KeepaliveWindow
+		if r.config.Keepalive && keepaliveDue && time.Since(ticket.keepaliveFailure) >= r.config.KeepaliveBackoff {
+			if err := r.keepalive(ctx, id); err != nil {
+				ticket.keepaliveFailure = time.Now()
+				keepaliveFailureCounter.Inc(1)
+				log.Warn("RetryableRedeemer: failed to keep retryable alive", "ticket", id, "err", err)
+			} else {
+				keepaliveSuccessCounter.Inc(1)
+				log.Info("RetryableRedeemer: kept retryable alive", "ticket", id)
+			}
+		}
+
+		if r.config.MaxRedeemAttempts != 0 && ticket.attempts >= r.config.MaxRedeemAttempts {
+			continue
+		}
+		if time.Since(ticket.lastAttempt) < r.config.RedeemInterval {
+			continue
+		}
+		ticket.attempts++
+		ticket.lastAttempt = time.Now()
+		succeeded, err := r.redeem(ctx, id)
+		if succeeded {
+			redeemSuccessCounter.Inc(1)
+			log.Info("RetryableRedeemer: redeemed retryable", "ticket", id, "attempt", ticket.attempts)
+		} else {
+			redeemFailureCounter.Inc(1)
+			log.Warn("RetryableRedeemer: failed to redeem retryable", "ticket", id, "attempt", ticket.attempts, "err", err)
+		}
+	}
+
+	// forget retryables that were redeemed, canceled, or expired
+	for id := range r.tickets {
+		if !live[id] {
+			delete(r.tickets, id)
+		}
+	}
+	return nil
+}
+
+func (r *RetryableRedeemer) Start(ctxIn context.Context) {
+	r.StopWaiter.Start(ctxIn)
+	r.CallIteratively(func(ctx context.Context) time.Duration {
+		if err := r.update(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("RetryableRedeemer: error checking retryables", "err", err)
+		}
+		return r.config.PollInterval
+	})
+}
@@ -6,10 +6,15 @@ package arbnode
 var (
 	arbitrumPrefix           string = "\t"                 // the prefix for all Arbitrum specific keys
 	blockValidatorPrefix     string = arbitrumPrefix + "v" // the prefix for all block validator keys
+	feedCatchupPrefix        string = arbitrumPrefix + "f" // the prefix for the persistent feed catchup buffer
+	batchPosterPrefix        string = arbitrumPrefix + "b" // the prefix for all batch poster keys
 	messagePrefix            []byte = []byte("m")          // maps a message sequence number to a message
 	delayedMessagePrefix     []byte = []byte("d")          // maps a delayed sequence number to an accumulator and a message
 	sequencerBatchMetaPrefix []byte = []byte("s")          // maps a batch sequence number to BatchMetadata
 	delayedSequencedPrefix   []byte = []byte("a")          // maps a delayed message count to the first sequencer batch sequence number with this delayed count
+	pendingBatchPrefix       []byte = []byte("p")          // maps a batch sequence number to a batch poster transaction not yet read by the inbox tracker
+	batchStatsPrefix         []byte = []byte("t")          // maps a batch sequence number to the BatchStats of a posted batch
+	encryptedTxPrefix        []byte = []byte("e")          // maps an epoch and index to an encrypted transaction awaiting its epoch's key
 
 	messageCountKey        []byte = []byte("_messageCount")        // contains the current message count
 	delayedMessageCountKey []byte = []byte("_delayedMessageCount") // contains the current delayed message count
@@ -31,9 +31,19 @@ type txQueueItem struct {
 	tx         *types.Transaction
 	resultChan chan<- error
 	ctx        context.Context
+	// committed is set for decrypted transactions of the encrypted mempool, whose
+	// ordering was committed to and so bypasses the ordering policy
+	committed bool
 }
 
 func (i *txQueueItem) returnResult(err error) {
+	if i.resultChan == nil {
+		// Decrypted transactions have no publisher waiting for the result
+		if err != nil {
+			log.Info("decrypted transaction not sequenced", "hash", i.tx.Hash(), "err", err)
+		}
+		return
+	}
 	i.resultChan <- err
 	close(i.resultChan)
 }
@@ -43,9 +53,16 @@ type Sequencer struct {
 
 	txStreamer *TransactionStreamer
 	txQueue    chan txQueueItem
+	ordering   TxOrderingPolicy
+	admission  *txAdmission
 	l1Reader   *headerreader.HeaderReader
 	config     SequencerConfig
 
+	encryptedMempool *encryptedMempool
+	encryptedQueue   chan encryptedQueueItem
+	encryptedPending []encryptedQueueItem // waiting for their commitments to be sequenced
+	decrypted        []txQueueItem        // sequenced before anything in ordering
+
 	L1BlockAndTimeMutex sync.Mutex
 	l1BlockNumber       uint64
 	l1Timestamp         uint64
@@ -55,22 +72,50 @@ type Sequencer struct {
 }
 
 func NewSequencer(txStreamer *TransactionStreamer, l1Reader *headerreader.HeaderReader, config SequencerConfig) (*Sequencer, error) {
-	return &Sequencer{
+	signer := types.LatestSigner(txStreamer.bc.Config())
+	ordering, err := NewTxOrderingPolicy(config.TxOrderingPolicy, signer)
+	if err != nil {
+		return nil, err
+	}
+	var admission *txAdmission
+	if config.Admission.Enable {
+		admission = newTxAdmission(config.Admission, signer, func(sender common.Address) (uint64, error) {
+			statedb, err := txStreamer.bc.State()
+			if err != nil {
+				return 0, err
+			}
+			return statedb.GetNonce(sender), nil
+		})
+	}
+	sequencer := &Sequencer{
 		txStreamer:    txStreamer,
 		txQueue:       make(chan txQueueItem, 128),
+		ordering:      ordering,
+		admission:     admission,
 		l1Reader:      l1Reader,
 		config:        config,
 		l1BlockNumber: 0,
 		l1Timestamp:   0,
-	}, nil
+	}
+	if config.EncryptedMempool.Enable {
+		if err := sequencer.EnableEncryptedMempool(NewLocalKeyper()); err != nil {
+			return nil, err
+		}
+	}
+	return sequencer, nil
 }
 
 func (s *Sequencer) PublishTransaction(ctx context.Context, tx *types.Transaction) error {
+	release, err := s.admission.admit(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer release()
 	resultChan := make(chan error, 1)
 	queueItem := txQueueItem{
-		tx,
-		resultChan,
-		ctx,
+		tx:         tx,
+		resultChan: resultChan,
+		ctx:        ctx,
 	}
 	select {
 	case s.txQueue <- queueItem:
@@ -138,33 +183,102 @@ func (s *Sequencer) forwardIfSet(queueItems []txQueueItem) bool {
 		return false
 	}
 	for _, item := range queueItems {
-		item.resultChan <- s.forwarder.PublishTransaction(item.ctx, item.tx)
+		item.returnResult(s.forwarder.PublishTransaction(item.ctx, item.tx))
 	}
 	return true
 }
 
+// fillOrderingQueue moves newly published transactions into the ordering policy,
+// newly decrypted transactions into the decrypted queue, and newly published encrypted
+// transactions into encryptedPending, blocking for one if there are none queued.
+// It returns false if ctx is done.
+func (s *Sequencer) fillOrderingQueue(ctx context.Context) bool {
+	decryptionKeys := s.encryptedMempool.decryptionKeys()
+	if s.ordering.Len() == 0 && len(s.decrypted) == 0 && len(s.encryptedPending) == 0 {
+		select {
+		case queueItem := <-s.txQueue:
+			s.ordering.Add(queueItem)
+		case key := <-decryptionKeys:
+			s.decrypted = append(s.decrypted, s.encryptedMempool.release(key)...)
+		case queueItem := <-s.encryptedQueue:
+			s.encryptedPending = append(s.encryptedPending, queueItem)
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for {
+		select {
+		case key := <-decryptionKeys:
+			s.decrypted = append(s.decrypted, s.encryptedMempool.release(key)...)
+			continue
+		case queueItem := <-s.encryptedQueue:
+			s.encryptedPending = append(s.encryptedPending, queueItem)
+			continue
+		default:
+		}
+		if s.ordering.Len() >= cap(s.txQueue) {
+			return true
+		}
+		select {
+		case queueItem := <-s.txQueue:
+			s.ordering.Add(queueItem)
+		default:
+			return true
+		}
+	}
+}
+
+func (s *Sequencer) nextQueueItem() (txQueueItem, bool) {
+	if len(s.decrypted) > 0 {
+		queueItem := s.decrypted[0]
+		s.decrypted = s.decrypted[1:]
+		return queueItem, true
+	}
+	return s.ordering.Next()
+}
+
+// requeue puts items back into the ordering policy, or the decrypted queue for committed items,
+// preserving their relative order. Items that don't fit are returned the result of queueFullErr.
+func (s *Sequencer) requeue(queueItems []txQueueItem, queueFullErr func() error) {
+	var committed, uncommitted []txQueueItem
+	for _, item := range queueItems {
+		if item.committed {
+			committed = append(committed, item)
+		} else {
+			uncommitted = append(uncommitted, item)
+		}
+	}
+	s.decrypted = append(committed, s.decrypted...)
+
+	fit := cap(s.txQueue) - s.ordering.Len()
+	if fit < 0 {
+		fit = 0
+	}
+	if fit < len(uncommitted) {
+		for _, item := range uncommitted[fit:] {
+			item.returnResult(queueFullErr())
+		}
+		uncommitted = uncommitted[:fit]
+	}
+	// Requeue puts an item in front of the others, so go in reverse
+	for i := len(uncommitted) - 1; i >= 0; i-- {
+		s.ordering.Requeue(uncommitted[i])
+	}
+}
+
 func (s *Sequencer) sequenceTransactions(ctx context.Context) {
+	if !s.fillOrderingQueue(ctx) {
+		return
+	}
+	s.sequenceEncryptedCommitments()
+
 	var txes types.Transactions
 	var queueItems []txQueueItem
 	var totalBatchSize int
 	for {
-		var queueItem txQueueItem
-		if len(txes) == 0 {
-			select {
-			case queueItem = <-s.txQueue:
-			case <-ctx.Done():
-				return
-			}
-		} else {
-			done := false
-			select {
-			case queueItem = <-s.txQueue:
-			default:
-				done = true
-			}
-			if done {
-				break
-			}
+		queueItem, ok := s.nextQueueItem()
+		if !ok {
+			break
 		}
 		err := queueItem.ctx.Err()
 		if err != nil {
@@ -183,47 +297,27 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		}
 		if totalBatchSize+len(txBytes) > int(maxTxDataSize) {
 			// This tx would be too large to add to this batch.
-			// Attempt to put it back in the queue, but error if the queue is full.
+			// Put it back in the queue, where there's room as it was just taken out.
 			// Then, end the batch here.
-			select {
-			case s.txQueue <- queueItem:
-			default:
-				queueItem.returnResult(core.ErrOversizedData)
-			}
+			s.requeue([]txQueueItem{queueItem}, func() error { return errors.New("queue full") })
 			break
 		}
 		totalBatchSize += len(txBytes)
 		txes = append(txes, queueItem.tx)
 		queueItems = append(queueItems, queueItem)
 	}
-
-	if s.forwardIfSet(queueItems) {
+	if len(queueItems) == 0 {
 		return
 	}
 
-	timestamp := time.Now().Unix()
-	s.L1BlockAndTimeMutex.Lock()
-	l1Block := s.l1BlockNumber
-	l1Timestamp := s.l1Timestamp
-	s.L1BlockAndTimeMutex.Unlock()
-
-	if s.l1Reader != nil && (l1Block == 0 || math.Abs(float64(l1Timestamp)-float64(timestamp)) > s.config.MaxAcceptableTimestampDelta.Seconds()) {
-		log.Error(
-			"cannot sequence: unknown L1 block or L1 timestamp too far from local clock time",
-			"l1Block", l1Block,
-			"l1Timestamp", l1Timestamp,
-			"localTimestamp", timestamp,
-		)
+	if s.forwardIfSet(queueItems) {
 		return
 	}
 
-	header := &arbos.L1IncomingMessageHeader{
-		Kind:        arbos.L1MessageType_L2Message,
-		Poster:      l1pricing.SequencerAddress,
-		BlockNumber: l1Block,
-		Timestamp:   uint64(timestamp),
-		RequestId:   nil,
-		L1BaseFee:   nil,
+	header, err := s.sequencingHeader()
+	if err != nil {
+		log.Error("cannot sequence", "err", err)
+		return
 	}
 
 	hooks := &arbos.SequencingHooks{
@@ -232,7 +326,7 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		RequireDataGas: true,
 		TxErrors:       []error{},
 	}
-	err := s.txStreamer.SequenceTransactions(header, txes, hooks)
+	err = s.txStreamer.SequenceTransactions(header, txes, hooks)
 	if err == nil && len(hooks.TxErrors) != len(txes) {
 		err = fmt.Errorf("unexpected number of error results: %v vs number of txes %v", len(hooks.TxErrors), len(txes))
 	}
@@ -243,13 +337,7 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 			return
 		}
 		// try to add back to queue otherwise
-		for _, item := range queueItems {
-			select {
-			case s.txQueue <- item:
-			default:
-				item.resultChan <- errors.New("queue full")
-			}
-		}
+		s.requeue(queueItems, func() error { return errors.New("queue full") })
 		return
 	}
 	if err != nil {
@@ -260,20 +348,41 @@ func (s *Sequencer) sequenceTransactions(ctx context.Context) {
 		return
 	}
 
+	var gasLimitItems []txQueueItem
 	for i, err := range hooks.TxErrors {
 		queueItem := queueItems[i]
 		if errors.Is(err, core.ErrGasLimit) {
 			// There's not enough gas left in the block for this tx.
-			// Attempt to re-queue the transaction.
-			// If the queue is full, fall through to returning an error.
-			select {
-			case s.txQueue <- queueItem:
-				continue
-			default:
-			}
+			// Attempt to re-queue the transaction below.
+			gasLimitItems = append(gasLimitItems, queueItem)
+			continue
 		}
 		queueItem.returnResult(err)
 	}
+	// If the queue is full, return the gas limit error
+	s.requeue(gasLimitItems, func() error { return core.ErrGasLimit })
+}
+
+// sequencingHeader returns the header for a message sequenced now
+func (s *Sequencer) sequencingHeader() (*arbos.L1IncomingMessageHeader, error) {
+	timestamp := time.Now().Unix()
+	s.L1BlockAndTimeMutex.Lock()
+	l1Block := s.l1BlockNumber
+	l1Timestamp := s.l1Timestamp
+	s.L1BlockAndTimeMutex.Unlock()
+
+	if s.l1Reader != nil && (l1Block == 0 || math.Abs(float64(l1Timestamp)-float64(timestamp)) > s.config.MaxAcceptableTimestampDelta.Seconds()) {
+		return nil, fmt.Errorf("unknown L1 block or L1 timestamp too far from local clock time: l1Block %v l1Timestamp %v localTimestamp %v", l1Block, l1Timestamp, timestamp)
+	}
+
+	return &arbos.L1IncomingMessageHeader{
+		Kind:        arbos.L1MessageType_L2Message,
+		Poster:      l1pricing.SequencerAddress,
+		BlockNumber: l1Block,
+		Timestamp:   uint64(timestamp),
+		RequestId:   nil,
+		L1BaseFee:   nil,
+	}, nil
 }
 
 func (s *Sequencer) updateLatestL1Block(header *types.Header) {
@@ -325,6 +434,10 @@ func (s *Sequencer) Start(ctxIn context.Context) error {
 
 	}
 
+	if s.encryptedMempool != nil && s.config.EncryptedMempool.Enable && s.config.EncryptedMempool.EpochDuration > 0 {
+		s.CallIteratively(s.releaseLocalKeys)
+	}
+
 	s.CallIteratively(func(ctx context.Context) time.Duration {
 		nextBlock := time.Now().Add(s.config.MaxBlockSpeed)
 		s.sequenceTransactions(ctx)
@@ -96,6 +96,7 @@ func (i *SequencerInbox) GetAccumulator(ctx context.Context, sequenceNumber uint
 type SequencerInboxBatch struct {
 	BlockHash         common.Hash
 	BlockNumber       uint64
+	TxHash            common.Hash
 	SequenceNumber    uint64
 	BeforeInboxAcc    common.Hash
 	AfterInboxAcc     common.Hash
@@ -215,6 +216,7 @@ func (i *SequencerInbox) LookupBatchesInRange(ctx context.Context, from, to *big
 		batch := &SequencerInboxBatch{
 			BlockHash:         log.BlockHash,
 			BlockNumber:       log.BlockNumber,
+			TxHash:            log.TxHash,
 			SequenceNumber:    parsedLog.BatchSequenceNumber.Uint64(),
 			BeforeInboxAcc:    parsedLog.BeforeAcc,
 			AfterInboxAcc:     parsedLog.AfterAcc,
@@ -235,7 +235,19 @@ func (s *TransactionStreamer) AddMessages(pos arbutil.MessageIndex, force bool,
 	return s.AddMessagesAndEndBatch(pos, force, messages, nil)
 }
 
-func (s *TransactionStreamer) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
+func (s *TransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	if len(feedMessages) == 0 {
+		return nil
+	}
+	pos := feedMessages[0].SequenceNumber
+	messages := make([]arbstate.MessageWithMetadata, 0, len(feedMessages))
+	for i, feedMessage := range feedMessages {
+		if feedMessage.SequenceNumber != pos+arbutil.MessageIndex(i) {
+			return fmt.Errorf("non-sequential broadcast messages: expected %v got %v", pos+arbutil.MessageIndex(i), feedMessage.SequenceNumber)
+		}
+		messages = append(messages, feedMessage.Message)
+	}
+
 	s.insertionMutex.Lock()
 	defer s.insertionMutex.Unlock()
 
@@ -495,6 +507,69 @@ func (s *TransactionStreamer) SequenceTransactions(header *arbos.L1IncomingMessa
 		return err
 	}
 
+	return s.writeSequencedMessage(pos, msg, delayedMessagesRead, lastBlockHeader, block, receipts, statedb)
+}
+
+// SequenceL2Message sequences an L2 message that isn't made of transactions the sequencer
+// has to filter, such as a record of encrypted transaction commitments.
+func (s *TransactionStreamer) SequenceL2Message(header *arbos.L1IncomingMessageHeader, l2Message []byte) error {
+	s.insertionMutex.Lock()
+	defer s.insertionMutex.Unlock()
+	s.createBlocksMutex.Lock()
+	defer s.createBlocksMutex.Unlock()
+	s.reorgMutex.RLock()
+	defer s.reorgMutex.RUnlock()
+
+	pos, err := s.GetMessageCount()
+	if err != nil {
+		return err
+	}
+
+	lastBlockHeader := s.bc.CurrentBlock().Header()
+	if lastBlockHeader == nil {
+		return errors.New("current block header not found")
+	}
+	expectedBlockNum, err := s.MessageCountToBlockNumber(pos)
+	if err != nil {
+		return err
+	}
+	if lastBlockHeader.Number.Int64() != expectedBlockNum {
+		return fmt.Errorf("block production not caught up: last block number %v but expected %v", lastBlockHeader.Number, expectedBlockNum)
+	}
+	statedb, err := s.bc.StateAt(lastBlockHeader.Root)
+	if err != nil {
+		return err
+	}
+
+	var delayedMessagesRead uint64
+	if pos > 0 {
+		lastMsg, err := s.GetMessage(pos - 1)
+		if err != nil {
+			return err
+		}
+		delayedMessagesRead = lastMsg.DelayedMessagesRead
+	}
+
+	msg := &arbos.L1IncomingMessage{
+		Header: header,
+		L2msg:  l2Message,
+	}
+	block, receipts := arbos.ProduceBlock(msg, delayedMessagesRead, lastBlockHeader, statedb, s.bc, s.bc.Config())
+
+	return s.writeSequencedMessage(pos, msg, delayedMessagesRead, lastBlockHeader, block, receipts, statedb)
+}
+
+// writeSequencedMessage writes and broadcasts a sequenced message along with the block produced for it.
+// The caller must hold the insertion, createBlocks, and reorg mutexes.
+func (s *TransactionStreamer) writeSequencedMessage(
+	pos arbutil.MessageIndex,
+	msg *arbos.L1IncomingMessage,
+	delayedMessagesRead uint64,
+	lastBlockHeader *types.Header,
+	block *types.Block,
+	receipts types.Receipts,
+	statedb *state.StateDB,
+) error {
 	msgWithMeta := arbstate.MessageWithMetadata{
 		Message:             msg,
 		DelayedMessagesRead: delayedMessagesRead,
@@ -511,7 +586,9 @@ func (s *TransactionStreamer) SequenceTransactions(header *arbos.L1IncomingMessa
 	}
 
 	if s.broadcastServer != nil {
-		s.broadcastServer.BroadcastSingle(msgWithMeta, pos)
+		if err := s.broadcastServer.BroadcastSingle(msgWithMeta, pos); err != nil {
+			log.Error("failed broadcasting message", "pos", pos, "err", err)
+		}
 	}
 
 	// Only write the block after we've written the messages, so if the node dies in the middle of this,
@@ -579,7 +656,9 @@ func (s *TransactionStreamer) SequenceDelayedMessages(ctx context.Context, messa
 
 	for i, msg := range messagesWithMeta {
 		if s.broadcastServer != nil {
-			s.broadcastServer.BroadcastSingle(msg, pos+arbutil.MessageIndex(i))
+			if err := s.broadcastServer.BroadcastSingle(msg, pos+arbutil.MessageIndex(i)); err != nil {
+				log.Error("failed broadcasting message", "pos", pos+arbutil.MessageIndex(i), "err", err)
+			}
 		}
 	}
 
@@ -0,0 +1,257 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+)
+
+type TxAdmissionConfig struct {
+	Enable              bool    `koanf:"enable"`
+	SenderRate          float64 `koanf:"sender-rate"`
+	SenderBurst         int     `koanf:"sender-burst"`
+	IPRate              float64 `koanf:"ip-rate"`
+	IPBurst             int     `koanf:"ip-burst"`
+	MaxPendingPerSender int     `koanf:"max-pending-per-sender"`
+	RejectNonceGaps     bool    `koanf:"reject-nonce-gaps"`
+}
+
+var DefaultTxAdmissionConfig = TxAdmissionConfig{
+	Enable:              false,
+	SenderRate:          10,
+	SenderBurst:         50,
+	IPRate:              50,
+	IPBurst:             250,
+	MaxPendingPerSender: 64,
+	RejectNonceGaps:     true,
+}
+
+func TxAdmissionConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultTxAdmissionConfig.Enable, "enable admission control of transactions into the sequencer queue")
+	f.Float64(prefix+".sender-rate", DefaultTxAdmissionConfig.SenderRate, "transactions per second accepted from a single sender (0 for no limit)")
+	f.Int(prefix+".sender-burst", DefaultTxAdmissionConfig.SenderBurst, "transactions a single sender may submit at once before being rate limited")
+	f.Float64(prefix+".ip-rate", DefaultTxAdmissionConfig.IPRate, "transactions per second accepted from a single IP address over HTTP RPC, which is the proxy's address for requests through one (0 for no limit)")
+	f.Int(prefix+".ip-burst", DefaultTxAdmissionConfig.IPBurst, "transactions a single IP address may submit at once before being rate limited")
+	f.Int(prefix+".max-pending-per-sender", DefaultTxAdmissionConfig.MaxPendingPerSender, "maximum transactions from a single sender waiting to be sequenced (0 for no limit)")
+	f.Bool(prefix+".reject-nonce-gaps", DefaultTxAdmissionConfig.RejectNonceGaps, "reject transactions whose nonce is ahead of the sender's nonce plus its pending transactions")
+}
+
+// TxAdmissionError is returned to RPC clients with a distinct error code for each reason
+type TxAdmissionError struct {
+	code    int
+	message string
+}
+
+func (e *TxAdmissionError) Error() string {
+	return e.message
+}
+
+func (e *TxAdmissionError) ErrorCode() int {
+	return e.code
+}
+
+var (
+	ErrIPRateLimited            = &TxAdmissionError{-32010, "too many transactions from this IP address"}
+	ErrSenderRateLimited        = &TxAdmissionError{-32011, "too many transactions from this sender"}
+	ErrTooManyPendingFromSender = &TxAdmissionError{-32012, "too many pending transactions from this sender"}
+	ErrNonceGap                 = &TxAdmissionError{-32013, "transaction nonce leaves a gap"}
+)
+
+var (
+	ipRateLimitedCounter     = metrics.NewRegisteredCounter("arb/sequencer/admission/rejected/iprate", nil)
+	senderRateLimitedCounter = metrics.NewRegisteredCounter("arb/sequencer/admission/rejected/senderrate", nil)
+	tooManyPendingCounter    = metrics.NewRegisteredCounter("arb/sequencer/admission/rejected/pending", nil)
+	nonceGapCounter          = metrics.NewRegisteredCounter("arb/sequencer/admission/rejected/noncegap", nil)
+)
+
+// Buckets that have refilled completely are forgotten at most this often
+const tokenBucketPruneInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// tokenBuckets rate limits each key to rate per second, allowing bursts of up to burst.
+// It isn't thread safe.
+type tokenBuckets struct {
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+func newTokenBuckets(rate float64, burst int) *tokenBuckets {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBuckets{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (b *tokenBuckets) refill(bucket *tokenBucket, now time.Time) {
+	if now.After(bucket.last) {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * b.rate
+		if bucket.tokens > b.burst {
+			bucket.tokens = b.burst
+		}
+		bucket.last = now
+	}
+}
+
+func (b *tokenBuckets) allow(key string, now time.Time) bool {
+	if !b.hasToken(key, now) {
+		return false
+	}
+	b.spend(key)
+	return true
+}
+
+// hasToken returns whether key may be allowed now, without spending its token
+func (b *tokenBuckets) hasToken(key string, now time.Time) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	if now.Sub(b.lastPrune) >= tokenBucketPruneInterval {
+		for k, bucket := range b.buckets {
+			b.refill(bucket, now)
+			if bucket.tokens >= b.burst {
+				delete(b.buckets, k)
+			}
+		}
+		b.lastPrune = now
+	}
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: b.burst, last: now}
+		b.buckets[key] = bucket
+	}
+	b.refill(bucket, now)
+	return bucket.tokens >= 1
+}
+
+// spend takes a token from key, which hasToken must have just allowed
+func (b *tokenBuckets) spend(key string) {
+	if bucket, ok := b.buckets[key]; ok {
+		bucket.tokens--
+	}
+}
+
+// txAdmission decides whether a transaction may join the sequencer queue
+type txAdmission struct {
+	config  TxAdmissionConfig
+	signer  types.Signer
+	nonceAt func(common.Address) (uint64, error)
+
+	mutex         sync.Mutex
+	ipBuckets     *tokenBuckets
+	senderBuckets *tokenBuckets
+	pending       map[common.Address]int
+}
+
+func newTxAdmission(config TxAdmissionConfig, signer types.Signer, nonceAt func(common.Address) (uint64, error)) *txAdmission {
+	return &txAdmission{
+		config:        config,
+		signer:        signer,
+		nonceAt:       nonceAt,
+		ipBuckets:     newTokenBuckets(config.IPRate, config.IPBurst),
+		senderBuckets: newTokenBuckets(config.SenderRate, config.SenderBurst),
+		pending:       make(map[common.Address]int),
+	}
+}
+
+// remoteIP returns the IP address of the HTTP RPC client that sent the request, if any
+func remoteIP(ctx context.Context) string {
+	remote, ok := ctx.Value("remote").(string)
+	if !ok || remote == "" {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return remote
+	}
+	return host
+}
+
+// admit checks whether tx may be queued. If so, the returned function must be called
+// once the transaction is no longer pending.
+func (a *txAdmission) admit(ctx context.Context, tx *types.Transaction) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+	sender, err := types.Sender(a.signer, tx)
+	if err != nil {
+		return nil, err
+	}
+	var stateNonce uint64
+	if a.config.RejectNonceGaps {
+		stateNonce, err = a.nonceAt(sender)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	pending := a.pending[sender]
+	if a.config.MaxPendingPerSender > 0 && pending >= a.config.MaxPendingPerSender {
+		tooManyPendingCounter.Inc(1)
+		return nil, ErrTooManyPendingFromSender
+	}
+	if a.config.RejectNonceGaps && tx.Nonce() > stateNonce+uint64(pending) {
+		nonceGapCounter.Inc(1)
+		return nil, ErrNonceGap
+	}
+	// Tokens are only spent on transactions that are admitted
+	now := time.Now()
+	ip := remoteIP(ctx)
+	if ip != "" && !a.ipBuckets.hasToken(ip, now) {
+		ipRateLimitedCounter.Inc(1)
+		return nil, ErrIPRateLimited
+	}
+	if !a.senderBuckets.hasToken(sender.String(), now) {
+		senderRateLimitedCounter.Inc(1)
+		return nil, ErrSenderRateLimited
+	}
+	if ip != "" {
+		a.ipBuckets.spend(ip)
+	}
+	a.senderBuckets.spend(sender.String())
+	a.pending[sender]++
+	return func() {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.pending[sender]--
+		if a.pending[sender] <= 0 {
+			delete(a.pending, sender)
+		}
+	}, nil
+}
+
+// admitEncrypted checks whether an encrypted transaction may be committed to. Its sender
+// isn't known until it's decrypted, so it's only limited by the client's IP address.
+func (a *txAdmission) admitEncrypted(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	ip := remoteIP(ctx)
+	if ip != "" && !a.ipBuckets.allow(ip, time.Now()) {
+		ipRateLimitedCounter.Inc(1)
+		return ErrIPRateLimited
+	}
+	return nil
+}
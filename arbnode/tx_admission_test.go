@@ -0,0 +1,113 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestTokenBuckets(t *testing.T) {
+	buckets := newTokenBuckets(2, 3)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !buckets.allow("a", now) {
+			Fail(t, "burst rejected at", i)
+		}
+	}
+	if buckets.allow("a", now) {
+		Fail(t, "allowed more than burst")
+	}
+	if !buckets.allow("b", now) {
+		Fail(t, "keys share a bucket")
+	}
+	if !buckets.allow("a", now.Add(time.Second/2)) || buckets.allow("a", now.Add(time.Second/2)) {
+		Fail(t, "bucket didn't refill at its rate")
+	}
+}
+
+func TestTxAdmission(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(412346))
+	senders := newOrderingTestSenders(t, 3)
+	config := TxAdmissionConfig{
+		Enable:              true,
+		SenderRate:          1,
+		SenderBurst:         3,
+		IPRate:              1,
+		IPBurst:             5,
+		MaxPendingPerSender: 2,
+		RejectNonceGaps:     true,
+	}
+	admission := newTxAdmission(config, signer, func(common.Address) (uint64, error) { return 0, nil })
+	ctx := context.WithValue(context.Background(), "remote", "10.0.0.1:1234")
+
+	// Sender 0 has a nonce gap
+	senders[0].nonce = 1
+	_, err := admission.admit(ctx, newOrderingTestItem(t, signer, senders[0], 1).tx)
+	if err != ErrNonceGap {
+		Fail(t, "expected nonce gap, got", err)
+	}
+
+	// Sender 1's pending transactions fill in nonces
+	release, err := admission.admit(ctx, newOrderingTestItem(t, signer, senders[1], 1).tx)
+	Require(t, err)
+	release2, err := admission.admit(ctx, newOrderingTestItem(t, signer, senders[1], 1).tx)
+	Require(t, err)
+	_, err = admission.admit(ctx, newOrderingTestItem(t, signer, senders[1], 1).tx)
+	if err != ErrTooManyPendingFromSender {
+		Fail(t, "expected too many pending, got", err)
+	}
+	release()
+	senders[1].nonce = 1
+	_, err = admission.admit(ctx, newOrderingTestItem(t, signer, senders[1], 1).tx)
+	Require(t, err)
+	release2()
+	// The sender's burst has been used up by its admitted transactions
+	senders[1].nonce = 1
+	_, err = admission.admit(ctx, newOrderingTestItem(t, signer, senders[1], 1).tx)
+	if err != ErrSenderRateLimited {
+		Fail(t, "expected sender rate limit, got", err)
+	}
+
+	// Only the admitted transactions counted against the IP address
+	senders[0].nonce = 0
+	_, err = admission.admit(ctx, newOrderingTestItem(t, signer, senders[0], 1).tx)
+	Require(t, err)
+	_, err = admission.admit(ctx, newOrderingTestItem(t, signer, senders[0], 1).tx)
+	Require(t, err)
+	tx := newOrderingTestItem(t, signer, senders[2], 1).tx
+	_, err = admission.admit(ctx, tx)
+	if err != ErrIPRateLimited {
+		Fail(t, "expected IP rate limit, got", err)
+	}
+	_, err = admission.admit(context.Background(), tx)
+	Require(t, err)
+}
+
+func TestTxAdmissionEncrypted(t *testing.T) {
+	config := DefaultTxAdmissionConfig
+	config.IPRate = 1
+	config.IPBurst = 2
+	admission := newTxAdmission(config, nil, nil)
+
+	ctx := context.WithValue(context.Background(), "remote", "10.0.0.1:1234")
+	for i := 0; i < config.IPBurst; i++ {
+		Require(t, admission.admitEncrypted(ctx))
+	}
+	if err := admission.admitEncrypted(ctx); !errors.Is(err, ErrIPRateLimited) {
+		Fail(t, "expected IP rate limit, got", err)
+	}
+	otherCtx := context.WithValue(context.Background(), "remote", "10.0.0.2:1234")
+	Require(t, admission.admitEncrypted(otherCtx))
+
+	// Without admission control nothing is limited
+	var disabled *txAdmission
+	Require(t, disabled.admitEncrypted(ctx))
+}
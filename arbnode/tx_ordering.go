@@ -0,0 +1,255 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"container/heap"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TxOrderingPolicy decides the order in which queued transactions are sequenced.
+// It is only accessed from the sequencer loop.
+type TxOrderingPolicy interface {
+	// Add queues a newly received transaction
+	Add(item txQueueItem)
+	// Requeue puts back a transaction that was taken but couldn't be sequenced yet,
+	// so it's retried before other transactions from the same sender.
+	Requeue(item txQueueItem)
+	// Next removes and returns the transaction to sequence next
+	Next() (txQueueItem, bool)
+	Len() int
+}
+
+const (
+	TxOrderingFifo        = "fifo"
+	TxOrderingPriorityFee = "priority-fee"
+	TxOrderingFair        = "fair"
+)
+
+func NewTxOrderingPolicy(name string, signer types.Signer) (TxOrderingPolicy, error) {
+	switch name {
+	case TxOrderingFifo, "":
+		return &fifoOrdering{}, nil
+	case TxOrderingPriorityFee:
+		return newPriorityFeeOrdering(signer), nil
+	case TxOrderingFair:
+		return newFairOrdering(signer), nil
+	default:
+		return nil, fmt.Errorf("unknown transaction ordering policy %v", name)
+	}
+}
+
+// fifoOrdering sequences transactions in the order they were received
+type fifoOrdering struct {
+	queue []txQueueItem
+}
+
+func (o *fifoOrdering) Add(item txQueueItem) {
+	o.queue = append(o.queue, item)
+}
+
+func (o *fifoOrdering) Requeue(item txQueueItem) {
+	o.queue = append([]txQueueItem{item}, o.queue...)
+}
+
+func (o *fifoOrdering) Next() (txQueueItem, bool) {
+	if len(o.queue) == 0 {
+		return txQueueItem{}, false
+	}
+	item := o.queue[0]
+	o.queue = o.queue[1:]
+	return item, true
+}
+
+func (o *fifoOrdering) Len() int {
+	return len(o.queue)
+}
+
+// senderQueues keeps a FIFO queue of transactions per sender, so that policies reordering
+// transactions between senders never reorder the transactions (and nonces) of one sender.
+type senderQueues struct {
+	signer  types.Signer
+	queues  map[common.Address][]txQueueItem
+	length  int
+	arrival uint64
+}
+
+func newSenderQueues(signer types.Signer) senderQueues {
+	return senderQueues{
+		signer: signer,
+		queues: make(map[common.Address][]txQueueItem),
+	}
+}
+
+func (q *senderQueues) sender(item txQueueItem) common.Address {
+	// Transactions with invalid signatures are grouped under the zero address, they'll fail when executed
+	sender, _ := types.Sender(q.signer, item.tx)
+	return sender
+}
+
+// push appends to the sender's queue, or prepends if front is set.
+// It returns the sender and whether the sender's queue was previously empty.
+func (q *senderQueues) push(item txQueueItem, front bool) (common.Address, bool) {
+	sender := q.sender(item)
+	queue := q.queues[sender]
+	wasEmpty := len(queue) == 0
+	if front {
+		queue = append([]txQueueItem{item}, queue...)
+	} else {
+		queue = append(queue, item)
+	}
+	q.queues[sender] = queue
+	q.length++
+	return sender, wasEmpty
+}
+
+func (q *senderQueues) pop(sender common.Address) (txQueueItem, bool) {
+	queue := q.queues[sender]
+	item := queue[0]
+	if len(queue) == 1 {
+		delete(q.queues, sender)
+	} else {
+		q.queues[sender] = queue[1:]
+	}
+	q.length--
+	return item, len(queue) > 1
+}
+
+func (q *senderQueues) head(sender common.Address) txQueueItem {
+	return q.queues[sender][0]
+}
+
+// priorityFeeOrdering sequences the sender whose next transaction offers the highest
+// priority fee first, breaking ties by arrival order.
+type priorityFeeOrdering struct {
+	senderQueues
+	heap priorityFeeHeap
+}
+
+type priorityFeeEntry struct {
+	sender  common.Address
+	tip     *big.Int
+	arrival uint64
+}
+
+type priorityFeeHeap []priorityFeeEntry
+
+func (h priorityFeeHeap) Len() int { return len(h) }
+func (h priorityFeeHeap) Less(i, j int) bool {
+	if cmp := h[i].tip.Cmp(h[j].tip); cmp != 0 {
+		return cmp > 0
+	}
+	return h[i].arrival < h[j].arrival
+}
+func (h priorityFeeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *priorityFeeHeap) Push(x interface{}) { *h = append(*h, x.(priorityFeeEntry)) }
+func (h *priorityFeeHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func newPriorityFeeOrdering(signer types.Signer) *priorityFeeOrdering {
+	return &priorityFeeOrdering{senderQueues: newSenderQueues(signer)}
+}
+
+func (o *priorityFeeOrdering) pushSender(sender common.Address) {
+	o.arrival++
+	heap.Push(&o.heap, priorityFeeEntry{
+		sender:  sender,
+		tip:     o.head(sender).tx.GasTipCap(),
+		arrival: o.arrival,
+	})
+}
+
+func (o *priorityFeeOrdering) Add(item txQueueItem) {
+	sender, wasEmpty := o.push(item, false)
+	if wasEmpty {
+		o.pushSender(sender)
+	}
+}
+
+func (o *priorityFeeOrdering) Requeue(item txQueueItem) {
+	sender, wasEmpty := o.push(item, true)
+	if wasEmpty {
+		o.pushSender(sender)
+		return
+	}
+	// The sender's head changed, so its priority may have too
+	for i, entry := range o.heap {
+		if entry.sender == sender {
+			o.heap[i].tip = item.tx.GasTipCap()
+			heap.Fix(&o.heap, i)
+			break
+		}
+	}
+}
+
+func (o *priorityFeeOrdering) Next() (txQueueItem, bool) {
+	if len(o.heap) == 0 {
+		return txQueueItem{}, false
+	}
+	entry := heap.Pop(&o.heap).(priorityFeeEntry)
+	item, more := o.pop(entry.sender)
+	if more {
+		o.pushSender(entry.sender)
+	}
+	return item, true
+}
+
+func (o *priorityFeeOrdering) Len() int {
+	return o.length
+}
+
+// fairOrdering takes one transaction from each sender in turn, so a single sender
+// flooding the queue can't delay everyone else.
+type fairOrdering struct {
+	senderQueues
+	rotation []common.Address
+}
+
+func newFairOrdering(signer types.Signer) *fairOrdering {
+	return &fairOrdering{senderQueues: newSenderQueues(signer)}
+}
+
+func (o *fairOrdering) Add(item txQueueItem) {
+	sender, wasEmpty := o.push(item, false)
+	if wasEmpty {
+		o.rotation = append(o.rotation, sender)
+	}
+}
+
+func (o *fairOrdering) Requeue(item txQueueItem) {
+	sender, _ := o.push(item, true)
+	// Give the sender back the turn it just used
+	for i, rotationSender := range o.rotation {
+		if rotationSender == sender {
+			o.rotation = append(o.rotation[:i], o.rotation[i+1:]...)
+			break
+		}
+	}
+	o.rotation = append([]common.Address{sender}, o.rotation...)
+}
+
+func (o *fairOrdering) Next() (txQueueItem, bool) {
+	if len(o.rotation) == 0 {
+		return txQueueItem{}, false
+	}
+	sender := o.rotation[0]
+	o.rotation = o.rotation[1:]
+	item, more := o.pop(sender)
+	if more {
+		o.rotation = append(o.rotation, sender)
+	}
+	return item, true
+}
+
+func (o *fairOrdering) Len() int {
+	return o.length
+}
@@ -0,0 +1,102 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbnode
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+type orderingTestSender struct {
+	key   []byte
+	nonce uint64
+}
+
+func newOrderingTestItem(t *testing.T, signer types.Signer, sender *orderingTestSender, tip int64) txQueueItem {
+	t.Helper()
+	key, err := crypto.ToECDSA(sender.key)
+	Require(t, err)
+	tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+		Nonce:     sender.nonce,
+		GasTipCap: big.NewInt(tip),
+		GasFeeCap: big.NewInt(tip + 100),
+		Gas:       21000,
+	})
+	Require(t, err)
+	sender.nonce++
+	return txQueueItem{tx: tx, resultChan: make(chan error, 1), ctx: context.Background()}
+}
+
+func newOrderingTestSenders(t *testing.T, count int) []*orderingTestSender {
+	var senders []*orderingTestSender
+	for i := 0; i < count; i++ {
+		key, err := crypto.GenerateKey()
+		Require(t, err)
+		senders = append(senders, &orderingTestSender{key: crypto.FromECDSA(key)})
+	}
+	return senders
+}
+
+func drainOrdering(t *testing.T, ordering TxOrderingPolicy, expected []txQueueItem) {
+	t.Helper()
+	if ordering.Len() != len(expected) {
+		Fail(t, "expected", len(expected), "queued transactions, got", ordering.Len())
+	}
+	for i, want := range expected {
+		got, ok := ordering.Next()
+		if !ok {
+			Fail(t, "ordering ran out of transactions at", i)
+		}
+		if got.tx.Hash() != want.tx.Hash() {
+			Fail(t, "unexpected transaction at position", i)
+		}
+	}
+	if _, ok := ordering.Next(); ok {
+		Fail(t, "ordering has extra transactions")
+	}
+}
+
+func TestTxOrderingPolicies(t *testing.T) {
+	signer := types.LatestSignerForChainID(big.NewInt(412346))
+	senders := newOrderingTestSenders(t, 2)
+	a0 := newOrderingTestItem(t, signer, senders[0], 1)
+	a1 := newOrderingTestItem(t, signer, senders[0], 10)
+	a2 := newOrderingTestItem(t, signer, senders[0], 10)
+	b0 := newOrderingTestItem(t, signer, senders[1], 5)
+	b1 := newOrderingTestItem(t, signer, senders[1], 1)
+	received := []txQueueItem{a0, a1, a2, b0, b1}
+
+	for _, test := range []struct {
+		policy   string
+		expected []txQueueItem
+	}{
+		{TxOrderingFifo, []txQueueItem{a0, a1, a2, b0, b1}},
+		// a0's low tip holds back the rest of sender a, as nonces can't be reordered
+		{TxOrderingPriorityFee, []txQueueItem{b0, a0, a1, a2, b1}},
+		{TxOrderingFair, []txQueueItem{a0, b0, a1, b1, a2}},
+	} {
+		ordering, err := NewTxOrderingPolicy(test.policy, signer)
+		Require(t, err)
+		for _, item := range received {
+			ordering.Add(item)
+		}
+		drainOrdering(t, ordering, test.expected)
+
+		// A requeued transaction must come before the rest of its sender's transactions
+		for _, item := range received {
+			ordering.Add(item)
+		}
+		first, _ := ordering.Next()
+		ordering.Requeue(first)
+		drainOrdering(t, ordering, test.expected)
+	}
+
+	if _, err := NewTxOrderingPolicy("random", signer); err == nil {
+		Fail(t, "unknown ordering policy accepted")
+	}
+}
@@ -185,7 +185,7 @@ func InitializeArbosState(stateDB vm.StateDB, burner burn.Burner, chainConfig *p
 	}
 
 	arbosVersion = chainConfig.ArbitrumChainParams.InitialArbOSVersion
-	if arbosVersion < 1 || arbosVersion > 4 {
+	if arbosVersion < 1 || arbosVersion > 5 {
 		return nil, fmt.Errorf("cannot initialize to unsupported ArbOS version %v", arbosVersion)
 	}
 
@@ -240,6 +240,8 @@ func (state *ArbosState) UpgradeArbosVersionIfNecessary(currentTimestamp uint64,
 				// (We don't bother to remove no-longer-used fields, for safety
 				//       and because they'll be removed when we telescope versions for re-launch.)
 				state.Restrict(state.l2PricingState.UpgradeToVersion4())
+			} else if state.arbosVersion == 4 {
+				// Upgrade version 4->5 has no state changes, but parses L2 messages of the EncryptedTxCommitments kind
 			} else {
 				// code to upgrade to future versions will be put here
 				panic("Unable to perform requested ArbOS upgrade")
@@ -103,7 +103,7 @@ func ProduceBlock(
 	chainContext core.ChainContext,
 	chainConfig *params.ChainConfig,
 ) (*types.Block, types.Receipts) {
-	txes, err := message.ParseL2Transactions(chainConfig.ChainID)
+	txes, err := message.ParseL2Transactions(chainConfig.ChainID, arbosState.ArbOSVersion(statedb))
 	if err != nil {
 		log.Warn("error parsing incoming message", "err", err)
 		txes = types.Transactions{}
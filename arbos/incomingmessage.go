@@ -169,14 +169,14 @@ func ParseIncomingL1Message(rd io.Reader) (*L1IncomingMessage, error) {
 	}, nil
 }
 
-func (msg *L1IncomingMessage) ParseL2Transactions(chainId *big.Int) (types.Transactions, error) {
+func (msg *L1IncomingMessage) ParseL2Transactions(chainId *big.Int, arbosVersion uint64) (types.Transactions, error) {
 	if len(msg.L2msg) > MaxL2MessageSize {
 		// ignore the message if l2msg is too large
 		return nil, errors.New("message too large")
 	}
 	switch msg.Header.Kind {
 	case L1MessageType_L2Message:
-		return parseL2Message(bytes.NewReader(msg.L2msg), msg.Header.Poster, msg.Header.RequestId, chainId, 0)
+		return parseL2Message(bytes.NewReader(msg.L2msg), msg.Header.Poster, msg.Header.RequestId, chainId, arbosVersion, 0)
 	case L1MessageType_Initialize:
 		return nil, errors.New("ParseL2Transactions encounted initialize message (should've been handled explicitly at genesis)")
 	case L1MessageType_EndOfBlock:
@@ -250,9 +250,16 @@ const (
 	L2MessageKind_Heartbeat          = 6
 	L2MessageKind_SignedCompressedTx = 7
 	// 8 is reserved for BLS signed batch
+	// Records the sequencer's commitments to the order of encrypted transactions, see arbnode's encrypted mempool.
+	// It produces no transactions, but before FirstEncryptedTxCommitmentsVersion it's an unknown kind,
+	// which makes a batch containing it invalid, so parsing it depends on the ArbOS version.
+	L2MessageKind_EncryptedTxCommitments = 9
 )
 
-func parseL2Message(rd io.Reader, poster common.Address, requestId *common.Hash, chainId *big.Int, depth int) (types.Transactions, error) {
+// FirstEncryptedTxCommitmentsVersion is the first ArbOS version to parse L2MessageKind_EncryptedTxCommitments
+const FirstEncryptedTxCommitmentsVersion = 5
+
+func parseL2Message(rd io.Reader, poster common.Address, requestId *common.Hash, chainId *big.Int, arbosVersion uint64, depth int) (types.Transactions, error) {
 	var l2KindBuf [1]byte
 	if _, err := rd.Read(l2KindBuf[:]); err != nil {
 		return nil, err
@@ -292,7 +299,7 @@ func parseL2Message(rd io.Reader, poster common.Address, requestId *common.Hash,
 				subRequestId := crypto.Keccak256Hash(requestId[:], math.U256Bytes(index))
 				nextRequestId = &subRequestId
 			}
-			nestedSegments, err := parseL2Message(bytes.NewReader(nextMsg), poster, nextRequestId, chainId, depth+1)
+			nestedSegments, err := parseL2Message(bytes.NewReader(nextMsg), poster, nextRequestId, chainId, arbosVersion, depth+1)
 			if err != nil {
 				return nil, err
 			}
@@ -313,6 +320,12 @@ func parseL2Message(rd io.Reader, poster common.Address, requestId *common.Hash,
 	case L2MessageKind_Heartbeat:
 		// do nothing
 		return nil, nil
+	case L2MessageKind_EncryptedTxCommitments:
+		if arbosVersion < FirstEncryptedTxCommitmentsVersion {
+			return nil, fmt.Errorf("unkown L2 message kind %v", l2KindBuf[0])
+		}
+		// do nothing, the commitments are only a record for the decrypted transactions sequenced later
+		return nil, nil
 	case L2MessageKind_SignedCompressedTx:
 		return nil, errors.New("L2 message kind SignedCompressedTx is unimplemented")
 	default:
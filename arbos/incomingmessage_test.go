@@ -9,6 +9,8 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/offchainlabs/nitro/arbos/util"
 )
 
 func TestSerializeAndParseL1Message(t *testing.T) {
@@ -34,7 +36,42 @@ func TestSerializeAndParseL1Message(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	txes, err := newMsg.ParseL2Transactions(chainId)
+	txes, err := newMsg.ParseL2Transactions(chainId, FirstEncryptedTxCommitmentsVersion)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(txes) != 0 {
+		Fail(t, "unexpected tx count")
+	}
+}
+
+func TestEncryptedTxCommitmentsNeedArbOSVersion(t *testing.T) {
+	chainId := big.NewInt(6345634)
+	var batch bytes.Buffer
+	batch.WriteByte(L2MessageKind_Batch)
+	for _, segment := range [][]byte{{L2MessageKind_Heartbeat}, {L2MessageKind_EncryptedTxCommitments}} {
+		if err := util.BytestringToWriter(segment, &batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requestId := common.BigToHash(big.NewInt(3))
+	msg := L1IncomingMessage{
+		&L1IncomingMessageHeader{
+			L1MessageType_L2Message,
+			common.BigToAddress(big.NewInt(4684)),
+			864513,
+			8794561564,
+			&requestId,
+			big.NewInt(10000000000000),
+		},
+		batch.Bytes(),
+	}
+
+	// Before the upgrade, the unknown kind makes the whole batch invalid, as it always did
+	if _, err := msg.ParseL2Transactions(chainId, FirstEncryptedTxCommitmentsVersion-1); err == nil {
+		Fail(t, "parsed commitments before their ArbOS version")
+	}
+	txes, err := msg.ParseL2Transactions(chainId, FirstEncryptedTxCommitmentsVersion)
 	if err != nil {
 		t.Error(err)
 	}
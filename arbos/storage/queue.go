@@ -123,3 +123,31 @@ func (q *Queue) ForEach(closure func(uint64, common.Hash) error) error {
 	}
 	return nil
 }
+
+// Apply a closure on the elements of the queue from a position, until the closure returns true.
+// An element's position, unlike its index in ForEach, doesn't change as elements before it are removed.
+func (q *Queue) ForEachFrom(position uint64, closure func(uint64, common.Hash) (bool, error)) error {
+	get, err := q.nextGetOffset.Get()
+	if err != nil {
+		return err
+	}
+	put, err := q.nextPutOffset.Get()
+	if err != nil {
+		return err
+	}
+	if position < get {
+		position = get
+	}
+
+	for ; position < put; position++ {
+		entry, err := q.storage.GetByUint64(position)
+		if err != nil {
+			return err
+		}
+		done, err := closure(position, entry)
+		if done || err != nil {
+			return err
+		}
+	}
+	return nil
+}
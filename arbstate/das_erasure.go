@@ -0,0 +1,236 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbos/util"
+)
+
+// The most shares a batch may be split into, since each share is identified by a distinct field element
+const MaxErasureShares = 256
+
+// ErasureCodingManifest lists the shares a batch was split into. An erasure coded certificate's
+// data hash is the hash of the serialized manifest, and every committee member stores the manifest.
+//
+// The batch is padded to a multiple of DataShares bytes and cut into DataShares data shares.
+// Every byte offset of the shares is then treated as the values at 0, 1, ... DataShares-1 of a
+// polynomial over GF(2^8), and the remaining parity shares hold that polynomial's values at
+// DataShares, DataShares+1, ... len(ShareHashes)-1. Any DataShares shares recover the batch.
+type ErasureCodingManifest struct {
+	DataHash    [32]byte
+	DataLength  uint64
+	DataShares  uint64
+	ShareHashes [][32]byte
+}
+
+func (m *ErasureCodingManifest) Serialize() []byte {
+	buf := bytes.NewBuffer([]byte{})
+	buf.Write(m.DataHash[:])
+	_ = util.Uint64ToWriter(m.DataLength, buf)
+	_ = util.Uint64ToWriter(m.DataShares, buf)
+	_ = util.Uint64ToWriter(uint64(len(m.ShareHashes)), buf)
+	for _, hash := range m.ShareHashes {
+		buf.Write(hash[:])
+	}
+	return buf.Bytes()
+}
+
+func DeserializeErasureCodingManifest(rd io.Reader) (*ErasureCodingManifest, error) {
+	m := &ErasureCodingManifest{}
+	if _, err := io.ReadFull(rd, m.DataHash[:]); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.DataLength, err = util.Uint64FromReader(rd); err != nil {
+		return nil, err
+	}
+	if m.DataShares, err = util.Uint64FromReader(rd); err != nil {
+		return nil, err
+	}
+	totalShares, err := util.Uint64FromReader(rd)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkErasureShareCounts(m.DataShares, totalShares); err != nil {
+		return nil, err
+	}
+	if m.DataLength > uint64(maxDecompressedLen) {
+		return nil, errors.New("erasure coded batch too long")
+	}
+	m.ShareHashes = make([][32]byte, totalShares)
+	for i := range m.ShareHashes {
+		if _, err := io.ReadFull(rd, m.ShareHashes[i][:]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func checkErasureShareCounts(dataShares, totalShares uint64) error {
+	if dataShares == 0 || dataShares > totalShares || totalShares > MaxErasureShares {
+		return fmt.Errorf("invalid erasure coding of %v data shares out of %v", dataShares, totalShares)
+	}
+	return nil
+}
+
+// ShareSize is the length of each of the batch's shares
+func (m *ErasureCodingManifest) ShareSize() uint64 {
+	size := (m.DataLength + m.DataShares - 1) / m.DataShares
+	if size == 0 {
+		return 1
+	}
+	return size
+}
+
+// EncodeErasureShares splits the data into totalShares shares, any dataShares of which recover it
+func EncodeErasureShares(data []byte, dataShares, totalShares uint64) (*ErasureCodingManifest, [][]byte, error) {
+	if err := checkErasureShareCounts(dataShares, totalShares); err != nil {
+		return nil, nil, err
+	}
+	manifest := &ErasureCodingManifest{
+		DataLength: uint64(len(data)),
+		DataShares: dataShares,
+	}
+	copy(manifest.DataHash[:], crypto.Keccak256(data))
+	size := manifest.ShareSize()
+
+	padded := make([]byte, size*dataShares)
+	copy(padded, data)
+	shares := make([][]byte, totalShares)
+	points := make([]uint64, dataShares)
+	for i := uint64(0); i < dataShares; i++ {
+		shares[i] = padded[i*size : (i+1)*size]
+		points[i] = i
+	}
+	for i := dataShares; i < totalShares; i++ {
+		shares[i] = interpolateShare(points, shares[:dataShares], i, size)
+	}
+	manifest.ShareHashes = make([][32]byte, totalShares)
+	for i, share := range shares {
+		copy(manifest.ShareHashes[i][:], crypto.Keccak256(share))
+	}
+	return manifest, shares, nil
+}
+
+// RecoverErasureCodedPayload fetches shares of the batch until it can be recovered. If preimages
+// is non-nil, the data shares are recorded so the batch can be recovered again from them alone.
+func RecoverErasureCodedPayload(
+	ctx context.Context,
+	manifest *ErasureCodingManifest,
+	dasReader DataAvailabilityReader,
+	preimages map[common.Hash][]byte,
+) ([]byte, error) {
+	size := manifest.ShareSize()
+
+	// data shares come first, so the batch is recovered without interpolation if they're available
+	var points []uint64
+	var shares [][]byte
+	for i, hash := range manifest.ShareHashes {
+		share, err := dasReader.GetByHash(ctx, hash[:])
+		if err == nil && !bytes.Equal(crypto.Keccak256(share), hash[:]) {
+			err = ErrHashMismatch
+		}
+		if err == nil && uint64(len(share)) != size {
+			err = fmt.Errorf("erasure share has length %v, expected %v", len(share), size)
+		}
+		if err != nil {
+			log.Warn("Couldn't fetch erasure share", "share", i, "err", err)
+			continue
+		}
+		points = append(points, uint64(i))
+		shares = append(shares, share)
+		if uint64(len(shares)) == manifest.DataShares {
+			break
+		}
+	}
+	if uint64(len(shares)) < manifest.DataShares {
+		return nil, fmt.Errorf("only %v of the %v erasure shares needed were available", len(shares), manifest.DataShares)
+	}
+
+	padded := make([]byte, 0, size*manifest.DataShares)
+	for i := uint64(0); i < manifest.DataShares; i++ {
+		if points[i] == i {
+			padded = append(padded, shares[i]...)
+		} else {
+			padded = append(padded, interpolateShare(points, shares, i, size)...)
+		}
+	}
+	payload := padded[:manifest.DataLength]
+	if !bytes.Equal(crypto.Keccak256(payload), manifest.DataHash[:]) {
+		return nil, ErrHashMismatch
+	}
+
+	if preimages != nil {
+		for i := uint64(0); i < manifest.DataShares; i++ {
+			share := padded[i*size : (i+1)*size]
+			preimages[common.BytesToHash(manifest.ShareHashes[i][:])] = share
+		}
+	}
+	return payload, nil
+}
+
+// GF(2^8) arithmetic, modulo x^8 + x^4 + x^3 + x^2 + 1 with generator 2
+var gfExp [510]byte
+var gfLog [256]byte
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfExp[i+255] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// interpolateShare evaluates at x the polynomials through the shares at the given distinct points
+func interpolateShare(points []uint64, shares [][]byte, x uint64, size uint64) []byte {
+	result := make([]byte, size)
+	for m, share := range shares {
+		// the Lagrange basis polynomial of point m, evaluated at x
+		coefficient := byte(1)
+		for l, point := range points {
+			if l != m {
+				coefficient = gfMul(coefficient, gfDiv(byte(x)^byte(point), byte(points[m])^byte(point)))
+			}
+		}
+		if coefficient == 0 {
+			continue
+		}
+		logCoefficient := int(gfLog[coefficient])
+		for j, value := range share {
+			if value != 0 {
+				result[j] ^= gfExp[logCoefficient+int(gfLog[value])]
+			}
+		}
+	}
+	return result
+}
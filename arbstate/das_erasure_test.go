@@ -0,0 +1,77 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type preimageReader map[common.Hash][]byte
+
+func (r preimageReader) GetByHash(ctx context.Context, hash []byte) ([]byte, error) {
+	preimage, ok := r[common.BytesToHash(hash)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return preimage, nil
+}
+
+func (r preimageReader) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func (r preimageReader) ExpirationPolicy(ctx context.Context) (ExpirationPolicy, error) {
+	return KeepForever, nil
+}
+
+func TestErasureCodingRecovery(t *testing.T) {
+	ctx := context.Background()
+	for _, length := range []int{0, 1, 1000, 4097} {
+		data := make([]byte, length)
+		rand.Read(data)
+		manifest, shares, err := EncodeErasureShares(data, 3, 7)
+		Require(t, err)
+
+		serialized := manifest.Serialize()
+		manifest, err = DeserializeErasureCodingManifest(bytes.NewReader(serialized))
+		Require(t, err)
+
+		// only a single data share survives
+		reader := preimageReader{}
+		for _, i := range []int{1, 4, 6} {
+			reader[common.BytesToHash(manifest.ShareHashes[i][:])] = shares[i]
+		}
+		preimages := make(map[common.Hash][]byte)
+		recovered, err := RecoverErasureCodedPayload(ctx, manifest, reader, preimages)
+		Require(t, err)
+		if !bytes.Equal(recovered, data) {
+			Fail(t, "recovered the wrong data of length", length)
+		}
+
+		// the recorded preimages are the data shares, which are enough on their own
+		if len(preimages) > 3 {
+			Fail(t, "recorded", len(preimages), "preimages")
+		}
+		recovered, err = RecoverErasureCodedPayload(ctx, manifest, preimageReader(preimages), nil)
+		Require(t, err)
+		if !bytes.Equal(recovered, data) {
+			Fail(t, "recovered the wrong data from the recorded preimages")
+		}
+
+		// tiny batches have identical shares, which are stored once
+		if length < 16 {
+			continue
+		}
+		delete(reader, common.BytesToHash(manifest.ShareHashes[4][:]))
+		if _, err := RecoverErasureCodedPayload(ctx, manifest, reader, nil); err == nil {
+			Fail(t, "recovered data from too few shares", length)
+		}
+	}
+}
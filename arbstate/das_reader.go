@@ -36,6 +36,12 @@ const L1AuthenticatedMessageHeaderFlag byte = 0x40
 // Indicates that this message is zeroheavy-encoded.
 const ZeroheavyMessageHeaderFlag byte = 0x20
 
+// Indicates that the data availability certificate is for an erasure coding manifest,
+// whose shares hold the full batch data. Replay binaries from before this flag read the
+// manifest as if it were the batch, so the batch poster only sets it once the rollup's
+// wasm module root has been upgraded to one that reads erasure coded certificates.
+const ErasureCodedDASMessageHeaderFlag byte = 0x08
+
 func IsDASMessageHeaderByte(header byte) bool {
 	return (DASMessageHeaderFlag & header) > 0
 }
@@ -44,12 +50,17 @@ func IsZeroheavyEncodedHeaderByte(header byte) bool {
 	return (ZeroheavyMessageHeaderFlag & header) > 0
 }
 
+func IsErasureCodedDASMessageHeaderByte(header byte) bool {
+	return (ErasureCodedDASMessageHeaderFlag & header) > 0
+}
+
 type DataAvailabilityCertificate struct {
-	KeysetHash  [32]byte
-	DataHash    [32]byte
-	Timeout     uint64
-	SignersMask uint64
-	Sig         blsSignatures.Signature
+	KeysetHash   [32]byte
+	DataHash     [32]byte
+	Timeout      uint64
+	SignersMask  uint64
+	Sig          blsSignatures.Signature
+	ErasureCoded bool // whether DataHash is the hash of an ErasureCodingManifest
 }
 
 func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err error) {
@@ -63,6 +74,7 @@ func DeserializeDASCertFrom(rd io.Reader) (c *DataAvailabilityCertificate, err e
 	if !IsDASMessageHeaderByte(header) {
 		return nil, errors.New("Tried to deserialize a message that doesn't have the DAS header.")
 	}
+	c.ErasureCoded = IsErasureCodedDASMessageHeaderByte(header)
 
 	_, err = io.ReadFull(r, c.KeysetHash[:])
 	if err != nil {
@@ -112,6 +124,19 @@ func (c *DataAvailabilityCertificate) SerializeSignableFields() []byte {
 	return buf
 }
 
+// SerializeErasureShareSignableFields is what the committee member storing the erasure share
+// at index signs for an erasure coded certificate, which commits to the share's hash.
+func (c *DataAvailabilityCertificate) SerializeErasureShareSignableFields(index uint64, shareHash [32]byte) []byte {
+	buf := make([]byte, 0, 32+8+8+32)
+	buf = append(buf, c.SerializeSignableFields()...)
+
+	var intData [8]byte
+	binary.BigEndian.PutUint64(intData[:], index)
+	buf = append(buf, intData[:]...)
+
+	return append(buf, shareHash[:]...)
+}
+
 func (cert *DataAvailabilityCertificate) RecoverKeyset(
 	ctx context.Context,
 	da DataAvailabilityReader,
@@ -135,6 +160,20 @@ func (cert *DataAvailabilityCertificate) VerifyNonPayloadParts(
 		return err
 	}
 
+	if cert.ErasureCoded {
+		manifestBytes, err := da.GetByHash(ctx, cert.DataHash[:])
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(crypto.Keccak256(manifestBytes), cert.DataHash[:]) {
+			return ErrHashMismatch
+		}
+		manifest, err := DeserializeErasureCodingManifest(bytes.NewReader(manifestBytes))
+		if err != nil {
+			return err
+		}
+		return keyset.VerifyErasureCodedSignature(cert, manifest)
+	}
 	return keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig)
 }
 
@@ -227,6 +266,36 @@ func (keyset *DataAvailabilityKeyset) VerifySignature(signersMask uint64, data [
 	return nil
 }
 
+// VerifyErasureCodedSignature checks the signature of an erasure coded certificate, in which
+// each signer signed for the share whose index is the position of its key in the keyset.
+func (keyset *DataAvailabilityKeyset) VerifyErasureCodedSignature(cert *DataAvailabilityCertificate, manifest *ErasureCodingManifest) error {
+	pubkeys := []blsSignatures.PublicKey{}
+	messages := [][]byte{}
+	numNonSigners := uint64(0)
+	for i := 0; i < len(keyset.PubKeys); i++ {
+		if (1<<i)&cert.SignersMask == 0 {
+			numNonSigners++
+			continue
+		}
+		if i >= len(manifest.ShareHashes) {
+			return errors.New("signer has no erasure share")
+		}
+		pubkeys = append(pubkeys, keyset.PubKeys[i])
+		messages = append(messages, cert.SerializeErasureShareSignableFields(uint64(i), manifest.ShareHashes[i]))
+	}
+	if numNonSigners >= keyset.AssumedHonest {
+		return errors.New("not enough signers")
+	}
+	success, err := blsSignatures.VerifyAggregatedSignatureDifferentMessages(cert.Sig, messages, pubkeys)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return errors.New("bad signature")
+	}
+	return nil
+}
+
 type ExpirationPolicy int64
 
 const (
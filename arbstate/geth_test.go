@@ -116,7 +116,7 @@ func RunMessagesThroughAPI(t *testing.T, msgs [][]byte, statedb *state.StateDB)
 		if err != nil {
 			t.Error(err)
 		}
-		txes, err := msg.ParseL2Transactions(chainId)
+		txes, err := msg.ParseL2Transactions(chainId, arbosState.ArbOSVersion(statedb))
 		if err != nil {
 			t.Error(err)
 		}
@@ -39,6 +39,15 @@ type MessageWithMetadata struct {
 	DelayedMessagesRead uint64                   `json:"delayedMessagesRead"`
 }
 
+// Hash returns the keccak256 hash of the message's RLP encoding, which is the same encoding used to store it in the database.
+func (m *MessageWithMetadata) Hash() (common.Hash, error) {
+	data, err := rlp.EncodeToBytes(m)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
 type InboxMultiplexer interface {
 	Pop(context.Context) (*MessageWithMetadata, error)
 	DelayedMessagesRead() uint64
@@ -155,7 +164,23 @@ func RecoverPayloadFromDasBatch(
 		log.Error("Couldn't deserialize keyset", "err", err)
 		return nil, nil
 	}
-	err = keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig)
+	// An erasure coded certificate is signed for the shares listed in its manifest, which is fetched first
+	var manifest *ErasureCodingManifest
+	var payload []byte
+	if cert.ErasureCoded {
+		payload, err = getDASPayload(ctx, cert, dasReader, preimages)
+		if err != nil {
+			return nil, err
+		}
+		manifest, err = DeserializeErasureCodingManifest(bytes.NewReader(payload))
+		if err != nil {
+			log.Error("Couldn't deserialize erasure coding manifest", "err", err)
+			return nil, nil
+		}
+		err = keyset.VerifyErasureCodedSignature(cert, manifest)
+	} else {
+		err = keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig)
+	}
 	if err != nil {
 		log.Error("Bad signature on DAS batch", "err", err)
 		return nil, nil
@@ -165,6 +190,25 @@ func RecoverPayloadFromDasBatch(
 		log.Error("Data availability cert expires too soon", "err", "")
 		return nil, nil
 	}
+
+	if cert.ErasureCoded {
+		payload, err = RecoverErasureCodedPayload(ctx, manifest, dasReader, preimages)
+		if err != nil {
+			log.Error("Couldn't recover erasure coded DAS batch", "err", err)
+			return nil, err
+		}
+		return payload, nil
+	}
+	return getDASPayload(ctx, cert, dasReader, preimages)
+}
+
+// getDASPayload fetches the data the certificate is for
+func getDASPayload(
+	ctx context.Context,
+	cert *DataAvailabilityCertificate,
+	dasReader DataAvailabilityReader,
+	preimages map[common.Hash][]byte,
+) ([]byte, error) {
 	payload, err := dasReader.GetByHash(ctx, cert.DataHash[:])
 	if err == nil && !bytes.Equal(crypto.Keccak256(payload), cert.DataHash[:]) {
 		err = ErrHashMismatch
@@ -176,7 +220,6 @@ func RecoverPayloadFromDasBatch(
 	if preimages != nil {
 		preimages[common.BytesToHash(cert.DataHash[:])] = payload
 	}
-
 	return payload, nil
 }
 
@@ -7,20 +7,24 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"io"
-	"math/big"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/pkg/errors"
 	flag "github.com/spf13/pflag"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcaster"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
@@ -47,8 +51,11 @@ var FeedConfigDefault = FeedConfig{
 }
 
 type BroadcastClientConfig struct {
-	Timeout time.Duration `koanf:"timeout"`
-	URLs    []string      `koanf:"url"`
+	Timeout           time.Duration `koanf:"timeout"`
+	URLs              []string      `koanf:"url"`
+	SequencerAddress  string        `koanf:"sequencer-address"`
+	EnableCompression bool          `koanf:"enable-compression"`
+	MaxMessageSize    int           `koanf:"max-message-size"`
 }
 
 func (c *BroadcastClientConfig) Enable() bool {
@@ -56,52 +63,75 @@ func (c *BroadcastClientConfig) Enable() bool {
 }
 
 func BroadcastClientConfigAddOptions(prefix string, f *flag.FlagSet) {
-	f.StringSlice(prefix+".url", DefaultBroadcastClientConfig.URLs, "URL of sequencer feed source")
+	f.StringSlice(prefix+".url", DefaultBroadcastClientConfig.URLs, "URL of sequencer feed source, if several are given one is forwarded as primary and the others are used for failover")
 	f.Duration(prefix+".timeout", DefaultBroadcastClientConfig.Timeout, "duration to wait before timing out connection to sequencer feed")
+	f.String(prefix+".sequencer-address", DefaultBroadcastClientConfig.SequencerAddress, "if set, only accept feed messages signed by this sequencer address and disconnect on invalid signatures")
+	f.Bool(prefix+".enable-compression", DefaultBroadcastClientConfig.EnableCompression, "request per message deflate compression from the feed server")
+	f.Int(prefix+".max-message-size", DefaultBroadcastClientConfig.MaxMessageSize, "maximum size in bytes of a feed message, after decompression (0 for no limit)")
 }
 
 var DefaultBroadcastClientConfig = BroadcastClientConfig{
-	URLs:    []string{""},
-	Timeout: 20 * time.Second,
+	URLs:              []string{""},
+	Timeout:           20 * time.Second,
+	SequencerAddress:  "",
+	EnableCompression: true,
+	MaxMessageSize:    256 * 1024 * 1024,
 }
 
+var ErrIncorrectFeedSignature = errors.New("feed message signed by unexpected address")
+var ErrFeedLoop = errors.New("feed loop detected")
+var ErrUnsignedFilteredFeed = errors.New("filtered feed messages are unsigned and can't be verified")
+
 type TransactionStreamerInterface interface {
-	AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error
+	AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error
 }
 
 type BroadcastClient struct {
 	stopwaiter.StopWaiter
 
-	websocketUrl    string
-	lastInboxSeqNum *big.Int
+	websocketUrl string
+	nextSeqNum   arbutil.MessageIndex // sequence number to resume from when (re)connecting, 0 for the server's full catchup
 
 	// Protects conn and shuttingDown
 	connMutex sync.Mutex
 	conn      net.Conn
 
+	enableCompression bool
+	compression       bool // whether the server accepted compression on the current connection
+
 	retryCount int64
 
 	retrying                        bool
 	shuttingDown                    bool
 	ConfirmedSequenceNumberListener chan arbutil.MessageIndex
+	FeedPath                        *wsbroadcastserver.FeedPath // if not nil, identifies this client as a relay and refuses feed loops
 	idleTimeout                     time.Duration
+	maxMessageSize                  int
 	txStreamer                      TransactionStreamerInterface
+	sequencerAddress                *common.Address // if not nil, feed messages must be signed by this address
 }
 
-func NewBroadcastClient(websocketUrl string, lastInboxSeqNum *big.Int, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
-	var seqNum *big.Int
-	if lastInboxSeqNum == nil {
-		seqNum = big.NewInt(0)
-	} else {
-		seqNum = lastInboxSeqNum
+// NewBroadcastClient creates a client for the feed at websocketUrl. If currentMessageCount is
+// non-zero, the server is asked to only send messages starting at that sequence number.
+func NewBroadcastClient(config BroadcastClientConfig, websocketUrl string, currentMessageCount arbutil.MessageIndex, txStreamer TransactionStreamerInterface) (*BroadcastClient, error) {
+	var sequencerAddress *common.Address
+	if config.SequencerAddress != "" {
+		if !common.IsHexAddress(config.SequencerAddress) {
+			return nil, fmt.Errorf("invalid feed sequencer address %v", config.SequencerAddress)
+		}
+		addr := common.HexToAddress(config.SequencerAddress)
+		sequencerAddress = &addr
 	}
 
 	return &BroadcastClient{
-		websocketUrl:    websocketUrl,
-		lastInboxSeqNum: seqNum,
-		idleTimeout:     idleTimeout,
-		txStreamer:      txStreamer,
-	}
+		websocketUrl:      websocketUrl,
+		nextSeqNum:        currentMessageCount,
+		idleTimeout:       config.Timeout,
+		maxMessageSize:    config.MaxMessageSize,
+		txStreamer:        txStreamer,
+		sequencerAddress:  sequencerAddress,
+		enableCompression: config.EnableCompression,
+	}, nil
 }
 
 func (bc *BroadcastClient) Start(ctxIn context.Context) {
@@ -131,22 +161,67 @@ func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reade
 		return
 	}
 
-	log.Info("connecting to arbitrum inbox message broadcaster", "url", bc.websocketUrl)
+	log.Info("connecting to arbitrum inbox message broadcaster", "url", bc.websocketUrl, "requestedSeqNum", bc.nextSeqNum)
 	timeoutDialer := ws.Dialer{
 		Timeout: 10 * time.Second,
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12,
 		},
 	}
+	if bc.enableCompression {
+		timeoutDialer.Extensions = []httphead.Option{wsflate.DefaultParameters.Option()}
+	}
+	header := http.Header{}
+	if bc.nextSeqNum > 0 {
+		// Resume where we left off instead of replaying the whole catchup buffer
+		header.Set(wsbroadcastserver.HTTPHeaderRequestedSequenceNumber, strconv.FormatUint(uint64(bc.nextSeqNum), 10))
+	}
+	var upstreamPath []string
+	if bc.FeedPath != nil {
+		header.Set(wsbroadcastserver.HTTPHeaderFeedRelayId, bc.FeedPath.ID())
+		timeoutDialer.OnHeader = func(key, value []byte) error {
+			if !strings.EqualFold(string(key), wsbroadcastserver.HTTPHeaderFeedPath) {
+				return nil
+			}
+			upstreamPath = wsbroadcastserver.ParseFeedPath(string(value))
+			for _, id := range upstreamPath {
+				if id == bc.FeedPath.ID() {
+					return fmt.Errorf("%w: %v is downstream of this relay", ErrFeedLoop, bc.websocketUrl)
+				}
+			}
+			return nil
+		}
+	}
+	if len(header) > 0 {
+		timeoutDialer.Header = ws.HandshakeHeaderHTTP(header)
+	}
 
 	if bc.isShuttingDown() {
 		return
 	}
 
-	conn, br, _, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	conn, br, hs, err := timeoutDialer.Dial(ctx, bc.websocketUrl)
+	var statusErr ws.StatusError
+	if errors.As(err, &statusErr) && int(statusErr) == http.StatusLoopDetected {
+		err = fmt.Errorf("%w: this relay is upstream of %v", ErrFeedLoop, bc.websocketUrl)
+	}
+	if errors.Is(err, ErrFeedLoop) {
+		log.Error("refusing to connect to feed that would create a loop", "url", bc.websocketUrl, "err", err)
+	}
 	if err != nil {
 		return nil, errors.Wrap(err, "broadcast client unable to connect")
 	}
+	if bc.FeedPath != nil {
+		bc.FeedPath.SetUpstream(bc.websocketUrl, upstreamPath)
+	}
+
+	// Servers without compression support simply don't echo the extension back
+	compression := false
+	for _, extension := range hs.Extensions {
+		if string(extension.Name) == wsflate.ExtensionName {
+			compression = true
+		}
+	}
 
 	if br != nil {
 		// Depending on how long the client takes to read the response, there may be
@@ -161,9 +236,10 @@ func (bc *BroadcastClient) connect(ctx context.Context) (earlyFrameData io.Reade
 
 	bc.connMutex.Lock()
 	bc.conn = conn
+	bc.compression = compression
 	bc.connMutex.Unlock()
 
-	log.Info("Connected")
+	log.Info("Connected", "compression", compression)
 
 	return
 }
@@ -177,7 +253,7 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 			default:
 			}
 
-			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide)
+			msg, op, err := wsbroadcastserver.ReadData(ctx, bc.conn, earlyFrameData, bc.idleTimeout, ws.StateClientSide, bc.compression, bc.maxMessageSize)
 			if err != nil {
 				if bc.isShuttingDown() {
 					return
@@ -206,18 +282,34 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 					log.Debug("received batch item", "count", len(res.Messages), "first seq", res.Messages[0].SequenceNumber)
 				} else if res.ConfirmedSequenceNumberMessage != nil {
 					log.Debug("confirmed sequence number", "seq", res.ConfirmedSequenceNumberMessage.SequenceNumber)
+				} else if res.CatchupErrorMessage != nil {
+					log.Warn("sequencer feed could not resume from requested sequence number, missing messages will be read from L1", "url", bc.websocketUrl, "requestedSeqNum", res.CatchupErrorMessage.RequestedSequenceNumber, "firstAvailableSeqNum", res.CatchupErrorMessage.FirstAvailableSequenceNumber, "err", res.CatchupErrorMessage.Error)
 				} else {
 					log.Debug("received broadcast with no messages populated", "length", len(msg))
 				}
 
 				if res.Version == 1 {
+					if len(res.FilteredMessages) > 0 && bc.sequencerAddress != nil {
+						log.Error("rejecting sequencer feed messages, disconnecting", "url", bc.websocketUrl, "err", ErrUnsignedFilteredFeed)
+						_ = bc.conn.Close()
+						earlyFrameData = bc.retryConnect(ctx)
+						continue
+					}
 					if len(res.Messages) > 0 {
-						messages := []arbstate.MessageWithMetadata{}
-						for _, message := range res.Messages {
-							messages = append(messages, message.Message)
+						if err := bc.verifyFeedMessages(res.Messages); err != nil {
+							log.Error("rejecting sequencer feed messages, disconnecting", "url", bc.websocketUrl, "err", err)
+							_ = bc.conn.Close()
+							earlyFrameData = bc.retryConnect(ctx)
+							continue
 						}
-						if err := bc.txStreamer.AddBroadcastMessages(res.Messages[0].SequenceNumber, messages); err != nil {
+						if err := bc.txStreamer.AddBroadcastMessages(res.Messages); err != nil {
+							// don't skip these messages when resuming after a reconnect
 							log.Error("Error adding message from Sequencer Feed", "err", err)
+						} else {
+							lastSeqNum := res.Messages[len(res.Messages)-1].SequenceNumber
+							if lastSeqNum >= bc.nextSeqNum {
+								bc.nextSeqNum = lastSeqNum + 1
+							}
 						}
 					}
 					if res.ConfirmedSequenceNumberMessage != nil && bc.ConfirmedSequenceNumberListener != nil {
@@ -229,6 +321,22 @@ func (bc *BroadcastClient) startBackgroundReader(earlyFrameData io.Reader) {
 	})
 }
 
+func (bc *BroadcastClient) verifyFeedMessages(messages []*broadcaster.BroadcastFeedMessage) error {
+	if bc.sequencerAddress == nil {
+		return nil
+	}
+	for _, message := range messages {
+		signer, err := message.RecoverSigner()
+		if err != nil {
+			return fmt.Errorf("sequence number %v: %w", message.SequenceNumber, err)
+		}
+		if signer != *bc.sequencerAddress {
+			return fmt.Errorf("%w: sequence number %v signed by %v, expected %v", ErrIncorrectFeedSignature, message.SequenceNumber, signer, *bc.sequencerAddress)
+		}
+	}
+	return nil
+}
+
 func (bc *BroadcastClient) GetRetryCount() int64 {
 	return atomic.LoadInt64(&bc.retryCount)
 }
@@ -6,11 +6,15 @@ package broadcastclient
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"net"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbos"
 	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcaster"
@@ -18,15 +22,28 @@ import (
 )
 
 func TestReceiveMessages(t *testing.T) {
+	testReceiveMessages(t, true, true)
+}
+
+func TestReceiveMessagesServerCompressionOnly(t *testing.T) {
+	testReceiveMessages(t, true, false)
+}
+
+func TestReceiveMessagesClientCompressionOnly(t *testing.T) {
+	testReceiveMessages(t, false, true)
+}
+
+func testReceiveMessages(t *testing.T, serverCompression bool, clientCompression bool) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.EnableCompression = serverCompression
 
 	messageCount := 1000
 	clientCount := 2
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -34,9 +51,12 @@ func TestReceiveMessages(t *testing.T) {
 	}
 	defer b.StopAndWait()
 
+	config := DefaultBroadcastClientConfig
+	config.EnableCompression = clientCompression
+
 	var wg sync.WaitGroup
 	for i := 0; i < clientCount; i++ {
-		startMakeBroadcastClient(ctx, t, b.ListenerAddr(), i, messageCount, &wg)
+		startMakeBroadcastClient(ctx, t, config, b.ListenerAddr(), i, messageCount, &wg)
 	}
 
 	go func() {
@@ -59,24 +79,33 @@ func NewDummyTransactionStreamer() *dummyTransactionStreamer {
 	}
 }
 
-func (ts *dummyTransactionStreamer) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
-	for i, message := range messages {
-		ts.messageReceiver <- broadcaster.BroadcastFeedMessage{
-			SequenceNumber: pos + arbutil.MessageIndex(i),
-			Message:        message,
-		}
+func (ts *dummyTransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, feedMessage := range feedMessages {
+		ts.messageReceiver <- *feedMessage
 	}
 	return nil
 }
 
-func newTestBroadcastClient(listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+func newTestBroadcastClient(t *testing.T, listenerAddress net.Addr, idleTimeout time.Duration, txStreamer TransactionStreamerInterface) *BroadcastClient {
+	t.Helper()
+	config := DefaultBroadcastClientConfig
+	config.Timeout = idleTimeout
+	return newTestBroadcastClientWithConfig(t, config, listenerAddress, txStreamer)
+}
+
+func newTestBroadcastClientWithConfig(t *testing.T, config BroadcastClientConfig, listenerAddress net.Addr, txStreamer TransactionStreamerInterface) *BroadcastClient {
+	t.Helper()
 	port := listenerAddress.(*net.TCPAddr).Port
-	return NewBroadcastClient(fmt.Sprintf("ws://127.0.0.1:%d/", port), nil, idleTimeout, txStreamer)
+	client, err := NewBroadcastClient(config, fmt.Sprintf("ws://127.0.0.1:%d/", port), 0, txStreamer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
 }
 
-func startMakeBroadcastClient(ctx context.Context, t *testing.T, addr net.Addr, index int, expectedCount int, wg *sync.WaitGroup) {
+func startMakeBroadcastClient(ctx context.Context, t *testing.T, config BroadcastClientConfig, addr net.Addr, index int, expectedCount int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClientWithConfig(t, config, addr, ts)
 	broadcastClient.Start(ctx)
 	messageCount := 0
 
@@ -108,6 +137,144 @@ func startMakeBroadcastClient(ctx context.Context, t *testing.T, addr net.Addr,
 
 }
 
+func TestReceiveSignedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sequencerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, broadcaster.FeedSignerFromPrivateKey(sequencerKey))
+
+	err = b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	config := DefaultBroadcastClientConfig
+	config.SequencerAddress = crypto.PubkeyToAddress(sequencerKey.PublicKey).Hex()
+	ts := NewDummyTransactionStreamer()
+	broadcastClient := newTestBroadcastClientWithConfig(t, config, b.ListenerAddr(), ts)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	err = b.BroadcastSingle(testMessage(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+	select {
+	case receivedMsg := <-ts.messageReceiver:
+		if len(receivedMsg.Signature) == 0 {
+			t.Fatal("received message without signature")
+		}
+	case <-timer.C:
+		t.Fatal("Client did not receive signed message")
+	}
+}
+
+func TestRejectIncorrectlySignedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sequencerKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostorKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, broadcaster.FeedSignerFromPrivateKey(impostorKey))
+
+	err = b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	config := DefaultBroadcastClientConfig
+	config.SequencerAddress = crypto.PubkeyToAddress(sequencerKey.PublicKey).Hex()
+	ts := NewDummyTransactionStreamer()
+	broadcastClient := newTestBroadcastClientWithConfig(t, config, b.ListenerAddr(), ts)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	err = b.BroadcastSingle(testMessage(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	select {
+	case receivedMsg := <-ts.messageReceiver:
+		t.Fatal("Client accepted message signed by wrong key", receivedMsg.SequenceNumber)
+	case <-timer.C:
+	}
+
+	if broadcastClient.GetRetryCount() <= 0 {
+		t.Error("Client should have disconnected after receiving incorrectly signed message")
+	}
+}
+
+func TestRejectOversizedCompressedMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil)
+
+	err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	config := DefaultBroadcastClientConfig
+	config.MaxMessageSize = 4096
+	ts := NewDummyTransactionStreamer()
+	broadcastClient := newTestBroadcastClientWithConfig(t, config, b.ListenerAddr(), ts)
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	// Compresses to far less than the limit, but inflates to far more
+	msg := testMessage()
+	msg.Message.L2msg = make([]byte, 64*1024)
+	err = b.BroadcastSingle(msg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timer := time.NewTimer(2 * time.Second)
+	defer timer.Stop()
+	select {
+	case receivedMsg := <-ts.messageReceiver:
+		t.Fatal("Client accepted message larger than its maximum message size", receivedMsg.SequenceNumber)
+	case <-timer.C:
+	}
+
+	if broadcastClient.GetRetryCount() <= 0 {
+		t.Error("Client should have disconnected after receiving oversized message")
+	}
+}
+
+func testMessage() arbstate.MessageWithMetadata {
+	return arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				Kind:      arbos.L1MessageType_L2Message,
+				L1BaseFee: big.NewInt(0),
+			},
+			L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+		},
+		DelayedMessagesRead: 0,
+	}
+}
+
 func TestServerClientDisconnect(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -115,7 +282,7 @@ func TestServerClientDisconnect(t *testing.T) {
 	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
 	settings.Ping = 1 * time.Second
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -124,7 +291,7 @@ func TestServerClientDisconnect(t *testing.T) {
 	defer b.StopAndWait()
 
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(b.ListenerAddr(), 20*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, b.ListenerAddr(), 20*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	b.BroadcastSingle(arbstate.MessageWithMetadata{}, 0)
@@ -165,7 +332,7 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 	settings.Ping = 50 * time.Second
 	settings.ClientTimeout = 150 * time.Second
 
-	b1 := broadcaster.NewBroadcaster(settings)
+	b1 := broadcaster.NewBroadcaster(settings, nil)
 
 	err := b1.Start(ctx)
 	if err != nil {
@@ -173,7 +340,7 @@ func TestBroadcastClientReconnectsOnServerDisconnect(t *testing.T) {
 	}
 	defer b1.StopAndWait()
 
-	broadcastClient := newTestBroadcastClient(b1.ListenerAddr(), 2*time.Second, nil)
+	broadcastClient := newTestBroadcastClient(t, b1.ListenerAddr(), 2*time.Second, nil)
 
 	broadcastClient.Start(ctx)
 
@@ -196,7 +363,7 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 	defer cancel()
 	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
 
-	b := broadcaster.NewBroadcaster(settings)
+	b := broadcaster.NewBroadcaster(settings, nil)
 
 	err := b.Start(ctx)
 	if err != nil {
@@ -257,7 +424,7 @@ func TestBroadcasterSendsCachedMessagesOnClientConnect(t *testing.T) {
 
 func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.T, clientIndex int, wg *sync.WaitGroup) {
 	ts := NewDummyTransactionStreamer()
-	broadcastClient := newTestBroadcastClient(addr, 60*time.Second, ts)
+	broadcastClient := newTestBroadcastClient(t, addr, 60*time.Second, ts)
 	broadcastClient.Start(ctx)
 
 	go func() {
@@ -298,3 +465,45 @@ func connectAndGetCachedMessages(ctx context.Context, addr net.Addr, t *testing.
 
 	}()
 }
+
+func TestBroadcasterSendsCachedMessagesFromRequestedSequenceNumber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil)
+
+	err := b.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.StopAndWait()
+
+	for i := 0; i < 10; i++ {
+		err = b.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := NewDummyTransactionStreamer()
+	port := b.ListenerAddr().(*net.TCPAddr).Port
+	broadcastClient, err := NewBroadcastClient(DefaultBroadcastClientConfig, fmt.Sprintf("ws://127.0.0.1:%d/", port), 5, ts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broadcastClient.Start(ctx)
+	defer broadcastClient.StopAndWait()
+
+	for expected := arbutil.MessageIndex(5); expected < 10; expected++ {
+		timer := time.NewTimer(5 * time.Second)
+		select {
+		case receivedMsg := <-ts.messageReceiver:
+			if receivedMsg.SequenceNumber != expected {
+				t.Fatal("expected sequence number", expected, "got", receivedMsg.SequenceNumber)
+			}
+		case <-timer.C:
+			t.Fatal("client did not receive message", expected)
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclients
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+// Messages received from sources that are not the primary are held until the primary
+// catches up or a failover happens. Only this many are kept, highest sequence numbers are dropped first
+// since the lowest are the ones needed next.
+const maxPendingMessages = 1024
+
+// Weights used when scoring sources, a lower score is healthier.
+// One message of lag costs as much as lagPenalty of latency or staleness.
+const lagPenalty = 100 * time.Millisecond
+const errorPenalty = 1 * time.Second
+
+var failoverCounter = metrics.NewRegisteredCounter("arb/feed/failovers", nil)
+var duplicateCounter = metrics.NewRegisteredCounter("arb/feed/duplicates", nil)
+
+type sourceStats struct {
+	url          string
+	hasReceived  bool
+	lastSeqNum   arbutil.MessageIndex
+	lastReceived time.Time
+	latency      time.Duration // moving average of the delay behind the first source to deliver each message
+	messages     uint64
+}
+
+// SourceStats is a snapshot of the health of one feed source.
+type SourceStats struct {
+	URL                string
+	Primary            bool
+	HasReceived        bool
+	LastSequenceNumber arbutil.MessageIndex
+	LastReceived       time.Time
+	Lag                uint64
+	Latency            time.Duration
+	Errors             int64
+	Messages           uint64
+}
+
+// BroadcastClients connects to every configured feed URL, forwards messages from a single
+// primary source to the transaction streamer, and fails over to the healthiest other source
+// when the primary stops delivering messages while others keep advancing.
+type BroadcastClients struct {
+	stopwaiter.StopWaiter
+
+	clients    []*broadcastclient.BroadcastClient
+	txStreamer broadcastclient.TransactionStreamerInterface
+	timeout    time.Duration
+
+	// Held while passing messages to the transaction streamer, so the runs in forwardQueue stay in order.
+	// The mutex below isn't held meanwhile, so the other sources aren't blocked on the streamer.
+	forwardMutex sync.Mutex
+
+	// Protects everything below
+	mutex        sync.Mutex
+	sources      []*sourceStats
+	primary      int
+	forwarded    bool
+	nextSeqNum   arbutil.MessageIndex
+	firstSeen    map[arbutil.MessageIndex]time.Time
+	pending      map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage
+	forwardQueue [][]*broadcaster.BroadcastFeedMessage
+}
+
+// sourceRouter tags messages from one BroadcastClient with the index of its source
+type sourceRouter struct {
+	clients *BroadcastClients
+	index   int
+}
+
+func (r *sourceRouter) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	return r.clients.addMessages(r.index, feedMessages)
+}
+
+func NewBroadcastClients(config broadcastclient.BroadcastClientConfig, currentMessageCount arbutil.MessageIndex, txStreamer broadcastclient.TransactionStreamerInterface) (*BroadcastClients, error) {
+	bcs := &BroadcastClients{
+		txStreamer: txStreamer,
+		timeout:    config.Timeout,
+		firstSeen:  make(map[arbutil.MessageIndex]time.Time),
+		pending:    make(map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage),
+	}
+	for i, address := range config.URLs {
+		client, err := broadcastclient.NewBroadcastClient(config, address, currentMessageCount, &sourceRouter{bcs, i})
+		if err != nil {
+			return nil, err
+		}
+		bcs.clients = append(bcs.clients, client)
+		bcs.sources = append(bcs.sources, &sourceStats{url: address})
+	}
+	return bcs, nil
+}
+
+func (bcs *BroadcastClients) Start(ctxIn context.Context) {
+	bcs.StopWaiter.Start(ctxIn)
+	now := time.Now()
+	bcs.mutex.Lock()
+	for _, source := range bcs.sources {
+		source.lastReceived = now
+	}
+	bcs.mutex.Unlock()
+	for _, client := range bcs.clients {
+		client.Start(ctxIn)
+	}
+	checkInterval := bcs.timeout / 4
+	if checkInterval <= 0 {
+		checkInterval = time.Second
+	}
+	bcs.CallIteratively(func(ctx context.Context) time.Duration {
+		bcs.checkPrimary()
+		return checkInterval
+	})
+}
+
+func (bcs *BroadcastClients) StopAndWait() {
+	for _, client := range bcs.clients {
+		client.StopAndWait()
+	}
+	bcs.StopWaiter.StopAndWait()
+}
+
+// Primary returns the URL of the source currently being forwarded to the transaction streamer
+func (bcs *BroadcastClients) Primary() string {
+	bcs.mutex.Lock()
+	defer bcs.mutex.Unlock()
+	if len(bcs.sources) == 0 {
+		return ""
+	}
+	return bcs.sources[bcs.primary].url
+}
+
+func (bcs *BroadcastClients) Stats() []SourceStats {
+	bcs.mutex.Lock()
+	defer bcs.mutex.Unlock()
+	highest := bcs.highestSeqNumLocked()
+	stats := make([]SourceStats, 0, len(bcs.sources))
+	for i, source := range bcs.sources {
+		var lag uint64
+		if source.hasReceived {
+			lag = uint64(highest - source.lastSeqNum)
+		}
+		stats = append(stats, SourceStats{
+			URL:                source.url,
+			Primary:            i == bcs.primary,
+			HasReceived:        source.hasReceived,
+			LastSequenceNumber: source.lastSeqNum,
+			LastReceived:       source.lastReceived,
+			Lag:                lag,
+			Latency:            source.latency,
+			Errors:             bcs.clients[i].GetRetryCount(),
+			Messages:           source.messages,
+		})
+	}
+	return stats
+}
+
+func (bcs *BroadcastClients) addMessages(index int, feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	if len(feedMessages) == 0 {
+		return nil
+	}
+	bcs.mutex.Lock()
+
+	now := time.Now()
+	source := bcs.sources[index]
+	for _, msg := range feedMessages {
+		seqNum := msg.SequenceNumber
+		if first, ok := bcs.firstSeen[seqNum]; ok {
+			source.latency = (source.latency*7 + now.Sub(first)) / 8
+		} else {
+			bcs.firstSeen[seqNum] = now
+		}
+		if !source.hasReceived || seqNum > source.lastSeqNum {
+			source.lastSeqNum = seqNum
+			source.hasReceived = true
+		}
+		source.lastReceived = now
+		source.messages++
+
+		if bcs.forwarded && seqNum < bcs.nextSeqNum {
+			duplicateCounter.Inc(1)
+			continue
+		}
+		bcs.pending[seqNum] = msg
+	}
+
+	isPrimary := index == bcs.primary
+	if isPrimary {
+		bcs.forwardLocked(feedMessages[len(feedMessages)-1].SequenceNumber)
+	}
+	bcs.pruneLocked()
+	bcs.mutex.Unlock()
+
+	if isPrimary {
+		bcs.flushForwardQueue()
+	}
+	return nil
+}
+
+// forwardLocked queues all pending messages up to and including upTo for the transaction streamer,
+// split into runs of consecutive sequence numbers. The caller must call flushForwardQueue after unlocking.
+func (bcs *BroadcastClients) forwardLocked(upTo arbutil.MessageIndex) {
+	if bcs.forwarded && upTo < bcs.nextSeqNum {
+		return
+	}
+	var seqNums []arbutil.MessageIndex
+	for seqNum := range bcs.pending {
+		if seqNum <= upTo {
+			seqNums = append(seqNums, seqNum)
+		}
+	}
+	sort.Slice(seqNums, func(i, j int) bool { return seqNums[i] < seqNums[j] })
+
+	var run []*broadcaster.BroadcastFeedMessage
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		bcs.forwardQueue = append(bcs.forwardQueue, run)
+		run = nil
+	}
+	for _, seqNum := range seqNums {
+		if len(run) > 0 && run[len(run)-1].SequenceNumber+1 != seqNum {
+			flush()
+		}
+		run = append(run, bcs.pending[seqNum])
+		delete(bcs.pending, seqNum)
+	}
+	flush()
+
+	bcs.nextSeqNum = upTo + 1
+	bcs.forwarded = true
+}
+
+// flushForwardQueue passes the queued runs of messages to the transaction streamer, in order
+func (bcs *BroadcastClients) flushForwardQueue() {
+	bcs.forwardMutex.Lock()
+	defer bcs.forwardMutex.Unlock()
+	for {
+		bcs.mutex.Lock()
+		if len(bcs.forwardQueue) == 0 {
+			bcs.mutex.Unlock()
+			return
+		}
+		run := bcs.forwardQueue[0]
+		bcs.forwardQueue = bcs.forwardQueue[1:]
+		url := bcs.sources[bcs.primary].url
+		bcs.mutex.Unlock()
+
+		if err := bcs.txStreamer.AddBroadcastMessages(run); err != nil {
+			log.Error("Error adding message from Sequencer Feed", "url", url, "err", err)
+		}
+	}
+}
+
+func (bcs *BroadcastClients) pruneLocked() {
+	for seqNum := range bcs.pending {
+		if bcs.forwarded && seqNum < bcs.nextSeqNum {
+			delete(bcs.pending, seqNum)
+		}
+	}
+	if len(bcs.pending) > maxPendingMessages {
+		var seqNums []arbutil.MessageIndex
+		for seqNum := range bcs.pending {
+			seqNums = append(seqNums, seqNum)
+		}
+		sort.Slice(seqNums, func(i, j int) bool { return seqNums[i] < seqNums[j] })
+		for _, seqNum := range seqNums[maxPendingMessages:] {
+			delete(bcs.pending, seqNum)
+		}
+	}
+	if len(bcs.firstSeen) > 2*maxPendingMessages {
+		highest := bcs.highestSeqNumLocked()
+		for seqNum := range bcs.firstSeen {
+			if seqNum+maxPendingMessages < highest {
+				delete(bcs.firstSeen, seqNum)
+			}
+		}
+	}
+}
+
+func (bcs *BroadcastClients) highestSeqNumLocked() arbutil.MessageIndex {
+	var highest arbutil.MessageIndex
+	for _, source := range bcs.sources {
+		if source.hasReceived && source.lastSeqNum > highest {
+			highest = source.lastSeqNum
+		}
+	}
+	return highest
+}
+
+// scoreLocked returns a penalty for a source, lower is healthier
+func (bcs *BroadcastClients) scoreLocked(index int, highest arbutil.MessageIndex) time.Duration {
+	source := bcs.sources[index]
+	lag := time.Duration(highest - source.lastSeqNum)
+	errors := time.Duration(bcs.clients[index].GetRetryCount())
+	return lag*lagPenalty + source.latency + errors*errorPenalty + time.Since(source.lastReceived)
+}
+
+func (bcs *BroadcastClients) checkPrimary() {
+	if bcs.switchPrimary() {
+		bcs.flushForwardQueue()
+	}
+}
+
+// switchPrimary fails over from a stalled primary, and returns whether it did
+func (bcs *BroadcastClients) switchPrimary() bool {
+	bcs.mutex.Lock()
+	defer bcs.mutex.Unlock()
+
+	primary := bcs.sources[bcs.primary]
+	if time.Since(primary.lastReceived) < bcs.timeout {
+		return false
+	}
+	// The primary has stalled, but only switch if another source has advanced past it
+	highest := bcs.highestSeqNumLocked()
+	best := -1
+	for i, source := range bcs.sources {
+		if i == bcs.primary || !source.hasReceived {
+			continue
+		}
+		if primary.hasReceived && source.lastSeqNum <= primary.lastSeqNum {
+			continue
+		}
+		if best < 0 || bcs.scoreLocked(i, highest) < bcs.scoreLocked(best, highest) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	log.Warn("primary sequencer feed stalled, switching source", "from", primary.url, "to", bcs.sources[best].url, "lastSeqNum", primary.lastSeqNum, "newLastSeqNum", bcs.sources[best].lastSeqNum)
+	failoverCounter.Inc(1)
+	bcs.primary = best
+	bcs.forwardLocked(bcs.sources[best].lastSeqNum)
+	return true
+}
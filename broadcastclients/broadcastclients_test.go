@@ -0,0 +1,116 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcastclients
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/testhelpers"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+type dummyTransactionStreamer struct {
+	messageReceiver chan arbutil.MessageIndex
+}
+
+func (ts *dummyTransactionStreamer) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, feedMessage := range feedMessages {
+		ts.messageReceiver <- feedMessage.SequenceNumber
+	}
+	return nil
+}
+
+func feedURL(addr net.Addr) string {
+	return fmt.Sprintf("ws://127.0.0.1:%d/", addr.(*net.TCPAddr).Port)
+}
+
+func expectMessages(t *testing.T, ts *dummyTransactionStreamer, from arbutil.MessageIndex, to arbutil.MessageIndex) {
+	t.Helper()
+	timer := time.NewTimer(10 * time.Second)
+	defer timer.Stop()
+	for expected := from; expected <= to; expected++ {
+		select {
+		case seqNum := <-ts.messageReceiver:
+			if seqNum != expected {
+				t.Fatal("expected sequence number", expected, "got", seqNum)
+			}
+		case <-timer.C:
+			t.Fatal("timed out waiting for sequence number", expected)
+		}
+	}
+}
+
+func TestFailoverToAdvancingSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	settings := wsbroadcastserver.DefaultTestBroadcasterConfig
+	settings.Ping = 100 * time.Millisecond
+
+	b1 := broadcaster.NewBroadcaster(settings, nil)
+	Require(t, b1.Start(ctx))
+	defer b1.StopAndWait()
+	b2 := broadcaster.NewBroadcaster(settings, nil)
+	Require(t, b2.Start(ctx))
+	defer b2.StopAndWait()
+
+	config := broadcastclient.DefaultBroadcastClientConfig
+	config.URLs = []string{feedURL(b1.ListenerAddr()), feedURL(b2.ListenerAddr())}
+	config.Timeout = time.Second
+
+	ts := &dummyTransactionStreamer{make(chan arbutil.MessageIndex, 100)}
+	clients, err := NewBroadcastClients(config, 0, ts)
+	Require(t, err)
+	clients.Start(ctx)
+	defer clients.StopAndWait()
+
+	// Give both clients time to connect
+	time.Sleep(500 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		Require(t, b1.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i)))
+		Require(t, b2.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i)))
+	}
+	expectMessages(t, ts, 0, 4)
+	if clients.Primary() != config.URLs[0] {
+		Fail(t, "unexpected primary", clients.Primary())
+	}
+
+	// The primary goes quiet while the secondary keeps advancing
+	for i := 5; i < 10; i++ {
+		Require(t, b2.BroadcastSingle(arbstate.MessageWithMetadata{}, arbutil.MessageIndex(i)))
+	}
+	expectMessages(t, ts, 5, 9)
+	if clients.Primary() != config.URLs[1] {
+		Fail(t, "expected failover to second source, primary is", clients.Primary())
+	}
+
+	// Messages the new primary already delivered are not forwarded again
+	Require(t, b1.BroadcastSingle(arbstate.MessageWithMetadata{}, 9))
+	Require(t, b2.BroadcastSingle(arbstate.MessageWithMetadata{}, 10))
+	expectMessages(t, ts, 10, 10)
+	select {
+	case seqNum := <-ts.messageReceiver:
+		Fail(t, "unexpected duplicate message", seqNum)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func Require(t *testing.T, err error, printables ...interface{}) {
+	t.Helper()
+	testhelpers.RequireImpl(t, err, printables...)
+}
+
+func Fail(t *testing.T, printables ...interface{}) {
+	t.Helper()
+	testhelpers.FailImpl(t, printables...)
+}
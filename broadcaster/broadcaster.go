@@ -5,6 +5,7 @@ package broadcaster
 
 import (
 	"context"
+	"math/big"
 	"net"
 	"sync/atomic"
 	"time"
@@ -18,7 +19,8 @@ import (
 
 type Broadcaster struct {
 	server        *wsbroadcastserver.WSBroadcastServer
-	catchupBuffer *SequenceNumberCatchupBuffer
+	catchupBuffer wsbroadcastserver.CatchupBuffer
+	signer        FeedSigner // if not nil, used to sign each feed message
 }
 
 /*
@@ -42,17 +44,29 @@ type BroadcastMessage struct {
 	// TODO better name than messages since there are different types of messages
 	Messages                       []*BroadcastFeedMessage         `json:"messages,omitempty"`
 	ConfirmedSequenceNumberMessage *ConfirmedSequenceNumberMessage `json:"confirmedSequenceNumberMessage,omitempty"`
+	CatchupErrorMessage            *CatchupErrorMessage            `json:"catchupErrorMessage,omitempty"`
+	FilteredMessages               []*FilteredFeedMessage          `json:"filteredMessages,omitempty"`
 }
 
 type BroadcastFeedMessage struct {
 	SequenceNumber arbutil.MessageIndex         `json:"sequenceNumber"`
 	Message        arbstate.MessageWithMetadata `json:"message"`
+	Signature      []byte                       `json:"signature,omitempty"`
 }
 
 type ConfirmedSequenceNumberMessage struct {
 	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
 }
 
+// CatchupErrorMessage is sent to a client that asked to resume from a sequence number
+// older than anything left in the catchup buffer. The client is then sent the whole buffer,
+// and the messages in between have to come from L1.
+type CatchupErrorMessage struct {
+	RequestedSequenceNumber      arbutil.MessageIndex `json:"requestedSequenceNumber"`
+	FirstAvailableSequenceNumber arbutil.MessageIndex `json:"firstAvailableSequenceNumber"`
+	Error                        string               `json:"error"`
+}
+
 type SequenceNumberCatchupBuffer struct {
 	messages     []*BroadcastFeedMessage
 	messageCount int32
@@ -62,13 +76,53 @@ func NewSequenceNumberCatchupBuffer() *SequenceNumberCatchupBuffer {
 	return &SequenceNumberCatchupBuffer{}
 }
 
+// getCacheMessages returns the cached messages starting at requestedSeqNum, or all of them if
+// requestedSeqNum is 0. If the requested sequence number is no longer cached, all cached
+// messages are returned along with an error message for the client.
+func (b *SequenceNumberCatchupBuffer) getCacheMessages(requestedSeqNum arbutil.MessageIndex) ([]*BroadcastFeedMessage, *CatchupErrorMessage) {
+	if len(b.messages) == 0 || requestedSeqNum == 0 {
+		return b.messages, nil
+	}
+	firstCachedSeqNum := b.messages[0].SequenceNumber
+	if requestedSeqNum < firstCachedSeqNum {
+		return b.messages, &CatchupErrorMessage{
+			RequestedSequenceNumber:      requestedSeqNum,
+			FirstAvailableSequenceNumber: firstCachedSeqNum,
+			Error:                        "requested sequence number is older than the catchup buffer",
+		}
+	}
+	if requestedSeqNum-firstCachedSeqNum >= arbutil.MessageIndex(len(b.messages)) {
+		// Client is already caught up
+		return nil, nil
+	}
+	return b.messages[requestedSeqNum-firstCachedSeqNum:], nil
+}
+
+func sendCatchupError(clientConnection *wsbroadcastserver.ClientConnection, catchupErr *CatchupErrorMessage) error {
+	log.Warn("client requested sequence number no longer in catchup buffer", "client", clientConnection.Name, "requestedSeqNum", catchupErr.RequestedSequenceNumber, "firstCachedSeqNum", catchupErr.FirstAvailableSequenceNumber)
+	err := clientConnection.Write(BroadcastMessage{
+		Version:             1,
+		CatchupErrorMessage: catchupErr,
+	})
+	if err != nil {
+		log.Error("error sending client catchup error", "err", err, "client", clientConnection.Name)
+	}
+	return err
+}
+
 func (b *SequenceNumberCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
 	start := time.Now()
-	if len(b.messages) > 0 {
-		// send the newly connected client all the messages we've got...
+	messages, catchupErr := b.getCacheMessages(clientConnection.RequestedSeqNum())
+	if catchupErr != nil {
+		if err := sendCatchupError(clientConnection, catchupErr); err != nil {
+			return err
+		}
+	}
+	if len(messages) > 0 {
+		// send the newly connected client all the messages it asked for...
 		bm := BroadcastMessage{
 			Version:  1,
-			Messages: b.messages,
+			Messages: messages,
 		}
 
 		err := clientConnection.Write(bm)
@@ -146,23 +200,37 @@ func (b *SequenceNumberCatchupBuffer) GetMessageCount() int {
 	return int(atomic.LoadInt32(&b.messageCount))
 }
 
-func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig) *Broadcaster {
-	catchupBuffer := NewSequenceNumberCatchupBuffer()
+func NewBroadcaster(settings wsbroadcastserver.BroadcasterConfig, signer FeedSigner) *Broadcaster {
+	return NewBroadcasterWithCatchupBuffer(settings, signer, NewSequenceNumberCatchupBuffer())
+}
+
+// NewBroadcasterWithCatchupBuffer creates a Broadcaster that replays messages to new clients
+// from the given buffer, such as a PersistentCatchupBuffer.
+func NewBroadcasterWithCatchupBuffer(settings wsbroadcastserver.BroadcasterConfig, signer FeedSigner, catchupBuffer wsbroadcastserver.CatchupBuffer) *Broadcaster {
 	return &Broadcaster{
 		server:        wsbroadcastserver.NewWSBroadcastServer(settings, catchupBuffer),
 		catchupBuffer: catchupBuffer,
+		signer:        signer,
 	}
 }
 
-func (b *Broadcaster) BroadcastSingle(msg arbstate.MessageWithMetadata, seq arbutil.MessageIndex) {
-	var broadcastMessages []*BroadcastFeedMessage
-
+func (b *Broadcaster) BroadcastSingle(msg arbstate.MessageWithMetadata, seq arbutil.MessageIndex) error {
 	bfm := BroadcastFeedMessage{SequenceNumber: seq, Message: msg}
-	broadcastMessages = append(broadcastMessages, &bfm)
+	if b.signer != nil {
+		if err := bfm.Sign(b.signer); err != nil {
+			return err
+		}
+	}
 
+	b.BroadcastFeedMessages([]*BroadcastFeedMessage{&bfm})
+	return nil
+}
+
+// BroadcastFeedMessages sends already constructed feed messages, keeping any signatures they carry.
+func (b *Broadcaster) BroadcastFeedMessages(messages []*BroadcastFeedMessage) {
 	bm := BroadcastMessage{
 		Version:  1,
-		Messages: broadcastMessages,
+		Messages: messages,
 	}
 
 	b.server.Broadcast(bm)
@@ -178,6 +246,17 @@ func (b *Broadcaster) Confirm(seq arbutil.MessageIndex) {
 		ConfirmedSequenceNumberMessage: &ConfirmedSequenceNumberMessage{seq}})
 }
 
+// SetFeedPath makes the server refuse relays that are upstream of this one, it must be called before Start
+func (b *Broadcaster) SetFeedPath(feedPath *wsbroadcastserver.FeedPath) {
+	b.server.SetFeedPath(feedPath)
+}
+
+// EnableSubscriptionFilters lets clients subscribe to only the transactions matching a FeedFilter,
+// decoded using chainId. It must be called before Start.
+func (b *Broadcaster) EnableSubscriptionFilters(chainId *big.Int) {
+	b.server.SetClientFilterParser(feedFilterParser(chainId), feedFilterPreparer(chainId))
+}
+
 func (b *Broadcaster) ClientCount() int32 {
 	return b.server.ClientCount()
 }
@@ -5,11 +5,25 @@ package broadcaster
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gobwas/ws"
+
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/arbos/util"
 	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/testhelpers"
 	"github.com/offchainlabs/nitro/wsbroadcastserver"
 )
@@ -57,7 +71,7 @@ func TestBroadcasterMessagesRemovedOnConfirmation(t *testing.T) {
 
 	broadcasterSettings := wsbroadcastserver.DefaultTestBroadcasterConfig
 
-	b := NewBroadcaster(broadcasterSettings)
+	b := NewBroadcaster(broadcasterSettings, nil)
 	Require(t, b.Start(ctx))
 	defer b.StopAndWait()
 
@@ -119,6 +133,181 @@ func TestBroadcasterMessagesRemovedOnConfirmation(t *testing.T) {
 
 }
 
+func TestBroadcastFeedMessageSignature(t *testing.T) {
+	privateKey, err := crypto.GenerateKey()
+	Require(t, err)
+	signer := FeedSignerFromPrivateKey(privateKey)
+	signerAddr := crypto.PubkeyToAddress(privateKey.PublicKey)
+
+	msg := &BroadcastFeedMessage{
+		SequenceNumber: 42,
+		Message: arbstate.MessageWithMetadata{
+			Message: &arbos.L1IncomingMessage{
+				Header: &arbos.L1IncomingMessageHeader{
+					Kind:      arbos.L1MessageType_L2Message,
+					L1BaseFee: big.NewInt(0),
+				},
+				L2msg: []byte{0xde, 0xad, 0xbe, 0xef},
+			},
+			DelayedMessagesRead: 1,
+		},
+	}
+
+	if _, err := msg.RecoverSigner(); !errors.Is(err, ErrMissingFeedSignature) {
+		Fail(t, "expected missing signature error, got", err)
+	}
+
+	Require(t, msg.Sign(signer))
+	recovered, err := msg.RecoverSigner()
+	Require(t, err)
+	if recovered != signerAddr {
+		Fail(t, "recovered signer", recovered, "expected", signerAddr)
+	}
+
+	msg.SequenceNumber++
+	recovered, err = msg.RecoverSigner()
+	if err == nil && recovered == signerAddr {
+		Fail(t, "signature still valid after changing sequence number")
+	}
+}
+
+func TestPersistentCatchupBufferSurvivesRestart(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	db := rawdb.NewMemoryDatabase()
+	catchupBuffer, err := NewPersistentCatchupBuffer(db, time.Hour)
+	Require(t, err)
+	b := NewBroadcasterWithCatchupBuffer(wsbroadcastserver.DefaultTestBroadcasterConfig, nil, catchupBuffer)
+	Require(t, b.Start(ctx))
+
+	dummyMessage := arbstate.MessageWithMetadata{}
+	expectMessageCount := func(count int, contextMessage string) predicate {
+		return &messageCountPredicate{b, count, contextMessage, 0}
+	}
+	for i := 1; i <= 4; i++ {
+		Require(t, b.BroadcastSingle(dummyMessage, arbutil.MessageIndex(i)))
+	}
+	waitUntilUpdated(t, expectMessageCount(4, "after 4 messages"))
+
+	// Confirmed messages are kept until they fall out of the retention window
+	b.Confirm(3)
+	Require(t, b.BroadcastSingle(dummyMessage, 5))
+	waitUntilUpdated(t, expectMessageCount(5, "after confirming 3 of 5 messages"))
+	b.StopAndWait()
+
+	restarted, err := NewPersistentCatchupBuffer(db, time.Hour)
+	Require(t, err)
+	if restarted.GetMessageCount() != 5 {
+		Fail(t, "expected 5 messages after restart, got", restarted.GetMessageCount())
+	}
+	if restarted.firstSeqNum != 1 || restarted.nextSeqNum != 6 {
+		Fail(t, "unexpected range after restart", restarted.firstSeqNum, restarted.nextSeqNum)
+	}
+
+	// A gap in sequence numbers discards everything before it
+	Require(t, restarted.OnDoBroadcast(BroadcastMessage{Version: 1, Messages: []*BroadcastFeedMessage{{SequenceNumber: 10}}}))
+	if restarted.GetMessageCount() != 1 || restarted.firstSeqNum != 10 {
+		Fail(t, "expected only message 10 after gap, got", restarted.GetMessageCount(), "starting at", restarted.firstSeqNum)
+	}
+
+	// Everything is older than a negative retention window
+	restarted.retention = -time.Hour
+	Require(t, restarted.prune())
+	restarted.updateMessageCount()
+	if restarted.GetMessageCount() != 0 {
+		Fail(t, "expected empty buffer after pruning, got", restarted.GetMessageCount())
+	}
+	iter := db.NewIterator(catchupMessagePrefix, nil)
+	defer iter.Release()
+	if iter.Next() {
+		Fail(t, "pruned message still in database")
+	}
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	defer cancelFunc()
+
+	config := wsbroadcastserver.DefaultTestBroadcasterConfig
+	config.MaxFilteredClients = 1
+	b := NewBroadcaster(config, nil)
+	b.EnableSubscriptionFilters(big.NewInt(412346))
+	Require(t, b.Start(ctx))
+	defer b.StopAndWait()
+
+	poster := common.HexToAddress("0x1234")
+	requestId := common.HexToHash("0x5678")
+	heartbeat := arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				Kind:      arbos.L1MessageType_L2Message,
+				Poster:    poster,
+				L1BaseFee: big.NewInt(0),
+			},
+			L2msg: []byte{arbos.L2MessageKind_Heartbeat},
+		},
+	}
+	deposit := arbstate.MessageWithMetadata{
+		Message: &arbos.L1IncomingMessage{
+			Header: &arbos.L1IncomingMessageHeader{
+				Kind:      arbos.L1MessageType_EthDeposit,
+				Poster:    poster,
+				RequestId: &requestId,
+				L1BaseFee: big.NewInt(0),
+			},
+			L2msg: common.BigToHash(big.NewInt(1e18)).Bytes(),
+		},
+	}
+	Require(t, b.BroadcastSingle(heartbeat, 0))
+	Require(t, b.BroadcastSingle(deposit, 1))
+	waitUntilUpdated(t, &messageCountPredicate{b, 2, "after 2 messages", 0})
+
+	filter, err := json.Marshal(FeedFilter{Kinds: []uint8{arbos.L1MessageType_EthDeposit}})
+	Require(t, err)
+	dialer := ws.Dialer{
+		Header: ws.HandshakeHeaderHTTP(http.Header{wsbroadcastserver.HTTPHeaderFeedFilter: []string{string(filter)}}),
+	}
+	port := b.ListenerAddr().(*net.TCPAddr).Port
+	conn, br, _, err := dialer.Dial(ctx, fmt.Sprintf("ws://127.0.0.1:%d/", port))
+	Require(t, err)
+	defer conn.Close()
+	var earlyFrameData io.Reader
+	if br != nil {
+		earlyFrameData = io.LimitReader(br, int64(br.Buffered()))
+	}
+	data, _, err := wsbroadcastserver.ReadData(ctx, conn, earlyFrameData, 5*time.Second, ws.StateClientSide, false, 0)
+	Require(t, err)
+
+	var received BroadcastMessage
+	Require(t, json.Unmarshal(data, &received))
+	if len(received.Messages) != 0 {
+		Fail(t, "filtered subscriber received full feed messages")
+	}
+	if len(received.FilteredMessages) != 2 {
+		Fail(t, "expected an entry for every sequence number, got", len(received.FilteredMessages))
+	}
+	if received.FilteredMessages[0].SequenceNumber != 0 || len(received.FilteredMessages[0].Transactions) != 0 {
+		Fail(t, "heartbeat should not match the filter", received.FilteredMessages[0])
+	}
+	depositEntry := received.FilteredMessages[1]
+	if depositEntry.SequenceNumber != 1 || depositEntry.Kind != arbos.L1MessageType_EthDeposit || len(depositEntry.Transactions) != 1 {
+		Fail(t, "deposit should match the filter", depositEntry)
+	}
+	if to := depositEntry.Transactions[0].To(); to == nil || *to != util.RemapL1Address(poster) {
+		Fail(t, "unexpected deposit recipient", to)
+	}
+
+	// Filtered subscriptions are capped, unfiltered ones aren't
+	if conn2, _, _, err := dialer.Dial(ctx, fmt.Sprintf("ws://127.0.0.1:%d/", port)); err == nil {
+		conn2.Close()
+		Fail(t, "filtered subscription allowed past max-filtered-clients")
+	}
+	conn3, _, _, err := ws.Dialer{}.Dial(ctx, fmt.Sprintf("ws://127.0.0.1:%d/", port))
+	Require(t, err)
+	conn3.Close()
+}
+
 func Require(t *testing.T, err error, printables ...interface{}) {
 	t.Helper()
 	testhelpers.RequireImpl(t, err, printables...)
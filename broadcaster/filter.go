@@ -0,0 +1,189 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+// FeedFilter is the subscription a client sends, as json, in the
+// wsbroadcastserver.HTTPHeaderFeedFilter header. Empty lists match everything.
+type FeedFilter struct {
+	From  []common.Address `json:"from,omitempty"`
+	To    []common.Address `json:"to,omitempty"`
+	Kinds []uint8          `json:"kinds,omitempty"` // arbos.L1MessageType_* values
+}
+
+// FilteredFeedMessage is sent to filtered subscribers for every message in the feed, so they
+// can detect gaps. Transactions only holds the decoded transactions matching the filter.
+// It isn't signed: the sequencer's signature covers the whole message, so a subscriber
+// can't check it without the transactions left out. Clients that verify feed signatures
+// must subscribe to the full feed.
+type FilteredFeedMessage struct {
+	SequenceNumber arbutil.MessageIndex `json:"sequenceNumber"`
+	Kind           uint8                `json:"kind"`
+	Transactions   []*types.Transaction `json:"transactions,omitempty"`
+}
+
+type feedFilter struct {
+	key    string
+	signer types.Signer
+	from   map[common.Address]bool
+	to     map[common.Address]bool
+	kinds  map[uint8]bool
+}
+
+// preparedBroadcastMessage is a BroadcastMessage with its transactions decoded once for every filter.
+// It's only used from one thread at a time, so the decoding is done lazily without locking.
+type preparedBroadcastMessage struct {
+	bm       BroadcastMessage
+	messages []*preparedFeedMessage
+}
+
+type preparedFeedMessage struct {
+	msg     *BroadcastFeedMessage
+	chainId *big.Int
+	parsed  bool
+	txs     []*types.Transaction
+}
+
+// transactions decodes the message's transactions the first time it's called.
+// Their senders are cached in the transactions, so each is also recovered once.
+func (p *preparedFeedMessage) transactions() []*types.Transaction {
+	if p.parsed {
+		return p.txs
+	}
+	p.parsed = true
+	// Feed messages aren't tied to a state, so they're parsed as the latest ArbOS version would
+	txs, err := p.msg.Message.Message.ParseL2Transactions(p.chainId, math.MaxUint64)
+	if err != nil {
+		log.Debug("unable to parse feed message for filtered subscriber", "seqNum", p.msg.SequenceNumber, "err", err)
+		return nil
+	}
+	p.txs = txs
+	return txs
+}
+
+func feedFilterPreparer(chainId *big.Int) wsbroadcastserver.ClientFilterPreparer {
+	return func(bmi interface{}) interface{} {
+		bm, ok := bmi.(BroadcastMessage)
+		if !ok {
+			return bmi
+		}
+		prepared := &preparedBroadcastMessage{bm: bm}
+		for _, msg := range bm.Messages {
+			prepared.messages = append(prepared.messages, &preparedFeedMessage{msg: msg, chainId: chainId})
+		}
+		return prepared
+	}
+}
+
+func feedFilterParser(chainId *big.Int) wsbroadcastserver.ClientFilterParser {
+	return func(filterJson string) (wsbroadcastserver.ClientFilter, error) {
+		var config FeedFilter
+		if err := json.Unmarshal([]byte(filterJson), &config); err != nil {
+			return nil, err
+		}
+		return newFeedFilter(config, chainId)
+	}
+}
+
+func newFeedFilter(config FeedFilter, chainId *big.Int) (*feedFilter, error) {
+	// the key is the filter re-encoded, so formatting doesn't keep equal filters apart
+	key, err := json.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	f := &feedFilter{
+		key:    string(key),
+		signer: types.LatestSignerForChainID(chainId),
+	}
+	if len(config.From) > 0 {
+		f.from = make(map[common.Address]bool)
+		for _, addr := range config.From {
+			f.from[addr] = true
+		}
+	}
+	if len(config.To) > 0 {
+		f.to = make(map[common.Address]bool)
+		for _, addr := range config.To {
+			f.to[addr] = true
+		}
+	}
+	if len(config.Kinds) > 0 {
+		f.kinds = make(map[uint8]bool)
+		for _, kind := range config.Kinds {
+			f.kinds[kind] = true
+		}
+	}
+	return f, nil
+}
+
+func (f *feedFilter) Key() string {
+	return f.key
+}
+
+func (f *feedFilter) matchesTx(tx *types.Transaction) bool {
+	if f.to != nil {
+		if tx.To() == nil || !f.to[*tx.To()] {
+			return false
+		}
+	}
+	if f.from != nil {
+		sender, err := types.Sender(f.signer, tx)
+		if err != nil || !f.from[sender] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *feedFilter) filterFeedMessage(prepared *preparedFeedMessage) *FilteredFeedMessage {
+	msg := prepared.msg
+	filtered := &FilteredFeedMessage{SequenceNumber: msg.SequenceNumber}
+	l1Message := msg.Message.Message
+	if l1Message == nil || l1Message.Header == nil {
+		return filtered
+	}
+	filtered.Kind = l1Message.Header.Kind
+	if f.kinds != nil && !f.kinds[filtered.Kind] {
+		return filtered
+	}
+	for _, tx := range prepared.transactions() {
+		if f.matchesTx(tx) {
+			filtered.Transactions = append(filtered.Transactions, tx)
+		}
+	}
+	return filtered
+}
+
+// FilterMessage takes a BroadcastMessage prepared by feedFilterPreparer
+func (f *feedFilter) FilterMessage(preparedi interface{}) (interface{}, bool) {
+	prepared, ok := preparedi.(*preparedBroadcastMessage)
+	if !ok {
+		return nil, false
+	}
+	bm := prepared.bm
+	filtered := BroadcastMessage{
+		Version:                        bm.Version,
+		ConfirmedSequenceNumberMessage: bm.ConfirmedSequenceNumberMessage,
+		CatchupErrorMessage:            bm.CatchupErrorMessage,
+	}
+	for _, msg := range prepared.messages {
+		filtered.FilteredMessages = append(filtered.FilteredMessages, f.filterFeedMessage(msg))
+	}
+	if len(filtered.FilteredMessages) == 0 && filtered.ConfirmedSequenceNumberMessage == nil && filtered.CatchupErrorMessage == nil {
+		return nil, false
+	}
+	return filtered, true
+}
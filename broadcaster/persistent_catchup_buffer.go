@@ -0,0 +1,336 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+var (
+	catchupMessagePrefix  []byte = []byte("m")            // maps a sequence number to a persistedFeedMessage
+	catchupFirstSeqNumKey []byte = []byte("_firstSeqNum") // contains the sequence number of the first stored message
+	catchupNextSeqNumKey  []byte = []byte("_nextSeqNum")  // contains the sequence number after the last stored message
+)
+
+// Maximum number of stored messages sent to a client in one BroadcastMessage
+const persistentCatchupBatchSize = 1000
+
+// Minimum time between scans for expired messages
+const catchupPruneInterval = time.Minute
+
+type persistedFeedMessage struct {
+	Timestamp int64                 `json:"timestamp"`
+	Message   *BroadcastFeedMessage `json:"message"`
+}
+
+// PersistentCatchupBuffer is a CatchupBuffer that keeps feed messages in a key-value store
+// instead of memory. Messages stay in the buffer for the retention window even after
+// they are confirmed, so a restarted relay can still serve clients that are far behind.
+//
+// Like SequenceNumberCatchupBuffer, its fields are only accessed from the ClientManager thread.
+// The backlog of a new client is read from the database on the client's own thread, though,
+// so a client that's far behind doesn't hold up broadcasts to the others.
+type PersistentCatchupBuffer struct {
+	db        ethdb.Database
+	retention time.Duration
+
+	firstSeqNum  arbutil.MessageIndex
+	nextSeqNum   arbutil.MessageIndex // firstSeqNum == nextSeqNum means the buffer is empty
+	lastPrune    time.Time
+	messageCount int32
+}
+
+func NewPersistentCatchupBuffer(db ethdb.Database, retention time.Duration) (*PersistentCatchupBuffer, error) {
+	b := &PersistentCatchupBuffer{
+		db:        db,
+		retention: retention,
+	}
+	has, err := b.db.Has(catchupFirstSeqNumKey)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return b, nil
+	}
+	b.firstSeqNum, err = b.readSeqNum(catchupFirstSeqNumKey)
+	if err != nil {
+		return nil, err
+	}
+	b.nextSeqNum, err = b.readSeqNum(catchupNextSeqNumKey)
+	if err != nil {
+		return nil, err
+	}
+	if b.nextSeqNum < b.firstSeqNum {
+		log.Warn("persistent catchup buffer is inconsistent, clearing it", "first", b.firstSeqNum, "next", b.nextSeqNum)
+		if err := b.clear(); err != nil {
+			return nil, err
+		}
+	}
+	b.updateMessageCount()
+	log.Info("loaded persistent catchup buffer", "first", b.firstSeqNum, "next", b.nextSeqNum)
+	return b, nil
+}
+
+func catchupMessageKey(seqNum arbutil.MessageIndex) []byte {
+	key := make([]byte, len(catchupMessagePrefix)+8)
+	copy(key, catchupMessagePrefix)
+	binary.BigEndian.PutUint64(key[len(catchupMessagePrefix):], uint64(seqNum))
+	return key
+}
+
+func (b *PersistentCatchupBuffer) readSeqNum(key []byte) (arbutil.MessageIndex, error) {
+	data, err := b.db.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, errors.New("invalid catchup buffer sequence number")
+	}
+	return arbutil.MessageIndex(binary.BigEndian.Uint64(data)), nil
+}
+
+func putSeqNum(batch ethdb.KeyValueWriter, key []byte, seqNum arbutil.MessageIndex) error {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(seqNum))
+	return batch.Put(key, data[:])
+}
+
+func (b *PersistentCatchupBuffer) updateMessageCount() {
+	atomic.StoreInt32(&b.messageCount, int32(b.nextSeqNum-b.firstSeqNum))
+}
+
+func (b *PersistentCatchupBuffer) empty() bool {
+	return b.firstSeqNum == b.nextSeqNum
+}
+
+// clear deletes every stored message
+func (b *PersistentCatchupBuffer) clear() error {
+	batch := b.db.NewBatch()
+	iter := b.db.NewIterator(catchupMessagePrefix, nil)
+	defer iter.Release()
+	for iter.Next() {
+		if err := batch.Delete(iter.Key()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := batch.Delete(catchupFirstSeqNumKey); err != nil {
+		return err
+	}
+	if err := batch.Delete(catchupNextSeqNumKey); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	b.firstSeqNum = 0
+	b.nextSeqNum = 0
+	return nil
+}
+
+func (b *PersistentCatchupBuffer) OnRegisterClient(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection) error {
+	startSeqNum := b.firstSeqNum
+	requestedSeqNum := clientConnection.RequestedSeqNum()
+	if requestedSeqNum != 0 && !b.empty() {
+		if requestedSeqNum < b.firstSeqNum {
+			err := sendCatchupError(clientConnection, &CatchupErrorMessage{
+				RequestedSequenceNumber:      requestedSeqNum,
+				FirstAvailableSequenceNumber: b.firstSeqNum,
+				Error:                        "requested sequence number is older than the catchup buffer",
+			})
+			if err != nil {
+				return err
+			}
+		} else {
+			startSeqNum = requestedSeqNum
+		}
+	}
+
+	// The backlog can be hours of messages, so it's streamed from the client's own thread instead of this one.
+	// Everything broadcast from now on is queued for the client, so the backlog ends where the buffer ends now.
+	// A client that takes longer than max-send-queue broadcasts to catch up is disconnected like any backed up client.
+	endSeqNum := b.nextSeqNum
+	if startSeqNum < endSeqNum {
+		clientConnection.SetCatchup(func(ctx context.Context) error {
+			return b.sendStoredMessages(ctx, clientConnection, startSeqNum, endSeqNum)
+		})
+	} else {
+		log.Info("client registered", "client", clientConnection.Name, "sent", 0)
+	}
+	return nil
+}
+
+// sendStoredMessages sends the client the stored messages from startSeqNum up to but excluding endSeqNum.
+// It only reads the database, so it's safe to call from other threads than the ClientManager's.
+func (b *PersistentCatchupBuffer) sendStoredMessages(ctx context.Context, clientConnection *wsbroadcastserver.ClientConnection, startSeqNum, endSeqNum arbutil.MessageIndex) error {
+	start := time.Now()
+	sent := 0
+	iter := b.db.NewIterator(catchupMessagePrefix, catchupMessageKey(startSeqNum)[len(catchupMessagePrefix):])
+	defer iter.Release()
+	var messages []*BroadcastFeedMessage
+	flush := func() error {
+		if len(messages) == 0 {
+			return nil
+		}
+		err := clientConnection.Write(BroadcastMessage{
+			Version:  1,
+			Messages: messages,
+		})
+		sent += len(messages)
+		messages = nil
+		if err != nil {
+			log.Error("error sending client cached messages", "err", err, "client", clientConnection.Name, "elapsed", time.Since(start))
+		}
+		return err
+	}
+	for iter.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var persisted persistedFeedMessage
+		if err := json.Unmarshal(iter.Value(), &persisted); err != nil {
+			return err
+		}
+		if persisted.Message.SequenceNumber >= endSeqNum {
+			break
+		}
+		messages = append(messages, persisted.Message)
+		if len(messages) >= persistentCatchupBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	log.Info("client registered", "client", clientConnection.Name, "sent", sent, "elapsed", time.Since(start))
+	return nil
+}
+
+func (b *PersistentCatchupBuffer) OnDoBroadcast(bmi interface{}) error {
+	broadcastMessage, ok := bmi.(BroadcastMessage)
+	if !ok {
+		log.Crit("Requested to broadcast messasge of unknown type")
+	}
+	defer b.updateMessageCount()
+
+	// Confirmations don't remove messages, they expire after the retention window instead
+	if len(broadcastMessage.Messages) > 0 {
+		if err := b.addMessages(broadcastMessage.Messages); err != nil {
+			return err
+		}
+	}
+
+	if time.Since(b.lastPrune) >= catchupPruneInterval {
+		b.lastPrune = time.Now()
+		return b.prune()
+	}
+	return nil
+}
+
+func (b *PersistentCatchupBuffer) addMessages(newMessages []*BroadcastFeedMessage) error {
+	now := time.Now().Unix()
+	batch := b.db.NewBatch()
+	for _, newMsg := range newMessages {
+		if !b.empty() && newMsg.SequenceNumber < b.nextSeqNum {
+			log.Info("Skipping already seen message", "seqNum", newMsg.SequenceNumber)
+			continue
+		}
+		if !b.empty() && newMsg.SequenceNumber > b.nextSeqNum {
+			log.Warn(
+				"Message requested to be broadcast has unexpected sequence number; discarding to seqNum from catchup buffer",
+				"seqNum", newMsg.SequenceNumber,
+				"expectedSeqNum", b.nextSeqNum,
+			)
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+			if err := b.clear(); err != nil {
+				return err
+			}
+		}
+		if b.empty() {
+			b.firstSeqNum = newMsg.SequenceNumber
+			b.nextSeqNum = newMsg.SequenceNumber
+			if err := putSeqNum(batch, catchupFirstSeqNumKey, b.firstSeqNum); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(persistedFeedMessage{Timestamp: now, Message: newMsg})
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(catchupMessageKey(newMsg.SequenceNumber), data); err != nil {
+			return err
+		}
+		b.nextSeqNum = newMsg.SequenceNumber + 1
+	}
+	if err := putSeqNum(batch, catchupNextSeqNumKey, b.nextSeqNum); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// prune deletes messages older than the retention window, oldest first
+func (b *PersistentCatchupBuffer) prune() error {
+	if b.empty() {
+		return nil
+	}
+	cutoff := time.Now().Add(-b.retention).Unix()
+	batch := b.db.NewBatch()
+	iter := b.db.NewIterator(catchupMessagePrefix, nil)
+	defer iter.Release()
+	newFirst := b.firstSeqNum
+	for iter.Next() && newFirst < b.nextSeqNum {
+		var persisted persistedFeedMessage
+		if err := json.Unmarshal(iter.Value(), &persisted); err != nil {
+			return err
+		}
+		if persisted.Timestamp >= cutoff {
+			break
+		}
+		if err := batch.Delete(iter.Key()); err != nil {
+			return err
+		}
+		newFirst = persisted.Message.SequenceNumber + 1
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if newFirst == b.firstSeqNum {
+		return nil
+	}
+	if err := putSeqNum(batch, catchupFirstSeqNumKey, newFirst); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Debug("pruned persistent catchup buffer", "removed", newFirst-b.firstSeqNum)
+	b.firstSeqNum = newFirst
+	return nil
+}
+
+func (b *PersistentCatchupBuffer) GetMessageCount() int {
+	return int(atomic.LoadInt32(&b.messageCount))
+}
@@ -0,0 +1,86 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package broadcaster
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var feedSigningPrefix = []byte("Arbitrum Nitro Feed Message:")
+
+var ErrMissingFeedSignature = errors.New("feed message is missing signature")
+
+type FeedSigner func([]byte) ([]byte, error) // takes 32-byte array (hash of data) and produces signature bytes (and/or error)
+
+func FeedSignerFromPrivateKey(privateKey *ecdsa.PrivateKey) FeedSigner {
+	return func(data []byte) ([]byte, error) {
+		return crypto.Sign(data, privateKey)
+	}
+}
+
+// LoadFeedSigningKey accepts either a hex encoded private key or a path to a file containing one.
+func LoadFeedSigningKey(keyConfig string) (*ecdsa.PrivateKey, error) {
+	if keyConfig == "" {
+		return nil, nil
+	}
+	if key, err := crypto.HexToECDSA(strings.TrimPrefix(keyConfig, "0x")); err == nil {
+		return key, nil
+	}
+	contents, err := ioutil.ReadFile(keyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed signing key file: %w", err)
+	}
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(string(contents)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("feed signing key file contents are not a valid private key: %w", err)
+	}
+	return key, nil
+}
+
+// SignatureHash is the hash the sequencer signs, covering the sequence number and the message hash.
+func (m *BroadcastFeedMessage) SignatureHash() (common.Hash, error) {
+	msgHash, err := m.Message.Hash()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var seqNumBytes [8]byte
+	binary.BigEndian.PutUint64(seqNumBytes[:], uint64(m.SequenceNumber))
+	return crypto.Keccak256Hash(feedSigningPrefix, seqNumBytes[:], msgHash[:]), nil
+}
+
+func (m *BroadcastFeedMessage) Sign(signer FeedSigner) error {
+	hash, err := m.SignatureHash()
+	if err != nil {
+		return err
+	}
+	sig, err := signer(hash[:])
+	if err != nil {
+		return err
+	}
+	m.Signature = sig
+	return nil
+}
+
+func (m *BroadcastFeedMessage) RecoverSigner() (common.Address, error) {
+	if len(m.Signature) == 0 {
+		return common.Address{}, ErrMissingFeedSignature
+	}
+	hash, err := m.SignatureHash()
+	if err != nil {
+		return common.Address{}, err
+	}
+	pk, err := crypto.SigToPub(hash[:], m.Signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pk), nil
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/ethereum/go-ethereum/log"
 	koanfjson "github.com/knadh/koanf/parsers/json"
@@ -74,7 +75,7 @@ func startup() error {
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 
-	storage, err := das.NewLocalFileStorageService(serverConfig.StorageDir)
+	storage, err := das.NewLocalFileStorageService(context.Background(), das.LocalFileStorageConfig{DataDir: serverConfig.StorageDir})
 	if err != nil {
 		return err
 	}
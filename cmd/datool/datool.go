@@ -7,25 +7,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/offchainlabs/nitro/blsSignatures"
 	"github.com/offchainlabs/nitro/cmd/genericconf"
 
 	"github.com/offchainlabs/nitro/cmd/util"
 	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/das/dasrpc"
+	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
 	flag "github.com/spf13/pflag"
 )
 
 func main() {
 	args := os.Args
 	if len(args) < 2 {
-		panic("Usage: datool [client|keygen] ...")
+		panic("Usage: datool [client|keygen|keyset] ...")
 	}
 
 	var err error
@@ -34,8 +38,10 @@ func main() {
 		err = startClient(args[2:])
 	case "keygen":
 		err = startKeyGen(args[2:])
+	case "keyset":
+		err = startKeyset(args[2:])
 	default:
-		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'client', 'keygen'", args[1]))
+		panic(fmt.Sprintf("Unknown tool '%s' specified, valid tools are 'client', 'keygen', 'keyset'", args[1]))
 	}
 	if err != nil {
 		panic(err)
@@ -284,3 +290,140 @@ func startKeyGen(args []string) error {
 	}
 	return nil
 }
+
+// datool keyset ...
+
+func startKeyset(args []string) error {
+	if len(args) == 0 {
+		return errors.New("datool keyset needs an argument, valid arguments are 'build' and 'invalidate'")
+	}
+	switch strings.ToLower(args[0]) {
+	case "build":
+		return startKeysetBuild(args[1:])
+	case "invalidate":
+		return startKeysetInvalidate(args[1:])
+	}
+	return fmt.Errorf("datool keyset '%s' not supported, valid arguments are 'build' and 'invalidate'", args[0])
+}
+
+// datool keyset build
+
+type KeysetBuildConfig struct {
+	AssumedHonest int                     `koanf:"assumed-honest"`
+	PubKeys       []string                `koanf:"pubkeys"`
+	PubKeyFiles   []string                `koanf:"pubkey-files"`
+	ErasureCoding das.ErasureCodingConfig `koanf:"erasure-coding"`
+	ConfConfig    genericconf.ConfConfig  `koanf:"conf"`
+}
+
+func parseKeysetBuildConfig(args []string) (*KeysetBuildConfig, error) {
+	f := flag.NewFlagSet("datool keyset build", flag.ContinueOnError)
+	f.Int("assumed-honest", 1, "Number of assumed honest backends (H)")
+	f.StringSlice("pubkeys", []string{}, "base64 encoded BLS public keys of the backends, in the order of their signersMask bits")
+	f.StringSlice("pubkey-files", []string{}, "files holding the BLS public keys of the backends, in the order of their signersMask bits; used instead of --pubkeys")
+	das.ErasureCodingConfigAddOptions("erasure-coding", f)
+	genericconf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config KeysetBuildConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func startKeysetBuild(args []string) error {
+	config, err := parseKeysetBuildConfig(args)
+	if err != nil {
+		return err
+	}
+	if (len(config.PubKeys) == 0) == (len(config.PubKeyFiles) == 0) {
+		return errors.New("exactly one of --pubkeys and --pubkey-files must be given")
+	}
+
+	var pubKeys []blsSignatures.PublicKey
+	for _, encoded := range config.PubKeys {
+		pubKey, err := das.DecodeBase64BLSPublicKey([]byte(encoded))
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, *pubKey)
+	}
+	for _, path := range config.PubKeyFiles {
+		pubKey, err := das.ReadPubKeyFromFile(path)
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, *pubKey)
+	}
+
+	keysetBytes, keysetHash, err := das.KeysetFromPubKeys(config.AssumedHonest, config.ErasureCoding, pubKeys)
+	if err != nil {
+		return err
+	}
+	seqInboxABI, err := bridgegen.SequencerInboxMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	calldata, err := seqInboxABI.Pack("setValidKeyset", keysetBytes)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Keyset: %s\n", hexutil.Encode(keysetBytes))
+	fmt.Printf("KeysetHash: %s\n", hexutil.Encode(keysetHash[:]))
+	fmt.Printf("SetValidKeyset calldata for the Sequencer Inbox: %s\n", hexutil.Encode(calldata))
+	return nil
+}
+
+// datool keyset invalidate
+
+type KeysetInvalidateConfig struct {
+	KeysetHash string                 `koanf:"keyset-hash"`
+	ConfConfig genericconf.ConfConfig `koanf:"conf"`
+}
+
+func parseKeysetInvalidateConfig(args []string) (*KeysetInvalidateConfig, error) {
+	f := flag.NewFlagSet("datool keyset invalidate", flag.ContinueOnError)
+	f.String("keyset-hash", "", "hex encoded hash of the keyset to invalidate")
+	genericconf.ConfConfigAddOptions("conf", f)
+
+	k, err := util.BeginCommonParse(f, args)
+	if err != nil {
+		return nil, err
+	}
+
+	var config KeysetInvalidateConfig
+	if err := util.EndCommonParse(k, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func startKeysetInvalidate(args []string) error {
+	config, err := parseKeysetInvalidateConfig(args)
+	if err != nil {
+		return err
+	}
+	decodedHash, err := hexutil.Decode(config.KeysetHash)
+	if err != nil {
+		return err
+	}
+	if len(decodedHash) != common.HashLength {
+		return fmt.Errorf("keyset hash has length %d, expected %d", len(decodedHash), common.HashLength)
+	}
+	seqInboxABI, err := bridgegen.SequencerInboxMetaData.GetAbi()
+	if err != nil {
+		return err
+	}
+	calldata, err := seqInboxABI.Pack("invalidateKeysetHash", common.BytesToHash(decodedHash))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("InvalidateKeysetHash calldata for the Sequencer Inbox: %s\n", hexutil.Encode(calldata))
+	return nil
+}
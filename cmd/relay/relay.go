@@ -5,7 +5,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"os"
 	"os/signal"
@@ -65,19 +67,27 @@ func startup() error {
 	log.Info("Running Arbitrum nitro relay", "revision", vcsRevision, "vcs.time", vcsTime)
 
 	serverConf := wsbroadcastserver.BroadcasterConfig{
-		Addr:          relayConfig.Node.Feed.Output.Addr,
-		IOTimeout:     relayConfig.Node.Feed.Output.IOTimeout,
-		Port:          relayConfig.Node.Feed.Output.Port,
-		Ping:          relayConfig.Node.Feed.Output.Ping,
-		ClientTimeout: relayConfig.Node.Feed.Output.ClientTimeout,
-		Queue:         relayConfig.Node.Feed.Output.Queue,
-		Workers:       relayConfig.Node.Feed.Output.Workers,
-		MaxSendQueue:  relayConfig.Node.Feed.Output.MaxSendQueue,
+		Addr:                 relayConfig.Node.Feed.Output.Addr,
+		IOTimeout:            relayConfig.Node.Feed.Output.IOTimeout,
+		Port:                 relayConfig.Node.Feed.Output.Port,
+		Ping:                 relayConfig.Node.Feed.Output.Ping,
+		ClientTimeout:        relayConfig.Node.Feed.Output.ClientTimeout,
+		Queue:                relayConfig.Node.Feed.Output.Queue,
+		Workers:              relayConfig.Node.Feed.Output.Workers,
+		MaxSendQueue:         relayConfig.Node.Feed.Output.MaxSendQueue,
+		EnableCompression:    relayConfig.Node.Feed.Output.EnableCompression,
+		CatchupBuffer:        relayConfig.Node.Feed.Output.CatchupBuffer,
+		EnableFilters:        relayConfig.Node.Feed.Output.EnableFilters,
+		MaxFilteredClients:   relayConfig.Node.Feed.Output.MaxFilteredClients,
+		MaxClientMessageSize: relayConfig.Node.Feed.Output.MaxClientMessageSize,
 	}
 
 	clientConf := broadcastclient.BroadcastClientConfig{
-		Timeout: relayConfig.Node.Feed.Input.Timeout,
-		URLs:    relayConfig.Node.Feed.Input.URLs,
+		Timeout:           relayConfig.Node.Feed.Input.Timeout,
+		URLs:              relayConfig.Node.Feed.Input.URLs,
+		SequencerAddress:  relayConfig.Node.Feed.Input.SequencerAddress,
+		EnableCompression: relayConfig.Node.Feed.Input.EnableCompression,
+		MaxMessageSize:    relayConfig.Node.Feed.Input.MaxMessageSize,
 	}
 
 	defer log.Info("Cleanly shutting down relay")
@@ -86,7 +96,16 @@ func startup() error {
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
 
 	// Start up an arbitrum sequencer relay
-	newRelay := relay.NewRelay(serverConf, clientConf)
+	newRelay, err := relay.NewRelay(serverConf, clientConf, relayConfig.Node.RelayId)
+	if err != nil {
+		return err
+	}
+	if serverConf.EnableFilters {
+		if relayConfig.Node.ChainId == 0 {
+			return errors.New("feed subscription filters require the relay chain id")
+		}
+		newRelay.EnableSubscriptionFilters(new(big.Int).SetUint64(relayConfig.Node.ChainId))
+	}
 	err = newRelay.Start(ctx)
 	if err != nil {
 		return err
@@ -118,15 +137,21 @@ func RelayConfigAddOptions(f *flag.FlagSet) {
 }
 
 type RelayNodeConfig struct {
-	Feed broadcastclient.FeedConfig `koanf:"feed"`
+	Feed    broadcastclient.FeedConfig `koanf:"feed"`
+	RelayId string                     `koanf:"relay-id"`
+	ChainId uint64                     `koanf:"chain-id"`
 }
 
 var RelayNodeConfigDefault = RelayNodeConfig{
-	Feed: broadcastclient.FeedConfigDefault,
+	Feed:    broadcastclient.FeedConfigDefault,
+	RelayId: "",
+	ChainId: 0,
 }
 
 func RelayNodeConfigAddOptions(prefix string, f *flag.FlagSet) {
 	broadcastclient.FeedConfigAddOptions(prefix+".feed", f, true, true)
+	f.String(prefix+".relay-id", RelayNodeConfigDefault.RelayId, "unique id of this relay, used to detect feed loops between relays (random if empty)")
+	f.Uint64(prefix+".chain-id", RelayNodeConfigDefault.ChainId, "chain id of the relayed feed, needed to decode transactions for feed subscription filters")
 }
 
 func ParseRelay(_ context.Context, args []string) (*RelayConfig, error) {
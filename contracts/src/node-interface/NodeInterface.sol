@@ -64,4 +64,69 @@ interface NodeInterface {
      * @return confirmations The number of L1 confirmations the sequencer batch has. Returns 0 if block not yet included in an L1 batch.
      */
     function getL1Confirmations(bytes32 blockHash) external view returns (uint64 confirmations);
+
+    /**
+     * @notice Gets where the sequencer batch containing the requested L2 block was posted to L1
+     * Throws if block doesn't exist, or if it isn't in a batch the node has read from L1
+     * @param blockNum The L2 block being queried
+     * @return batch The sequence number of the batch containing the requested L2 block
+     * @return l1BlockNumber The L1 block the batch was posted in
+     * @return l1TxHash The hash of the L1 transaction that posted the batch
+     * @return accumulator The sequencer inbox accumulator after the batch
+     */
+    function getBatchL1Info(uint64 blockNum)
+        external
+        view
+        returns (
+            uint64 batch,
+            uint64 l1BlockNumber,
+            bytes32 l1TxHash,
+            bytes32 accumulator
+        );
+
+    /**
+     * @notice Gets the data availability certificate of the AnyTrust batch containing the requested L2 block
+     * Throws if block doesn't exist, if it isn't in a batch the node has read from L1,
+     * or if the batch's data was posted to L1 instead of a certificate
+     * @param blockNum The L2 block being queried
+     * @return keysetHash The hash of the keyset of the committee that signed the certificate
+     * @return dataHash The hash of the batch data
+     * @return timeout The time until which the committee promised to store the data
+     * @return signersMask Which committee members signed the certificate
+     */
+    function getBatchDASCertificate(uint64 blockNum)
+        external
+        view
+        returns (
+            bytes32 keysetHash,
+            bytes32 dataHash,
+            uint64 timeout,
+            uint64 signersMask
+        );
+
+    /**
+     * @notice Estimates a transaction's gas and how much of it pays for posting its data to L1
+     * The call's sender and value are those of the transaction being estimated,
+     * and the call's gas limit caps the estimate.
+     * @param to destination of the transaction, ignored if contractCreation is true
+     * @param contractCreation whether the transaction deploys a contract
+     * @param data calldata of the transaction, or the initcode of the deployed contract
+     * @return gasEstimate an estimate of the total gas the transaction needs
+     * @return gasEstimateForL1 the part of gasEstimate paying the poster's L1 data cost
+     * @return baseFee the current L2 base fee
+     * @return l1BaseFeeEstimate the current estimate of the L1 base fee
+     */
+    function gasEstimateComponents(
+        address to,
+        bool contractCreation,
+        bytes calldata data
+    )
+        external
+        payable
+        returns (
+            uint64 gasEstimate,
+            uint64 gasEstimateForL1,
+            uint256 baseFee,
+            uint256 l1BaseFeeEstimate
+        );
 }
@@ -10,8 +10,10 @@ import (
 	"fmt"
 	"math/bits"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/offchainlabs/nitro/arbutil"
@@ -32,12 +34,19 @@ type AggregatorConfig struct {
 	AssumedHonest int    `koanf:"assumed-honest"`
 	Backends      string `koanf:"backends"`
 	DumpKeyset    bool   `koanf:"dump-keyset"`
+
+	ErasureCoding   ErasureCodingConfig   `koanf:"erasure-coding"`
+	BackgroundStore BackgroundStoreConfig `koanf:"background-store"`
+	NextKeyset      NextKeysetConfig      `koanf:"next-keyset"`
 }
 
 var DefaultAggregatorConfig = AggregatorConfig{
-	AssumedHonest: 0,
-	Backends:      "",
-	DumpKeyset:    false,
+	AssumedHonest:   0,
+	Backends:        "",
+	DumpKeyset:      false,
+	ErasureCoding:   DefaultErasureCodingConfig,
+	BackgroundStore: DefaultBackgroundStoreConfig,
+	NextKeyset:      DefaultNextKeysetConfig,
 }
 
 func AggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -45,18 +54,65 @@ func AggregatorConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".assumed-honest", DefaultAggregatorConfig.AssumedHonest, "Number of assumed honest backends (H). If there are N backends, K=N+1-H valid responses are required to consider an Store request to be successful.")
 	f.String(prefix+".backends", DefaultAggregatorConfig.Backends, "JSON RPC backend configuration")
 	f.Bool(prefix+".dump-keyset", DefaultAggregatorConfig.DumpKeyset, "Dump the keyset encoded in hexadecimal for the backends string")
+	ErasureCodingConfigAddOptions(prefix+".erasure-coding", f)
+	BackgroundStoreConfigAddOptions(prefix+".background-store", f)
+	NextKeysetConfigAddOptions(prefix+".next-keyset", f)
+}
+
+// NextKeysetConfig is the committee the aggregator rotates to at an L1 block
+type NextKeysetConfig struct {
+	Enable           bool   `koanf:"enable"`
+	AssumedHonest    int    `koanf:"assumed-honest"`
+	Backends         string `koanf:"backends"`
+	ActivationBlock  uint64 `koanf:"activation-block"`
+	FinalizeDistance uint64 `koanf:"finalize-distance"`
+}
+
+var DefaultNextKeysetConfig = NextKeysetConfig{
+	Enable:           false,
+	AssumedHonest:    0,
+	Backends:         "",
+	ActivationBlock:  0,
+	FinalizeDistance: 12,
+}
+
+func NextKeysetConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultNextKeysetConfig.Enable, "switch to a second committee of backends once L1 reaches the activation block")
+	f.Int(prefix+".assumed-honest", DefaultNextKeysetConfig.AssumedHonest, "Number of assumed honest backends (H) of the next committee")
+	f.String(prefix+".backends", DefaultNextKeysetConfig.Backends, "JSON RPC backend configuration of the next committee")
+	f.Uint64(prefix+".activation-block", DefaultNextKeysetConfig.ActivationBlock, "L1 block number from which batches are stored to the next committee and signed with its keyset")
+	f.Uint64(prefix+".finalize-distance", DefaultNextKeysetConfig.FinalizeDistance, "how many blocks past the activation block the L1 head must be before switching to the next committee")
 }
 
 type Aggregator struct {
-	config   AggregatorConfig
-	services []ServiceDetails
+	config AggregatorConfig
 
 	/// calculated fields
+	keyset     *aggregatorKeyset
+	nextKeyset *aggregatorKeyset
+	rotated    int32 // set atomically once the next keyset is in use
+	l1Reader   BlockNumberReader
+	bpVerifier *BatchPosterVerifier
+	storeQueue *backgroundStoreQueue
+
+	// erasure coding is only used while the rollup's wasm module root is one of erasureModuleRoots
+	erasureModuleRoots map[common.Hash]bool
+	wasmModuleRoots    WasmModuleRootReader
+	manifestSigner     DasSigner
+}
+
+// The backends of a committee, and the keyset their aggregated signatures are checked against
+type aggregatorKeyset struct {
+	services                       []ServiceDetails
 	requiredServicesForStore       int
 	maxAllowedServiceStoreFailures int
+	assumedHonest                  int
 	keysetHash                     [32]byte
 	keysetBytes                    []byte
-	bpVerifier                     *BatchPosterVerifier
+}
+
+type BlockNumberReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
 }
 
 type ServiceDetails struct {
@@ -108,7 +164,14 @@ func NewAggregatorWithL1Info(
 	if err != nil {
 		return nil, err
 	}
-	return NewAggregatorWithSeqInboxCaller(config, services, seqInboxCaller)
+	aggregator, err := NewAggregatorWithSeqInboxCaller(config, services, seqInboxCaller)
+	if err != nil {
+		return nil, err
+	}
+	if config.ErasureCoding.Enable {
+		aggregator.SetWasmModuleRootReader(NewWasmModuleRootReader(l1client, seqInboxCaller))
+	}
+	return aggregator, nil
 }
 
 func NewAggregatorWithSeqInboxCaller(
@@ -116,6 +179,109 @@ func NewAggregatorWithSeqInboxCaller(
 	services []ServiceDetails,
 	seqInboxCaller *bridgegen.SequencerInboxCaller,
 ) (*Aggregator, error) {
+	keyset, err := newAggregatorKeyset(config.AssumedHonest, config.ErasureCoding, services)
+	if err != nil {
+		return nil, err
+	}
+	if config.DumpKeyset {
+		fmt.Printf("Keyset: %s\n", hexutil.Encode(keyset.keysetBytes))
+		fmt.Printf("KeysetHash: %s\n", hexutil.Encode(keyset.keysetHash[:]))
+		os.Exit(0)
+	}
+
+	erasureModuleRoots, err := config.ErasureCoding.moduleRoots()
+	if err != nil {
+		return nil, err
+	}
+	if config.ErasureCoding.Enable {
+		for _, d := range services {
+			if _, ok := innermostService(d.service).(ErasureShareWriter); !ok {
+				return nil, fmt.Errorf("Erasure coding needs every backend to store erasure shares, but %v doesn't", d.service)
+			}
+		}
+	}
+
+	var bpVerifier *BatchPosterVerifier
+	if seqInboxCaller != nil {
+		bpVerifier = NewBatchPosterVerifier(seqInboxCaller)
+	}
+
+	var storeQueue *backgroundStoreQueue
+	if config.BackgroundStore.Enable {
+		storeQueue, err = newBackgroundStoreQueue(&config.BackgroundStore)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Aggregator{
+		config:             config,
+		keyset:             keyset,
+		bpVerifier:         bpVerifier,
+		storeQueue:         storeQueue,
+		erasureModuleRoots: erasureModuleRoots,
+	}, nil
+}
+
+// SetWasmModuleRootReader has the aggregator erasure code batches while the rollup's wasm module root
+// is one of the configured ones. Without it, batches are always stored whole.
+func (a *Aggregator) SetWasmModuleRootReader(reader WasmModuleRootReader) {
+	a.wasmModuleRoots = reader
+}
+
+// SetManifestSigner sets the batch poster key the erasure coding manifests sent to the backends are signed with
+func (a *Aggregator) SetManifestSigner(signer DasSigner) {
+	a.manifestSigner = signer
+}
+
+// erasureCodingActive is whether batches are erasure coded, which they can only be once the replay
+// binary of the rollup's wasm module root reads erasure coded certificates.
+// Batches stored whole are still safe under the keyset's lower assumed honest count,
+// as every certificate is then signed by at least one honest backend.
+func (a *Aggregator) erasureCodingActive(ctx context.Context) (bool, error) {
+	if !a.config.ErasureCoding.Enable || a.wasmModuleRoots == nil {
+		return false, nil
+	}
+	moduleRoot, err := a.wasmModuleRoots.WasmModuleRoot(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return false, err
+	}
+	if !a.erasureModuleRoots[moduleRoot] {
+		return false, nil
+	}
+	if a.manifestSigner == nil && a.bpVerifier != nil {
+		return false, errors.New("erasure coding needs the batch poster's key to sign erasure coding manifests")
+	}
+	return true, nil
+}
+
+// SetNextKeyset has the aggregator switch to the committee of the given backends once
+// L1 reaches the configured activation block. The next keyset must be made valid in the
+// Sequencer Inbox before then, and the current one only invalidated once it's no longer used.
+func (a *Aggregator) SetNextKeyset(services []ServiceDetails, l1Reader BlockNumberReader) error {
+	nextConfig := &a.config.NextKeyset
+	if !nextConfig.Enable {
+		return errors.New("next keyset isn't enabled")
+	}
+	if l1Reader == nil {
+		return errors.New("switching to the next keyset needs an L1 connection")
+	}
+	keyset, err := newAggregatorKeyset(nextConfig.AssumedHonest, a.config.ErasureCoding, services)
+	if err != nil {
+		return err
+	}
+	if a.config.DumpKeyset {
+		fmt.Printf("NextKeyset: %s\n", hexutil.Encode(keyset.keysetBytes))
+		fmt.Printf("NextKeysetHash: %s\n", hexutil.Encode(keyset.keysetHash[:]))
+		os.Exit(0)
+	}
+	a.nextKeyset = keyset
+	a.l1Reader = l1Reader
+	log.Info("Configured the next DAS keyset", "keysetHash", hexutil.Encode(keyset.keysetHash[:]), "activationBlock", nextConfig.ActivationBlock)
+	return nil
+}
+
+func newAggregatorKeyset(configAssumedHonest int, erasureCoding ErasureCodingConfig, services []ServiceDetails) (*aggregatorKeyset, error) {
 	var aggSignersMask uint64
 	pubKeys := []blsSignatures.PublicKey{}
 	for _, d := range services {
@@ -129,8 +295,23 @@ func NewAggregatorWithSeqInboxCaller(
 		return nil, errors.New("At least two signers share a mask")
 	}
 
+	// With erasure coding, any K honest signers hold enough shares to recover the data,
+	// so the certificate needs H+1-K fewer signers than an honest one.
+	assumedHonest := configAssumedHonest
+	if erasureCoding.Enable {
+		dataShares := erasureCoding.DataShares
+		if dataShares <= 0 || dataShares > configAssumedHonest {
+			return nil, fmt.Errorf("Erasure coding needs between 1 and %d data shares, got %d", configAssumedHonest, dataShares)
+		}
+		// backends store the share with the index of their bit in the signers mask
+		if aggSignersMask != (uint64(1)<<len(services))-1 {
+			return nil, fmt.Errorf("Erasure coding needs signersMasks 1, 2, 4, ... for each backend, got combined mask %X", aggSignersMask)
+		}
+		assumedHonest = configAssumedHonest + 1 - dataShares
+	}
+
 	keyset := &arbstate.DataAvailabilityKeyset{
-		AssumedHonest: uint64(config.AssumedHonest),
+		AssumedHonest: uint64(assumedHonest),
 		PubKeys:       pubKeys,
 	}
 	ksBuf := bytes.NewBuffer([]byte{})
@@ -143,37 +324,108 @@ func NewAggregatorWithSeqInboxCaller(
 	}
 	var keysetHash [32]byte
 	copy(keysetHash[:], keysetHashBuf)
-	if config.DumpKeyset {
-		fmt.Printf("Keyset: %s\n", hexutil.Encode(ksBuf.Bytes()))
-		fmt.Printf("KeysetHash: %s\n", hexutil.Encode(keysetHash[:]))
-		os.Exit(0)
-	}
 
-	var bpVerifier *BatchPosterVerifier
-	if seqInboxCaller != nil {
-		bpVerifier = NewBatchPosterVerifier(seqInboxCaller)
-	}
-
-	return &Aggregator{
-		config:                         config,
+	return &aggregatorKeyset{
 		services:                       services,
-		requiredServicesForStore:       len(services) + 1 - config.AssumedHonest,
-		maxAllowedServiceStoreFailures: config.AssumedHonest - 1,
+		requiredServicesForStore:       len(services) + 1 - assumedHonest,
+		maxAllowedServiceStoreFailures: assumedHonest - 1,
+		assumedHonest:                  assumedHonest,
 		keysetHash:                     keysetHash,
 		keysetBytes:                    ksBuf.Bytes(),
-		bpVerifier:                     bpVerifier,
 	}, nil
 }
 
+// KeysetFromPubKeys serializes the keyset an aggregator of backends with the given public keys
+// signs with, where the i-th key belongs to the backend with signersMask 1<<i, and returns its hash.
+func KeysetFromPubKeys(assumedHonest int, erasureCoding ErasureCodingConfig, pubKeys []blsSignatures.PublicKey) ([]byte, [32]byte, error) {
+	var services []ServiceDetails
+	for i, pubKey := range pubKeys {
+		services = append(services, ServiceDetails{pubKey: pubKey, signersMask: uint64(1) << i})
+	}
+	keyset, err := newAggregatorKeyset(assumedHonest, erasureCoding, services)
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+	return keyset.keysetBytes, keyset.keysetHash, nil
+}
+
+// storeKeyset is the keyset for new certificates. Once the next keyset is in use, it's never switched back.
+// The switch waits until the activation block is FinalizeDistance blocks deep, so it isn't undone by L1 reorgs
+// of that depth. A deeper reorg doesn't invalidate the certificates either, as both keysets are valid on L1
+// throughout the rotation.
+func (a *Aggregator) storeKeyset(ctx context.Context) (*aggregatorKeyset, error) {
+	if a.nextKeyset == nil {
+		return a.keyset, nil
+	}
+	if atomic.LoadInt32(&a.rotated) != 0 {
+		return a.nextKeyset, nil
+	}
+	blockNum, err := a.l1Reader.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum < a.config.NextKeyset.ActivationBlock+a.config.NextKeyset.FinalizeDistance {
+		return a.keyset, nil
+	}
+	if atomic.CompareAndSwapInt32(&a.rotated, 0, 1) {
+		log.Info("Switched to the next DAS keyset", "keysetHash", hexutil.Encode(a.nextKeyset.keysetHash[:]), "l1Block", blockNum)
+	}
+	return a.nextKeyset, nil
+}
+
+// Keysets returns the serialized current keyset, and the next one if a rotation is configured
+func (a *Aggregator) Keysets() [][]byte {
+	keysets := [][]byte{a.keyset.keysetBytes}
+	if a.nextKeyset != nil {
+		keysets = append(keysets, a.nextKeyset.keysetBytes)
+	}
+	return keysets
+}
+
+func (a *Aggregator) keysetByHash(keysetHash [32]byte) *aggregatorKeyset {
+	if a.keyset.keysetHash == keysetHash {
+		return a.keyset
+	}
+	if a.nextKeyset != nil && a.nextKeyset.keysetHash == keysetHash {
+		return a.nextKeyset
+	}
+	return nil
+}
+
+// allServices lists the backends of both the current and next keysets
+func (a *Aggregator) allServices() []ServiceDetails {
+	if a.nextKeyset == nil {
+		return a.keyset.services
+	}
+	services := append([]ServiceDetails{}, a.keyset.services...)
+	return append(services, a.nextKeyset.services...)
+}
+
+// Start launches the background completion of stores to backends that didn't sign, if it's enabled
+func (a *Aggregator) Start(ctx context.Context) error {
+	if a.storeQueue == nil {
+		return nil
+	}
+	return a.storeQueue.start(ctx, a)
+}
+
+func (a *Aggregator) Close(ctx context.Context) error {
+	if a.storeQueue != nil {
+		a.storeQueue.stopWaiter.StopAndWait()
+	}
+	return nil
+}
+
 func (a *Aggregator) GetByHash(ctx context.Context, hash []byte) ([]byte, error) {
 	// Query all services, even those that didn't sign.
 	// They may have been late in returning a response after storing the data,
 	// or got the data by some other means.
-	blobChan := make(chan []byte, len(a.services))
-	errorChan := make(chan error, len(a.services))
+	services := a.allServices()
+	blobChan := make(chan []byte, len(services))
+	errorChan := make(chan error, len(services))
 	subCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	for _, d := range a.services {
+	for _, d := range services {
 		go func(ctx context.Context, d ServiceDetails) {
 			blob, err := d.service.GetByHash(ctx, hash)
 			if err != nil {
@@ -190,7 +442,7 @@ func (a *Aggregator) GetByHash(ctx context.Context, hash []byte) ([]byte, error)
 
 	errorCount := 0
 	var errorCollection []error
-	for errorCount < len(a.services) {
+	for errorCount < len(services) {
 		select {
 		case blob := <-blobChan:
 			return blob, nil
@@ -246,49 +498,35 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64,
 		}
 	}
 
-	responses := make(chan storeResponse, len(a.services))
+	keyset, err := a.storeKeyset(ctx)
+	if err != nil {
+		return nil, err
+	}
+	erasureCoded, err := a.erasureCodingActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := a.newStoreRequest(keyset, message, timeout, sig, erasureCoded)
+	if err != nil {
+		return nil, err
+	}
 
-	expectedHash := crypto.Keccak256(message)
-	for _, d := range a.services {
+	responses := make(chan storeResponse, len(keyset.services))
+	for _, d := range keyset.services {
 		go func(ctx context.Context, d ServiceDetails) {
-			cert, err := d.service.Store(ctx, message, timeout, sig)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
-
-			verified, err := blsSignatures.VerifySignature(cert.Sig, serializeSignableFields(cert), d.pubKey)
-			if err != nil {
-				responses <- storeResponse{d, nil, err}
-				return
-			}
-			if !verified {
-				responses <- storeResponse{d, nil, errors.New("Signature verification failed.")}
-				return
-			}
-
-			// SignersMask from backend DAS is ignored.
-
-			if !bytes.Equal(cert.DataHash[:], expectedHash) {
-				responses <- storeResponse{d, nil, errors.New("Hash verification failed.")}
-				return
-			}
-			if cert.Timeout != timeout {
-				responses <- storeResponse{d, nil, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, timeout)}
-				return
-			}
-
-			responses <- storeResponse{d, cert.Sig, nil}
+			blsSig, err := req.storeToBackend(ctx, d)
+			responses <- storeResponse{d, blsSig, err}
 		}(ctx, d)
 	}
 
 	var pubKeys []blsSignatures.PublicKey
 	var sigs []blsSignatures.Signature
+	var signed []ServiceDetails
 	var aggCert arbstate.DataAvailabilityCertificate
 	var aggSignersMask uint64
 	var storeFailures, successfullyStoredCount int
 	var errs []error
-	for i := 0; i < len(a.services) && storeFailures <= a.maxAllowedServiceStoreFailures && successfullyStoredCount < a.requiredServicesForStore; i++ {
+	for i := 0; i < len(keyset.services) && storeFailures <= keyset.maxAllowedServiceStoreFailures && successfullyStoredCount < keyset.requiredServicesForStore; i++ {
 		select {
 		case <-ctx.Done():
 			break
@@ -301,37 +539,152 @@ func (a *Aggregator) Store(ctx context.Context, message []byte, timeout uint64,
 
 			pubKeys = append(pubKeys, r.details.pubKey)
 			sigs = append(sigs, r.sig)
+			signed = append(signed, r.details)
 			aggSignersMask |= r.details.signersMask
 			successfullyStoredCount++
 		}
 	}
 
-	if successfullyStoredCount < a.requiredServicesForStore {
-		return nil, fmt.Errorf("Aggregator failed to store message to at least %d out of %d DASes (assuming %d are honest), errors received %d, %v", a.requiredServicesForStore, len(a.services), a.config.AssumedHonest, storeFailures, errs)
+	if successfullyStoredCount < keyset.requiredServicesForStore {
+		return nil, fmt.Errorf("Aggregator failed to store message to at least %d out of %d DASes (assuming %d are honest), errors received %d, %v", keyset.requiredServicesForStore, len(keyset.services), keyset.assumedHonest, storeFailures, errs)
 	}
 
 	aggCert.Sig = blsSignatures.AggregateSignatures(sigs)
-	aggPubKey := blsSignatures.AggregatePublicKeys(pubKeys)
 	aggCert.SignersMask = aggSignersMask
-	copy(aggCert.DataHash[:], expectedHash)
+	aggCert.DataHash = req.dataHash
+	aggCert.ErasureCoded = req.erasureCoded
 	aggCert.Timeout = timeout
-	aggCert.KeysetHash = a.keysetHash
+	aggCert.KeysetHash = keyset.keysetHash
 
-	verified, err := blsSignatures.VerifySignature(aggCert.Sig, serializeSignableFields(&aggCert), aggPubKey)
+	var verified bool
+	if req.erasureCoded {
+		var messages [][]byte
+		for _, d := range signed {
+			messages = append(messages, req.signableFields(&aggCert, d))
+		}
+		verified, err = blsSignatures.VerifyAggregatedSignatureDifferentMessages(aggCert.Sig, messages, pubKeys)
+	} else {
+		aggPubKey := blsSignatures.AggregatePublicKeys(pubKeys)
+		verified, err = blsSignatures.VerifySignature(aggCert.Sig, serializeSignableFields(&aggCert), aggPubKey)
+	}
 	if err != nil {
 		return nil, err
 	}
 	if !verified {
 		return nil, errors.New("Failed aggregate signature check")
 	}
+
+	// The backends that failed or were too slow get the batch in the background.
+	if a.storeQueue != nil {
+		var allSignersMask uint64
+		for _, d := range keyset.services {
+			allSignersMask |= d.signersMask
+		}
+		if err := a.storeQueue.add(keyset.keysetHash, req.dataHash, message, timeout, sig, req.erasureCoded, allSignersMask&^aggSignersMask); err != nil {
+			log.Error("Failed to queue store for backends that didn't sign", "signersMask", aggSignersMask, "err", err)
+		}
+	}
 	return &aggCert, nil
 }
 
+// storeRequest is a batch as it's stored to each backend of a keyset. Erasure coded batches are
+// stored as the manifest, signed for the backends by the batch poster, and each backend's share.
+type storeRequest struct {
+	message      []byte
+	timeout      uint64
+	sig          []byte
+	dataHash     [32]byte
+	erasureCoded bool
+
+	manifest    []byte
+	manifestSig []byte
+	shareHashes [][32]byte
+	shares      [][]byte
+}
+
+func (a *Aggregator) newStoreRequest(keyset *aggregatorKeyset, message []byte, timeout uint64, sig []byte, erasureCoded bool) (*storeRequest, error) {
+	req := &storeRequest{
+		message:      message,
+		timeout:      timeout,
+		sig:          sig,
+		erasureCoded: erasureCoded,
+	}
+	if !erasureCoded {
+		copy(req.dataHash[:], crypto.Keccak256(message))
+		return req, nil
+	}
+	manifest, shares, err := arbstate.EncodeErasureShares(message, uint64(a.config.ErasureCoding.DataShares), uint64(len(keyset.services)))
+	if err != nil {
+		return nil, err
+	}
+	req.manifest = manifest.Serialize()
+	copy(req.dataHash[:], crypto.Keccak256(req.manifest))
+	req.shareHashes = manifest.ShareHashes
+	req.shares = shares
+	if a.manifestSigner != nil {
+		req.manifestSig, err = applyDasSigner(a.manifestSigner, req.manifest, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// shareIndex is the erasure share of the backend, which is the position of its bit in the signers mask
+func shareIndex(d ServiceDetails) uint64 {
+	return uint64(bits.TrailingZeros64(d.signersMask))
+}
+
+// signableFields is what the backend signs in the certificate
+func (req *storeRequest) signableFields(cert *arbstate.DataAvailabilityCertificate, d ServiceDetails) []byte {
+	if !req.erasureCoded {
+		return serializeSignableFields(cert)
+	}
+	index := shareIndex(d)
+	return cert.SerializeErasureShareSignableFields(index, req.shareHashes[index])
+}
+
+// storeToBackend stores the batch, or the backend's share of it, to a backend, and checks the certificate it signed
+func (req *storeRequest) storeToBackend(ctx context.Context, d ServiceDetails) (blsSignatures.Signature, error) {
+	var cert *arbstate.DataAvailabilityCertificate
+	var err error
+	if req.erasureCoded {
+		index := shareIndex(d)
+		cert, err = storeErasureShareTo(d.service, ctx, req.manifest, index, req.shares[index], req.timeout, req.manifestSig)
+	} else {
+		cert, err = d.service.Store(ctx, req.message, req.timeout, req.sig)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verified, err := blsSignatures.VerifySignature(cert.Sig, req.signableFields(cert, d), d.pubKey)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, errors.New("Signature verification failed.")
+	}
+
+	// SignersMask from backend DAS is ignored.
+
+	if cert.DataHash != req.dataHash {
+		return nil, errors.New("Hash verification failed.")
+	}
+	if cert.ErasureCoded != req.erasureCoded {
+		return nil, fmt.Errorf("Certificate erasure coded was %v, expected %v", cert.ErasureCoded, req.erasureCoded)
+	}
+	if cert.Timeout != req.timeout {
+		return nil, fmt.Errorf("Timeout was %d, expected %d", cert.Timeout, req.timeout)
+	}
+	return cert.Sig, nil
+}
+
 func (a *Aggregator) String() string {
 	var b bytes.Buffer
 	b.WriteString("das.Aggregator{")
 	first := true
-	for _, d := range a.services {
+	for _, d := range a.allServices() {
 		if !first {
 			b.WriteString(",")
 		}
@@ -343,7 +696,7 @@ func (a *Aggregator) String() string {
 }
 
 func (a *Aggregator) HealthCheck(ctx context.Context) error {
-	for _, serv := range a.services {
+	for _, serv := range a.allServices() {
 		err := serv.service.HealthCheck(ctx)
 		if err != nil {
 			return err
@@ -353,16 +706,17 @@ func (a *Aggregator) HealthCheck(ctx context.Context) error {
 }
 
 func (a *Aggregator) ExpirationPolicy(ctx context.Context) (arbstate.ExpirationPolicy, error) {
-	if len(a.services) == 0 {
+	services := a.allServices()
+	if len(services) == 0 {
 		return -1, errors.New("no DataAvailabilityService present")
 	}
-	expectedExpirationPolicy, err := a.services[0].service.ExpirationPolicy(ctx)
+	expectedExpirationPolicy, err := services[0].service.ExpirationPolicy(ctx)
 	if err != nil {
 		return -1, err
 	}
 	// Even if a single service is different from the rest,
 	// then whole aggregator will be considered for mixed expiration timeout policy.
-	for _, serv := range a.services {
+	for _, serv := range services {
 		ep, err := serv.service.ExpirationPolicy(ctx)
 		if err != nil {
 			return -1, err
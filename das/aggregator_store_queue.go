@@ -0,0 +1,374 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+	"golang.org/x/sys/unix"
+
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+var (
+	backgroundStoreSuccessCounter = metrics.NewRegisteredCounter("arb/das/aggregator/backgroundstore/success", nil)
+	backgroundStoreFailureCounter = metrics.NewRegisteredCounter("arb/das/aggregator/backgroundstore/failure", nil)
+	backgroundStoreExpiredCounter = metrics.NewRegisteredCounter("arb/das/aggregator/backgroundstore/expired", nil)
+)
+
+type BackgroundStoreConfig struct {
+	Enable        bool          `koanf:"enable"`
+	QueueDir      string        `koanf:"queue-dir"`
+	RetryInterval time.Duration `koanf:"retry-interval"`
+	StoreTimeout  time.Duration `koanf:"store-timeout"`
+}
+
+var DefaultBackgroundStoreConfig = BackgroundStoreConfig{
+	Enable:        false,
+	QueueDir:      "",
+	RetryInterval: time.Minute,
+	StoreTimeout:  10 * time.Second,
+}
+
+func BackgroundStoreConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultBackgroundStoreConfig.Enable, "keep storing batches to the backends that didn't sign them, until they do or the batches expire")
+	f.String(prefix+".queue-dir", DefaultBackgroundStoreConfig.QueueDir, "directory in which batches waiting to be stored to some backends are kept, so they survive restarts")
+	f.Duration(prefix+".retry-interval", DefaultBackgroundStoreConfig.RetryInterval, "how often to retry storing queued batches")
+	f.Duration(prefix+".store-timeout", DefaultBackgroundStoreConfig.StoreTimeout, "timeout of each background store to a backend")
+}
+
+// A batch that some backends haven't stored yet. Its message and batch poster
+// signature stay on disk, in the file it's loaded from.
+type queuedStore struct {
+	path         string
+	pendingMask  uint64
+	timeout      uint64
+	keysetHash   [32]byte
+	erasureCoded bool
+}
+
+// A backend of a keyset
+type queueMember struct {
+	keysetHash  [32]byte
+	signersMask uint64
+}
+
+// backgroundStoreQueue keeps storing batches to the backends that didn't sign
+// them in Aggregator.Store, until they acknowledge the batch or it expires.
+// Each batch is a file in the queue directory, named after the keyset hash and the
+// certificate's data hash, which holds the mask of the keyset's backends the batch
+// is still pending on.
+type backgroundStoreQueue struct {
+	config     *BackgroundStoreConfig
+	stopWaiter stopwaiter.StopWaiterSafe
+
+	mutex   sync.Mutex
+	pending map[string]*queuedStore
+
+	backlogGauges map[queueMember]metrics.Gauge
+}
+
+const queuedStoreHeaderSize = 57
+
+// Set in the flags byte of a queue file if the batch's certificate is erasure coded
+const queuedStoreErasureCodedFlag byte = 0x01
+
+func newBackgroundStoreQueue(config *BackgroundStoreConfig) (*backgroundStoreQueue, error) {
+	if config.QueueDir == "" {
+		return nil, errors.New("background store enabled, but no queue-dir given")
+	}
+	if unix.Access(config.QueueDir, unix.W_OK|unix.R_OK) != nil {
+		return nil, fmt.Errorf("Couldn't start background store queue, directory '%s' must be readable and writeable", config.QueueDir)
+	}
+	q := &backgroundStoreQueue{
+		config:        config,
+		pending:       make(map[string]*queuedStore),
+		backlogGauges: make(map[queueMember]metrics.Gauge),
+	}
+
+	// pick up the batches queued before a restart
+	entries, err := os.ReadDir(config.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// temp files left by a crash mid-write start with a dot
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(config.QueueDir, entry.Name())
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var header [queuedStoreHeaderSize]byte
+		_, err = io.ReadFull(file, header[:])
+		_ = file.Close()
+		if err != nil {
+			log.Warn("Ignoring unreadable background store queue file", "path", path, "err", err)
+			continue
+		}
+		store := &queuedStore{
+			path:         path,
+			pendingMask:  binary.BigEndian.Uint64(header[:8]),
+			timeout:      binary.BigEndian.Uint64(header[8:16]),
+			erasureCoded: header[56]&queuedStoreErasureCodedFlag != 0,
+		}
+		copy(store.keysetHash[:], header[16:48])
+		q.pending[entry.Name()] = store
+	}
+	q.updateBacklogGauges()
+	if len(q.pending) > 0 {
+		log.Info("Loaded queued background stores", "count", len(q.pending))
+	}
+	return q, nil
+}
+
+func (q *backgroundStoreQueue) start(ctx context.Context, a *Aggregator) error {
+	if err := q.stopWaiter.Start(ctx); err != nil {
+		return err
+	}
+	return q.stopWaiter.CallIteratively(func(ctx context.Context) time.Duration {
+		q.retryAll(ctx, a)
+		return q.config.RetryInterval
+	})
+}
+
+// queuedStoreName is the file name of the batch with the certificate's data hash in the keyset
+func queuedStoreName(keysetHash [32]byte, dataHash [32]byte) string {
+	return EncodeStorageServiceKey(keysetHash[:]) + "-" + EncodeStorageServiceKey(dataHash[:])
+}
+
+// add queues the batch for the backends in pendingMask, merging with the backends it's already queued for.
+// The backends of an erasure coded batch get their shares of it.
+func (q *backgroundStoreQueue) add(keysetHash [32]byte, dataHash [32]byte, message []byte, timeout uint64, sig []byte, erasureCoded bool, pendingMask uint64) error {
+	if pendingMask == 0 {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	name := queuedStoreName(keysetHash, dataHash)
+	if existing := q.pending[name]; existing != nil {
+		pendingMask |= existing.pendingMask
+	}
+	path := filepath.Join(q.config.QueueDir, name)
+	store := &queuedStore{path, pendingMask, timeout, keysetHash, erasureCoded}
+	if err := writeQueuedStore(store, sig, message); err != nil {
+		return err
+	}
+	q.pending[name] = store
+	q.updateBacklogGauges()
+	return nil
+}
+
+// A batch retried in a pass
+type queuedRetry struct {
+	name  string
+	store queuedStore
+}
+
+// retryAll retries the queued batches of each backend in parallel, soonest expiring first.
+// A backend stops being retried for the rest of the pass once a store to it fails,
+// so a backend that's down doesn't hold up the others.
+func (q *backgroundStoreQueue) retryAll(ctx context.Context, a *Aggregator) {
+	q.mutex.Lock()
+	queued := make([]queuedRetry, 0, len(q.pending))
+	for name, store := range q.pending {
+		queued = append(queued, queuedRetry{name, *store})
+	}
+	q.mutex.Unlock()
+	sort.Slice(queued, func(i, j int) bool {
+		return queued[i].store.timeout < queued[j].store.timeout
+	})
+
+	now := uint64(time.Now().Unix())
+	byKeyset := make(map[[32]byte][]queuedRetry)
+	for _, r := range queued {
+		if r.store.timeout < now {
+			backgroundStoreExpiredCounter.Inc(1)
+			log.Warn("Batch expired before all backends stored it", "file", r.name, "pendingMask", r.store.pendingMask)
+			q.acknowledge(r.name, r.store.pendingMask)
+			continue
+		}
+		if a.keysetByHash(r.store.keysetHash) == nil {
+			log.Warn("Dropping queued batch for a keyset that's no longer configured", "file", r.name, "keysetHash", hexutil.Encode(r.store.keysetHash[:]))
+			q.acknowledge(r.name, r.store.pendingMask)
+			continue
+		}
+		byKeyset[r.store.keysetHash] = append(byKeyset[r.store.keysetHash], r)
+	}
+
+	var wg sync.WaitGroup
+	for keysetHash, retries := range byKeyset {
+		keyset := a.keysetByHash(keysetHash)
+		for _, d := range keyset.services {
+			wg.Add(1)
+			go func(d ServiceDetails, retries []queuedRetry) {
+				defer wg.Done()
+				q.retryBackend(ctx, a, keyset, d, retries)
+			}(d, retries)
+		}
+	}
+	wg.Wait()
+}
+
+// retryBackend stores the batches pending on the backend to it, until one fails
+func (q *backgroundStoreQueue) retryBackend(ctx context.Context, a *Aggregator, keyset *aggregatorKeyset, d ServiceDetails, retries []queuedRetry) {
+	for _, r := range retries {
+		if ctx.Err() != nil {
+			return
+		}
+		if r.store.pendingMask&d.signersMask == 0 {
+			continue
+		}
+		req, err := q.load(a, keyset, &r.store)
+		if err != nil {
+			log.Error("Failed to load queued background store", "file", r.name, "err", err)
+			continue
+		}
+		storeCtx, cancel := context.WithTimeout(ctx, q.config.StoreTimeout)
+		_, err = req.storeToBackend(storeCtx, d)
+		cancel()
+		if err != nil {
+			backgroundStoreFailureCounter.Inc(1)
+			log.Warn("Background store to backend failed, retrying its batches next time", "backend", d.service, "signersMask", d.signersMask, "file", r.name, "err", err)
+			return
+		}
+		backgroundStoreSuccessCounter.Inc(1)
+		q.acknowledge(r.name, d.signersMask)
+	}
+}
+
+// load reads the queued batch from its file, as it's stored to each backend
+func (q *backgroundStoreQueue) load(a *Aggregator, keyset *aggregatorKeyset, store *queuedStore) (*storeRequest, error) {
+	contents, err := os.ReadFile(store.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(contents) < queuedStoreHeaderSize {
+		return nil, errors.New("truncated background store queue file")
+	}
+	sigLen := binary.BigEndian.Uint64(contents[48:56])
+	if uint64(len(contents)-queuedStoreHeaderSize) < sigLen {
+		return nil, errors.New("truncated background store queue file")
+	}
+	sig := contents[queuedStoreHeaderSize : queuedStoreHeaderSize+sigLen]
+	message := contents[queuedStoreHeaderSize+sigLen:]
+	return a.newStoreRequest(keyset, message, store.timeout, sig, store.erasureCoded)
+}
+
+// acknowledge removes the backends in ackedMask from the batch's pending backends, and forgets it once there are none left
+func (q *backgroundStoreQueue) acknowledge(name string, ackedMask uint64) {
+	if ackedMask == 0 {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	store := q.pending[name]
+	if store == nil {
+		return
+	}
+	store.pendingMask &^= ackedMask
+	if store.pendingMask == 0 {
+		delete(q.pending, name)
+		if err := os.Remove(store.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn("Failed to remove background store queue file", "path", store.path, "err", err)
+		}
+	} else if err := writeQueuedStoreMask(store.path, store.pendingMask); err != nil {
+		// the backends that acknowledged will just get the batch again after a restart
+		log.Warn("Failed to update background store queue file", "path", store.path, "err", err)
+	}
+	q.updateBacklogGauges()
+}
+
+// updateBacklogGauges counts the batches each backend is missing. The mutex must be held.
+func (q *backgroundStoreQueue) updateBacklogGauges() {
+	backlogs := make(map[queueMember]int64)
+	for _, store := range q.pending {
+		for i := 0; i < 64; i++ {
+			mask := uint64(1) << i
+			if store.pendingMask&mask != 0 {
+				backlogs[queueMember{store.keysetHash, mask}]++
+			}
+		}
+	}
+	for member := range backlogs {
+		if q.backlogGauges[member] == nil {
+			name := fmt.Sprintf("arb/das/aggregator/backgroundstore/backlog/%x/%d", member.keysetHash[:4], member.signersMask)
+			q.backlogGauges[member] = metrics.GetOrRegisterGauge(name, nil)
+		}
+	}
+	for member, gauge := range q.backlogGauges {
+		gauge.Update(backlogs[member])
+	}
+}
+
+func (q *backgroundStoreQueue) backlog() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// A queue file holds the pending mask and timeout as big-endian uint64s, the keyset hash,
+// the batch poster signature length as a big-endian uint64 and a flags byte, followed by
+// the signature and the message.
+func writeQueuedStore(store *queuedStore, sig, message []byte) error {
+	path := store.path
+	contents := make([]byte, queuedStoreHeaderSize, queuedStoreHeaderSize+len(sig)+len(message))
+	binary.BigEndian.PutUint64(contents[0:8], store.pendingMask)
+	binary.BigEndian.PutUint64(contents[8:16], store.timeout)
+	copy(contents[16:48], store.keysetHash[:])
+	binary.BigEndian.PutUint64(contents[48:56], uint64(len(sig)))
+	if store.erasureCoded {
+		contents[56] |= queuedStoreErasureCodedFlag
+	}
+	contents = append(contents, sig...)
+	contents = append(contents, message...)
+
+	// Use a temp file and rename to achieve atomic writes.
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(contents); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func writeQueuedStoreMask(path string, pendingMask uint64) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	var mask [8]byte
+	binary.BigEndian.PutUint64(mask[:], pendingMask)
+	if _, err := f.WriteAt(mask[:], 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
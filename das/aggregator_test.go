@@ -12,9 +12,13 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbstate"
 )
@@ -69,6 +73,452 @@ func TestDAS_BasicAggregationLocal(t *testing.T) {
 	}
 }
 
+func TestDAS_ErasureCodedAggregationLocal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	numBackendDAS := 6
+	dataShares := 3
+	var backends []ServiceDetails
+	for i := 0; i < numBackendDAS; i++ {
+		dbPath := t.TempDir()
+		_, _, err := GenerateAndStoreKeys(dbPath)
+		Require(t, err)
+
+		config := DataAvailabilityConfig{
+			Enable: true,
+			KeyConfig: KeyConfig{
+				KeyDir: dbPath,
+			},
+			ErasureShare: ErasureShareConfig{
+				Enable:      true,
+				Index:       i,
+				DataShares:  dataShares,
+				TotalShares: numBackendDAS,
+			},
+			LocalFileStorageConfig: LocalFileStorageConfig{
+				Enable:  true,
+				DataDir: dbPath,
+			},
+			L1NodeURL: "none",
+		}
+
+		storageService, lifecycleManager, err := CreatePersistentStorageService(ctx, &config)
+		Require(t, err)
+		defer lifecycleManager.StopAndWaitUntil(time.Second)
+		das, err := NewSignAfterStoreDAS(ctx, config, storageService)
+		Require(t, err)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		details, err := NewServiceDetails(das, *pubKey, uint64(1<<i))
+		Require(t, err)
+		backends = append(backends, *details)
+	}
+
+	erasureModuleRoot := common.HexToHash("0xec")
+	aggConfig := AggregatorConfig{
+		AssumedHonest: 3,
+		ErasureCoding: ErasureCodingConfig{
+			Enable:          true,
+			DataShares:      dataShares,
+			WasmModuleRoots: []string{erasureModuleRoot.Hex()},
+		},
+	}
+	aggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggConfig, L1NodeURL: "none"}, backends)
+	Require(t, err)
+	if aggregator.keyset.requiredServicesForStore != numBackendDAS {
+		Fail(t, "Expected every backend to be required, got", aggregator.keyset.requiredServicesForStore)
+	}
+	keyset, err := arbstate.DeserializeKeyset(bytes.NewReader(aggregator.keyset.keysetBytes))
+	Require(t, err)
+	moduleRoot := &testWasmModuleRoot{common.HexToHash("0x01")}
+	aggregator.SetWasmModuleRootReader(moduleRoot)
+
+	// Until the wasm module root reads erasure coded certificates, batches are stored whole
+	wholeMsg := []byte("Stored before the upgrade")
+	cert, err := aggregator.Store(ctx, wholeMsg, 0, []byte{})
+	Require(t, err, "Error storing message")
+	if cert.ErasureCoded {
+		Fail(t, "Certificate is erasure coded before the upgrade")
+	}
+	Require(t, keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig))
+	messageRetrieved, err := aggregator.GetByHash(ctx, cert.DataHash[:])
+	Require(t, err, "Failed to retrieve message")
+	if !bytes.Equal(wholeMsg, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+
+	moduleRoot.root = erasureModuleRoot
+	rawMsg := make([]byte, 1000)
+	rand.Read(rawMsg)
+	cert, err = aggregator.Store(ctx, rawMsg, 0, []byte{})
+	Require(t, err, "Error storing message")
+	if !cert.ErasureCoded {
+		Fail(t, "Certificate isn't marked as erasure coded")
+	}
+
+	manifestBytes, err := aggregator.GetByHash(ctx, cert.DataHash[:])
+	Require(t, err, "Failed to retrieve manifest")
+	manifest, err := arbstate.DeserializeErasureCodingManifest(bytes.NewReader(manifestBytes))
+	Require(t, err)
+	Require(t, keyset.VerifyErasureCodedSignature(cert, manifest))
+	if keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig) == nil {
+		Fail(t, "Erasure coded certificate doesn't commit to the shares")
+	}
+
+	// no backend holds the whole message
+	if _, err := aggregator.GetByHash(ctx, manifest.DataHash[:]); err == nil {
+		Fail(t, "Retrieved the whole message from a backend")
+	}
+	messageRetrieved, err = arbstate.RecoverErasureCodedPayload(ctx, manifest, aggregator, nil)
+	Require(t, err, "Failed to recover message")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Recovered message is not the same as stored one.")
+	}
+}
+
+func TestDAS_ErasureCodingNeedsWrappedShareWriters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	aggConfig := DataAvailabilityConfig{
+		AggregatorConfig: AggregatorConfig{
+			AssumedHonest: 2,
+			ErasureCoding: ErasureCodingConfig{
+				Enable:     true,
+				DataShares: 2,
+			},
+		},
+		L1NodeURL: "none",
+	}
+	backends := newTestCommittee(ctx, t, 3)
+	wrapped := make([]ServiceDetails, len(backends))
+	for i, d := range backends {
+		wrapped[i] = d
+		wrapped[i].service = NewRetryWrapper(NewTimeoutWrapper(d.service, time.Second))
+	}
+	_, err := NewAggregator(ctx, aggConfig, wrapped)
+	Require(t, err)
+
+	// the wrappers pass erasure shares through, but the store they wrap doesn't take them
+	for i, d := range backends {
+		wrapped[i].service = NewRetryWrapper(&downableStore{DataAvailabilityService: d.service})
+	}
+	if _, err := NewAggregator(ctx, aggConfig, wrapped); err == nil {
+		Fail(t, "Aggregator accepted backends that don't store erasure shares")
+	}
+
+	// and retrying won't change that
+	retrying := wrapped[0].service.(*RetryWrapper)
+	storeCtx, storeCancel := context.WithTimeout(ctx, time.Second)
+	defer storeCancel()
+	_, err = retrying.StoreErasureShare(storeCtx, []byte{}, 0, []byte{}, 0, []byte{})
+	if !errors.Is(err, ErrErasureSharesUnsupported) {
+		Fail(t, "Expected an unsupported erasure share store to fail permanently, got", err)
+	}
+}
+
+type testWasmModuleRoot struct {
+	root common.Hash
+}
+
+func (r *testWasmModuleRoot) WasmModuleRoot(opts *bind.CallOpts) ([32]byte, error) {
+	return r.root, nil
+}
+
+type downableStore struct {
+	down     int32
+	failures int32
+	DataAvailabilityService
+}
+
+func (d *downableStore) Store(ctx context.Context, message []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	if atomic.LoadInt32(&d.down) != 0 {
+		atomic.AddInt32(&d.failures, 1)
+		return nil, errors.New("Expected Store failure")
+	}
+	return d.DataAvailabilityService.Store(ctx, message, timeout, sig)
+}
+
+func TestDAS_BackgroundStoreToLaggingBackends(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	numBackendDAS := 3
+	var backends []ServiceDetails
+	var stores []*downableStore
+	for i := 0; i < numBackendDAS; i++ {
+		dbPath := t.TempDir()
+		_, _, err := GenerateAndStoreKeys(dbPath)
+		Require(t, err)
+
+		config := DataAvailabilityConfig{
+			Enable: true,
+			KeyConfig: KeyConfig{
+				KeyDir: dbPath,
+			},
+			LocalFileStorageConfig: LocalFileStorageConfig{
+				Enable:  true,
+				DataDir: dbPath,
+			},
+			L1NodeURL: "none",
+		}
+
+		storageService, lifecycleManager, err := CreatePersistentStorageService(ctx, &config)
+		Require(t, err)
+		defer lifecycleManager.StopAndWaitUntil(time.Second)
+		das, err := NewSignAfterStoreDAS(ctx, config, storageService)
+		Require(t, err)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		store := &downableStore{DataAvailabilityService: das}
+		details, err := NewServiceDetails(store, *pubKey, uint64(1<<i))
+		Require(t, err)
+		backends = append(backends, *details)
+		stores = append(stores, store)
+	}
+	lagging := stores[numBackendDAS-1]
+	atomic.StoreInt32(&lagging.down, 1)
+
+	aggConfig := AggregatorConfig{
+		AssumedHonest: 2,
+		BackgroundStore: BackgroundStoreConfig{
+			Enable:        true,
+			QueueDir:      t.TempDir(),
+			RetryInterval: time.Millisecond * 10,
+			StoreTimeout:  time.Second,
+		},
+	}
+	aggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggConfig, L1NodeURL: "none"}, backends)
+	Require(t, err)
+
+	rawMsg := []byte("It's time for you to see the fnords.")
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+	cert, err := aggregator.Store(ctx, rawMsg, timeout, []byte{})
+	Require(t, err, "Error storing message")
+	if cert.SignersMask&(1<<(numBackendDAS-1)) != 0 {
+		Fail(t, "The lagging backend signed the certificate")
+	}
+	if aggregator.storeQueue.backlog() != 1 {
+		Fail(t, "Expected the message to be queued, backlog is", aggregator.storeQueue.backlog())
+	}
+
+	// the queue survives a restart of the aggregator
+	restarted, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggConfig, L1NodeURL: "none"}, backends)
+	Require(t, err)
+	if restarted.storeQueue.backlog() != 1 {
+		Fail(t, "Expected the queued message to be loaded, backlog is", restarted.storeQueue.backlog())
+	}
+	Require(t, restarted.Start(ctx))
+	defer func() {
+		Require(t, restarted.Close(ctx))
+	}()
+
+	atomic.StoreInt32(&lagging.down, 0)
+	for i := 0; restarted.storeQueue.backlog() != 0; i++ {
+		if i >= 500 {
+			Fail(t, "Timed out waiting for the background store")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	messageRetrieved, err := lagging.GetByHash(ctx, cert.DataHash[:])
+	Require(t, err, "Failed to retrieve message from the lagging backend")
+	if !bytes.Equal(rawMsg, messageRetrieved) {
+		Fail(t, "Retrieved message is not the same as stored one.")
+	}
+}
+
+func TestDAS_BackgroundStoreRetriesEachBackend(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var backends []ServiceDetails
+	var stores []*downableStore
+	for _, d := range newTestCommittee(ctx, t, 4) {
+		store := &downableStore{DataAvailabilityService: d.service}
+		details, err := NewServiceDetails(store, d.pubKey, d.signersMask)
+		Require(t, err)
+		backends = append(backends, *details)
+		stores = append(stores, store)
+	}
+	lagging, dead := stores[2], stores[3]
+	atomic.StoreInt32(&lagging.down, 1)
+	atomic.StoreInt32(&dead.down, 1)
+
+	aggConfig := AggregatorConfig{
+		AssumedHonest: 3,
+		BackgroundStore: BackgroundStoreConfig{
+			Enable:        true,
+			QueueDir:      t.TempDir(),
+			RetryInterval: time.Hour,
+			StoreTimeout:  time.Second,
+		},
+	}
+	aggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: aggConfig, L1NodeURL: "none"}, backends)
+	Require(t, err)
+
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+	messages := [][]byte{[]byte("first fnord"), []byte("second fnord")}
+	var certs []*arbstate.DataAvailabilityCertificate
+	for _, message := range messages {
+		cert, err := aggregator.Store(ctx, message, timeout, []byte{})
+		Require(t, err, "Error storing message")
+		certs = append(certs, cert)
+	}
+	if aggregator.storeQueue.backlog() != len(messages) {
+		Fail(t, "Expected the messages to be queued, backlog is", aggregator.storeQueue.backlog())
+	}
+
+	// wait for the stores the aggregator didn't wait for
+	for i := 0; atomic.LoadInt32(&lagging.failures) != int32(len(messages)) || atomic.LoadInt32(&dead.failures) != int32(len(messages)); i++ {
+		if i >= 500 {
+			Fail(t, "Timed out waiting for the failed stores")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// the dead backend is tried once per pass, and doesn't hold up the lagging one
+	atomic.StoreInt32(&lagging.down, 0)
+	atomic.StoreInt32(&dead.failures, 0)
+	aggregator.storeQueue.retryAll(ctx, aggregator)
+	if failures := atomic.LoadInt32(&dead.failures); failures != 1 {
+		Fail(t, "Expected the dead backend to be tried once, got", failures)
+	}
+	for i, cert := range certs {
+		messageRetrieved, err := lagging.GetByHash(ctx, cert.DataHash[:])
+		Require(t, err, "Failed to retrieve message from the lagging backend")
+		if !bytes.Equal(messages[i], messageRetrieved) {
+			Fail(t, "Retrieved message is not the same as stored one.")
+		}
+	}
+	for _, store := range aggregator.storeQueue.pending {
+		if store.pendingMask != backends[3].signersMask {
+			Fail(t, "Expected the batches to be pending on the dead backend only, got mask", store.pendingMask)
+		}
+	}
+
+	// the same batch queued for another keyset is kept separately
+	otherKeyset := common.HexToHash("0x0ec")
+	Require(t, aggregator.storeQueue.add(otherKeyset, certs[0].DataHash, messages[0], timeout, []byte{}, false, 1))
+	if aggregator.storeQueue.backlog() != len(messages)+1 {
+		Fail(t, "Expected the batch to be queued for both keysets, backlog is", aggregator.storeQueue.backlog())
+	}
+}
+
+type testL1BlockNumber struct {
+	blockNum uint64
+}
+
+func (r *testL1BlockNumber) BlockNumber(ctx context.Context) (uint64, error) {
+	return atomic.LoadUint64(&r.blockNum), nil
+}
+
+func newTestCommittee(ctx context.Context, t *testing.T, numBackendDAS int) []ServiceDetails {
+	var backends []ServiceDetails
+	for i := 0; i < numBackendDAS; i++ {
+		dbPath := t.TempDir()
+		_, _, err := GenerateAndStoreKeys(dbPath)
+		Require(t, err)
+
+		config := DataAvailabilityConfig{
+			Enable: true,
+			KeyConfig: KeyConfig{
+				KeyDir: dbPath,
+			},
+			LocalFileStorageConfig: LocalFileStorageConfig{
+				Enable:  true,
+				DataDir: dbPath,
+			},
+			L1NodeURL: "none",
+		}
+
+		storageService, lifecycleManager, err := CreatePersistentStorageService(ctx, &config)
+		Require(t, err)
+		t.Cleanup(func() { lifecycleManager.StopAndWaitUntil(time.Second) })
+		das, err := NewSignAfterStoreDAS(ctx, config, storageService)
+		Require(t, err)
+		pubKey, _, err := ReadKeysFromFile(dbPath)
+		Require(t, err)
+		details, err := NewServiceDetails(das, *pubKey, uint64(1<<i))
+		Require(t, err)
+		backends = append(backends, *details)
+	}
+	return backends
+}
+
+func TestDAS_KeysetRotation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	backends := newTestCommittee(ctx, t, 3)
+	nextBackends := newTestCommittee(ctx, t, 4)
+	config := AggregatorConfig{
+		AssumedHonest: 1,
+		NextKeyset: NextKeysetConfig{
+			Enable:           true,
+			AssumedHonest:    2,
+			ActivationBlock:  100,
+			FinalizeDistance: 2,
+		},
+	}
+	aggregator, err := NewAggregator(ctx, DataAvailabilityConfig{AggregatorConfig: config, L1NodeURL: "none"}, backends)
+	Require(t, err)
+	l1 := &testL1BlockNumber{99}
+	Require(t, aggregator.SetNextKeyset(nextBackends, l1))
+
+	// both keysets are known, so certificates of either can be checked
+	keysets := make(map[[32]byte][]byte)
+	for _, keyset := range aggregator.Keysets() {
+		var hash [32]byte
+		copy(hash[:], crypto.Keccak256(keyset))
+		keysets[hash] = keyset
+	}
+	if len(keysets) != 2 {
+		Fail(t, "Expected two keysets, got", len(keysets))
+	}
+	checkCert := func(cert *arbstate.DataAvailabilityCertificate, expectedKeyset *aggregatorKeyset) {
+		t.Helper()
+		if cert.KeysetHash != expectedKeyset.keysetHash {
+			Fail(t, "Certificate signed with the wrong keyset")
+		}
+		keyset, err := arbstate.DeserializeKeyset(bytes.NewReader(keysets[cert.KeysetHash]))
+		Require(t, err)
+		Require(t, keyset.VerifySignature(cert.SignersMask, cert.SerializeSignableFields(), cert.Sig))
+	}
+
+	rawMsg := []byte("It's time for you to see the fnords.")
+	cert, err := aggregator.Store(ctx, rawMsg, 0, []byte{})
+	Require(t, err, "Error storing message")
+	checkCert(cert, aggregator.keyset)
+
+	// the activation block isn't final yet
+	atomic.StoreUint64(&l1.blockNum, 101)
+	cert, err = aggregator.Store(ctx, rawMsg, 0, []byte{})
+	Require(t, err, "Error storing message")
+	checkCert(cert, aggregator.keyset)
+
+	atomic.StoreUint64(&l1.blockNum, 102)
+	rotatedMsg := []byte("The fnords are gone.")
+	cert, err = aggregator.Store(ctx, rotatedMsg, 0, []byte{})
+	Require(t, err, "Error storing message after the rotation")
+	checkCert(cert, aggregator.nextKeyset)
+
+	// the switch is final, even if L1 reorgs back before the activation block
+	atomic.StoreUint64(&l1.blockNum, 99)
+	cert, err = aggregator.Store(ctx, rawMsg, 0, []byte{})
+	Require(t, err, "Error storing message after the reorg")
+	checkCert(cert, aggregator.nextKeyset)
+
+	// data stored with either committee can still be read
+	for _, msg := range [][]byte{rawMsg, rotatedMsg} {
+		messageRetrieved, err := aggregator.GetByHash(ctx, crypto.Keccak256(msg))
+		Require(t, err, "Failed to retrieve message")
+		if !bytes.Equal(msg, messageRetrieved) {
+			Fail(t, "Retrieved message is not the same as stored one.")
+		}
+	}
+}
+
 type failureType int
 
 const (
@@ -61,10 +61,18 @@ func (a *CacheStorageToDASAdapter) Store(ctx context.Context, message []byte, ti
 	return cert, nil
 }
 
+func (a *CacheStorageToDASAdapter) StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	return storeErasureShareTo(a.DataAvailabilityService, ctx, manifest, index, share, timeout, sig)
+}
+
 func (a *CacheStorageToDASAdapter) String() string {
 	return fmt.Sprintf("CacheStorageToDASAdapter{inner: %v, cache: %v}", a.DataAvailabilityService, a.cache)
 }
 
+func (a *CacheStorageToDASAdapter) L1SyncProgress() *L1SyncProgress {
+	return l1SyncProgressOf(a.DataAvailabilityService)
+}
+
 type emptyStorageService struct {
 }
 
@@ -38,6 +38,12 @@ func (c *syncedKeysetCache) put(key [32]byte, value []byte) {
 	c.cache[key] = value
 }
 
+func (c *syncedKeysetCache) add(keysetBytes []byte) {
+	var hash [32]byte
+	copy(hash[:], crypto.Keccak256(keysetBytes))
+	c.put(hash, keysetBytes)
+}
+
 type ChainFetchDAS struct {
 	DataAvailabilityService
 	seqInboxCaller   *bridgegen.SequencerInboxCaller
@@ -45,6 +51,9 @@ type ChainFetchDAS struct {
 	keysetCache      syncedKeysetCache
 }
 
+// ChainFetchReader looks up the keysets missing from the inner reader in the Sequencer Inbox.
+// Keysets are found by their creation block, which is kept when they're invalidated, so both
+// keysets of a rotation are found during and after the overlap.
 type ChainFetchReader struct {
 	arbstate.DataAvailabilityReader
 	seqInboxCaller   *bridgegen.SequencerInboxCaller
@@ -87,6 +96,11 @@ func NewChainFetchReaderWithSeqInbox(inner arbstate.DataAvailabilityReader, seqI
 	}, nil
 }
 
+// AddKeyset makes the keyset available without looking it up, such as both keysets of a rotation
+func (this *ChainFetchDAS) AddKeyset(keysetBytes []byte) {
+	this.keysetCache.add(keysetBytes)
+}
+
 func (this *ChainFetchDAS) GetByHash(ctx context.Context, hash []byte) ([]byte, error) {
 	log.Trace("das.ChainFetchDAS.GetByHash", "hash", pretty.FirstFewBytes(hash))
 	return chainFetchGetByHash(ctx, this.DataAvailabilityService, &this.keysetCache, this.seqInboxCaller, this.seqInboxFilterer, hash)
@@ -97,6 +111,14 @@ func (this *ChainFetchReader) GetByHash(ctx context.Context, hash []byte) ([]byt
 	return chainFetchGetByHash(ctx, this.DataAvailabilityReader, &this.keysetCache, this.seqInboxCaller, this.seqInboxFilterer, hash)
 }
 
+func (this *ChainFetchDAS) L1SyncProgress() *L1SyncProgress {
+	return l1SyncProgressOf(this.DataAvailabilityService)
+}
+
+func (this *ChainFetchDAS) StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	return storeErasureShareTo(this.DataAvailabilityService, ctx, manifest, index, share, timeout, sig)
+}
+
 func chainFetchGetByHash(
 	ctx context.Context,
 	daReader arbstate.DataAvailabilityReader,
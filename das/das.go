@@ -42,6 +42,8 @@ type DataAvailabilityConfig struct {
 
 	KeyConfig KeyConfig `koanf:"key"`
 
+	ErasureShare ErasureShareConfig `koanf:"erasure-share"`
+
 	AggregatorConfig              AggregatorConfig              `koanf:"rpc-aggregator"`
 	RestfulClientAggregatorConfig RestfulClientAggregatorConfig `koanf:"rest-aggregator"`
 
@@ -53,6 +55,7 @@ var DefaultDataAvailabilityConfig = DataAvailabilityConfig{
 	RequestTimeout:                5 * time.Second,
 	Enable:                        false,
 	RestfulClientAggregatorConfig: DefaultRestfulClientAggregatorConfig,
+	ErasureShare:                  DefaultErasureShareConfig,
 }
 
 /* TODO put these checks somewhere
@@ -116,6 +119,7 @@ func DataAvailabilityConfigAddOptions(prefix string, f *flag.FlagSet) {
 
 	// Key config for storage
 	KeyConfigAddOptions(prefix+".key", f)
+	ErasureShareConfigAddOptions(prefix+".erasure-share", f)
 
 	// Aggregator options
 	AggregatorConfigAddOptions(prefix+".rpc-aggregator", f)
@@ -139,7 +143,11 @@ func serializeSignableFields(c *arbstate.DataAvailabilityCertificate) []byte {
 func Serialize(c *arbstate.DataAvailabilityCertificate) []byte {
 	buf := make([]byte, 0)
 
-	buf = append(buf, arbstate.DASMessageHeaderFlag)
+	header := arbstate.DASMessageHeaderFlag
+	if c.ErasureCoded {
+		header |= arbstate.ErasureCodedDASMessageHeaderFlag
+	}
+	buf = append(buf, header)
 
 	buf = append(buf, c.KeysetHash[:]...)
 
@@ -55,6 +55,19 @@ func (c *DASRPCClient) Store(ctx context.Context, message []byte, timeout uint64
 	if err := c.clnt.CallContext(ctx, &ret, "das_store", hexutil.Bytes(message), hexutil.Uint64(timeout), hexutil.Bytes(reqSig)); err != nil {
 		return nil, err
 	}
+	return certFromStoreResult(&ret)
+}
+
+func (c *DASRPCClient) StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, reqSig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	log.Trace("das.DASRPCClient.StoreErasureShare(...)", "index", index, "share", pretty.FirstFewBytes(share), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(reqSig), "this", *c)
+	var ret StoreResult
+	if err := c.clnt.CallContext(ctx, &ret, "das_storeErasureShare", hexutil.Bytes(manifest), hexutil.Uint64(index), hexutil.Bytes(share), hexutil.Uint64(timeout), hexutil.Bytes(reqSig)); err != nil {
+		return nil, err
+	}
+	return certFromStoreResult(&ret)
+}
+
+func certFromStoreResult(ret *StoreResult) (*arbstate.DataAvailabilityCertificate, error) {
 	var keysetHash [32]byte
 	copy(keysetHash[:], ret.KeysetHash)
 	var dataHash [32]byte
@@ -69,6 +82,8 @@ func (c *DASRPCClient) Store(ctx context.Context, message []byte, timeout uint64
 		SignersMask: uint64(ret.SignersMask),
 		Sig:         respSig,
 		KeysetHash:  keysetHash,
+
+		ErasureCoded: ret.ErasureCoded,
 	}, nil
 }
 
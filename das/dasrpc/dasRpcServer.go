@@ -5,6 +5,7 @@ package dasrpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/rpc"
 
+	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/blsSignatures"
 	"github.com/offchainlabs/nitro/das"
 	"github.com/offchainlabs/nitro/util/pretty"
@@ -62,6 +64,8 @@ type StoreResult struct {
 	SignersMask hexutil.Uint64 `json:"signersMask,omitempty"`
 	KeysetHash  hexutil.Bytes  `json:"keysetHash,omitempty"`
 	Sig         hexutil.Bytes  `json:"sig,omitempty"`
+
+	ErasureCoded bool `json:"erasureCoded,omitempty"`
 }
 
 func (serv *DASRPCServer) Store(ctx context.Context, message hexutil.Bytes, timeout hexutil.Uint64, sig hexutil.Bytes) (*StoreResult, error) {
@@ -71,13 +75,33 @@ func (serv *DASRPCServer) Store(ctx context.Context, message hexutil.Bytes, time
 	if err != nil {
 		return nil, err
 	}
+	return storeResultFromCert(cert), nil
+}
+
+func (serv *DASRPCServer) StoreErasureShare(ctx context.Context, manifest hexutil.Bytes, index hexutil.Uint64, share hexutil.Bytes, timeout hexutil.Uint64, sig hexutil.Bytes) (*StoreResult, error) {
+	log.Trace("dasRpc.DASRPCServer.StoreErasureShare", "index", index, "share", pretty.FirstFewBytes(share), "share length", len(share), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(sig), "this", serv)
+
+	writer, ok := serv.localDAS.(das.ErasureShareWriter)
+	if !ok {
+		return nil, errors.New("this DAS doesn't store erasure shares")
+	}
+	cert, err := writer.StoreErasureShare(ctx, manifest, uint64(index), share, uint64(timeout), sig)
+	if err != nil {
+		return nil, err
+	}
+	return storeResultFromCert(cert), nil
+}
+
+func storeResultFromCert(cert *arbstate.DataAvailabilityCertificate) *StoreResult {
 	return &StoreResult{
 		KeysetHash:  cert.KeysetHash[:],
 		DataHash:    cert.DataHash[:],
 		Timeout:     hexutil.Uint64(cert.Timeout),
 		SignersMask: hexutil.Uint64(cert.SignersMask),
 		Sig:         blsSignatures.SignatureToBytes(cert.Sig),
-	}, nil
+
+		ErasureCoded: cert.ErasureCoded,
+	}
 }
 
 func (serv *DASRPCServer) GetByHash(ctx context.Context, certBytes hexutil.Bytes) (hexutil.Bytes, error) {
@@ -10,6 +10,7 @@ import (
 	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/offchainlabs/nitro/arbutil"
 
 	"github.com/offchainlabs/nitro/das"
@@ -22,32 +23,74 @@ type BackendConfig struct {
 }
 
 func NewRPCAggregator(ctx context.Context, config das.DataAvailabilityConfig) (*das.Aggregator, error) {
-	services, err := setUpServices(config.AggregatorConfig)
+	services, err := setUpServices(config.AggregatorConfig.Backends)
 	if err != nil {
 		return nil, err
 	}
-	return das.NewAggregator(ctx, config, services)
+	aggregator, err := das.NewAggregator(ctx, config, services)
+	if err != nil {
+		return nil, err
+	}
+	var l1client arbutil.L1Interface
+	if config.AggregatorConfig.NextKeyset.Enable && config.L1NodeURL != "none" {
+		l1client, err = ethclient.DialContext(ctx, config.L1NodeURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := setUpNextKeyset(aggregator, config.AggregatorConfig, l1client); err != nil {
+		return nil, err
+	}
+	return aggregator, nil
 }
 
 func NewRPCAggregatorWithL1Info(config das.AggregatorConfig, l1client arbutil.L1Interface, seqInboxAddress common.Address) (*das.Aggregator, error) {
-	services, err := setUpServices(config)
+	services, err := setUpServices(config.Backends)
+	if err != nil {
+		return nil, err
+	}
+	aggregator, err := das.NewAggregatorWithL1Info(config, services, l1client, seqInboxAddress)
 	if err != nil {
 		return nil, err
 	}
-	return das.NewAggregatorWithL1Info(config, services, l1client, seqInboxAddress)
+	if err := setUpNextKeyset(aggregator, config, l1client); err != nil {
+		return nil, err
+	}
+	return aggregator, nil
 }
 
-func NewRPCAggregatorWithSeqInboxCaller(config das.AggregatorConfig, seqInboxCaller *bridgegen.SequencerInboxCaller) (*das.Aggregator, error) {
-	services, err := setUpServices(config)
+func NewRPCAggregatorWithSeqInboxCaller(config das.AggregatorConfig, l1client arbutil.L1Interface, seqInboxCaller *bridgegen.SequencerInboxCaller) (*das.Aggregator, error) {
+	services, err := setUpServices(config.Backends)
+	if err != nil {
+		return nil, err
+	}
+	aggregator, err := das.NewAggregatorWithSeqInboxCaller(config, services, seqInboxCaller)
 	if err != nil {
 		return nil, err
 	}
-	return das.NewAggregatorWithSeqInboxCaller(config, services, seqInboxCaller)
+	if config.ErasureCoding.Enable && l1client != nil && seqInboxCaller != nil {
+		aggregator.SetWasmModuleRootReader(das.NewWasmModuleRootReader(l1client, seqInboxCaller))
+	}
+	if err := setUpNextKeyset(aggregator, config, l1client); err != nil {
+		return nil, err
+	}
+	return aggregator, nil
+}
+
+func setUpNextKeyset(aggregator *das.Aggregator, config das.AggregatorConfig, l1client arbutil.L1Interface) error {
+	if !config.NextKeyset.Enable {
+		return nil
+	}
+	services, err := setUpServices(config.NextKeyset.Backends)
+	if err != nil {
+		return err
+	}
+	return aggregator.SetNextKeyset(services, l1client)
 }
 
-func setUpServices(config das.AggregatorConfig) ([]das.ServiceDetails, error) {
+func setUpServices(backends string) ([]das.ServiceDetails, error) {
 	var cs []BackendConfig
-	err := json.Unmarshal([]byte(config.Backends), &cs)
+	err := json.Unmarshal([]byte(backends), &cs)
 	if err != nil {
 		return nil, err
 	}
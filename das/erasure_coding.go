@@ -0,0 +1,169 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
+	"github.com/offchainlabs/nitro/solgen/go/rollupgen"
+)
+
+// ErasureCodingConfig has an Aggregator certify batches that each backend only stores a share of
+type ErasureCodingConfig struct {
+	Enable          bool     `koanf:"enable"`
+	DataShares      int      `koanf:"data-shares"`
+	WasmModuleRoots []string `koanf:"wasm-module-roots"`
+}
+
+var DefaultErasureCodingConfig = ErasureCodingConfig{
+	Enable:          false,
+	DataShares:      1,
+	WasmModuleRoots: []string{},
+}
+
+func ErasureCodingConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultErasureCodingConfig.Enable, "have each backend store one erasure coded share of every batch instead of all of it; the backends must be configured with matching erasure-share options")
+	f.Int(prefix+".data-shares", DefaultErasureCodingConfig.DataShares, "Number of shares (K) needed to recover a batch, which must be at most assumed-honest (H). The keyset then assumes H+1-K honest backends, so that K honest backends sign every certificate.")
+	f.StringSlice(prefix+".wasm-module-roots", DefaultErasureCodingConfig.WasmModuleRoots, "wasm module roots whose replay binaries read erasure coded certificates; batches are only erasure coded while the rollup's wasm module root is one of these, and are stored whole to every backend otherwise")
+}
+
+func (c *ErasureCodingConfig) moduleRoots() (map[common.Hash]bool, error) {
+	roots := make(map[common.Hash]bool)
+	for _, root := range c.WasmModuleRoots {
+		hash := common.HexToHash(root)
+		if hash == (common.Hash{}) {
+			return nil, fmt.Errorf("invalid erasure coding wasm module root %v", root)
+		}
+		roots[hash] = true
+	}
+	if c.Enable && len(roots) == 0 {
+		return nil, errors.New("erasure coding needs the wasm module roots that read erasure coded certificates")
+	}
+	return roots, nil
+}
+
+// WasmModuleRootReader reads the rollup's current wasm module root
+type WasmModuleRootReader interface {
+	WasmModuleRoot(opts *bind.CallOpts) ([32]byte, error)
+}
+
+// rollupModuleRootReader reads the wasm module root of the rollup the sequencer inbox belongs to,
+// looking the rollup up on first use
+type rollupModuleRootReader struct {
+	l1client       arbutil.L1Interface
+	seqInboxCaller *bridgegen.SequencerInboxCaller
+
+	mutex  sync.Mutex
+	rollup *rollupgen.RollupUserLogicCaller
+}
+
+func NewWasmModuleRootReader(l1client arbutil.L1Interface, seqInboxCaller *bridgegen.SequencerInboxCaller) WasmModuleRootReader {
+	return &rollupModuleRootReader{
+		l1client:       l1client,
+		seqInboxCaller: seqInboxCaller,
+	}
+}
+
+func (r *rollupModuleRootReader) WasmModuleRoot(opts *bind.CallOpts) ([32]byte, error) {
+	r.mutex.Lock()
+	if r.rollup == nil {
+		rollupAddress, err := r.seqInboxCaller.Rollup(opts)
+		if err != nil {
+			r.mutex.Unlock()
+			return [32]byte{}, err
+		}
+		r.rollup, err = rollupgen.NewRollupUserLogicCaller(rollupAddress, r.l1client)
+		if err != nil {
+			r.mutex.Unlock()
+			return [32]byte{}, err
+		}
+	}
+	rollup := r.rollup
+	r.mutex.Unlock()
+	return rollup.WasmModuleRoot(opts)
+}
+
+// ErasureShareWriter is a committee member that stores one erasure coded share of each batch
+type ErasureShareWriter interface {
+	// StoreErasureShare stores the serialized erasure coding manifest and the share at index until
+	// timeout, where sig is the batch poster's signature of the manifest. The certificate it returns
+	// is for the manifest, and signed for the index and the share's hash.
+	StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error)
+}
+
+// ErrErasureSharesUnsupported is returned by a service that can't store erasure shares, which retrying won't change
+var ErrErasureSharesUnsupported = errors.New("erasure shares aren't supported")
+
+// storeErasureShareTo has a wrapped DataAvailabilityService store an erasure share, if it can
+func storeErasureShareTo(inner DataAvailabilityService, ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	writer, ok := inner.(ErasureShareWriter)
+	if !ok {
+		return nil, fmt.Errorf("%w by %v", ErrErasureSharesUnsupported, inner)
+	}
+	return writer.StoreErasureShare(ctx, manifest, index, share, timeout, sig)
+}
+
+// innermostService unwraps the wrappers that pass erasure shares through to the service they wrap,
+// since they all implement ErasureShareWriter whether or not the service they wrap does
+func innermostService(service DataAvailabilityService) DataAvailabilityService {
+	for {
+		switch wrapper := service.(type) {
+		case *RetryWrapper:
+			service = wrapper.DataAvailabilityService
+		case *TimeoutWrapper:
+			service = wrapper.DataAvailabilityService
+		case *CacheStorageToDASAdapter:
+			service = wrapper.DataAvailabilityService
+		case *ChainFetchDAS:
+			service = wrapper.DataAvailabilityService
+		default:
+			return service
+		}
+	}
+}
+
+// ErasureShareConfig has a DAS accept the erasure coded shares of batches with the given index
+type ErasureShareConfig struct {
+	Enable      bool `koanf:"enable"`
+	Index       int  `koanf:"index"`
+	DataShares  int  `koanf:"data-shares"`
+	TotalShares int  `koanf:"total-shares"`
+}
+
+var DefaultErasureShareConfig = ErasureShareConfig{
+	Enable:      false,
+	Index:       0,
+	DataShares:  1,
+	TotalShares: 1,
+}
+
+func ErasureShareConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".enable", DefaultErasureShareConfig.Enable, "accept this DAS's erasure coded share of batches, instead of the whole batch; for use in a committee whose aggregator has erasure coding enabled")
+	f.Int(prefix+".index", DefaultErasureShareConfig.Index, "the share to store, which is the position of this DAS's bit in the aggregator's signers mask")
+	f.Int(prefix+".data-shares", DefaultErasureShareConfig.DataShares, "number of shares needed to recover a batch, as configured in the aggregator")
+	f.Int(prefix+".total-shares", DefaultErasureShareConfig.TotalShares, "number of shares every batch is split into, which is the number of backends in the aggregator")
+}
+
+func (c *ErasureShareConfig) Validate() error {
+	if !c.Enable {
+		return nil
+	}
+	if c.DataShares <= 0 || c.DataShares > c.TotalShares || c.TotalShares > arbstate.MaxErasureShares {
+		return fmt.Errorf("invalid erasure share config: %v data shares out of %v", c.DataShares, c.TotalShares)
+	}
+	if c.Index < 0 || c.Index >= c.TotalShares {
+		return fmt.Errorf("invalid erasure share index %v out of %v shares", c.Index, c.TotalShares)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/util/stopwaiter"
+)
+
+type ExpirationPrunerConfig struct {
+	Interval time.Duration `koanf:"interval"`
+	DryRun   bool          `koanf:"dry-run"`
+}
+
+var DefaultExpirationPrunerConfig = ExpirationPrunerConfig{
+	Interval: time.Hour,
+	DryRun:   false,
+}
+
+func ExpirationPrunerConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Duration(prefix+".interval", DefaultExpirationPrunerConfig.Interval, "how often to delete data past its expiry timeout, when discard-after-timeout is set (0 = never)")
+	f.Bool(prefix+".dry-run", DefaultExpirationPrunerConfig.DryRun, "only log and measure the expired data instead of deleting it")
+}
+
+// pruneFunc deletes the data that expired before now, or only finds it if dryRun is set,
+// and returns how many items and bytes that was.
+type pruneFunc func(ctx context.Context, now uint64, dryRun bool) (int64, int64, error)
+
+// expirationPruner periodically deletes expired data from a storage service
+type expirationPruner struct {
+	stopWaiter stopwaiter.StopWaiterSafe
+	name       string
+	config     ExpirationPrunerConfig
+	prune      pruneFunc
+
+	prunedItemsCounter   metrics.Counter
+	prunedBytesCounter   metrics.Counter
+	expiredItemsGauge    metrics.Gauge
+	expiredBytesGauge    metrics.Gauge
+	pruneFailuresCounter metrics.Counter
+}
+
+// startExpirationPruner runs the pruner of the named storage service, if it's configured to run
+func startExpirationPruner(ctx context.Context, name string, config ExpirationPrunerConfig, prune pruneFunc) (*expirationPruner, error) {
+	if config.Interval <= 0 {
+		return nil, nil
+	}
+	prefix := "arb/das/" + name + "/pruner/"
+	p := &expirationPruner{
+		name:                 name,
+		config:               config,
+		prune:                prune,
+		prunedItemsCounter:   metrics.GetOrRegisterCounter(prefix+"pruned/items", nil),
+		prunedBytesCounter:   metrics.GetOrRegisterCounter(prefix+"pruned/bytes", nil),
+		expiredItemsGauge:    metrics.GetOrRegisterGauge(prefix+"expired/items", nil),
+		expiredBytesGauge:    metrics.GetOrRegisterGauge(prefix+"expired/bytes", nil),
+		pruneFailuresCounter: metrics.GetOrRegisterCounter(prefix+"failures", nil),
+	}
+	if err := p.stopWaiter.Start(ctx); err != nil {
+		return nil, err
+	}
+	err := p.stopWaiter.CallIteratively(func(ctx context.Context) time.Duration {
+		p.pruneOnce(ctx)
+		return p.config.Interval
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *expirationPruner) pruneOnce(ctx context.Context) {
+	items, reclaimed, err := p.prune(ctx, uint64(time.Now().Unix()), p.config.DryRun)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.pruneFailuresCounter.Inc(1)
+			log.Warn("Failed to prune expired DAS data", "storage", p.name, "err", err)
+		}
+		return
+	}
+	if p.config.DryRun {
+		// what's expired stays around, so this is what a real run would reclaim
+		p.expiredItemsGauge.Update(items)
+		p.expiredBytesGauge.Update(reclaimed)
+		log.Info("Found expired DAS data (dry run)", "storage", p.name, "items", items, "bytes", reclaimed)
+		return
+	}
+	p.prunedItemsCounter.Inc(items)
+	p.prunedBytesCounter.Inc(reclaimed)
+	p.expiredItemsGauge.Update(0)
+	p.expiredBytesGauge.Update(0)
+	if items > 0 {
+		log.Info("Pruned expired DAS data", "storage", p.name, "items", items, "bytes", reclaimed)
+	}
+}
+
+// stop is a no-op on the nil pruner of a storage service that doesn't prune
+func (p *expirationPruner) stop() {
+	if p != nil {
+		p.stopWaiter.StopAndWait()
+	}
+}
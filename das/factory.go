@@ -25,7 +25,7 @@ func CreatePersistentStorageService(
 	}
 
 	if config.LocalFileStorageConfig.Enable {
-		s, err := NewLocalFileStorageService(config.LocalFileStorageConfig.DataDir)
+		s, err := NewLocalFileStorageService(ctx, config.LocalFileStorageConfig)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -34,7 +34,7 @@ func CreatePersistentStorageService(
 	}
 
 	if config.S3StorageServiceConfig.Enable {
-		s, err := NewS3StorageService(config.S3StorageServiceConfig)
+		s, err := NewS3StorageService(ctx, config.S3StorageServiceConfig)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -7,9 +7,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/base32"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
@@ -21,28 +24,53 @@ import (
 )
 
 type LocalFileStorageConfig struct {
-	Enable  bool   `koanf:"enable"`
-	DataDir string `koanf:"data-dir"`
+	Enable              bool                   `koanf:"enable"`
+	DataDir             string                 `koanf:"data-dir"`
+	DiscardAfterTimeout bool                   `koanf:"discard-after-timeout"`
+	Pruner              ExpirationPrunerConfig `koanf:"pruner"`
 }
 
 var DefaultLocalFileStorageConfig = LocalFileStorageConfig{
 	DataDir: "",
+	Pruner:  DefaultExpirationPrunerConfig,
 }
 
 func LocalFileStorageConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Bool(prefix+".enable", DefaultLocalFileStorageConfig.Enable, "enable storage/retrieval of sequencer batch data from a directory of files, one per batch")
 	f.String(prefix+".data-dir", DefaultLocalFileStorageConfig.DataDir, "local data directory")
+	f.Bool(prefix+".discard-after-timeout", DefaultLocalFileStorageConfig.DiscardAfterTimeout, "discard data after its expiry timeout")
+	ExpirationPrunerConfigAddOptions(prefix+".pruner", f)
 }
 
+// Each file's expiry timeout is kept in a file of the same name with this suffix.
+// Files stored before expiry timeouts were recorded have none, and are kept forever.
+const expirationFileSuffix = ".expires"
+
 type LocalFileStorageService struct {
-	dataDir string
+	dataDir             string
+	discardAfterTimeout bool
+	pruner              *expirationPruner
+
+	// held while writing, and while deleting an expired file, so a file stored again isn't deleted
+	mutex sync.Mutex
 }
 
-func NewLocalFileStorageService(dataDir string) (StorageService, error) {
-	if unix.Access(dataDir, unix.W_OK|unix.R_OK) != nil {
-		return nil, fmt.Errorf("Couldn't start LocalFileStorageService, directory '%s' must be readable and writeable", dataDir)
+func NewLocalFileStorageService(ctx context.Context, config LocalFileStorageConfig) (StorageService, error) {
+	if unix.Access(config.DataDir, unix.W_OK|unix.R_OK) != nil {
+		return nil, fmt.Errorf("Couldn't start LocalFileStorageService, directory '%s' must be readable and writeable", config.DataDir)
+	}
+	s := &LocalFileStorageService{
+		dataDir:             config.DataDir,
+		discardAfterTimeout: config.DiscardAfterTimeout,
 	}
-	return &LocalFileStorageService{dataDir: dataDir}, nil
+	if config.DiscardAfterTimeout {
+		pruner, err := startExpirationPruner(ctx, "localfile", config.Pruner, s.pruneExpired)
+		if err != nil {
+			return nil, err
+		}
+		s.pruner = pruner
+	}
+	return s, nil
 }
 
 func (s *LocalFileStorageService) GetByHash(ctx context.Context, key []byte) ([]byte, error) {
@@ -67,6 +95,24 @@ func (s *LocalFileStorageService) GetByHash(ctx context.Context, key []byte) ([]
 func (s *LocalFileStorageService) Put(ctx context.Context, data []byte, timeout uint64) error {
 	log.Trace("das.LocalFileStorageService.Store", "message", pretty.FirstFewBytes(data), "timeout", time.Unix(int64(timeout), 0), "this", s)
 	fileName := EncodeStorageServiceKey(crypto.Keccak256(data))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The expiry timeout is written first, so the data is never left without one.
+	// Storing the data again only ever extends it.
+	if existing, err := s.readExpiration(fileName); err == nil && existing > timeout {
+		timeout = existing
+	}
+	var expiration [8]byte
+	binary.BigEndian.PutUint64(expiration[:], timeout)
+	if err := s.writeFile(fileName+expirationFileSuffix, expiration[:]); err != nil {
+		return err
+	}
+	return s.writeFile(fileName, data)
+}
+
+func (s *LocalFileStorageService) writeFile(fileName string, data []byte) error {
 	finalPath := s.dataDir + "/" + fileName
 
 	// Use a temp file and rename to achieve atomic writes.
@@ -88,7 +134,72 @@ func (s *LocalFileStorageService) Put(ctx context.Context, data []byte, timeout
 	}
 
 	return os.Rename(f.Name(), finalPath)
+}
+
+func (s *LocalFileStorageService) readExpiration(fileName string) (uint64, error) {
+	expiration, err := os.ReadFile(s.dataDir + "/" + fileName + expirationFileSuffix)
+	if err != nil {
+		return 0, err
+	}
+	if len(expiration) != 8 {
+		return 0, fmt.Errorf("expiry timeout file of %s has length %d", fileName, len(expiration))
+	}
+	return binary.BigEndian.Uint64(expiration), nil
+}
+
+// pruneExpired deletes the files whose expiry timeout is before now
+func (s *LocalFileStorageService) pruneExpired(ctx context.Context, now uint64, dryRun bool) (int64, int64, error) {
+	entries, err := os.ReadDir(s.dataDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var items, reclaimed int64
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return items, reclaimed, ctx.Err()
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), expirationFileSuffix) {
+			continue
+		}
+		fileName := strings.TrimSuffix(entry.Name(), expirationFileSuffix)
+		size, expired, err := s.pruneIfExpired(fileName, now, dryRun)
+		if err != nil {
+			log.Warn("Failed to prune expired DAS file", "file", fileName, "err", err)
+			continue
+		}
+		if expired {
+			items++
+			reclaimed += size
+		}
+	}
+	return items, reclaimed, nil
+}
 
+func (s *LocalFileStorageService) pruneIfExpired(fileName string, now uint64, dryRun bool) (int64, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	expiration, err := s.readExpiration(fileName)
+	if err != nil || expiration >= now {
+		return 0, false, err
+	}
+	path := s.dataDir + "/" + fileName
+	var size int64
+	info, err := os.Stat(path)
+	if err == nil {
+		size = info.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, false, err
+	}
+	if dryRun {
+		return size, true, nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, false, err
+	}
+	if err := os.Remove(path + expirationFileSuffix); err != nil {
+		return 0, false, err
+	}
+	return size, true, nil
 }
 
 func (s *LocalFileStorageService) Sync(ctx context.Context) error {
@@ -96,11 +207,16 @@ func (s *LocalFileStorageService) Sync(ctx context.Context) error {
 }
 
 func (s *LocalFileStorageService) Close(ctx context.Context) error {
+	s.pruner.stop()
 	return nil
 }
 
 func (s *LocalFileStorageService) ExpirationPolicy(ctx context.Context) (arbstate.ExpirationPolicy, error) {
-	return arbstate.KeepForever, nil
+	if s.discardAfterTimeout {
+		return arbstate.DiscardAfterDataTimeout, nil
+	} else {
+		return arbstate.KeepForever, nil
+	}
 }
 
 func (s *LocalFileStorageService) String() string {
@@ -0,0 +1,74 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestLocalFileStorageServicePruning(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	config := LocalFileStorageConfig{
+		Enable:              true,
+		DataDir:             dataDir,
+		DiscardAfterTimeout: true,
+	}
+	storageService, err := NewLocalFileStorageService(ctx, config)
+	Require(t, err)
+	defer storageService.Close(ctx)
+	s := storageService.(*LocalFileStorageService)
+
+	expiring := []byte("This batch expires first.")
+	lasting := []byte("This batch lasts longer.")
+	legacy := []byte("This batch was stored before expiry timeouts were recorded.")
+	Require(t, s.Put(ctx, expiring, 100))
+	// storing it again doesn't shorten its lifetime
+	Require(t, s.Put(ctx, expiring, 50))
+	Require(t, s.Put(ctx, lasting, 200))
+	Require(t, os.WriteFile(dataDir+"/"+EncodeStorageServiceKey(crypto.Keccak256(legacy)), legacy, 0600))
+
+	checkStored := func(data []byte, shouldBeStored bool) {
+		t.Helper()
+		_, err := s.GetByHash(ctx, crypto.Keccak256(data))
+		if shouldBeStored {
+			Require(t, err)
+		} else if !errors.Is(err, ErrNotFound) {
+			Fail(t, "Expected the batch to be pruned, got", err)
+		}
+	}
+
+	items, reclaimed, err := s.pruneExpired(ctx, 80, false)
+	Require(t, err)
+	if items != 0 || reclaimed != 0 {
+		Fail(t, "Pruned", items, "batches before any expired")
+	}
+
+	items, reclaimed, err = s.pruneExpired(ctx, 150, true)
+	Require(t, err)
+	if items != 1 || reclaimed != int64(len(expiring)) {
+		Fail(t, "Dry run found", items, "expired batches of", reclaimed, "bytes")
+	}
+	checkStored(expiring, true)
+
+	items, reclaimed, err = s.pruneExpired(ctx, 150, false)
+	Require(t, err)
+	if items != 1 || reclaimed != int64(len(expiring)) {
+		Fail(t, "Pruned", items, "batches of", reclaimed, "bytes")
+	}
+	checkStored(expiring, false)
+	checkStored(lasting, true)
+	checkStored(legacy, true)
+
+	items, _, err = s.pruneExpired(ctx, 150, false)
+	Require(t, err)
+	if items != 0 {
+		Fail(t, "Pruned", items, "batches again")
+	}
+}
@@ -56,3 +56,7 @@ func (*readLimitedDataAvailabilityService) Store(ctx context.Context, message []
 func (s *readLimitedDataAvailabilityService) String() string {
 	return fmt.Sprintf("ReadLimitedDataAvailabilityService(%v)", s.DataAvailabilityReader)
 }
+
+func (s *readLimitedDataAvailabilityService) L1SyncProgress() *L1SyncProgress {
+	return l1SyncProgressOf(s.DataAvailabilityReader)
+}
@@ -55,8 +55,9 @@ func NewRestfulDasServerOnListener(listener net.Listener, storageService arbstat
 }
 
 type RestfulDasServerResponse struct {
-	Data             string `json:"data,omitempty"`
-	ExpirationPolicy string `json:"expirationPolicy,omitempty"`
+	Data             string          `json:"data,omitempty"`
+	ExpirationPolicy string          `json:"expirationPolicy,omitempty"`
+	L1SyncProgress   *L1SyncProgress `json:"l1SyncProgress,omitempty"`
 }
 
 var cacheControlKey = http.CanonicalHeaderKey("cache-control")
@@ -91,7 +92,17 @@ func (rds *RestfulDasServer) HealthHandler(w http.ResponseWriter, r *http.Reques
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
+	// A DAS that eagerly syncs from L1 also reports how far it has got.
+	progress := l1SyncProgressOf(rds.storage)
+	if progress == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	err = json.NewEncoder(w).Encode(RestfulDasServerResponse{L1SyncProgress: progress})
+	if err != nil {
+		log.Warn("Failed encoding and writing response", "path", requestPath, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 }
 
 func (rds *RestfulDasServer) ExpirationPolicyHandler(w http.ResponseWriter, r *http.Request, requestPath string) {
@@ -5,6 +5,7 @@ package das
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -65,6 +66,28 @@ func (w *RetryWrapper) Store(ctx context.Context, message []byte, timeout uint64
 	return res, nil
 }
 
+func (w *RetryWrapper) StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	var res *arbstate.DataAvailabilityCertificate
+	err := backoff.Retry(func() error {
+		if ctx.Err() != nil {
+			return backoff.Permanent(ctx.Err())
+		}
+		data, err := storeErasureShareTo(w.DataAvailabilityService, ctx, manifest, index, share, timeout, sig)
+		if errors.Is(err, ErrErasureSharesUnsupported) {
+			return backoff.Permanent(err)
+		}
+		if err != nil {
+			return err
+		}
+		res = data
+		return nil
+	}, w.backoffPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (w *RetryWrapper) String() string {
 	return fmt.Sprintf("RetryWrapper{%v}", w.DataAvailabilityService)
 }
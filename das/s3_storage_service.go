@@ -6,8 +6,12 @@ package das
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -31,17 +35,31 @@ type S3Downloader interface {
 	Download(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error)
 }
 
+// S3ObjectPruner lists, inspects, and deletes objects, to extend their expiry timeouts and prune the expired ones
+type S3ObjectPruner interface {
+	s3.ListObjectsV2APIClient
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
 type S3StorageServiceConfig struct {
-	Enable              bool   `koanf:"enable"`
-	AccessKey           string `koanf:"access-key"`
-	Bucket              string `koanf:"bucket"`
-	ObjectPrefix        string `koanf:"object-prefix"`
-	Region              string `koanf:"region"`
-	SecretKey           string `koanf:"secret-key"`
-	DiscardAfterTimeout bool   `koanf:"discard-after-timeout"`
+	Enable              bool                   `koanf:"enable"`
+	AccessKey           string                 `koanf:"access-key"`
+	Bucket              string                 `koanf:"bucket"`
+	ObjectPrefix        string                 `koanf:"object-prefix"`
+	Region              string                 `koanf:"region"`
+	SecretKey           string                 `koanf:"secret-key"`
+	DiscardAfterTimeout bool                   `koanf:"discard-after-timeout"`
+	Pruner              ExpirationPrunerConfig `koanf:"pruner"`
+}
+
+var DefaultS3StorageServiceConfig = S3StorageServiceConfig{
+	Pruner: DefaultExpirationPrunerConfig,
 }
 
-var DefaultS3StorageServiceConfig = S3StorageServiceConfig{}
+// Objects' expiry timeouts are kept in this user-defined metadata key.
+// Objects stored before expiry timeouts were recorded have none, and are kept forever.
+const s3ExpirationMetadataKey = "expiration"
 
 func S3ConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Bool(prefix+".enable", DefaultS3StorageServiceConfig.Enable, "enable storage/retrieval of sequencer batch data from an AWS S3 bucket")
@@ -51,6 +69,7 @@ func S3ConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.String(prefix+".region", DefaultS3StorageServiceConfig.Region, "S3 region")
 	f.String(prefix+".secret-key", DefaultS3StorageServiceConfig.SecretKey, "S3 secret key")
 	f.Bool(prefix+".discard-after-timeout", DefaultS3StorageServiceConfig.DiscardAfterTimeout, "discard data after its expiry timeout")
+	ExpirationPrunerConfigAddOptions(prefix+".pruner", f)
 
 }
 
@@ -60,22 +79,51 @@ type S3StorageService struct {
 	objectPrefix        string
 	uploader            S3Uploader
 	downloader          S3Downloader
+	objectPruner        S3ObjectPruner
 	discardAfterTimeout bool
+	pruner              *expirationPruner
+
+	// an object's lock is held while storing it, and while checking it's expired before deleting it
+	keyLocksMutex sync.Mutex
+	keyLocks      map[string]*s3KeyLock
+	// the expiry timeouts of the objects the pruner last listed, which are only read
+	// again once an object is modified; only used by the pruner
+	expirations map[string]s3ObjectExpiration
+}
+
+type s3KeyLock struct {
+	sync.Mutex
+	holders int
+}
+
+type s3ObjectExpiration struct {
+	lastModified time.Time
+	expiration   uint64
+	expires      bool
 }
 
-func NewS3StorageService(config S3StorageServiceConfig) (StorageService, error) {
+func NewS3StorageService(ctx context.Context, config S3StorageServiceConfig) (StorageService, error) {
 	client := s3.New(s3.Options{
 		Region:      config.Region,
 		Credentials: aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(config.AccessKey, config.SecretKey, "")),
 	})
-	return &S3StorageService{
+	s3s := &S3StorageService{
 		client:              client,
 		bucket:              config.Bucket,
 		objectPrefix:        config.ObjectPrefix,
 		uploader:            manager.NewUploader(client),
 		downloader:          manager.NewDownloader(client),
+		objectPruner:        client,
 		discardAfterTimeout: config.DiscardAfterTimeout,
-	}, nil
+	}
+	if config.DiscardAfterTimeout {
+		pruner, err := startExpirationPruner(ctx, "s3", config.Pruner, s3s.pruneExpired)
+		if err != nil {
+			return nil, err
+		}
+		s3s.pruner = pruner
+	}
+	return s3s, nil
 }
 
 func (s3s *S3StorageService) GetByHash(ctx context.Context, key []byte) ([]byte, error) {
@@ -91,16 +139,34 @@ func (s3s *S3StorageService) GetByHash(ctx context.Context, key []byte) ([]byte,
 
 func (s3s *S3StorageService) Put(ctx context.Context, value []byte, timeout uint64) error {
 	log.Trace("das.S3StorageService.Store", "message", pretty.FirstFewBytes(value), "timeout", timeout, "this", s3s)
+	key := s3s.objectPrefix + EncodeStorageServiceKey(crypto.Keccak256(value))
+
+	defer s3s.lockKey(key)()
+
+	// Storing the data again only ever extends its expiry timeout.
+	head, err := s3s.headObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	if head != nil {
+		if expiration, expires := s3ExpirationOf(key, head); !expires || expiration >= timeout {
+			return nil
+		}
+	}
 
 	putObjectInput := s3.PutObjectInput{
 		Bucket: aws.String(s3s.bucket),
-		Key:    aws.String(s3s.objectPrefix + EncodeStorageServiceKey(crypto.Keccak256(value))),
-		Body:   bytes.NewReader(value)}
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(value),
+		Metadata: map[string]string{
+			s3ExpirationMetadataKey: strconv.FormatUint(timeout, 10),
+		},
+	}
 	if !s3s.discardAfterTimeout {
 		expires := time.Unix(int64(timeout), 0)
 		putObjectInput.Expires = &expires
 	}
-	_, err := s3s.uploader.Upload(ctx, &putObjectInput)
+	_, err = s3s.uploader.Upload(ctx, &putObjectInput)
 	if err != nil {
 		log.Error("das.S3StorageService.Store", "err", err)
 	}
@@ -111,7 +177,143 @@ func (s3s *S3StorageService) Sync(ctx context.Context) error {
 	return nil
 }
 
+// lockKey locks the object with the key, without blocking the other objects, and returns the function to unlock it
+func (s3s *S3StorageService) lockKey(key string) func() {
+	s3s.keyLocksMutex.Lock()
+	if s3s.keyLocks == nil {
+		s3s.keyLocks = make(map[string]*s3KeyLock)
+	}
+	lock, ok := s3s.keyLocks[key]
+	if !ok {
+		lock = &s3KeyLock{}
+		s3s.keyLocks[key] = lock
+	}
+	lock.holders++
+	s3s.keyLocksMutex.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s3s.keyLocksMutex.Lock()
+		defer s3s.keyLocksMutex.Unlock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(s3s.keyLocks, key)
+		}
+	}
+}
+
+// headObject returns the object's metadata, or nil if it doesn't exist
+func (s3s *S3StorageService) headObject(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	head, err := s3s.objectPruner.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(key),
+	})
+	if s3StatusCode(err) == http.StatusNotFound {
+		return nil, nil
+	}
+	return head, err
+}
+
+// s3StatusCode is the HTTP status code S3 failed a request with, or 0 if there's none
+func s3StatusCode(err error) int {
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+// s3ExpirationOf returns the object's expiry timeout, and whether it has one
+func s3ExpirationOf(key string, head *s3.HeadObjectOutput) (uint64, bool) {
+	encoded, ok := head.Metadata[s3ExpirationMetadataKey]
+	if !ok {
+		return 0, false
+	}
+	expiration, err := strconv.ParseUint(encoded, 10, 64)
+	if err != nil {
+		log.Warn("Invalid expiry timeout of DAS object", "key", key, "expiration", encoded)
+		return 0, false
+	}
+	return expiration, true
+}
+
+// pruneExpired deletes the objects whose expiry timeout is before now.
+// Only the objects that are new or modified since the last run are inspected.
+func (s3s *S3StorageService) pruneExpired(ctx context.Context, now uint64, dryRun bool) (int64, int64, error) {
+	var items, reclaimed int64
+	listed := make(map[string]s3ObjectExpiration)
+	paginator := s3.NewListObjectsV2Paginator(s3s.objectPruner, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s3s.bucket),
+		Prefix: aws.String(s3s.objectPrefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return items, reclaimed, err
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			cached, ok := s3s.expirations[key]
+			if !ok || !cached.lastModified.Equal(aws.ToTime(object.LastModified)) {
+				head, err := s3s.headObject(ctx, key)
+				if err != nil {
+					return items, reclaimed, err
+				}
+				if head == nil {
+					continue
+				}
+				cached.lastModified = aws.ToTime(head.LastModified)
+				cached.expiration, cached.expires = s3ExpirationOf(key, head)
+			}
+			if !cached.expires || cached.expiration >= now {
+				listed[key] = cached
+				continue
+			}
+			if dryRun {
+				listed[key] = cached
+			} else {
+				deleted, err := s3s.deleteIfExpired(ctx, key, now)
+				if err != nil {
+					return items, reclaimed, err
+				}
+				if !deleted {
+					continue
+				}
+			}
+			items++
+			reclaimed += object.Size
+		}
+	}
+	s3s.expirations = listed
+	return items, reclaimed, nil
+}
+
+// deleteIfExpired deletes the object if it's still expired, so it isn't deleted after being stored
+// again with a later expiry timeout. The version checked is the one deleted, so in a versioned
+// bucket, a version stored by another writer in the meantime is kept too.
+func (s3s *S3StorageService) deleteIfExpired(ctx context.Context, key string, now uint64) (bool, error) {
+	defer s3s.lockKey(key)()
+	head, err := s3s.headObject(ctx, key)
+	if err != nil || head == nil {
+		return false, err
+	}
+	if expiration, expires := s3ExpirationOf(key, head); !expires || expiration >= now {
+		return false, nil
+	}
+	_, err = s3s.objectPruner.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(s3s.bucket),
+		Key:       aws.String(key),
+		VersionId: head.VersionId,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (s3s *S3StorageService) Close(ctx context.Context) error {
+	s3s.pruner.stop()
 	return nil
 }
 
@@ -7,60 +7,165 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/offchainlabs/nitro/cmd/genericconf"
 )
 
-type mockS3Uploader struct {
-	mockStorageService StorageService
+// mockS3Bucket is a versioned bucket, whose objects are modified one second apart
+type mockS3Bucket struct {
+	mutex   sync.Mutex
+	objects map[string]*mockS3Object
+	version int64
+	heads   int
+	// called before each delete, to have another writer modify the bucket in between
+	beforeDelete func(key string)
+	// called before each upload, to hold it up
+	beforeUpload func(key string)
 }
 
-func (m *mockS3Uploader) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(input.Body)
+type mockS3Object struct {
+	data         []byte
+	metadata     map[string]string
+	lastModified time.Time
+	versionId    string
+}
+
+type mockS3Error struct {
+	statusCode int
+}
+
+func (e *mockS3Error) Error() string {
+	return fmt.Sprintf("mock S3 request failed with status %d", e.statusCode)
+}
+
+func (e *mockS3Error) HTTPStatusCode() int {
+	return e.statusCode
+}
+
+func newMockS3Bucket() *mockS3Bucket {
+	return &mockS3Bucket{objects: make(map[string]*mockS3Object)}
+}
+
+func (b *mockS3Bucket) put(key string, data []byte, metadata map[string]string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.version++
+	b.objects[key] = &mockS3Object{data, metadata, time.Unix(b.version, 0), strconv.FormatInt(b.version, 10)}
+}
+
+func (b *mockS3Bucket) Upload(ctx context.Context, input *s3.PutObjectInput, opts ...func(*manager.Uploader)) (*manager.UploadOutput, error) {
+	if b.beforeUpload != nil {
+		b.beforeUpload(aws.ToString(input.Key))
+	}
+	data, err := io.ReadAll(input.Body)
 	if err != nil {
 		return nil, err
 	}
+	b.put(aws.ToString(input.Key), data, input.Metadata)
+	return &manager.UploadOutput{}, nil
+}
 
-	err = m.mockStorageService.Put(ctx, buf.Bytes(), 0)
-	return nil, err
+func (b *mockS3Bucket) Download(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
+	b.mutex.Lock()
+	object, ok := b.objects[aws.ToString(input.Key)]
+	b.mutex.Unlock()
+	if !ok {
+		return 0, ErrNotFound
+	}
+	ret, err := w.WriteAt(object.data, 0)
+	return int64(ret), err
 }
 
-type mockS3Downloader struct {
-	mockStorageService StorageService
+// ListObjectsV2 lists two objects per page
+func (b *mockS3Bucket) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key >= aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	output := &s3.ListObjectsV2Output{}
+	for i, key := range keys {
+		if i == 2 {
+			output.IsTruncated = true
+			output.NextContinuationToken = aws.String(key)
+			break
+		}
+		object := b.objects[key]
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			LastModified: aws.Time(object.lastModified),
+			Size:         int64(len(object.data)),
+		})
+	}
+	return output, nil
 }
 
-func (m *mockS3Downloader) Download(ctx context.Context, w io.WriterAt, input *s3.GetObjectInput, options ...func(*manager.Downloader)) (n int64, err error) {
-	key, err := DecodeStorageServiceKey(*input.Key)
-	if err != nil {
-		return 0, err
+func (b *mockS3Bucket) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.heads++
+	object, ok := b.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &mockS3Error{http.StatusNotFound}
 	}
-	res, err := m.mockStorageService.GetByHash(ctx, key)
-	if err != nil {
-		return 0, err
+	metadata := make(map[string]string)
+	for k, v := range object.metadata {
+		metadata[k] = v
 	}
+	return &s3.HeadObjectOutput{
+		Metadata:     metadata,
+		LastModified: aws.Time(object.lastModified),
+		VersionId:    aws.String(object.versionId),
+	}, nil
+}
 
-	ret, err := w.WriteAt(res, 0)
-	if err != nil {
-		return 0, err
+// DeleteObject of an earlier version than the object's current one leaves it in place
+func (b *mockS3Bucket) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if b.beforeDelete != nil {
+		b.beforeDelete(aws.ToString(params.Key))
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	object, ok := b.objects[aws.ToString(params.Key)]
+	if ok && (params.VersionId == nil || *params.VersionId == object.versionId) {
+		delete(b.objects, aws.ToString(params.Key))
 	}
-	return int64(ret), nil
+	return &s3.DeleteObjectOutput{}, nil
 }
 
-func NewTestS3StorageService(ctx context.Context, s3Config genericconf.S3Config) (StorageService, error) {
-	mockStorageService := NewMemoryBackedStorageService(ctx)
+func newTestS3StorageService(bucket *mockS3Bucket, objectPrefix string, discardAfterTimeout bool) *S3StorageService {
 	return &S3StorageService{
-		bucket:     s3Config.Bucket,
-		uploader:   &mockS3Uploader{mockStorageService},
-		downloader: &mockS3Downloader{mockStorageService}}, nil
+		bucket:              "test",
+		objectPrefix:        objectPrefix,
+		uploader:            bucket,
+		downloader:          bucket,
+		objectPruner:        bucket,
+		discardAfterTimeout: discardAfterTimeout,
+	}
+}
+
+func NewTestS3StorageService(ctx context.Context, s3Config genericconf.S3Config) (StorageService, error) {
+	return newTestS3StorageService(newMockS3Bucket(), "", false), nil
 }
 
 func TestS3StorageService(t *testing.T) {
@@ -91,3 +196,118 @@ func TestS3StorageService(t *testing.T) {
 		t.Fatal(val, val1)
 	}
 }
+
+func TestS3StorageServicePruning(t *testing.T) {
+	ctx := context.Background()
+	bucket := newMockS3Bucket()
+	s := newTestS3StorageService(bucket, "das/", true)
+
+	expiring := []byte("This batch expires first.")
+	lasting := []byte("This batch lasts longer.")
+	legacy := []byte("This batch was stored before expiry timeouts were recorded.")
+	Require(t, s.Put(ctx, expiring, 100))
+	// storing it again doesn't shorten its lifetime
+	Require(t, s.Put(ctx, expiring, 50))
+	Require(t, s.Put(ctx, lasting, 200))
+	bucket.put("das/"+EncodeStorageServiceKey(crypto.Keccak256(legacy)), legacy, nil)
+	// nor give a lifetime to data kept forever
+	Require(t, s.Put(ctx, legacy, 50))
+	bucket.put("other/"+EncodeStorageServiceKey(crypto.Keccak256(expiring)), expiring, map[string]string{s3ExpirationMetadataKey: "1"})
+
+	checkStored := func(data []byte, shouldBeStored bool) {
+		t.Helper()
+		_, err := s.GetByHash(ctx, crypto.Keccak256(data))
+		if shouldBeStored {
+			Require(t, err)
+		} else if !errors.Is(err, ErrNotFound) {
+			Fail(t, "Expected the batch to be pruned, got", err)
+		}
+	}
+	checkPruned := func(now uint64, dryRun bool, expectedItems int64, expectedBytes int) {
+		t.Helper()
+		items, reclaimed, err := s.pruneExpired(ctx, now, dryRun)
+		Require(t, err)
+		if items != expectedItems || reclaimed != int64(expectedBytes) {
+			Fail(t, "Pruned", items, "batches of", reclaimed, "bytes, expected", expectedItems, "of", expectedBytes)
+		}
+	}
+
+	heads := bucket.heads
+	checkPruned(80, false, 0, 0)
+	if bucket.heads-heads != 3 {
+		Fail(t, "Expected each object to be inspected once, got", bucket.heads-heads, "inspections")
+	}
+	// objects that weren't modified aren't inspected again
+	heads = bucket.heads
+	checkPruned(80, false, 0, 0)
+	if bucket.heads != heads {
+		Fail(t, "Inspected", bucket.heads-heads, "unmodified objects again")
+	}
+
+	checkPruned(150, true, 1, len(expiring))
+	checkStored(expiring, true)
+
+	// storing it again with a later expiry timeout keeps it
+	Require(t, s.Put(ctx, expiring, 300))
+	checkPruned(150, false, 0, 0)
+	checkStored(expiring, true)
+
+	checkPruned(400, false, 2, len(expiring)+len(lasting))
+	checkStored(expiring, false)
+	checkStored(lasting, false)
+	checkStored(legacy, true)
+	checkPruned(400, false, 0, 0)
+
+	// an object another writer stores again just before it's deleted is kept
+	raced := []byte("This batch is stored again while it's pruned.")
+	Require(t, s.Put(ctx, raced, 500))
+	bucket.beforeDelete = func(key string) {
+		bucket.put(key, raced, map[string]string{s3ExpirationMetadataKey: "1000"})
+	}
+	checkPruned(600, false, 1, len(raced))
+	checkStored(raced, true)
+	bucket.beforeDelete = nil
+	checkPruned(600, false, 0, 0)
+	checkStored(raced, true)
+}
+
+func TestS3StorageServiceConcurrentPuts(t *testing.T) {
+	ctx := context.Background()
+	bucket := newMockS3Bucket()
+	s := newTestS3StorageService(bucket, "", true)
+
+	slow := []byte("This batch's upload is held up.")
+	fast := []byte("This batch is stored meanwhile.")
+	slowKey := EncodeStorageServiceKey(crypto.Keccak256(slow))
+	uploading := make(chan struct{})
+	release := make(chan struct{})
+	bucket.beforeUpload = func(key string) {
+		if key == slowKey {
+			close(uploading)
+			<-release
+		}
+	}
+	slowErr := make(chan error, 1)
+	go func() {
+		slowErr <- s.Put(ctx, slow, 100)
+	}()
+	<-uploading
+
+	// an upload that's held up doesn't block storing other objects
+	fastErr := make(chan error, 1)
+	go func() {
+		fastErr <- s.Put(ctx, fast, 100)
+	}()
+	select {
+	case err := <-fastErr:
+		Require(t, err)
+	case <-time.After(5 * time.Second):
+		Fail(t, "Storing an object was blocked by another object's upload")
+	}
+
+	close(release)
+	Require(t, <-slowErr)
+	if len(s.keyLocks) != 0 {
+		Fail(t, "Expected the objects' locks to be released, got", len(s.keyLocks))
+	}
+}
@@ -48,8 +48,13 @@ func KeyConfigAddOptions(prefix string, f *flag.FlagSet) {
 // constructed, calls to Store(...) will try to verify the passed-in data's signature
 // is from the batch poster. If the contract details are not provided, then the
 // signature is not checked, which is useful for testing.
+//
+// If it's configured to accept an erasure share, SignAfterStoreDAS.StoreErasureShare(...)
+// stores the erasure coding manifest and its share of a batch, and signs a certificate
+// for the manifest which commits to the share's hash.
 type SignAfterStoreDAS struct {
 	config         KeyConfig
+	erasureShare   ErasureShareConfig
 	privKey        *blsSignatures.PrivateKey
 	keysetHash     [32]byte
 	keysetBytes    []byte
@@ -59,7 +64,7 @@ type SignAfterStoreDAS struct {
 
 func NewSignAfterStoreDAS(ctx context.Context, config DataAvailabilityConfig, storageService StorageService) (*SignAfterStoreDAS, error) {
 	if config.L1NodeURL == "none" {
-		return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, nil, storageService)
+		return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, config.ErasureShare, nil, storageService)
 	}
 	l1client, err := ethclient.Dial(config.L1NodeURL)
 	if err != nil {
@@ -70,22 +75,26 @@ func NewSignAfterStoreDAS(ctx context.Context, config DataAvailabilityConfig, st
 		return nil, err
 	}
 	if seqInboxAddress == nil {
-		return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, nil, storageService)
+		return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, config.ErasureShare, nil, storageService)
 	}
 
 	seqInboxCaller, err := bridgegen.NewSequencerInboxCaller(*seqInboxAddress, l1client)
 	if err != nil {
 		return nil, err
 	}
-	return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, seqInboxCaller, storageService)
+	return NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, config.ErasureShare, seqInboxCaller, storageService)
 }
 
 func NewSignAfterStoreDASWithSeqInboxCaller(
 	ctx context.Context,
 	config KeyConfig,
+	erasureShare ErasureShareConfig,
 	seqInboxCaller *bridgegen.SequencerInboxCaller,
 	storageService StorageService,
 ) (*SignAfterStoreDAS, error) {
+	if err := erasureShare.Validate(); err != nil {
+		return nil, err
+	}
 	var privKey *blsSignatures.PrivateKey
 	var err error
 	if len(config.PrivKey) != 0 {
@@ -131,6 +140,7 @@ func NewSignAfterStoreDASWithSeqInboxCaller(
 
 	return &SignAfterStoreDAS{
 		config:         config,
+		erasureShare:   erasureShare,
 		privKey:        privKey,
 		keysetHash:     ksHash,
 		keysetBytes:    ksBuf.Bytes(),
@@ -181,6 +191,67 @@ func (d *SignAfterStoreDAS) Store(ctx context.Context, message []byte, timeout u
 	return c, nil
 }
 
+func (d *SignAfterStoreDAS) StoreErasureShare(ctx context.Context, manifestBytes []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	log.Trace("das.SignAfterStoreDAS.StoreErasureShare", "index", index, "share", pretty.FirstFewBytes(share), "timeout", time.Unix(int64(timeout), 0), "sig", pretty.FirstFewBytes(sig), "this", d)
+	if !d.erasureShare.Enable {
+		return nil, fmt.Errorf("%w: this DAS isn't configured to accept them", ErrErasureSharesUnsupported)
+	}
+	if d.bpVerifier != nil {
+		actualSigner, err := DasRecoverSigner(manifestBytes, timeout, sig)
+		if err != nil {
+			return nil, err
+		}
+		isBatchPoster, err := d.bpVerifier.IsBatchPoster(ctx, actualSigner)
+		if err != nil {
+			return nil, err
+		}
+		if !isBatchPoster {
+			return nil, errors.New("store request not properly signed")
+		}
+	}
+
+	manifest, err := arbstate.DeserializeErasureCodingManifest(bytes.NewReader(manifestBytes))
+	if err != nil {
+		return nil, err
+	}
+	if index != uint64(d.erasureShare.Index) {
+		return nil, fmt.Errorf("got erasure share %v, but this DAS stores share %v", index, d.erasureShare.Index)
+	}
+	if manifest.DataShares != uint64(d.erasureShare.DataShares) || len(manifest.ShareHashes) != d.erasureShare.TotalShares {
+		return nil, fmt.Errorf("got erasure coding of %v data shares out of %v, but this DAS is configured for %v out of %v", manifest.DataShares, len(manifest.ShareHashes), d.erasureShare.DataShares, d.erasureShare.TotalShares)
+	}
+	shareHash := manifest.ShareHashes[index]
+	if uint64(len(share)) != manifest.ShareSize() || !bytes.Equal(crypto.Keccak256(share), shareHash[:]) {
+		return nil, errors.New("erasure share doesn't match the manifest")
+	}
+
+	c := &arbstate.DataAvailabilityCertificate{}
+	copy(c.DataHash[:], crypto.Keccak256(manifestBytes))
+	c.ErasureCoded = true
+	c.Timeout = timeout
+	c.SignersMask = 1 // The aggregator will override this if we're part of a committee.
+
+	c.Sig, err = blsSignatures.SignMessage(*d.privKey, c.SerializeErasureShareSignableFields(index, shareHash))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, data := range [][]byte{manifestBytes, share} {
+		err = d.storageService.Put(ctx, data, timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = d.storageService.Sync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.KeysetHash = d.keysetHash
+
+	return c, nil
+}
+
 func (d *SignAfterStoreDAS) GetByHash(ctx context.Context, hash []byte) ([]byte, error) {
 	return d.storageService.GetByHash(ctx, hash)
 }
@@ -193,6 +264,10 @@ func (d *SignAfterStoreDAS) HealthCheck(ctx context.Context) error {
 	return d.storageService.HealthCheck(ctx)
 }
 
+func (d *SignAfterStoreDAS) L1SyncProgress() *L1SyncProgress {
+	return l1SyncProgressOf(d.storageService)
+}
+
 func (d *SignAfterStoreDAS) ExpirationPolicy(ctx context.Context) (arbstate.ExpirationPolicy, error) {
 	return d.storageService.ExpirationPolicy(ctx)
 }
@@ -2,8 +2,14 @@ package das
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -13,6 +19,7 @@ import (
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
 	"github.com/offchainlabs/nitro/util/arbmath"
+	"github.com/offchainlabs/nitro/util/stopwaiter"
 	flag "github.com/spf13/pflag"
 )
 
@@ -20,6 +27,10 @@ type SyncToStorageConfig struct {
 	Eager                  bool          `koanf:"eager"`
 	EagerStopsWhenCaughtUp bool          `koanf:"eager-stops-when-caught-up"`
 	EagerLowerBoundBlock   uint64        `koanf:"eager-lower-bound-block"`
+	EagerBlocksPerRead     uint64        `koanf:"eager-blocks-per-read"`
+	EagerPollInterval      time.Duration `koanf:"eager-poll-interval"`
+	EagerReorgRewindBlocks uint64        `koanf:"eager-reorg-rewind-blocks"`
+	StateDir               string        `koanf:"state-dir"`
 	RetentionPeriod        time.Duration `koanf:"retention-period"`
 	IgnoreWriteErrors      bool          `koanf:"ignore-write-errors"`
 }
@@ -28,6 +39,10 @@ var DefaultSyncToStorageConfig = SyncToStorageConfig{
 	Eager:                  false,
 	EagerStopsWhenCaughtUp: false,
 	EagerLowerBoundBlock:   0,
+	EagerBlocksPerRead:     1000,
+	EagerPollInterval:      time.Minute,
+	EagerReorgRewindBlocks: 128,
+	StateDir:               "",
 	RetentionPeriod:        time.Duration(math.MaxInt64),
 	IgnoreWriteErrors:      true,
 }
@@ -35,11 +50,55 @@ var DefaultSyncToStorageConfig = SyncToStorageConfig{
 func SyncToStorageConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Bool(prefix+".eager", DefaultSyncToStorageConfig.Eager, "eagerly sync batch data to this DAS's storage from the rest endpoints, using L1 as the index of batch data hashes; otherwise only sync lazily")
 	f.Bool(prefix+".eager-stops-when-caught-up", DefaultSyncToStorageConfig.EagerStopsWhenCaughtUp, "stop the sync process as soon as it is caught up, after which this DAS will only get newer batch data via lazy syncing on missed reads or if the batch poster directly requests it to store the data; otherwise leave it running")
-	f.Uint64(prefix+".eager-lower-bound-block", DefaultSyncToStorageConfig.EagerLowerBoundBlock, "when eagerly syncing, start indexing forward from this L1 block")
+	f.Uint64(prefix+".eager-lower-bound-block", DefaultSyncToStorageConfig.EagerLowerBoundBlock, "when eagerly syncing, start indexing forward from this L1 block, unless the sync state saved in state-dir is further along")
+	f.Uint64(prefix+".eager-blocks-per-read", DefaultSyncToStorageConfig.EagerBlocksPerRead, "when eagerly syncing, max number of L1 blocks to read batches from at once")
+	f.Duration(prefix+".eager-poll-interval", DefaultSyncToStorageConfig.EagerPollInterval, "when eagerly syncing, how long to wait for new L1 blocks once caught up")
+	f.Uint64(prefix+".eager-reorg-rewind-blocks", DefaultSyncToStorageConfig.EagerReorgRewindBlocks, "when eagerly syncing, how many L1 blocks to go back and sync again when the last synced block was reorged out")
+	f.String(prefix+".state-dir", DefaultSyncToStorageConfig.StateDir, "directory to save the last L1 block that was eagerly synced in, to resume from it after a restart (defaults to the local-file-storage data-dir if that is enabled, otherwise the sync state isn't saved)")
 	f.Duration(prefix+".retention-period", DefaultSyncToStorageConfig.RetentionPeriod, "period to retain synced data (defaults to forever)")
 	f.Bool(prefix+".ignore-write-errors", DefaultSyncToStorageConfig.IgnoreWriteErrors, "log only on failures to write when syncing; otherwise treat it as an error")
 }
 
+const l1SyncStateFileName = "l1-sync-state.json"
+
+// L1SyncProgress is how far the eager sync from L1 has got, as reported by the REST health endpoint
+type L1SyncProgress struct {
+	LowerBoundBlock uint64 `json:"lowerBoundBlock"`
+	NextBlock       uint64 `json:"nextBlock"` // the first L1 block not yet fully synced
+	LatestBlock     uint64 `json:"latestBlock"`
+	CaughtUp        bool   `json:"caughtUp"`
+	Stopped         bool   `json:"stopped"`
+	Reorgs          uint64 `json:"reorgs"`
+	LastError       string `json:"lastError,omitempty"`
+}
+
+// L1SyncProgressReporter is implemented by the services that eagerly sync from L1,
+// and by the services wrapping them, so the progress can be found from the top of the stack.
+type L1SyncProgressReporter interface {
+	L1SyncProgress() *L1SyncProgress
+}
+
+// l1SyncProgressOf returns the sync progress of the service, or nil if there's no eager sync below it
+func l1SyncProgressOf(service interface{}) *L1SyncProgress {
+	if reporter, ok := service.(L1SyncProgressReporter); ok {
+		return reporter.L1SyncProgress()
+	}
+	return nil
+}
+
+// l1SyncState is saved to the state dir after every range of L1 blocks is synced
+type l1SyncState struct {
+	SequencerInbox common.Address `json:"sequencerInbox"`
+	NextBlock      uint64         `json:"nextBlock"`
+	// the hash of block NextBlock-1, to tell if it was reorged out before the sync resumes
+	PrevBlockHash common.Hash `json:"prevBlockHash"`
+}
+
+type SyncingFallbackStorageService struct {
+	*FallbackStorageService
+	syncer *l1SyncService
+}
+
 func NewSyncingFallbackStorageService(
 	ctx context.Context,
 	primary StorageService,
@@ -49,83 +108,322 @@ func NewSyncingFallbackStorageService(
 	preventRecursiveGets bool, // if true, return NotFound on simultaneous calls to Gets that miss in primary (prevents infinite recursion)
 	l1client arbutil.L1Interface,
 	seqInboxAddr common.Address,
-	lowerBoundL1BlockNum *uint64,
+	syncConf *SyncToStorageConfig,
 	expirationTime uint64,
-	stopWhenCaughtUp bool,
-) (*FallbackStorageService, error) {
-	go func() {
-		err := SyncStorageServiceFromChain(ctx, primary, backup, l1client, seqInboxAddr, lowerBoundL1BlockNum, expirationTime, stopWhenCaughtUp)
-		if err != nil {
-			log.Warn("Error in SyncStorageServiceFromChain", "err", err)
-		}
-	}()
-	return NewFallbackStorageService(primary, backup, backupRetentionSeconds, ignoreRetentionWriteErrors, preventRecursiveGets), nil
+) (*SyncingFallbackStorageService, error) {
+	syncer, err := newL1SyncService(primary, backup, l1client, seqInboxAddr, syncConf, expirationTime)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncer.start(ctx); err != nil {
+		return nil, err
+	}
+	return &SyncingFallbackStorageService{
+		FallbackStorageService: NewFallbackStorageService(primary, backup, backupRetentionSeconds, ignoreRetentionWriteErrors, preventRecursiveGets),
+		syncer:                 syncer,
+	}, nil
 }
 
-func SyncStorageServiceFromChain(
-	ctx context.Context,
+func (s *SyncingFallbackStorageService) L1SyncProgress() *L1SyncProgress {
+	return s.syncer.progress()
+}
+
+func (s *SyncingFallbackStorageService) Close(ctx context.Context) error {
+	s.syncer.stopWaiter.StopAndWait()
+	return s.FallbackStorageService.Close(ctx)
+}
+
+func (s *SyncingFallbackStorageService) String() string {
+	return "SyncingFallbackStorageService(" + s.FallbackStorageService.String() + ")"
+}
+
+// l1SyncService copies the data of every DAS batch posted to L1 into syncTo,
+// reading the batches forward from the lower bound block in ranges of blocks.
+// After every range it saves the next block to read from, if there's a state dir,
+// so that a restarted sync resumes instead of checking every batch again.
+type l1SyncService struct {
+	stopWaiter stopwaiter.StopWaiterSafe
+
+	syncTo         StorageService
+	dataSource     arbstate.DataAvailabilityReader
+	l1client       arbutil.L1Interface
+	seqInbox       *bridgegen.SequencerInbox
+	seqInboxAddr   common.Address
+	config         *SyncToStorageConfig
+	expirationTime uint64
+
+	mutex         sync.Mutex
+	state         l1SyncState
+	syncProgress  L1SyncProgress
+	stateFilePath string
+}
+
+func newL1SyncService(
 	syncTo StorageService,
 	dataSource arbstate.DataAvailabilityReader,
 	l1client arbutil.L1Interface,
 	seqInboxAddr common.Address,
-	lowerBoundL1BlockNum *uint64,
+	config *SyncToStorageConfig,
 	expirationTime uint64,
-	stopWhenCaughtUp bool,
-) error {
+) (*l1SyncService, error) {
 	// make sure that as we sync, any Keysets missing from dataSource will fetched from the L1 chain
 	dataSource, err := NewChainFetchReader(dataSource, l1client, seqInboxAddr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
 	seqInbox, err := bridgegen.NewSequencerInbox(seqInboxAddr, l1client)
+	if err != nil {
+		return nil, err
+	}
+	if config.EagerBlocksPerRead == 0 {
+		return nil, errors.New("eager-blocks-per-read must be positive")
+	}
+	s := &l1SyncService{
+		syncTo:         syncTo,
+		dataSource:     dataSource,
+		l1client:       l1client,
+		seqInbox:       seqInbox,
+		seqInboxAddr:   seqInboxAddr,
+		config:         config,
+		expirationTime: expirationTime,
+		state: l1SyncState{
+			SequencerInbox: seqInboxAddr,
+			NextBlock:      config.EagerLowerBoundBlock,
+		},
+	}
+	if config.StateDir != "" {
+		s.stateFilePath = filepath.Join(config.StateDir, l1SyncStateFileName)
+		if err := s.loadState(); err != nil {
+			return nil, err
+		}
+	}
+	s.syncProgress.LowerBoundBlock = config.EagerLowerBoundBlock
+	s.syncProgress.NextBlock = s.state.NextBlock
+	return s, nil
+}
+
+// loadState resumes from the saved state, unless it's for another chain or from before the lower bound
+func (s *l1SyncService) loadState() error {
+	contents, err := os.ReadFile(s.stateFilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	seqInboxFilterer := seqInbox.SequencerInboxFilterer
-	eventChan := make(chan *bridgegen.SequencerInboxSequencerBatchData)
-	defer close(eventChan)
-	subscription, err := seqInboxFilterer.WatchSequencerBatchData(&bind.WatchOpts{Context: ctx, Start: lowerBoundL1BlockNum}, eventChan, nil)
+	var saved l1SyncState
+	if err := json.Unmarshal(contents, &saved); err != nil {
+		return fmt.Errorf("couldn't parse DAS sync state file %s: %w", s.stateFilePath, err)
+	}
+	if saved.SequencerInbox != s.seqInboxAddr {
+		log.Warn("Ignoring DAS sync state of another sequencer inbox", "path", s.stateFilePath, "sequencerInbox", saved.SequencerInbox)
+		return nil
+	}
+	if saved.NextBlock <= s.config.EagerLowerBoundBlock {
+		return nil
+	}
+	log.Info("Resuming DAS sync from L1", "nextBlock", saved.NextBlock, "lowerBoundBlock", s.config.EagerLowerBoundBlock)
+	s.state = saved
+	return nil
+}
+
+func (s *l1SyncService) saveState() error {
+	if s.stateFilePath == "" {
+		return nil
+	}
+	contents, err := json.Marshal(&s.state)
 	if err != nil {
 		return err
 	}
-	defer subscription.Unsubscribe()
 
-	latestL1BlockNumber, err := l1client.BlockNumber(ctx)
+	// Use a temp file and rename to achieve atomic writes.
+	f, err := os.CreateTemp(filepath.Dir(s.stateFilePath), "."+l1SyncStateFileName)
 	if err != nil {
 		return err
 	}
-	for {
-		select {
-		case event := <-eventChan:
-			data := event.Data
-			if len(data) >= 41 && arbstate.IsDASMessageHeaderByte(data[40]) {
-				preimages := make(map[common.Hash][]byte)
-				if _, err = arbstate.RecoverPayloadFromDasBatch(ctx, data, dataSource, preimages); err != nil {
-					return err
-				}
-				for hash, contents := range preimages {
-					_, err := syncTo.GetByHash(ctx, hash.Bytes())
-					if errors.Is(err, ErrNotFound) {
-						if err := syncTo.Put(ctx, contents, arbmath.SaturatingUAdd(uint64(time.Now().Unix()), expirationTime)); err != nil {
-							return err
-						}
-					} else if err != nil {
-						return err
-					}
-				}
+	if _, err := f.Write(contents); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.stateFilePath)
+}
+
+func (s *l1SyncService) start(ctx context.Context) error {
+	if err := s.stopWaiter.Start(ctx); err != nil {
+		return err
+	}
+	return s.stopWaiter.LaunchThread(func(ctx context.Context) {
+		defer s.updateProgress(func(p *L1SyncProgress) { p.Stopped = true })
+		for {
+			caughtUp, err := s.syncRange(ctx)
+			if ctx.Err() != nil {
+				return
 			}
-			if stopWhenCaughtUp {
-				if event.Raw.BlockNumber >= latestL1BlockNumber {
-					return syncTo.Sync(ctx)
-				}
-				latestL1BlockNumber, err = l1client.BlockNumber(ctx)
-				if err != nil {
-					return err
+			if err != nil {
+				log.Warn("Error syncing DAS data from L1, will retry", "nextBlock", s.state.NextBlock, "err", err)
+				s.updateProgress(func(p *L1SyncProgress) { p.LastError = err.Error() })
+			} else {
+				s.updateProgress(func(p *L1SyncProgress) { p.LastError = "" })
+			}
+			if caughtUp && s.config.EagerStopsWhenCaughtUp {
+				if err := s.syncTo.Sync(ctx); err != nil {
+					log.Warn("Error syncing DAS storage after catching up with L1", "err", err)
 				}
+				log.Info("DAS sync from L1 caught up, stopping", "nextBlock", s.state.NextBlock)
+				return
+			}
+			if err == nil && !caughtUp {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(s.config.EagerPollInterval):
 			}
-		case <-ctx.Done():
-			return ctx.Err()
 		}
+	})
+}
+
+// syncRange syncs the batches of the next range of L1 blocks, and returns whether that caught up with L1
+func (s *l1SyncService) syncRange(ctx context.Context) (bool, error) {
+	latestBlock, err := s.l1client.BlockNumber(ctx)
+	if err != nil {
+		return false, err
+	}
+	s.updateProgress(func(p *L1SyncProgress) { p.LatestBlock = latestBlock })
+
+	if err := s.rewindIfReorged(ctx, latestBlock); err != nil {
+		return false, err
+	}
+	start := s.state.NextBlock
+	if start > latestBlock {
+		s.updateProgress(func(p *L1SyncProgress) { p.CaughtUp = true })
+		return true, nil
+	}
+	end := start + s.config.EagerBlocksPerRead - 1
+	if end > latestBlock {
+		end = latestBlock
+	}
+	endHeader, err := s.l1client.HeaderByNumber(ctx, new(big.Int).SetUint64(end))
+	if err != nil {
+		return false, err
+	}
+
+	iter, err := s.seqInbox.FilterSequencerBatchData(&bind.FilterOpts{Context: ctx, Start: start, End: &end}, nil)
+	if err != nil {
+		return false, err
+	}
+	defer iter.Close()
+	batches := 0
+	for iter.Next() {
+		if err := s.syncBatch(ctx, iter.Event.Data); err != nil {
+			return false, err
+		}
+		batches++
+	}
+	if err := iter.Error(); err != nil {
+		return false, err
+	}
+	// The range's data must be durable before it's recorded as synced.
+	if batches > 0 {
+		if err := s.syncTo.Sync(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	// If the range was reorged while it was read, the next call finds that endHeader was reorged out.
+	s.state.NextBlock = end + 1
+	s.state.PrevBlockHash = endHeader.Hash()
+	if err := s.saveState(); err != nil {
+		return false, err
 	}
+	caughtUp := end >= latestBlock
+	s.updateProgress(func(p *L1SyncProgress) {
+		p.NextBlock = end + 1
+		p.CaughtUp = caughtUp
+	})
+	return caughtUp, nil
+}
+
+// rewindIfReorged goes back EagerReorgRewindBlocks blocks if the last synced block isn't on the L1 chain anymore
+func (s *l1SyncService) rewindIfReorged(ctx context.Context, latestBlock uint64) error {
+	if s.state.NextBlock == 0 || s.state.PrevBlockHash == (common.Hash{}) {
+		return nil
+	}
+	if s.state.NextBlock-1 <= latestBlock {
+		header, err := s.l1client.HeaderByNumber(ctx, new(big.Int).SetUint64(s.state.NextBlock-1))
+		if err != nil {
+			return err
+		}
+		if header.Hash() == s.state.PrevBlockHash {
+			return nil
+		}
+	}
+
+	rewindTo := s.config.EagerLowerBoundBlock
+	if s.state.NextBlock > rewindTo+s.config.EagerReorgRewindBlocks {
+		rewindTo = s.state.NextBlock - s.config.EagerReorgRewindBlocks
+	}
+	log.Warn("L1 reorg of synced DAS batches, syncing them again", "from", rewindTo, "nextBlock", s.state.NextBlock)
+	var prevBlockHash common.Hash
+	if rewindTo > 0 {
+		header, err := s.l1client.HeaderByNumber(ctx, new(big.Int).SetUint64(rewindTo-1))
+		if err != nil {
+			return err
+		}
+		prevBlockHash = header.Hash()
+	}
+	s.state.NextBlock = rewindTo
+	s.state.PrevBlockHash = prevBlockHash
+	if err := s.saveState(); err != nil {
+		return err
+	}
+	s.updateProgress(func(p *L1SyncProgress) {
+		p.NextBlock = rewindTo
+		p.CaughtUp = false
+		p.Reorgs++
+	})
+	return nil
+}
+
+// syncBatch stores the data of a DAS batch in syncTo, unless it's already there
+func (s *l1SyncService) syncBatch(ctx context.Context, data []byte) error {
+	if len(data) < 41 || !arbstate.IsDASMessageHeaderByte(data[40]) {
+		return nil
+	}
+	preimages := make(map[common.Hash][]byte)
+	if _, err := arbstate.RecoverPayloadFromDasBatch(ctx, data, s.dataSource, preimages); err != nil {
+		return err
+	}
+	for hash, contents := range preimages {
+		_, err := s.syncTo.GetByHash(ctx, hash.Bytes())
+		if errors.Is(err, ErrNotFound) {
+			if err := s.syncTo.Put(ctx, contents, arbmath.SaturatingUAdd(uint64(time.Now().Unix()), s.expirationTime)); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *l1SyncService) updateProgress(update func(*L1SyncProgress)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(&s.syncProgress)
+}
+
+func (s *l1SyncService) progress() *L1SyncProgress {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	progress := s.syncProgress
+	return &progress
 }
@@ -0,0 +1,318 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package das
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
+)
+
+func TestL1SyncStateResumes(t *testing.T) {
+	stateFilePath := filepath.Join(t.TempDir(), l1SyncStateFileName)
+	seqInboxAddr := common.HexToAddress("0x1234")
+	newSyncer := func(seqInboxAddr common.Address, lowerBound uint64) *l1SyncService {
+		return &l1SyncService{
+			seqInboxAddr:  seqInboxAddr,
+			config:        &SyncToStorageConfig{EagerLowerBoundBlock: lowerBound},
+			state:         l1SyncState{SequencerInbox: seqInboxAddr, NextBlock: lowerBound},
+			stateFilePath: stateFilePath,
+		}
+	}
+
+	// nothing saved yet
+	syncer := newSyncer(seqInboxAddr, 100)
+	Require(t, syncer.loadState())
+	if syncer.state.NextBlock != 100 {
+		Fail(t, "Started from block", syncer.state.NextBlock)
+	}
+
+	syncer.state.NextBlock = 500
+	syncer.state.PrevBlockHash = common.HexToHash("0xabcd")
+	Require(t, syncer.saveState())
+
+	syncer = newSyncer(seqInboxAddr, 100)
+	Require(t, syncer.loadState())
+	if syncer.state.NextBlock != 500 || syncer.state.PrevBlockHash != common.HexToHash("0xabcd") {
+		Fail(t, "Resumed from the wrong state", syncer.state)
+	}
+
+	// a lower bound past the saved state wins
+	syncer = newSyncer(seqInboxAddr, 1000)
+	Require(t, syncer.loadState())
+	if syncer.state.NextBlock != 1000 || syncer.state.PrevBlockHash != (common.Hash{}) {
+		Fail(t, "Resumed from before the lower bound", syncer.state)
+	}
+
+	// the state of another chain is ignored
+	syncer = newSyncer(common.HexToAddress("0x5678"), 100)
+	Require(t, syncer.loadState())
+	if syncer.state.NextBlock != 100 {
+		Fail(t, "Resumed from the state of another sequencer inbox", syncer.state)
+	}
+}
+
+// mockSyncL1 is an L1 chain of empty blocks, with DAS batches posted to the sequencer inbox in some of them
+type mockSyncL1 struct {
+	arbutil.L1Interface
+	seqInboxAddr common.Address
+	headers      []*types.Header
+	batches      map[uint64][]byte
+	// the block ranges batches were read from
+	filtered [][2]uint64
+}
+
+func newMockSyncL1(seqInboxAddr common.Address, blocks uint64) *mockSyncL1 {
+	l1 := &mockSyncL1{seqInboxAddr: seqInboxAddr, batches: make(map[uint64][]byte)}
+	l1.reorg(0, blocks, "")
+	return l1
+}
+
+// reorg replaces the blocks from the given one on with a chain of the given length
+func (l1 *mockSyncL1) reorg(from uint64, blocks uint64, fork string) {
+	l1.headers = l1.headers[:from]
+	for i := from; i < blocks; i++ {
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(i),
+			Difficulty: common.Big1,
+			Extra:      []byte(fork),
+		}
+		if i > 0 {
+			header.ParentHash = l1.headers[i-1].Hash()
+		}
+		l1.headers = append(l1.headers, header)
+	}
+}
+
+func (l1 *mockSyncL1) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(len(l1.headers) - 1), nil
+}
+
+func (l1 *mockSyncL1) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if !number.IsUint64() || number.Uint64() >= uint64(len(l1.headers)) {
+		return nil, ethereum.NotFound
+	}
+	return l1.headers[number.Uint64()], nil
+}
+
+func (l1 *mockSyncL1) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	seqInboxABI, err := bridgegen.SequencerInboxMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	event := seqInboxABI.Events["SequencerBatchData"]
+	from, to := query.FromBlock.Uint64(), query.ToBlock.Uint64()
+	l1.filtered = append(l1.filtered, [2]uint64{from, to})
+	var logs []types.Log
+	for block := from; block <= to && block < uint64(len(l1.headers)); block++ {
+		batch, ok := l1.batches[block]
+		if !ok {
+			continue
+		}
+		data, err := event.Inputs.NonIndexed().Pack(batch)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, types.Log{
+			Address:     l1.seqInboxAddr,
+			Topics:      []common.Hash{event.ID, common.BigToHash(new(big.Int).SetUint64(block))},
+			Data:        data,
+			BlockNumber: block,
+			BlockHash:   l1.headers[block].Hash(),
+		})
+	}
+	return logs, nil
+}
+
+// syncCheckingStorage records the next block saved in the sync state file whenever it's synced
+type syncCheckingStorage struct {
+	StorageService
+	stateFilePath string
+	savedAtSync   []uint64
+}
+
+func (s *syncCheckingStorage) Sync(ctx context.Context) error {
+	var saved l1SyncState
+	contents, err := os.ReadFile(s.stateFilePath)
+	if err == nil {
+		err = json.Unmarshal(contents, &saved)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s.savedAtSync = append(s.savedAtSync, saved.NextBlock)
+	return s.StorageService.Sync(ctx)
+}
+
+func newTestL1Sync(t *testing.T, ctx context.Context, l1 *mockSyncL1, syncTo StorageService, dataSource StorageService, stateFilePath string) *l1SyncService {
+	seqInbox, err := bridgegen.NewSequencerInbox(l1.seqInboxAddr, l1)
+	Require(t, err)
+	config := &SyncToStorageConfig{
+		EagerLowerBoundBlock:   2,
+		EagerBlocksPerRead:     10,
+		EagerReorgRewindBlocks: 5,
+	}
+	syncer := &l1SyncService{
+		syncTo:         syncTo,
+		dataSource:     dataSource,
+		l1client:       l1,
+		seqInbox:       seqInbox,
+		seqInboxAddr:   l1.seqInboxAddr,
+		config:         config,
+		expirationTime: 3600,
+		state:          l1SyncState{SequencerInbox: l1.seqInboxAddr, NextBlock: config.EagerLowerBoundBlock},
+		stateFilePath:  stateFilePath,
+	}
+	Require(t, syncer.loadState())
+	return syncer
+}
+
+// postTestDASBatch stores the message to a committee of one, and returns the batch posting its certificate
+func postTestDASBatch(t *testing.T, ctx context.Context, dataSource StorageService, message []byte) []byte {
+	dbPath := t.TempDir()
+	_, _, err := GenerateAndStoreKeys(dbPath)
+	Require(t, err)
+	signer, err := NewSignAfterStoreDASWithSeqInboxCaller(ctx, KeyConfig{KeyDir: dbPath}, ErasureShareConfig{}, nil, dataSource)
+	Require(t, err)
+	timeout := uint64(time.Now().Add(time.Hour).Unix())
+	cert, err := signer.Store(ctx, message, timeout, []byte{})
+	Require(t, err)
+	Require(t, dataSource.Put(ctx, signer.keysetBytes, timeout))
+	return append(make([]byte, 40), Serialize(cert)...)
+}
+
+func TestL1SyncRangeResumes(t *testing.T) {
+	ctx := context.Background()
+	stateFilePath := filepath.Join(t.TempDir(), l1SyncStateFileName)
+	l1 := newMockSyncL1(common.HexToAddress("0x1234"), 20)
+	dataSource := NewMemoryBackedStorageService(ctx)
+	first := []byte("The first synced batch.")
+	second := []byte("The second synced batch.")
+	l1.batches[5] = postTestDASBatch(t, ctx, dataSource, first)
+	l1.batches[15] = postTestDASBatch(t, ctx, dataSource, second)
+
+	syncTo := &syncCheckingStorage{StorageService: NewMemoryBackedStorageService(ctx), stateFilePath: stateFilePath}
+	checkSynced := func(data []byte, shouldBeSynced bool) {
+		t.Helper()
+		_, err := syncTo.GetByHash(ctx, crypto.Keccak256(data))
+		if shouldBeSynced {
+			Require(t, err)
+		} else if !errors.Is(err, ErrNotFound) {
+			Fail(t, "Expected the batch not to be synced yet, got", err)
+		}
+	}
+
+	syncer := newTestL1Sync(t, ctx, l1, syncTo, dataSource, stateFilePath)
+	caughtUp, err := syncer.syncRange(ctx)
+	Require(t, err)
+	if caughtUp || syncer.state.NextBlock != 12 {
+		Fail(t, "Synced to block", syncer.state.NextBlock, "caught up", caughtUp)
+	}
+	checkSynced(first, true)
+	checkSynced(second, false)
+	// the data was synced before the range was saved
+	if len(syncTo.savedAtSync) != 1 || syncTo.savedAtSync[0] != 0 {
+		Fail(t, "Expected one sync before saving, got", syncTo.savedAtSync)
+	}
+
+	// a restarted sync continues after the saved range
+	l1.filtered = nil
+	syncer = newTestL1Sync(t, ctx, l1, syncTo, dataSource, stateFilePath)
+	if syncer.state.NextBlock != 12 {
+		Fail(t, "Resumed from block", syncer.state.NextBlock)
+	}
+	caughtUp, err = syncer.syncRange(ctx)
+	Require(t, err)
+	if !caughtUp || syncer.state.NextBlock != 20 || syncer.state.PrevBlockHash != l1.headers[19].Hash() {
+		Fail(t, "Synced to block", syncer.state.NextBlock, "caught up", caughtUp)
+	}
+	if len(l1.filtered) != 1 || l1.filtered[0] != [2]uint64{12, 19} {
+		Fail(t, "Read batches from blocks", l1.filtered)
+	}
+	checkSynced(second, true)
+	if len(syncTo.savedAtSync) != 2 || syncTo.savedAtSync[1] != 12 {
+		Fail(t, "Expected a sync before saving the second range, got", syncTo.savedAtSync)
+	}
+
+	// ranges without batches don't need syncing
+	l1.reorg(20, 25, "")
+	caughtUp, err = syncer.syncRange(ctx)
+	Require(t, err)
+	if !caughtUp || syncer.state.NextBlock != 25 || len(syncTo.savedAtSync) != 2 {
+		Fail(t, "Synced to block", syncer.state.NextBlock, "caught up", caughtUp, "syncs", syncTo.savedAtSync)
+	}
+}
+
+func TestL1SyncRewindsAfterReorg(t *testing.T) {
+	ctx := context.Background()
+	stateFilePath := filepath.Join(t.TempDir(), l1SyncStateFileName)
+	l1 := newMockSyncL1(common.HexToAddress("0x1234"), 20)
+	dataSource := NewMemoryBackedStorageService(ctx)
+	syncTo := NewMemoryBackedStorageService(ctx)
+	syncer := newTestL1Sync(t, ctx, l1, syncTo, dataSource, stateFilePath)
+	for {
+		caughtUp, err := syncer.syncRange(ctx)
+		Require(t, err)
+		if caughtUp {
+			break
+		}
+	}
+
+	// nothing to rewind while the synced blocks are on the chain
+	Require(t, syncer.rewindIfReorged(ctx, 19))
+	if syncer.state.NextBlock != 20 || syncer.progress().Reorgs != 0 {
+		Fail(t, "Rewound to block", syncer.state.NextBlock, "without a reorg")
+	}
+
+	// a batch posted in a reorg of the last synced blocks is synced
+	l1.reorg(17, 20, "fork")
+	reorged := []byte("A batch posted in the reorg.")
+	l1.batches[18] = postTestDASBatch(t, ctx, dataSource, reorged)
+	l1.filtered = nil
+	caughtUp, err := syncer.syncRange(ctx)
+	Require(t, err)
+	if !caughtUp || syncer.state.NextBlock != 20 || syncer.state.PrevBlockHash != l1.headers[19].Hash() {
+		Fail(t, "Synced to block", syncer.state.NextBlock, "caught up", caughtUp)
+	}
+	if len(l1.filtered) != 1 || l1.filtered[0] != [2]uint64{15, 19} {
+		Fail(t, "Read batches from blocks", l1.filtered)
+	}
+	if syncer.progress().Reorgs != 1 {
+		Fail(t, "Counted", syncer.progress().Reorgs, "reorgs")
+	}
+	synced, err := syncTo.GetByHash(ctx, crypto.Keccak256(reorged))
+	Require(t, err)
+	if !bytes.Equal(synced, reorged) {
+		Fail(t, "Synced batch is not the same as posted one.")
+	}
+
+	// a reorg to a shorter chain rewinds too
+	l1.reorg(17, 19, "short")
+	l1.filtered = nil
+	caughtUp, err = syncer.syncRange(ctx)
+	Require(t, err)
+	if !caughtUp || syncer.state.NextBlock != 19 || syncer.state.PrevBlockHash != l1.headers[18].Hash() {
+		Fail(t, "Synced to block", syncer.state.NextBlock, "caught up", caughtUp)
+	}
+	if len(l1.filtered) != 1 || l1.filtered[0] != [2]uint64{15, 18} {
+		Fail(t, "Read batches from blocks", l1.filtered)
+	}
+	if syncer.progress().Reorgs != 2 {
+		Fail(t, "Counted", syncer.progress().Reorgs, "reorgs")
+	}
+}
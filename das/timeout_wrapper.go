@@ -43,6 +43,12 @@ func (w *TimeoutWrapper) Store(ctx context.Context, message []byte, timeout uint
 	return w.DataAvailabilityService.Store(deadlineCtx, message, timeout, sig)
 }
 
+func (w *TimeoutWrapper) StoreErasureShare(ctx context.Context, manifest []byte, index uint64, share []byte, timeout uint64, sig []byte) (*arbstate.DataAvailabilityCertificate, error) {
+	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now().Add(w.t))
+	defer cancel()
+	return storeErasureShareTo(w.DataAvailabilityService, deadlineCtx, manifest, index, share, timeout, sig)
+}
+
 func (w *TimeoutWrapper) String() string {
 	return fmt.Sprintf("TimeoutWrapper{%v}", w.DataAvailabilityService)
 }
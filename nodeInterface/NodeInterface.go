@@ -4,20 +4,26 @@
 package nodeInterface
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/offchainlabs/nitro/arbnode"
 	"github.com/offchainlabs/nitro/arbos/retryables"
 	"github.com/offchainlabs/nitro/arbos/util"
+	"github.com/offchainlabs/nitro/arbstate"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/arbmath"
 	"github.com/offchainlabs/nitro/util/merkletree"
@@ -34,6 +40,7 @@ type NodeInterface struct {
 	Address       addr
 	backend       core.NodeInterfaceBackendAPI
 	context       context.Context
+	header        *types.Header
 	sourceMessage types.Message
 	returnMessage struct {
 		message *types.Message
@@ -107,6 +114,64 @@ func (n NodeInterface) GetL1Confirmations(c ctx, evm mech, blockHash bytes32) (u
 	return confs, nil
 }
 
+func (n NodeInterface) GetBatchL1Info(c ctx, evm mech, blockNum uint64) (uint64, uint64, bytes32, bytes32, error) {
+	node, err := arbNodeFromNodeInterfaceBackend(n.backend)
+	if err != nil {
+		return 0, 0, bytes32{}, bytes32{}, err
+	}
+	if node.InboxReader == nil {
+		return 0, 0, bytes32{}, bytes32{}, errors.New("node isn't reading batches from L1")
+	}
+	genesis, err := node.TxStreamer.GetGenesisBlockNumber()
+	if err != nil {
+		return 0, 0, bytes32{}, bytes32{}, err
+	}
+	batchNum, err := findBatchContainingBlock(node, genesis, blockNum)
+	if err != nil {
+		return 0, 0, bytes32{}, bytes32{}, err
+	}
+	meta, err := node.InboxTracker.GetBatchMetadata(batchNum)
+	if err != nil {
+		return 0, 0, bytes32{}, bytes32{}, err
+	}
+	batch, err := node.InboxReader.GetSequencerBatch(n.context, batchNum)
+	if err != nil {
+		return 0, 0, bytes32{}, bytes32{}, err
+	}
+	return batchNum, meta.L1Block, batch.TxHash, meta.Accumulator, nil
+}
+
+func (n NodeInterface) GetBatchDASCertificate(c ctx, evm mech, blockNum uint64) (bytes32, bytes32, uint64, uint64, error) {
+	node, err := arbNodeFromNodeInterfaceBackend(n.backend)
+	if err != nil {
+		return bytes32{}, bytes32{}, 0, 0, err
+	}
+	if node.InboxReader == nil {
+		return bytes32{}, bytes32{}, 0, 0, errors.New("node isn't reading batches from L1")
+	}
+	genesis, err := node.TxStreamer.GetGenesisBlockNumber()
+	if err != nil {
+		return bytes32{}, bytes32{}, 0, 0, err
+	}
+	batchNum, err := findBatchContainingBlock(node, genesis, blockNum)
+	if err != nil {
+		return bytes32{}, bytes32{}, 0, 0, err
+	}
+	sequencerMsg, err := node.InboxReader.GetSequencerMessageBytes(n.context, batchNum)
+	if err != nil {
+		return bytes32{}, bytes32{}, 0, 0, err
+	}
+	// the batch data follows the 40 byte header of time bounds and delayed message count
+	if len(sequencerMsg) <= 40 || !arbstate.IsDASMessageHeaderByte(sequencerMsg[40]) {
+		return bytes32{}, bytes32{}, 0, 0, fmt.Errorf("batch %v isn't an AnyTrust batch", batchNum)
+	}
+	cert, err := arbstate.DeserializeDASCertFrom(bytes.NewReader(sequencerMsg[40:]))
+	if err != nil {
+		return bytes32{}, bytes32{}, 0, 0, err
+	}
+	return cert.KeysetHash, cert.DataHash, cert.Timeout, cert.SignersMask, nil
+}
+
 func (n NodeInterface) EstimateRetryableTicket(
 	c ctx,
 	evm mech,
@@ -150,6 +215,98 @@ func (n NodeInterface) EstimateRetryableTicket(
 	return err
 }
 
+func (n NodeInterface) GasEstimateComponents(
+	c ctx,
+	evm mech,
+	value huge,
+	to addr,
+	contractCreation bool,
+	data []byte,
+) (uint64, uint64, huge, huge, error) {
+	if to == types.NodeInterfaceAddress || to == types.NodeInterfaceDebugAddress {
+		return 0, 0, nil, nil, errors.New("cannot estimate virtual contract")
+	}
+	var pTo *addr
+	if !contractCreation {
+		pTo = &to
+	}
+	from := n.sourceMessage.From()
+	statedb, ok := evm.StateDB.(*state.StateDB)
+	if !ok {
+		return 0, 0, nil, nil, errors.New("failed to get state database")
+	}
+
+	baseFee, err := c.State.L2PricingState().BaseFeeWei()
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	l1Pricing := c.State.L1PricingState()
+	l1BaseFeeEstimate, err := l1Pricing.L1BaseFeeEstimateWei()
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+
+	message := func(gas uint64) Message {
+		return types.NewMessage(from, pTo, statedb.GetNonce(from), value, gas, common.Big0, common.Big0, common.Big0, data, nil, true)
+	}
+
+	// The poster's data cost is charged in L2 gas before execution, at the L2 base fee
+	gasForL1 := uint64(0)
+	poster, err := l1Pricing.ReimbursableAggregatorForSender(from)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	if poster != nil && baseFee.Sign() > 0 {
+		posterCost, _ := l1Pricing.PosterDataCost(message(n.sourceMessage.Gas()), from, *poster)
+		gasForL1 = arbmath.BigToUintSaturating(arbmath.BigDiv(posterCost, baseFee))
+	}
+
+	succeeds := func(gas uint64) (bool, error) {
+		msg := message(gas)
+		evm, vmError, err := n.backend.GetEVM(n.context, msg, statedb.Copy(), n.header, &vm.Config{NoBaseFee: true})
+		if err != nil {
+			return false, err
+		}
+		core.ReadyEVMForL2(evm, msg)
+		gasPool := new(core.GasPool).AddGas(math.MaxUint64)
+		result, err := core.ApplyMessage(evm, msg, gasPool)
+		if err := vmError(); err != nil {
+			return false, err
+		}
+		if errors.Is(err, core.ErrIntrinsicGas) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return !result.Failed(), nil
+	}
+
+	// Binary search for the lowest gas limit the transaction succeeds with, as eth_estimateGas does
+	low := params.TxGas - 1
+	high := n.sourceMessage.Gas()
+	success, err := succeeds(high)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	if !success {
+		return 0, 0, nil, nil, fmt.Errorf("transaction fails with the maximum gas of %v", high)
+	}
+	for low+1 < high {
+		mid := low + (high-low)/2
+		success, err := succeeds(mid)
+		if err != nil {
+			return 0, 0, nil, nil, err
+		}
+		if success {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return high, gasForL1, baseFee, l1BaseFeeEstimate, nil
+}
+
 func (n NodeInterface) ConstructOutboxProof(c ctx, evm mech, size, leaf uint64) (bytes32, bytes32, []bytes32, error) {
 
 	hash0 := bytes32{}
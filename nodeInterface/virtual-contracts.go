@@ -66,6 +66,7 @@ func init() {
 				duplicate := *nodeInterfaceImpl
 				duplicate.backend = backend
 				duplicate.context = ctx
+				duplicate.header = header
 				duplicate.sourceMessage = msg
 				duplicate.returnMessage.message = returnMessage
 				duplicate.returnMessage.changed = &swapMessages
@@ -0,0 +1,219 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcaster"
+)
+
+// Messages ahead of the next expected sequence number are held for at most this long,
+// waiting for some upstream to fill the gap, before the relay skips ahead.
+// Likewise, the first messages are held for this long, or until every upstream has delivered,
+// so the relay's feed starts at the oldest message any upstream replays.
+const gapTimeout = 5 * time.Second
+
+// A gap is also skipped once this many messages are waiting behind it
+const maxPendingMessages = 1024
+
+var gapCounter = metrics.NewRegisteredCounter("arb/relay/gaps", nil)
+
+type upstreamFeed struct {
+	url         string
+	hasReceived bool
+	lastSeqNum  arbutil.MessageIndex
+	messages    uint64
+	duplicates  uint64
+	outOfOrder  uint64
+
+	messagesCounter   metrics.Counter
+	duplicatesCounter metrics.Counter
+	outOfOrderCounter metrics.Counter
+	lastSeqNumGauge   metrics.Gauge
+}
+
+// UpstreamStats is a snapshot of what the relay has received from one upstream feed.
+type UpstreamStats struct {
+	URL                string
+	HasReceived        bool
+	LastSequenceNumber arbutil.MessageIndex
+	Messages           uint64
+	Duplicates         uint64
+	OutOfOrder         uint64
+}
+
+// feedMerger combines the messages of several upstream feeds into a single feed ordered
+// by sequence number. Each sequence number is forwarded once, from whichever upstream
+// delivers it first. Nothing is forwarded until every upstream has delivered or the gap
+// timeout passed, so that an upstream that's only sending live messages can't have the
+// catchup replayed by a slower upstream dropped as duplicates.
+type feedMerger struct {
+	forward func([]*broadcaster.BroadcastFeedMessage)
+
+	mutex      sync.Mutex
+	upstreams  []*upstreamFeed
+	hasNext    bool // whether the start of the feed was settled on
+	nextSeqNum arbutil.MessageIndex
+	pending    map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage
+	gapSince   time.Time // before hasNext, when the first message arrived
+	gaps       uint64
+}
+
+func newFeedMerger(urls []string, forward func([]*broadcaster.BroadcastFeedMessage)) *feedMerger {
+	m := &feedMerger{
+		forward: forward,
+		pending: make(map[arbutil.MessageIndex]*broadcaster.BroadcastFeedMessage),
+	}
+	for i, url := range urls {
+		prefix := fmt.Sprintf("arb/relay/upstream/%d/", i)
+		m.upstreams = append(m.upstreams, &upstreamFeed{
+			url:               url,
+			messagesCounter:   metrics.GetOrRegisterCounter(prefix+"messages", nil),
+			duplicatesCounter: metrics.GetOrRegisterCounter(prefix+"duplicates", nil),
+			outOfOrderCounter: metrics.GetOrRegisterCounter(prefix+"outoforder", nil),
+			lastSeqNumGauge:   metrics.GetOrRegisterGauge(prefix+"lastseqnum", nil),
+		})
+	}
+	return m
+}
+
+func (m *feedMerger) add(index int, msg *broadcaster.BroadcastFeedMessage) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	upstream := m.upstreams[index]
+	seqNum := msg.SequenceNumber
+	if upstream.hasReceived && seqNum <= upstream.lastSeqNum {
+		log.Warn("upstream feed delivered message out of order", "url", upstream.url, "seqNum", seqNum, "lastSeqNum", upstream.lastSeqNum)
+		upstream.outOfOrder++
+		upstream.outOfOrderCounter.Inc(1)
+	} else {
+		upstream.hasReceived = true
+		upstream.lastSeqNum = seqNum
+		upstream.lastSeqNumGauge.Update(int64(seqNum))
+	}
+	upstream.messages++
+	upstream.messagesCounter.Inc(1)
+
+	if (m.hasNext && seqNum < m.nextSeqNum) || m.pending[seqNum] != nil {
+		upstream.duplicates++
+		upstream.duplicatesCounter.Inc(1)
+		if !m.hasNext && m.allUpstreamsReceivedLocked() {
+			m.skipGapLocked()
+		}
+		return
+	}
+	if !m.hasNext {
+		if len(m.pending) == 0 {
+			m.gapSince = time.Now()
+		}
+		m.pending[seqNum] = msg
+		if m.allUpstreamsReceivedLocked() || len(m.pending) > maxPendingMessages {
+			m.skipGapLocked()
+		}
+		return
+	}
+	if len(m.pending) == 0 && seqNum > m.nextSeqNum {
+		m.gapSince = time.Now()
+	}
+	m.pending[seqNum] = msg
+	m.forwardLocked()
+	if len(m.pending) > maxPendingMessages {
+		m.skipGapLocked()
+	}
+}
+
+func (m *feedMerger) allUpstreamsReceivedLocked() bool {
+	for _, upstream := range m.upstreams {
+		if !upstream.hasReceived {
+			return false
+		}
+	}
+	return true
+}
+
+// forwardLocked forwards the run of pending messages starting at nextSeqNum
+func (m *feedMerger) forwardLocked() {
+	var run []*broadcaster.BroadcastFeedMessage
+	for {
+		msg, ok := m.pending[m.nextSeqNum]
+		if !ok {
+			break
+		}
+		delete(m.pending, m.nextSeqNum)
+		run = append(run, msg)
+		m.nextSeqNum++
+	}
+	if len(run) > 0 {
+		m.forward(run)
+		if len(m.pending) > 0 {
+			// Whatever is still pending is behind a new gap
+			m.gapSince = time.Now()
+		}
+	}
+}
+
+// skipGapLocked gives up on the messages missing before the lowest pending message,
+// or starts the feed at the lowest pending message if it hasn't started yet
+func (m *feedMerger) skipGapLocked() {
+	if len(m.pending) == 0 {
+		return
+	}
+	seqNums := make([]arbutil.MessageIndex, 0, len(m.pending))
+	for seqNum := range m.pending {
+		seqNums = append(seqNums, seqNum)
+	}
+	sort.Slice(seqNums, func(i, j int) bool { return seqNums[i] < seqNums[j] })
+	if m.hasNext {
+		log.Error("gap in relayed feed, skipping missing messages", "from", m.nextSeqNum, "to", seqNums[0]-1)
+		m.gaps++
+		gapCounter.Inc(1)
+	} else {
+		log.Info("starting relayed feed", "seqNum", seqNums[0])
+		m.hasNext = true
+	}
+	m.nextSeqNum = seqNums[0]
+	m.forwardLocked()
+}
+
+// checkGap skips a gap that no upstream has filled within the timeout,
+// or starts the feed if some upstream still hasn't delivered by then
+func (m *feedMerger) checkGap() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.pending) > 0 && time.Since(m.gapSince) >= gapTimeout {
+		m.skipGapLocked()
+	}
+}
+
+func (m *feedMerger) stats() []UpstreamStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := make([]UpstreamStats, 0, len(m.upstreams))
+	for _, upstream := range m.upstreams {
+		stats = append(stats, UpstreamStats{
+			URL:                upstream.url,
+			HasReceived:        upstream.hasReceived,
+			LastSequenceNumber: upstream.lastSeqNum,
+			Messages:           upstream.messages,
+			Duplicates:         upstream.duplicates,
+			OutOfOrder:         upstream.outOfOrder,
+		})
+	}
+	return stats
+}
+
+func (m *feedMerger) gapCount() uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.gaps
+}
@@ -5,11 +5,17 @@ package relay
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"math/big"
 	"net"
 	"time"
 
-	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/broadcastclient"
 	"github.com/offchainlabs/nitro/broadcaster"
@@ -22,52 +28,94 @@ type Relay struct {
 	broadcastClients            []*broadcastclient.BroadcastClient
 	broadcaster                 *broadcaster.Broadcaster
 	confirmedSequenceNumberChan chan arbutil.MessageIndex
-	messageChan                 chan broadcastFeedMessage
+	messageChan                 chan upstreamMessage
+	merger                      *feedMerger
+	feedPath                    *wsbroadcastserver.FeedPath
+	catchupDb                   ethdb.Database // nil unless the catchup buffer is persistent
 }
 
-type broadcastFeedMessage struct {
-	message        arbstate.MessageWithMetadata
-	sequenceNumber arbutil.MessageIndex
+type upstreamMessage struct {
+	upstream int
+	message  *broadcaster.BroadcastFeedMessage
 }
 
+// RelayMessageQueue tags messages from one upstream feed with its index
 type RelayMessageQueue struct {
-	queue chan broadcastFeedMessage
+	upstream int
+	queue    chan upstreamMessage
 }
 
-func (q *RelayMessageQueue) AddBroadcastMessages(pos arbutil.MessageIndex, messages []arbstate.MessageWithMetadata) error {
-	for i, message := range messages {
-		q.queue <- broadcastFeedMessage{
-			sequenceNumber: pos + arbutil.MessageIndex(i),
-			message:        message,
-		}
+func (q *RelayMessageQueue) AddBroadcastMessages(feedMessages []*broadcaster.BroadcastFeedMessage) error {
+	for _, feedMessage := range feedMessages {
+		q.queue <- upstreamMessage{q.upstream, feedMessage}
 	}
 
 	return nil
 }
 
-func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig) *Relay {
+// NewRelay creates a relay that merges the feeds of every url in clientConf into a single
+// feed served according to serverConf. The relayId is used to detect feed loops between
+// relays, a random one is generated if it is empty.
+func NewRelay(serverConf wsbroadcastserver.BroadcasterConfig, clientConf broadcastclient.BroadcastClientConfig, relayId string) (*Relay, error) {
 	var broadcastClients []*broadcastclient.BroadcastClient
 
-	q := RelayMessageQueue{make(chan broadcastFeedMessage, 100)}
+	if relayId == "" {
+		var idBytes [8]byte
+		if _, err := rand.Read(idBytes[:]); err != nil {
+			return nil, err
+		}
+		relayId = hex.EncodeToString(idBytes[:])
+	}
+	feedPath := wsbroadcastserver.NewFeedPath(relayId)
+
+	messageChan := make(chan upstreamMessage, 100)
 
 	confirmedSequenceNumberListener := make(chan arbutil.MessageIndex, 10)
 
-	for _, address := range clientConf.URLs {
-		client := broadcastclient.NewBroadcastClient(address, nil, clientConf.Timeout, &q)
+	for i, address := range clientConf.URLs {
+		client, err := broadcastclient.NewBroadcastClient(clientConf, address, 0, &RelayMessageQueue{i, messageChan})
+		if err != nil {
+			return nil, err
+		}
 		client.ConfirmedSequenceNumberListener = confirmedSequenceNumberListener
+		client.FeedPath = feedPath
 		broadcastClients = append(broadcastClients, client)
 	}
 
+	// The relay never signs messages itself, it forwards the sequencer's signatures unchanged
+	var feedBroadcaster *broadcaster.Broadcaster
+	var catchupDb ethdb.Database
+	if serverConf.CatchupBuffer.Persistent {
+		if serverConf.CatchupBuffer.Directory == "" {
+			return nil, errors.New("persistent catchup buffer requires a directory")
+		}
+		var err error
+		catchupDb, err = rawdb.NewLevelDBDatabase(serverConf.CatchupBuffer.Directory, 16, 16, "relay/catchup/", false)
+		if err != nil {
+			return nil, err
+		}
+		catchupBuffer, err := broadcaster.NewPersistentCatchupBuffer(catchupDb, serverConf.CatchupBuffer.Retention)
+		if err != nil {
+			_ = catchupDb.Close()
+			return nil, err
+		}
+		feedBroadcaster = broadcaster.NewBroadcasterWithCatchupBuffer(serverConf, nil, catchupBuffer)
+	} else {
+		feedBroadcaster = broadcaster.NewBroadcaster(serverConf, nil)
+	}
+	feedBroadcaster.SetFeedPath(feedPath)
+
 	return &Relay{
-		broadcaster:                 broadcaster.NewBroadcaster(serverConf),
+		broadcaster:                 feedBroadcaster,
 		broadcastClients:            broadcastClients,
 		confirmedSequenceNumberChan: confirmedSequenceNumberListener,
-		messageChan:                 q.queue,
-	}
+		messageChan:                 messageChan,
+		merger:                      newFeedMerger(clientConf.URLs, feedBroadcaster.BroadcastFeedMessages),
+		feedPath:                    feedPath,
+		catchupDb:                   catchupDb,
+	}, nil
 }
 
-const RECENT_FEED_ITEM_TTL time.Duration = time.Second * 10
-
 func (r *Relay) Start(ctx context.Context) error {
 	r.StopWaiter.Start(ctx)
 	err := r.broadcaster.Start(ctx)
@@ -79,30 +127,26 @@ func (r *Relay) Start(ctx context.Context) error {
 		client.Start(ctx)
 	}
 
-	recentFeedItems := make(map[arbutil.MessageIndex]time.Time)
 	r.LaunchThread(func(ctx context.Context) {
-		recentFeedItemsCleanup := time.NewTicker(RECENT_FEED_ITEM_TTL)
-		defer recentFeedItemsCleanup.Stop()
+		gapCheck := time.NewTicker(gapTimeout / 5)
+		defer gapCheck.Stop()
+		var lastConfirmed arbutil.MessageIndex
+		hasConfirmed := false
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case msg := <-r.messageChan:
-				if recentFeedItems[msg.sequenceNumber] != (time.Time{}) {
-					continue
-				}
-				recentFeedItems[msg.sequenceNumber] = time.Now()
-				r.broadcaster.BroadcastSingle(msg.message, msg.sequenceNumber)
+				r.merger.add(msg.upstream, msg.message)
 			case cs := <-r.confirmedSequenceNumberChan:
-				r.broadcaster.Confirm(cs)
-			case <-recentFeedItemsCleanup.C:
-				// Clear expired items from recentFeedItems
-				recentFeedItemExpiry := time.Now().Add(-RECENT_FEED_ITEM_TTL)
-				for acc, created := range recentFeedItems {
-					if created.Before(recentFeedItemExpiry) {
-						delete(recentFeedItems, acc)
-					}
+				// Every upstream sends its own confirmations, only pass on new ones
+				if !hasConfirmed || cs > lastConfirmed {
+					hasConfirmed = true
+					lastConfirmed = cs
+					r.broadcaster.Confirm(cs)
 				}
+			case <-gapCheck.C:
+				r.merger.checkGap()
 			}
 		}
 	})
@@ -110,6 +154,27 @@ func (r *Relay) Start(ctx context.Context) error {
 	return nil
 }
 
+// EnableSubscriptionFilters lets clients subscribe to a filtered feed, decoding messages with chainId.
+// It must be called before Start.
+func (r *Relay) EnableSubscriptionFilters(chainId *big.Int) {
+	r.broadcaster.EnableSubscriptionFilters(chainId)
+}
+
+// UpstreamStats returns what the relay has received from each upstream feed
+func (r *Relay) UpstreamStats() []UpstreamStats {
+	return r.merger.stats()
+}
+
+// GapCount returns how many times the relay skipped messages no upstream delivered
+func (r *Relay) GapCount() uint64 {
+	return r.merger.gapCount()
+}
+
+// FeedPath returns the relay ids this relay's feed passes through, starting with its own
+func (r *Relay) FeedPath() []string {
+	return r.feedPath.Path()
+}
+
 func (r *Relay) GetListenerAddr() net.Addr {
 	return r.broadcaster.ListenerAddr()
 }
@@ -120,4 +185,9 @@ func (r *Relay) StopAndWait() {
 		client.StopAndWait()
 	}
 	r.broadcaster.StopAndWait()
+	if r.catchupDb != nil {
+		if err := r.catchupDb.Close(); err != nil {
+			log.Warn("error closing catchup buffer database", "err", err)
+		}
+	}
 }
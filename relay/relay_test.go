@@ -0,0 +1,185 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package relay
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/offchainlabs/nitro/arbstate"
+	"github.com/offchainlabs/nitro/arbutil"
+	"github.com/offchainlabs/nitro/broadcastclient"
+	"github.com/offchainlabs/nitro/broadcaster"
+	"github.com/offchainlabs/nitro/util/testhelpers"
+	"github.com/offchainlabs/nitro/wsbroadcastserver"
+)
+
+func feedMessages(seqNums ...arbutil.MessageIndex) []*broadcaster.BroadcastFeedMessage {
+	var messages []*broadcaster.BroadcastFeedMessage
+	for _, seqNum := range seqNums {
+		messages = append(messages, &broadcaster.BroadcastFeedMessage{SequenceNumber: seqNum})
+	}
+	return messages
+}
+
+func TestFeedMergerOrdersAndDeduplicates(t *testing.T) {
+	var forwarded []arbutil.MessageIndex
+	merger := newFeedMerger([]string{"a", "b"}, func(messages []*broadcaster.BroadcastFeedMessage) {
+		for _, msg := range messages {
+			forwarded = append(forwarded, msg.SequenceNumber)
+		}
+	})
+
+	for _, msg := range feedMessages(10, 11, 13) {
+		merger.add(0, msg)
+	}
+	for _, msg := range feedMessages(11, 12, 13, 14) {
+		merger.add(1, msg)
+	}
+	// Upstream a replays an old message
+	merger.add(0, feedMessages(12)[0])
+
+	expected := []arbutil.MessageIndex{10, 11, 12, 13, 14}
+	if fmt.Sprint(forwarded) != fmt.Sprint(expected) {
+		Fail(t, "forwarded", forwarded, "expected", expected)
+	}
+	stats := merger.stats()
+	if stats[0].Messages != 4 || stats[0].OutOfOrder != 1 || stats[0].Duplicates != 1 || stats[0].LastSequenceNumber != 13 {
+		Fail(t, "unexpected stats for upstream a", stats[0])
+	}
+	if stats[1].Messages != 4 || stats[1].Duplicates != 2 || stats[1].LastSequenceNumber != 14 {
+		Fail(t, "unexpected stats for upstream b", stats[1])
+	}
+	if merger.gapCount() != 0 {
+		Fail(t, "unexpected gap")
+	}
+}
+
+func TestFeedMergerSkipsGap(t *testing.T) {
+	var forwarded []arbutil.MessageIndex
+	merger := newFeedMerger([]string{"a"}, func(messages []*broadcaster.BroadcastFeedMessage) {
+		for _, msg := range messages {
+			forwarded = append(forwarded, msg.SequenceNumber)
+		}
+	})
+
+	for _, msg := range feedMessages(1, 2, 5, 6) {
+		merger.add(0, msg)
+	}
+	if len(forwarded) != 2 {
+		Fail(t, "forwarded messages past a gap", forwarded)
+	}
+
+	// Nobody filled the gap in time
+	merger.gapSince = time.Now().Add(-gapTimeout)
+	merger.checkGap()
+
+	expected := []arbutil.MessageIndex{1, 2, 5, 6}
+	if fmt.Sprint(forwarded) != fmt.Sprint(expected) {
+		Fail(t, "forwarded", forwarded, "expected", expected)
+	}
+	if merger.gapCount() != 1 {
+		Fail(t, "expected 1 gap, got", merger.gapCount())
+	}
+
+	// Messages that show up after the gap was skipped are duplicates
+	merger.add(0, feedMessages(3)[0])
+	if len(forwarded) != 4 {
+		Fail(t, "forwarded message from skipped gap")
+	}
+}
+
+func TestFeedMergerStartsAtOldestReplay(t *testing.T) {
+	var forwarded []arbutil.MessageIndex
+	merger := newFeedMerger([]string{"a", "b", "c"}, func(messages []*broadcaster.BroadcastFeedMessage) {
+		for _, msg := range messages {
+			forwarded = append(forwarded, msg.SequenceNumber)
+		}
+	})
+
+	// Upstream a only sends live messages, and delivers before b replays its catchup
+	for _, msg := range feedMessages(20, 21) {
+		merger.add(0, msg)
+	}
+	for _, msg := range feedMessages(18, 19, 20) {
+		merger.add(1, msg)
+	}
+	if len(forwarded) != 0 {
+		Fail(t, "forwarded before every upstream delivered", forwarded)
+	}
+
+	// Upstream c never delivers
+	merger.gapSince = time.Now().Add(-gapTimeout)
+	merger.checkGap()
+	merger.add(1, feedMessages(21)[0])
+	merger.add(0, feedMessages(22)[0])
+
+	expected := []arbutil.MessageIndex{18, 19, 20, 21, 22}
+	if fmt.Sprint(forwarded) != fmt.Sprint(expected) {
+		Fail(t, "forwarded", forwarded, "expected", expected)
+	}
+	if merger.gapCount() != 0 {
+		Fail(t, "starting the feed counted as a gap")
+	}
+}
+
+func feedUrl(addr net.Addr) string {
+	return fmt.Sprintf("ws://127.0.0.1:%d/", addr.(*net.TCPAddr).Port)
+}
+
+func TestRelayRefusesFeedLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sequencer := broadcaster.NewBroadcaster(wsbroadcastserver.DefaultTestBroadcasterConfig, nil)
+	Require(t, sequencer.Start(ctx))
+	defer sequencer.StopAndWait()
+	Require(t, sequencer.BroadcastSingle(arbstate.MessageWithMetadata{}, 0))
+
+	clientConf := broadcastclient.DefaultBroadcastClientConfig
+	clientConf.URLs = []string{feedUrl(sequencer.ListenerAddr())}
+	relayA, err := NewRelay(wsbroadcastserver.DefaultTestBroadcasterConfig, clientConf, "a")
+	Require(t, err)
+	Require(t, relayA.Start(ctx))
+	defer relayA.StopAndWait()
+
+	clientConf.URLs = []string{feedUrl(relayA.GetListenerAddr())}
+	relayB, err := NewRelay(wsbroadcastserver.DefaultTestBroadcasterConfig, clientConf, "b")
+	Require(t, err)
+	Require(t, relayB.Start(ctx))
+	defer relayB.StopAndWait()
+
+	timeout := time.Now().Add(5 * time.Second)
+	for len(relayB.FeedPath()) < 2 || relayB.UpstreamStats()[0].Messages == 0 {
+		if time.Now().After(timeout) {
+			Fail(t, "relay b did not receive from relay a, feed path", relayB.FeedPath())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Relay a is upstream of b, so b must not serve it
+	loopClient, err := broadcastclient.NewBroadcastClient(broadcastclient.DefaultBroadcastClientConfig, feedUrl(relayB.GetListenerAddr()), 0, nil)
+	Require(t, err)
+	loopClient.FeedPath = wsbroadcastserver.NewFeedPath("a")
+	loopClient.Start(ctx)
+	defer loopClient.StopAndWait()
+
+	time.Sleep(time.Second)
+	if relayB.broadcaster.ClientCount() != 0 {
+		Fail(t, "relay b accepted a connection from upstream relay a")
+	}
+}
+
+func Require(t *testing.T, err error, printables ...interface{}) {
+	t.Helper()
+	testhelpers.RequireImpl(t, err, printables...)
+}
+
+func Fail(t *testing.T, printables ...interface{}) {
+	t.Helper()
+	testhelpers.FailImpl(t, printables...)
+}
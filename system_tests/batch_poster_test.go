@@ -0,0 +1,360 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/offchainlabs/nitro/arbnode"
+	"github.com/offchainlabs/nitro/statetransfer"
+	"github.com/offchainlabs/nitro/util/arbmath"
+)
+
+// waitForPendingBatches waits until the L1 transaction pool holds at least count transactions from the batch poster,
+// which are only included once mining is resumed, and returns them in nonce order
+func waitForPendingBatches(t *testing.T, l1backend *eth.Ethereum, poster common.Address, count int) types.Transactions {
+	t.Helper()
+	for attempts := 0; ; attempts++ {
+		pending, _ := l1backend.TxPool().ContentFrom(poster)
+		if len(pending) >= count {
+			return pending
+		}
+		if attempts > 200 {
+			Fail(t, "timed out waiting for", count, "batches in the L1 transaction pool, have", len(pending))
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// waitForPosterNonce waits until the batch poster's transactions up to nonce are included in L1
+func waitForPosterNonce(t *testing.T, ctx context.Context, l1client client, poster common.Address, nonce uint64) {
+	t.Helper()
+	for attempts := 0; ; attempts++ {
+		confirmed, err := l1client.NonceAt(ctx, poster, nil)
+		Require(t, err)
+		if confirmed > nonce {
+			return
+		}
+		if attempts > 200 {
+			Fail(t, "timed out waiting for batch poster nonce", nonce, "to be used, confirmed nonce is", confirmed)
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+}
+
+// advanceL1 makes L1 blocks for the inbox reader to read batches from
+func advanceL1(t *testing.T, ctx context.Context, l1client client, l1info info, blocks int) {
+	t.Helper()
+	for i := 0; i < blocks; i++ {
+		SendWaitTestTransactions(t, ctx, l1client, []*types.Transaction{
+			l1info.PrepareTx("Faucet", "User", 30000, big.NewInt(1e12), nil),
+		})
+	}
+}
+
+// startBatchPosterNode starts a sequencer on chainDb, which may hold the chain of a sequencer that was stopped
+func startBatchPosterNode(t *testing.T, ctx context.Context, l2info info, chainDb ethdb.Database, chainConfig *params.ChainConfig, nodeConfig *arbnode.Config, l1client client, addresses *arbnode.RollupAddresses, txOpts *bind.TransactOpts) (*arbnode.Node, *ethclient.Client) {
+	t.Helper()
+	stack, err := arbnode.CreateDefaultStack()
+	Require(t, err)
+	initReader := statetransfer.NewMemoryInitDataReader(&l2info.ArbInitData)
+	blockchain, err := arbnode.WriteOrTestBlockChain(chainDb, nil, initReader, 0, chainConfig)
+	Require(t, err)
+	node, err := arbnode.CreateNode(ctx, stack, chainDb, nodeConfig, blockchain, l1client, addresses, txOpts, nil)
+	Require(t, err)
+	Require(t, node.Start(ctx))
+	return node, ClientForArbBackend(t, node.Backend)
+}
+
+func TestBatchPosterMultipleInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.MaxInFlightBatches = 8
+	conf.BatchPoster.FeeBumpInterval = 0
+	l2info, nodeA, l2clientA, l1info, l1backend, l1client, l1stack := CreateTestNodeOnL1WithConfig(t, ctx, true, conf, params.ArbitrumDevTestChainConfig())
+	defer l1stack.Close()
+	l2clientB, nodeB := Create2ndNode(t, ctx, nodeA, l1stack, &l2info.ArbInitData, false)
+	l2info.GenerateAccount("User2")
+
+	posterAddr := l1info.GetAddress("Sequencer")
+	l1backend.StopMining()
+	initial := len(waitForPendingBatches(t, l1backend, posterAddr, 0))
+	confirmedNonce, err := l1client.NonceAt(ctx, posterAddr, nil)
+	Require(t, err)
+
+	// Each transaction is posted in its own batch before the previous batches are included
+	var lastTx *types.Transaction
+	for i := 1; i <= 3; i++ {
+		lastTx, _ = TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+		waitForPendingBatches(t, l1backend, posterAddr, initial+i)
+	}
+	pending := waitForPendingBatches(t, l1backend, posterAddr, initial+3)
+	inbox := l1info.GetAddress("SequencerInbox")
+	for i, tx := range pending {
+		if tx.Nonce() != confirmedNonce+uint64(i) {
+			Fail(t, "batch", i, "in flight has nonce", tx.Nonce(), "expected", confirmedNonce+uint64(i))
+		}
+		if tx.To() == nil || *tx.To() != inbox {
+			Fail(t, "batch", i, "in flight isn't sent to the sequencer inbox")
+		}
+	}
+
+	// Only the first batch's gas can be estimated, so the later batches only succeed if their gas was derived correctly
+	Require(t, l1backend.StartMining(1))
+	for _, tx := range pending {
+		_, err := EnsureTxSucceededWithTimeout(ctx, l1client, tx, time.Second*10)
+		Require(t, err)
+	}
+	advanceL1(t, ctx, l1client, l1info, 30)
+
+	_, err = WaitForTx(ctx, l2clientB, lastTx.Hash(), time.Second*5)
+	Require(t, err)
+	l2balance, err := l2clientB.BalanceAt(ctx, l2info.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(3e12)) != 0 {
+		Fail(t, "Unexpected balance:", l2balance)
+	}
+
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
+
+func TestBatchPosterRepostsWhenNonceUsed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.FeeBumpInterval = 0
+	l2info, nodeA, l2clientA, l1info, l1backend, l1client, l1stack := CreateTestNodeOnL1WithConfig(t, ctx, true, conf, params.ArbitrumDevTestChainConfig())
+	defer l1stack.Close()
+	l2clientB, nodeB := Create2ndNode(t, ctx, nodeA, l1stack, &l2info.ArbInitData, false)
+	l2info.GenerateAccount("User2")
+
+	posterAddr := l1info.GetAddress("Sequencer")
+	l1backend.StopMining()
+	initial := len(waitForPendingBatches(t, l1backend, posterAddr, 0))
+	tx, _ := TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+	pending := waitForPendingBatches(t, l1backend, posterAddr, initial+1)
+	batchTx := pending[len(pending)-1]
+
+	// Replace the batch transaction with a transfer, which uses its nonce without posting the batch
+	oneGwei := big.NewInt(params.GWei)
+	conflictingTx := l1info.SignTxAs("Sequencer", &types.DynamicFeeTx{
+		Nonce:     batchTx.Nonce(),
+		GasTipCap: arbmath.BigAdd(arbmath.BigMulByUint(batchTx.GasTipCap(), 2), oneGwei),
+		GasFeeCap: arbmath.BigAdd(arbmath.BigMulByUint(batchTx.GasFeeCap(), 2), oneGwei),
+		Gas:       params.TxGas,
+		To:        &posterAddr,
+		Value:     common.Big0,
+	})
+	Require(t, l1client.SendTransaction(ctx, conflictingTx))
+	Require(t, l1backend.StartMining(1))
+	_, err := EnsureTxSucceededWithTimeout(ctx, l1client, conflictingTx, time.Second*10)
+	Require(t, err)
+	// The batch is rebuilt and posted with the next nonce
+	waitForPosterNonce(t, ctx, l1client, posterAddr, batchTx.Nonce()+1)
+	advanceL1(t, ctx, l1client, l1info, 30)
+
+	_, err = WaitForTx(ctx, l2clientB, tx.Hash(), time.Second*10)
+	Require(t, err)
+
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
+
+func TestBatchPosterFeeBumps(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.FeeBumpInterval = time.Second
+	conf.BatchPoster.FeeBumpPercent = 20
+	// The L1 base fee starts at 50 gwei, so batches are sent with a fee cap well below this
+	conf.BatchPoster.MaxFeeCap = 250
+	l2info, nodeA, l2clientA, l1info, l1backend, l1client, l1stack := CreateTestNodeOnL1WithConfig(t, ctx, true, conf, params.ArbitrumDevTestChainConfig())
+	defer l1stack.Close()
+	l2clientB, nodeB := Create2ndNode(t, ctx, nodeA, l1stack, &l2info.ArbInitData, false)
+	l2info.GenerateAccount("User2")
+
+	posterAddr := l1info.GetAddress("Sequencer")
+	maxFeeCap := new(big.Int).SetUint64(uint64(conf.BatchPoster.MaxFeeCap * params.GWei))
+	l1backend.StopMining()
+	initial := len(waitForPendingBatches(t, l1backend, posterAddr, 0))
+	tx, _ := TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+	batchTx := waitForPendingBatches(t, l1backend, posterAddr, initial+1)[initial]
+	if batchTx.GasFeeCap().Cmp(maxFeeCap) >= 0 {
+		Fail(t, "batch sent with fee cap", batchTx.GasFeeCap(), "at or above the maximum")
+	}
+
+	// Bumps replace the transaction until the maximum fee cap leaves too little room for another one
+	var bumped *types.Transaction
+	for attempts := 0; ; attempts++ {
+		bumped = waitForPendingBatches(t, l1backend, posterAddr, initial+1)[initial]
+		if bumped.Nonce() != batchTx.Nonce() {
+			Fail(t, "fee bump has nonce", bumped.Nonce(), "expected", batchTx.Nonce())
+		}
+		if bumped.GasFeeCap().Cmp(maxFeeCap) > 0 {
+			Fail(t, "fee bumped to", bumped.GasFeeCap(), "above the maximum", maxFeeCap)
+		}
+		if arbmath.BigMulByUfrac(bumped.GasFeeCap(), 110, 100).Cmp(maxFeeCap) > 0 {
+			break
+		}
+		if attempts > 100 {
+			Fail(t, "timed out waiting for fee bumps to reach the maximum, fee cap is", bumped.GasFeeCap())
+		}
+		time.Sleep(time.Millisecond * 200)
+	}
+	if bumped.Hash() == batchTx.Hash() {
+		Fail(t, "batch transaction wasn't replaced")
+	}
+	time.Sleep(conf.BatchPoster.FeeBumpInterval * 2)
+	if pending := waitForPendingBatches(t, l1backend, posterAddr, initial+1); pending[initial].Hash() != bumped.Hash() {
+		Fail(t, "batch transaction replaced after reaching the maximum fee cap")
+	}
+
+	Require(t, l1backend.StartMining(1))
+	_, err := EnsureTxSucceededWithTimeout(ctx, l1client, bumped, time.Second*10)
+	Require(t, err)
+	advanceL1(t, ctx, l1client, l1info, 30)
+
+	_, err = WaitForTx(ctx, l2clientB, tx.Hash(), time.Second*5)
+	Require(t, err)
+
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
+
+func TestBatchPosterRestartWithBatchesInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainConfig := params.ArbitrumDevTestChainConfig()
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.FeeBumpInterval = 0
+	l1info, l1client, l1backend, l1stack := CreateTestL1BlockChain(t, nil)
+	defer l1stack.Close()
+	addresses := DeployOnTestL1(t, ctx, l1info, l1client, chainConfig.ChainID)
+	txOpts := l1info.GetDefaultTransactOpts("Sequencer", ctx)
+	l2info := NewArbTestInfo(t, chainConfig.ChainID)
+	l2chainDb := rawdb.NewMemoryDatabase()
+	nodeA, l2clientA := startBatchPosterNode(t, ctx, l2info, l2chainDb, chainConfig, conf, l1client, addresses, &txOpts)
+	l2info.GenerateAccount("User2")
+
+	posterAddr := l1info.GetAddress("Sequencer")
+	l1backend.StopMining()
+	initial := len(waitForPendingBatches(t, l1backend, posterAddr, 0))
+	var lastTx *types.Transaction
+	for i := 1; i <= 2; i++ {
+		lastTx, _ = TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+		waitForPendingBatches(t, l1backend, posterAddr, initial+i)
+	}
+	pending := waitForPendingBatches(t, l1backend, posterAddr, initial+2)
+
+	// The restarted poster waits for the batches it sent instead of posting them again
+	nodeA.StopAndWait()
+	nodeA, _ = startBatchPosterNode(t, ctx, l2info, l2chainDb, chainConfig, conf, l1client, addresses, &txOpts)
+	time.Sleep(time.Second)
+	resumed, _ := l1backend.TxPool().ContentFrom(posterAddr)
+	if len(resumed) != len(pending) {
+		Fail(t, "expected", len(pending), "batches in flight after restarting, have", len(resumed))
+	}
+	for i, tx := range pending {
+		if resumed[i].Hash() != tx.Hash() {
+			Fail(t, "batch with nonce", tx.Nonce(), "was posted again after restarting")
+		}
+	}
+
+	Require(t, l1backend.StartMining(1))
+	for _, tx := range pending {
+		_, err := EnsureTxSucceededWithTimeout(ctx, l1client, tx, time.Second*10)
+		Require(t, err)
+	}
+	l2clientB, nodeB := Create2ndNode(t, ctx, nodeA, l1stack, &l2info.ArbInitData, false)
+	advanceL1(t, ctx, l1client, l1info, 30)
+
+	_, err := WaitForTx(ctx, l2clientB, lastTx.Hash(), time.Second*5)
+	Require(t, err)
+	l2balance, err := l2clientB.BalanceAt(ctx, l2info.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(2e12)) != 0 {
+		Fail(t, "Unexpected balance:", l2balance)
+	}
+	nonce, err := l1client.NonceAt(ctx, posterAddr, nil)
+	Require(t, err)
+	if nonce != pending[len(pending)-1].Nonce()+1 {
+		Fail(t, "batch poster sent", nonce-pending[len(pending)-1].Nonce()-1, "more transactions after restarting")
+	}
+
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
+
+func TestBatchPosterRestartAfterBatchesIncluded(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainConfig := params.ArbitrumDevTestChainConfig()
+	conf := arbnode.ConfigDefaultL1Test()
+	conf.BatchPoster.FeeBumpInterval = 0
+	l1info, l1client, l1backend, l1stack := CreateTestL1BlockChain(t, nil)
+	defer l1stack.Close()
+	addresses := DeployOnTestL1(t, ctx, l1info, l1client, chainConfig.ChainID)
+	txOpts := l1info.GetDefaultTransactOpts("Sequencer", ctx)
+	l2info := NewArbTestInfo(t, chainConfig.ChainID)
+	l2chainDb := rawdb.NewMemoryDatabase()
+	nodeA, l2clientA := startBatchPosterNode(t, ctx, l2info, l2chainDb, chainConfig, conf, l1client, addresses, &txOpts)
+	l2info.GenerateAccount("User2")
+
+	posterAddr := l1info.GetAddress("Sequencer")
+	l1backend.StopMining()
+	initial := len(waitForPendingBatches(t, l1backend, posterAddr, 0))
+	TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+	pending := waitForPendingBatches(t, l1backend, posterAddr, initial+1)
+
+	// The batches are included while the poster is stopped, so its inbox tracker hasn't read them when it's restarted
+	nodeA.StopAndWait()
+	Require(t, l1backend.StartMining(1))
+	for _, tx := range pending {
+		_, err := EnsureTxSucceededWithTimeout(ctx, l1client, tx, time.Second*10)
+		Require(t, err)
+	}
+	includedNonce := pending[len(pending)-1].Nonce()
+	nodeA, l2clientA = startBatchPosterNode(t, ctx, l2info, l2chainDb, chainConfig, conf, l1client, addresses, &txOpts)
+
+	// The next batch continues after the included ones
+	tx, _ := TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, l2clientA, ctx)
+	waitForPosterNonce(t, ctx, l1client, posterAddr, includedNonce+1)
+	l2clientB, nodeB := Create2ndNode(t, ctx, nodeA, l1stack, &l2info.ArbInitData, false)
+	advanceL1(t, ctx, l1client, l1info, 30)
+
+	_, err := WaitForTx(ctx, l2clientB, tx.Hash(), time.Second*5)
+	Require(t, err)
+	l2balance, err := l2clientB.BalanceAt(ctx, l2info.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(2e12)) != 0 {
+		Fail(t, "Unexpected balance:", l2balance)
+	}
+	nonce, err := l1client.NonceAt(ctx, posterAddr, nil)
+	Require(t, err)
+	if nonce != includedNonce+2 {
+		Fail(t, "expected one batch after restarting, batch poster sent", nonce-includedNonce-1)
+	}
+
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
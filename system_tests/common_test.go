@@ -194,6 +194,16 @@ func ClientForArbBackend(t *testing.T, backend *arbitrum.Backend) *ethclient.Cli
 	return ethclient.NewClient(rpc.DialInProc(inproc))
 }
 
+// RPCClientForNodeAPIs returns a client for the node's own APIs, such as arbdebug
+func RPCClientForNodeAPIs(t *testing.T, node *arbnode.Node) *rpc.Client {
+	inproc := rpc.NewServer()
+	for _, api := range node.APIs() {
+		err := inproc.RegisterName(api.Namespace, api.Service)
+		Require(t, err)
+	}
+	return rpc.DialInProc(inproc)
+}
+
 // Create and deploy L1 and arbnode for L2
 func CreateTestNodeOnL1(t *testing.T, ctx context.Context, isSequencer bool) (l2info info, node *arbnode.Node, l2client *ethclient.Client, l1info info, l1backend *eth.Ethereum, l1client *ethclient.Client, l1stack *node.Node) {
 	conf := arbnode.ConfigDefaultL1Test()
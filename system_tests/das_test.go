@@ -12,11 +12,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
+	"github.com/offchainlabs/nitro/solgen/go/node_interfacegen"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 
@@ -62,7 +64,7 @@ func startLocalDASServer(
 	Require(t, err)
 	seqInboxCaller, err := bridgegen.NewSequencerInboxCaller(seqInboxAddress, l1client)
 	Require(t, err)
-	das, err := das.NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, seqInboxCaller, storageService)
+	das, err := das.NewSignAfterStoreDASWithSeqInboxCaller(ctx, config.KeyConfig, config.ErasureShare, seqInboxCaller, storageService)
 	Require(t, err)
 	dasServer, err := dasrpc.StartDASRPCServerOnListener(ctx, lis, das)
 	Require(t, err)
@@ -129,6 +131,7 @@ func TestDASRekey(t *testing.T) {
 	l1NodeConfigB.DataAvailability.AggregatorConfig = aggConfigForBackend(t, backendConfigA)
 	l2clientB, nodeB := Create2ndNodeWithConfig(t, ctx, nodeA, l1stack, &l2info.ArbInitData, l1NodeConfigB)
 	checkBatchPosting(t, ctx, l1client, l2clientA, l1info, l2info, big.NewInt(1e12), l2clientB)
+	checkBatchL1Info(t, ctx, l1client, l2clientB)
 	nodeA.StopAndWait()
 	nodeB.StopAndWait()
 
@@ -193,6 +196,39 @@ func checkBatchPosting(t *testing.T, ctx context.Context, l1client, l2clientA *e
 	}
 }
 
+func checkBatchL1Info(t *testing.T, ctx context.Context, l1client, l2client *ethclient.Client) {
+	nodeInterface, err := node_interfacegen.NewNodeInterface(types.NodeInterfaceAddress, l2client)
+	Require(t, err)
+	blockNum, err := l2client.BlockNumber(ctx)
+	Require(t, err)
+	callOpts := &bind.CallOpts{Context: ctx}
+
+	// the block may not have been read from L1 yet
+	for i := 0; i < 50; i++ {
+		_, err = nodeInterface.GetBatchL1Info(callOpts, blockNum)
+		if err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	info, err := nodeInterface.GetBatchL1Info(callOpts, blockNum)
+	Require(t, err)
+	receipt, err := l1client.TransactionReceipt(ctx, info.L1TxHash)
+	Require(t, err)
+	if receipt.BlockNumber.Uint64() != info.L1BlockNumber {
+		Fail(t, "batch", info.Batch, "posted in L1 block", receipt.BlockNumber, "not", info.L1BlockNumber)
+	}
+	if info.Accumulator == [32]byte{} {
+		Fail(t, "batch", info.Batch, "has no accumulator")
+	}
+
+	cert, err := nodeInterface.GetBatchDASCertificate(callOpts, blockNum)
+	Require(t, err)
+	if cert.KeysetHash == [32]byte{} || cert.DataHash == [32]byte{} || cert.SignersMask == 0 {
+		Fail(t, "unexpected DAS certificate", cert)
+	}
+}
+
 func TestDASComplexConfigAndRestMirror(t *testing.T) {
 	initTest(t)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -260,7 +296,7 @@ func TestDASComplexConfigAndRestMirror(t *testing.T) {
 		// L1NodeURL: normally we would have to set this but we are passing in the already constructed client and addresses to the factory
 	}
 
-	dasServerStack, lifecycleManager, err := arbnode.SetUpDataAvailability(ctx, &serverConfig, l1client, addresses)
+	dasServerStack, lifecycleManager, err := arbnode.SetUpDataAvailability(ctx, &serverConfig, l1client, addresses, nil)
 	Require(t, err)
 	dasServer, err := dasrpc.StartDASRPCServerOnListener(ctx, lis, dasServerStack)
 	Require(t, err)
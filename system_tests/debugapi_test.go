@@ -0,0 +1,82 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/offchainlabs/nitro/arbnode"
+)
+
+func TestPricingModelSeries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l2info, node, client := CreateTestL2(t, ctx)
+
+	l2info.GenerateAccount("User2")
+	for i := 0; i < 5; i++ {
+		TransferBalance(t, "Owner", "User2", big.NewInt(1e12), l2info, client, ctx)
+	}
+	head, err := client.BlockNumber(ctx)
+	Require(t, err)
+	start, end := uint64(1), head+1
+
+	gasUsed := make(map[uint64]uint64)
+	for block := start; block < end; block++ {
+		header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(block))
+		Require(t, err)
+		gasUsed[block] = header.GasUsed
+	}
+
+	rpcClient := RPCClientForNodeAPIs(t, node)
+	series := func(step uint64, aggregators *[]common.Address) (arbnode.PricingModelSeries, error) {
+		var series arbnode.PricingModelSeries
+		err := rpcClient.CallContext(ctx, &series, "arbdebug_pricingModelSeries", rpc.BlockNumber(start), rpc.BlockNumber(end), step, aggregators)
+		return series, err
+	}
+
+	stepped, err := series(2, nil)
+	Require(t, err)
+	if len(stepped.Samples) != int((end-start+1)/2) || stepped.Next != nil {
+		Fail(t, "unexpected samples", len(stepped.Samples), "for blocks", start, "to", end)
+	}
+	for i, sample := range stepped.Samples {
+		if sample.BlockNumber != start+2*uint64(i) {
+			Fail(t, "sample", i, "is of block", sample.BlockNumber)
+		}
+		if _, ok := sample.CompressionRatios[sample.DefaultAggregator]; !ok {
+			Fail(t, "sample", i, "is missing the default aggregator's compression ratio")
+		}
+		// Only the sampled block's gas is counted, not the skipped block's
+		if sample.GasUsed != gasUsed[sample.BlockNumber] {
+			Fail(t, "sample", i, "used", sample.GasUsed, "gas but its block used", gasUsed[sample.BlockNumber])
+		}
+	}
+
+	// A step past the range is a single sample of it all, instead of overflowing
+	whole, err := series(math.MaxUint64, nil)
+	Require(t, err)
+	if len(whole.Samples) != 1 || whole.Samples[0].GasUsed != gasUsed[start] {
+		Fail(t, "unexpected samples for a step past the range", whole.Samples)
+	}
+
+	aggregators := make([]common.Address, 17)
+	for i := range aggregators {
+		aggregators[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+	}
+	if _, err := series(1, &aggregators); err == nil {
+		Fail(t, "too many aggregators were accepted")
+	}
+	aggregators = aggregators[:2]
+	withAggregators, err := series(1, &aggregators)
+	Require(t, err)
+	if len(withAggregators.Samples[0].CompressionRatios) < len(aggregators) {
+		Fail(t, "missing requested aggregators' compression ratios", withAggregators.Samples[0].CompressionRatios)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/offchainlabs/nitro/arbnode"
+	"github.com/offchainlabs/nitro/arbos"
+	"github.com/offchainlabs/nitro/solgen/go/precompilesgen"
+)
+
+func TestEncryptedMempoolSequencesInCommittedOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodeConfig := arbnode.ConfigDefaultL2Test()
+	nodeConfig.Sequencer.EncryptedMempool.Enable = true
+	// Keys are only released by the test
+	nodeConfig.Sequencer.EncryptedMempool.EpochDuration = 0
+	l2info, node, client := CreateTestL2WithConfig(t, ctx, nil, nodeConfig, true)
+
+	sequencer, ok := node.TxPublisher.(*arbnode.Sequencer)
+	if !ok {
+		Fail(t, "node isn't a sequencer")
+	}
+	keyper, ok := sequencer.EncryptedMempoolKeyper().(*arbnode.LocalKeyper)
+	if !ok {
+		Fail(t, "sequencer doesn't have a local keyper")
+	}
+
+	l2info.GenerateAccount("User2")
+	l2info.GenerateAccount("User3")
+
+	// Commitments are only parsed from their ArbOS version on
+	_, err := sequencer.PublishEncryptedTransaction(ctx, arbnode.EncryptedTransaction{Epoch: keyper.CurrentEpoch(), Ciphertext: []byte{1, 2, 3}})
+	if !errors.Is(err, arbnode.ErrEncryptedMempoolInactive) {
+		Fail(t, "expected the encrypted mempool to need an ArbOS upgrade, got", err)
+	}
+	auth := l2info.GetDefaultTransactOpts("Owner", ctx)
+	arbOwner, err := precompilesgen.NewArbOwner(common.HexToAddress("0x70"), client)
+	Require(t, err)
+	tx, err := arbOwner.ScheduleArbOSUpgrade(&auth, arbos.FirstEncryptedTxCommitmentsVersion, 0)
+	Require(t, err)
+	_, err = EnsureTxSucceeded(ctx, client, tx)
+	Require(t, err)
+	// The upgrade happens at the start of the next block
+	TransferBalance(t, "Owner", "User2", big.NewInt(1e18), l2info, client, ctx)
+
+	// User2's transaction is committed to first, so it's sequenced first
+	txs := []*types.Transaction{
+		l2info.PrepareTx("User2", "User3", l2info.TransferGas, big.NewInt(1e12), nil),
+		l2info.PrepareTx("Owner", "User3", l2info.TransferGas, big.NewInt(1e12), nil),
+	}
+	epoch := keyper.CurrentEpoch()
+	for i, tx := range txs {
+		txBytes, err := tx.MarshalBinary()
+		Require(t, err)
+		ciphertext, err := keyper.Encrypt(epoch, txBytes)
+		Require(t, err)
+		commitment, err := sequencer.PublishEncryptedTransaction(ctx, arbnode.EncryptedTransaction{Epoch: epoch, Ciphertext: ciphertext})
+		Require(t, err)
+		if commitment.Epoch != epoch || commitment.Index != uint64(i) {
+			Fail(t, "unexpected commitment", commitment)
+		}
+
+		// The commitment is sequenced before the call returns
+		count, err := node.TxStreamer.GetMessageCount()
+		Require(t, err)
+		msg, err := node.TxStreamer.GetMessage(count - 1)
+		Require(t, err)
+		if len(msg.Message.L2msg) == 0 || msg.Message.L2msg[0] != arbos.L2MessageKind_EncryptedTxCommitments {
+			Fail(t, "last message isn't a commitment", msg.Message.L2msg)
+		}
+	}
+
+	// Nothing is executed until the epoch's key is released
+	if _, err := client.TransactionReceipt(ctx, txs[0].Hash()); err == nil {
+		Fail(t, "encrypted transaction executed before its key was released")
+	}
+	Require(t, keyper.ReleaseKey(ctx, epoch))
+
+	var receipts []*types.Receipt
+	for _, tx := range txs {
+		receipt, err := EnsureTxSucceeded(ctx, client, tx)
+		Require(t, err)
+		receipts = append(receipts, receipt)
+	}
+	first, second := receipts[0], receipts[1]
+	if first.BlockNumber.Cmp(second.BlockNumber) > 0 ||
+		(first.BlockNumber.Cmp(second.BlockNumber) == 0 && first.TransactionIndex > second.TransactionIndex) {
+		Fail(t, "encrypted transactions not sequenced in committed order")
+	}
+
+	_, err = sequencer.PublishEncryptedTransaction(ctx, arbnode.EncryptedTransaction{Epoch: epoch, Ciphertext: []byte("late")})
+	if err == nil {
+		Fail(t, "committed to transaction for released epoch")
+	}
+}
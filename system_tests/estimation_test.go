@@ -8,10 +8,13 @@ import (
 	"math/big"
 	"testing"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/offchainlabs/nitro/solgen/go/mocksgen"
+	"github.com/offchainlabs/nitro/solgen/go/node_interfacegen"
 	"github.com/offchainlabs/nitro/solgen/go/precompilesgen"
 )
 
@@ -118,3 +121,67 @@ func TestEstimate(t *testing.T) {
 		Fail(t, "Unexpected counter value", counter)
 	}
 }
+
+func TestComponentEstimate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l2info, _, client := CreateTestL2(t, ctx)
+	auth := l2info.GetDefaultTransactOpts("Owner", ctx)
+
+	simpleAddr, tx, _, err := mocksgen.DeploySimple(&auth, client)
+	Require(t, err, "could not deploy contract")
+	_, err = EnsureTxSucceeded(ctx, client, tx)
+	Require(t, err)
+
+	simpleAbi, err := mocksgen.SimpleMetaData.GetAbi()
+	Require(t, err)
+	data, err := simpleAbi.Pack("increment")
+	Require(t, err)
+
+	nodeAbi, err := node_interfacegen.NodeInterfaceMetaData.GetAbi()
+	Require(t, err)
+	calldata, err := nodeAbi.Pack("gasEstimateComponents", simpleAddr, false, data)
+	Require(t, err)
+	returnData, err := client.CallContract(ctx, ethereum.CallMsg{
+		From: auth.From,
+		To:   &types.NodeInterfaceAddress,
+		Data: calldata,
+	}, nil)
+	Require(t, err)
+	outputs, err := nodeAbi.Methods["gasEstimateComponents"].Outputs.Unpack(returnData)
+	Require(t, err)
+	if len(outputs) != 4 {
+		Fail(t, "expected 4 outputs from gasEstimateComponents, got", len(outputs))
+	}
+	gasEstimate, _ := outputs[0].(uint64)
+	gasEstimateForL1, _ := outputs[1].(uint64)
+	baseFee, _ := outputs[2].(*big.Int)
+	l1BaseFeeEstimate, _ := outputs[3].(*big.Int)
+	if gasEstimate < params.TxGas || gasEstimateForL1 >= gasEstimate {
+		Fail(t, "unexpected gas estimate", gasEstimate, "with L1 portion", gasEstimateForL1)
+	}
+	if baseFee.Cmp(GetBaseFee(t, client, ctx)) != 0 {
+		Fail(t, "unexpected base fee", baseFee)
+	}
+	if l1BaseFeeEstimate.Sign() <= 0 {
+		Fail(t, "unexpected L1 base fee estimate", l1BaseFeeEstimate)
+	}
+
+	// The estimate alone must be enough for the transaction to succeed
+	info := l2info.GetInfoWithPrivKey("Owner")
+	tx = l2info.SignTxAs("Owner", &types.DynamicFeeTx{
+		To:        &simpleAddr,
+		Gas:       gasEstimate,
+		GasFeeCap: new(big.Int).Set(l2info.GasPrice),
+		Nonce:     info.Nonce,
+		Data:      data,
+	})
+	info.Nonce++
+	Require(t, client.SendTransaction(ctx, tx))
+	receipt, err := EnsureTxSucceeded(ctx, client, tx)
+	Require(t, err)
+	if receipt.GasUsed > gasEstimate {
+		Fail(t, "transaction used", receipt.GasUsed, "gas, more than the estimate of", gasEstimate)
+	}
+}
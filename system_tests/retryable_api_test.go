@@ -0,0 +1,158 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package arbtest
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/offchainlabs/nitro/arbnode"
+	"github.com/offchainlabs/nitro/arbos/l2pricing"
+	"github.com/offchainlabs/nitro/solgen/go/mocksgen"
+	"github.com/offchainlabs/nitro/solgen/go/precompilesgen"
+	"github.com/offchainlabs/nitro/util/arbmath"
+)
+
+func TestRetryableAPI(t *testing.T) {
+	l2info, l1info, node, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown := retryableSetupWithNode(t, arbnode.ConfigDefaultL1Test())
+	defer teardown()
+
+	ownerTxOpts := l2info.GetDefaultTransactOpts("Owner", ctx)
+	usertxopts := l1info.GetDefaultTransactOpts("Faucet", ctx)
+	usertxopts.Value = arbmath.BigMul(big.NewInt(1e12), big.NewInt(1e12))
+
+	simpleAddr, _, _, err := mocksgen.DeploySimple(&ownerTxOpts, l2client)
+	Require(t, err)
+	simpleABI, err := mocksgen.SimpleMetaData.GetAbi()
+	Require(t, err)
+
+	// The auto-redeems fail, leaving the retryables live
+	beneficiaries := []common.Address{
+		l2info.GetAddress("Beneficiary"),
+		l2info.GetAddress("User2"),
+		l2info.GetAddress("Beneficiary"),
+	}
+	var l1receipts []*types.Receipt
+	for _, beneficiary := range beneficiaries {
+		l1tx, err := delayedInbox.CreateRetryableTicket(
+			&usertxopts,
+			simpleAddr,
+			common.Big0,
+			big.NewInt(1e16),
+			beneficiary,
+			beneficiary,
+			// send enough L2 gas for intrinsic but not compute
+			big.NewInt(int64(params.TxGas+params.TxDataNonZeroGasEIP2028*4)),
+			big.NewInt(l2pricing.InitialBaseFeeWei*2),
+			simpleABI.Methods["increment"].ID,
+		)
+		Require(t, err)
+		l1receipt, err := EnsureTxSucceeded(ctx, l1client, l1tx)
+		Require(t, err)
+		l1receipts = append(l1receipts, l1receipt)
+	}
+
+	waitForL1DelayBlocks(t, ctx, l1client, l1info)
+
+	var tickets []common.Hash
+	var autoRedeems []common.Hash
+	for _, l1receipt := range l1receipts {
+		receipt, err := WaitForTx(ctx, l2client, lookupSubmitRetryableL2TxHash(l1receipt), time.Second*5)
+		Require(t, err)
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			Fail(t, "retryable submission failed")
+		}
+		tickets = append(tickets, receipt.Logs[0].Topics[1])
+		autoRedeems = append(autoRedeems, receipt.Logs[1].Topics[2])
+	}
+
+	rpcClient := RPCClientForNodeAPIs(t, node)
+	list := func(filter arbnode.RetryableFilter) arbnode.RetryableList {
+		t.Helper()
+		var list arbnode.RetryableList
+		err := rpcClient.CallContext(ctx, &list, "arbretryable_retryables", rpc.LatestBlockNumber, filter)
+		Require(t, err)
+		return list
+	}
+	listTickets := func(list arbnode.RetryableList) []common.Hash {
+		var listed []common.Hash
+		for _, details := range list.Retryables {
+			listed = append(listed, details.TicketId)
+		}
+		return listed
+	}
+	expectTickets := func(listed []common.Hash, expected ...common.Hash) {
+		t.Helper()
+		if len(listed) != len(expected) {
+			Fail(t, "listed", listed, "expected", expected)
+		}
+		for i := range listed {
+			if listed[i] != expected[i] {
+				Fail(t, "listed", listed, "expected", expected)
+			}
+		}
+	}
+
+	all := list(arbnode.RetryableFilter{})
+	expectTickets(listTickets(all), tickets...)
+	if all.Next != nil {
+		Fail(t, "unexpected next page", *all.Next)
+	}
+
+	from := all.Retryables[0].From
+	expectTickets(listTickets(list(arbnode.RetryableFilter{From: &from})), tickets...)
+	stranger := common.HexToAddress("0x5ca1ab1e")
+	expectTickets(listTickets(list(arbnode.RetryableFilter{From: &stranger})))
+	expectTickets(listTickets(list(arbnode.RetryableFilter{Beneficiary: &beneficiaries[1]})), tickets[1])
+
+	// Pages continue from where the previous one stopped
+	var paged []common.Hash
+	filter := arbnode.RetryableFilter{Beneficiary: &beneficiaries[0], Limit: 1}
+	for pages := 0; ; pages++ {
+		if pages == len(tickets) {
+			Fail(t, "too many pages")
+		}
+		page := list(filter)
+		paged = append(paged, listTickets(page)...)
+		if page.Next == nil {
+			break
+		}
+		filter.Start = *page.Next
+	}
+	expectTickets(paged, tickets[0], tickets[2])
+
+	arbRetryableTx, err := precompilesgen.NewArbRetryableTx(common.HexToAddress("6e"), l2client)
+	Require(t, err)
+	tx, err := arbRetryableTx.Redeem(&ownerTxOpts, tickets[0])
+	Require(t, err)
+	receipt, err := EnsureTxSucceeded(ctx, l2client, tx)
+	Require(t, err)
+	manualRedeem := receipt.Logs[0].Topics[2]
+	_, err = WaitForTx(ctx, l2client, manualRedeem, time.Second*5)
+	Require(t, err)
+
+	// A redeemed retryable is no longer listed
+	expectTickets(listTickets(list(arbnode.RetryableFilter{})), tickets[1:]...)
+
+	head, err := l2client.BlockNumber(ctx)
+	Require(t, err)
+	var history arbnode.RedeemHistory
+	err = rpcClient.CallContext(ctx, &history, "arbretryable_redeemHistory", tickets[0], rpc.BlockNumber(0), rpc.BlockNumber(head+1))
+	Require(t, err)
+	if history.Next != nil || len(history.Attempts) != 2 {
+		Fail(t, "unexpected redeem history", history)
+	}
+	auto, manual := history.Attempts[0], history.Attempts[1]
+	if auto.TxHash != autoRedeems[0] || auto.Status != types.ReceiptStatusFailed {
+		Fail(t, "unexpected auto-redeem attempt", auto)
+	}
+	if manual.TxHash != manualRedeem || manual.Status != types.ReceiptStatusSuccessful || manual.BlockNumber < auto.BlockNumber {
+		Fail(t, "unexpected manual redeem attempt", manual)
+	}
+}
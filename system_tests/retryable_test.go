@@ -5,6 +5,8 @@ package arbtest
 
 import (
 	"context"
+	"encoding/hex"
+	"math"
 	"math/big"
 	"testing"
 	"time"
@@ -12,12 +14,14 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/offchainlabs/nitro/arbnode"
 	"github.com/offchainlabs/nitro/arbos/util"
 
 	"github.com/offchainlabs/nitro/arbos/l2pricing"
+	"github.com/offchainlabs/nitro/arbos/retryables"
 	"github.com/offchainlabs/nitro/solgen/go/bridgegen"
 	"github.com/offchainlabs/nitro/solgen/go/mocksgen"
 	"github.com/offchainlabs/nitro/solgen/go/node_interfacegen"
@@ -35,9 +39,37 @@ func retryableSetup(t *testing.T) (
 	func(*types.Receipt) common.Hash,
 	context.Context,
 	func(),
+) {
+	return retryableSetupWithConfig(t, arbnode.ConfigDefaultL1Test())
+}
+
+func retryableSetupWithConfig(t *testing.T, nodeConfig *arbnode.Config) (
+	*BlockchainTestInfo,
+	*BlockchainTestInfo,
+	*ethclient.Client,
+	*ethclient.Client,
+	*bridgegen.Inbox,
+	func(*types.Receipt) common.Hash,
+	context.Context,
+	func(),
+) {
+	l2info, l1info, _, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown := retryableSetupWithNode(t, nodeConfig)
+	return l2info, l1info, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown
+}
+
+func retryableSetupWithNode(t *testing.T, nodeConfig *arbnode.Config) (
+	*BlockchainTestInfo,
+	*BlockchainTestInfo,
+	*arbnode.Node,
+	*ethclient.Client,
+	*ethclient.Client,
+	*bridgegen.Inbox,
+	func(*types.Receipt) common.Hash,
+	context.Context,
+	func(),
 ) {
 	ctx, cancel := context.WithCancel(context.Background())
-	l2info, _, l2client, l1info, _, l1client, stack := CreateTestNodeOnL1(t, ctx, true)
+	l2info, l2node, l2client, l1info, _, l1client, stack := CreateTestNodeOnL1WithConfig(t, ctx, true, nodeConfig, params.ArbitrumDevTestChainConfig())
 	l2info.GenerateAccount("User2")
 	l2info.GenerateAccount("Beneficiary")
 	l2info.GenerateAccount("Burn")
@@ -53,7 +85,7 @@ func retryableSetup(t *testing.T) (
 		if len(messages) != 1 {
 			Fail(t, "expected 1 message from retryable submission, found", len(messages))
 		}
-		txs, err := messages[0].Message.ParseL2Transactions(params.ArbitrumDevTestChainConfig().ChainID)
+		txs, err := messages[0].Message.ParseL2Transactions(params.ArbitrumDevTestChainConfig().ChainID, math.MaxUint64)
 		Require(t, err)
 		if len(txs) != 1 {
 			Fail(t, "expected 1 tx from retryable submission, found", len(txs))
@@ -82,7 +114,7 @@ func retryableSetup(t *testing.T) (
 		cancel()
 		stack.Close()
 	}
-	return l2info, l1info, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown
+	return l2info, l1info, l2node, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown
 }
 
 func TestRetryableNoExist(t *testing.T) {
@@ -246,6 +278,180 @@ func TestSubmitRetryableFailThenRetry(t *testing.T) {
 	}
 }
 
+func TestRetryableRedeemer(t *testing.T) {
+	redeemerKey, err := crypto.GenerateKey()
+	Require(t, err)
+	redeemerAddress := crypto.PubkeyToAddress(redeemerKey.PublicKey)
+
+	// watch retryables whose beneficiary is the redeemer itself
+	nodeConfig := arbnode.ConfigDefaultL1Test()
+	nodeConfig.RetryableRedeemer.Enable = true
+	nodeConfig.RetryableRedeemer.Addresses = []string{redeemerAddress.Hex()}
+	nodeConfig.RetryableRedeemer.Wallet.PrivateKey = hex.EncodeToString(crypto.FromECDSA(redeemerKey))
+	l2info, l1info, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown := retryableSetupWithConfig(t, nodeConfig)
+	defer teardown()
+
+	l2info.Accounts["Redeemer"] = &AccountInfo{Address: redeemerAddress, PrivateKey: redeemerKey}
+	TransferBalance(t, "Faucet", "Redeemer", big.NewInt(1e18), l2info, l2client, ctx)
+
+	ownerTxOpts := l2info.GetDefaultTransactOpts("Owner", ctx)
+	usertxopts := l1info.GetDefaultTransactOpts("Faucet", ctx)
+	usertxopts.Value = arbmath.BigMul(big.NewInt(1e12), big.NewInt(1e12))
+
+	simpleAddr, _, simple, err := mocksgen.DeploySimple(&ownerTxOpts, l2client)
+	Require(t, err)
+	simpleABI, err := mocksgen.SimpleMetaData.GetAbi()
+	Require(t, err)
+
+	l1tx, err := delayedInbox.CreateRetryableTicket(
+		&usertxopts,
+		simpleAddr,
+		common.Big0,
+		big.NewInt(1e16),
+		redeemerAddress,
+		redeemerAddress,
+		// send enough L2 gas for intrinsic but not compute
+		big.NewInt(int64(params.TxGas+params.TxDataNonZeroGasEIP2028*4)),
+		big.NewInt(l2pricing.InitialBaseFeeWei*2),
+		simpleABI.Methods["increment"].ID,
+	)
+	Require(t, err)
+
+	l1receipt, err := EnsureTxSucceeded(ctx, l1client, l1tx)
+	Require(t, err)
+	if l1receipt.Status != types.ReceiptStatusSuccessful {
+		Fail(t, "l1receipt indicated failure")
+	}
+
+	waitForL1DelayBlocks(t, ctx, l1client, l1info)
+
+	receipt, err := WaitForTx(ctx, l2client, lookupSubmitRetryableL2TxHash(l1receipt), time.Second*5)
+	Require(t, err)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		Fail(t)
+	}
+	firstRetryTxId := receipt.Logs[1].Topics[2]
+	receipt, err = WaitForTx(ctx, l2client, firstRetryTxId, time.Second*5)
+	Require(t, err)
+	if receipt.Status != types.ReceiptStatusFailed {
+		Fail(t, "auto-redeem unexpectedly succeeded")
+	}
+
+	// the redeemer should notice the failed auto-redeem and retry it
+	for i := 0; ; i++ {
+		counter, err := simple.Counter(&bind.CallOpts{})
+		Require(t, err)
+		if counter == 1 {
+			break
+		}
+		if counter != 0 {
+			Fail(t, "Unexpected counter:", counter)
+		}
+		if i == 100 {
+			Fail(t, "retryable wasn't redeemed")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestRetryableRedeemerKeepalive(t *testing.T) {
+	redeemerKey, err := crypto.GenerateKey()
+	Require(t, err)
+	redeemerAddress := crypto.PubkeyToAddress(redeemerKey.PublicKey)
+
+	// a window longer than a retryable's lifetime makes new retryables due for a keepalive,
+	// but not once they've been kept alive
+	nodeConfig := arbnode.ConfigDefaultL1Test()
+	nodeConfig.RetryableRedeemer.Enable = true
+	nodeConfig.RetryableRedeemer.Addresses = []string{redeemerAddress.Hex()}
+	nodeConfig.RetryableRedeemer.Wallet.PrivateKey = hex.EncodeToString(crypto.FromECDSA(redeemerKey))
+	nodeConfig.RetryableRedeemer.Keepalive = true
+	nodeConfig.RetryableRedeemer.KeepaliveWindow = time.Duration(retryables.RetryableLifetimeSeconds+24*60*60) * time.Second
+	l2info, l1info, l2client, l1client, delayedInbox, lookupSubmitRetryableL2TxHash, ctx, teardown := retryableSetupWithConfig(t, nodeConfig)
+	defer teardown()
+
+	l2info.Accounts["Redeemer"] = &AccountInfo{Address: redeemerAddress, PrivateKey: redeemerKey}
+	TransferBalance(t, "Faucet", "Redeemer", big.NewInt(1e18), l2info, l2client, ctx)
+
+	ownerTxOpts := l2info.GetDefaultTransactOpts("Owner", ctx)
+	usertxopts := l1info.GetDefaultTransactOpts("Faucet", ctx)
+	usertxopts.Value = arbmath.BigMul(big.NewInt(1e12), big.NewInt(1e12))
+
+	simpleAddr, _, _, err := mocksgen.DeploySimple(&ownerTxOpts, l2client)
+	Require(t, err)
+	simpleABI, err := mocksgen.SimpleMetaData.GetAbi()
+	Require(t, err)
+
+	l1tx, err := delayedInbox.CreateRetryableTicket(
+		&usertxopts,
+		simpleAddr,
+		common.Big0,
+		big.NewInt(1e16),
+		redeemerAddress,
+		redeemerAddress,
+		// send enough L2 gas for intrinsic but not compute
+		big.NewInt(int64(params.TxGas+params.TxDataNonZeroGasEIP2028*4)),
+		big.NewInt(l2pricing.InitialBaseFeeWei*2),
+		simpleABI.Methods["increment"].ID,
+	)
+	Require(t, err)
+
+	l1receipt, err := EnsureTxSucceeded(ctx, l1client, l1tx)
+	Require(t, err)
+	if l1receipt.Status != types.ReceiptStatusSuccessful {
+		Fail(t, "l1receipt indicated failure")
+	}
+
+	waitForL1DelayBlocks(t, ctx, l1client, l1info)
+
+	receipt, err := WaitForTx(ctx, l2client, lookupSubmitRetryableL2TxHash(l1receipt), time.Second*5)
+	Require(t, err)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		Fail(t)
+	}
+	ticketId := receipt.Logs[0].Topics[1]
+	header, err := l2client.HeaderByNumber(ctx, receipt.BlockNumber)
+	Require(t, err)
+	initialTimeout := header.Time + retryables.RetryableLifetimeSeconds
+
+	arbRetryableTx, err := precompilesgen.NewArbRetryableTx(common.HexToAddress("6e"), l2client)
+	Require(t, err)
+
+	// the redeemer should extend the retryable's lifetime exactly once
+	var extensions []*precompilesgen.ArbRetryableTxLifetimeExtended
+	for i := 0; ; i++ {
+		iter, err := arbRetryableTx.FilterLifetimeExtended(&bind.FilterOpts{Context: ctx}, [][32]byte{ticketId})
+		Require(t, err)
+		extensions = nil
+		for iter.Next() {
+			extensions = append(extensions, iter.Event)
+		}
+		Require(t, iter.Error())
+		if len(extensions) > 0 {
+			break
+		}
+		if i == 100 {
+			Fail(t, "retryable wasn't kept alive")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+	iter, err := arbRetryableTx.FilterLifetimeExtended(&bind.FilterOpts{Context: ctx}, [][32]byte{ticketId})
+	Require(t, err)
+	extended := 0
+	for iter.Next() {
+		extended++
+	}
+	Require(t, iter.Error())
+	if extended != 1 {
+		Fail(t, "retryable was kept alive", extended, "times")
+	}
+	expectedTimeout := arbmath.UintToBig(initialTimeout + retryables.RetryableLifetimeSeconds)
+	if !arbmath.BigEquals(extensions[0].NewTimeout, expectedTimeout) {
+		Fail(t, "unexpected new timeout", extensions[0].NewTimeout, "expected", expectedTimeout)
+	}
+}
+
 func TestSubmissionGasCosts(t *testing.T) {
 	l2info, l1info, l2client, l1client, delayedInbox, _, ctx, teardown := retryableSetup(t)
 	defer teardown()
@@ -11,6 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
 	"github.com/offchainlabs/nitro/arbnode"
 	"github.com/offchainlabs/nitro/broadcastclient"
 	"github.com/offchainlabs/nitro/relay"
@@ -66,6 +69,46 @@ func TestSequencerFeed(t *testing.T) {
 	nodeB.StopAndWait()
 }
 
+func TestSignedSequencerFeed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	feedKey, err := crypto.GenerateKey()
+	Require(t, err)
+
+	seqNodeConfig := arbnode.ConfigDefaultL2Test()
+	seqNodeConfig.Feed.Output = *newBroadcasterConfigTest("0")
+	seqNodeConfig.Feed.Output.SigningKey = common.Bytes2Hex(crypto.FromECDSA(feedKey))
+	l2info1, nodeA, client1 := CreateTestL2WithConfig(t, ctx, nil, seqNodeConfig, true)
+
+	clientNodeConfig := arbnode.ConfigDefaultL2Test()
+	port := nodeA.BroadcastServer.ListenerAddr().(*net.TCPAddr).Port
+	clientNodeConfig.Feed.Input = *newBroadcastClientConfigTest(port)
+	clientNodeConfig.Feed.Input.SequencerAddress = crypto.PubkeyToAddress(feedKey.PublicKey).Hex()
+
+	_, nodeB, client2 := CreateTestL2WithConfig(t, ctx, nil, clientNodeConfig, false)
+
+	l2info1.GenerateAccount("User2")
+
+	tx := l2info1.PrepareTx("Owner", "User2", l2info1.TransferGas, big.NewInt(1e12), nil)
+
+	err = client1.SendTransaction(ctx, tx)
+	Require(t, err)
+
+	_, err = EnsureTxSucceeded(ctx, client1, tx)
+	Require(t, err)
+
+	_, err = WaitForTx(ctx, client2, tx.Hash(), time.Second*5)
+	Require(t, err)
+	l2balance, err := client2.BalanceAt(ctx, l2info1.GetAddress("User2"), nil)
+	Require(t, err)
+	if l2balance.Cmp(big.NewInt(1e12)) != 0 {
+		t.Fatal("Unexpected balance:", l2balance)
+	}
+	nodeA.StopAndWait()
+	nodeB.StopAndWait()
+}
+
 func TestRelayedSequencerFeed(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -78,8 +121,9 @@ func TestRelayedSequencerFeed(t *testing.T) {
 	port := nodeA.BroadcastServer.ListenerAddr().(*net.TCPAddr).Port
 	relayClientConf := *newBroadcastClientConfigTest(port)
 
-	relay := relay.NewRelay(relayServerConf, relayClientConf)
-	err := relay.Start(ctx)
+	relay, err := relay.NewRelay(relayServerConf, relayClientConf, "")
+	Require(t, err)
+	err = relay.Start(ctx)
 	Require(t, err)
 
 	clientNodeConfig := arbnode.ConfigDefaultL2Test()
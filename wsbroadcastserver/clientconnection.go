@@ -5,7 +5,6 @@ package wsbroadcastserver
 
 import (
 	"context"
-	"encoding/json"
 	"math/rand"
 	"net"
 	"strconv"
@@ -14,8 +13,8 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
 )
 
@@ -32,23 +31,64 @@ type ClientConnection struct {
 
 	lastHeardUnix int64
 	out           chan []byte
+
+	compression     bool                 // whether the client negotiated per message deflate
+	requestedSeqNum arbutil.MessageIndex // first sequence number the client wants replayed, 0 if not requested
+	filter          ClientFilter         // if not nil, the client only receives what the filter selects
+
+	catchup func(context.Context) error // if not nil, sends the client's backlog before any queued broadcasts
 }
 
-func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager) *ClientConnection {
+func NewClientConnection(conn net.Conn, desc *netpoll.Desc, clientManager *ClientManager, compression bool, requestedSeqNum arbutil.MessageIndex, filter ClientFilter) *ClientConnection {
 	return &ClientConnection{
-		conn:          conn,
-		desc:          desc,
-		Name:          conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
-		clientManager: clientManager,
-		lastHeardUnix: time.Now().Unix(),
-		out:           make(chan []byte, clientManager.settings.MaxSendQueue),
+		conn:            conn,
+		desc:            desc,
+		Name:            conn.RemoteAddr().String() + strconv.Itoa(rand.Intn(10)),
+		clientManager:   clientManager,
+		lastHeardUnix:   time.Now().Unix(),
+		out:             make(chan []byte, clientManager.settings.MaxSendQueue),
+		compression:     compression,
+		requestedSeqNum: requestedSeqNum,
+		filter:          filter,
 	}
 }
 
+// RequestedSeqNum returns the sequence number the client asked to resume from, or 0 if it didn't ask.
+func (cc *ClientConnection) RequestedSeqNum() arbutil.MessageIndex {
+	return cc.requestedSeqNum
+}
+
+// SetCatchup has the client's own thread run catchup once it starts, before writing any broadcasts.
+// Broadcasts queue up in the meantime, so catchup must send exactly the messages before the
+// first broadcast after the client is registered. Must be called before Start.
+func (cc *ClientConnection) SetCatchup(catchup func(context.Context) error) {
+	cc.catchup = catchup
+}
+
 func (cc *ClientConnection) Start(parentCtx context.Context) {
 	cc.StopWaiter.Start(parentCtx)
 	cc.LaunchThread(func(ctx context.Context) {
 		defer close(cc.out)
+		removeAfterError := func(err error, msg string) {
+			logWarn(err, msg)
+			cc.clientManager.Remove(cc)
+			for {
+				// Consume and ignore channel data until client properly stopped to prevent deadlock
+				select {
+				case <-ctx.Done():
+					return
+				case <-cc.out:
+				}
+			}
+		}
+		if cc.catchup != nil {
+			if err := cc.catchup(ctx); err != nil {
+				if ctx.Err() == nil {
+					removeAfterError(err, "error sending catchup to client")
+				}
+				return
+			}
+		}
 		for {
 			select {
 			case <-ctx.Done():
@@ -56,16 +96,8 @@ func (cc *ClientConnection) Start(parentCtx context.Context) {
 			case data := <-cc.out:
 				err := cc.writeRaw(data)
 				if err != nil {
-					logWarn(err, "error writing data to client")
-					cc.clientManager.Remove(cc)
-					for {
-						// Consume and ignore channel data until client properly stopped to prevent deadlock
-						select {
-						case <-ctx.Done():
-							return
-						case <-cc.out:
-						}
-					}
+					removeAfterError(err, "error writing data to client")
+					return
 				}
 			}
 		}
@@ -103,21 +135,32 @@ func (cc *ClientConnection) readRequest(ctx context.Context, timeout time.Durati
 
 	atomic.StoreInt64(&cc.lastHeardUnix, time.Now().Unix())
 
-	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide)
+	return ReadData(ctx, cc.conn, nil, timeout, ws.StateServerSide, cc.compression, cc.clientManager.settings.MaxClientMessageSize)
 }
 
+// Write sends x to the client immediately, applying the client's subscription filter if it has one
 func (cc *ClientConnection) Write(x interface{}) error {
-	writer := wsutil.NewWriter(cc.conn, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
+	if cc.filter != nil {
+		var ok bool
+		x, ok = cc.filter.FilterMessage(cc.clientManager.prepareForFilters(x))
+		if !ok {
+			return nil
+		}
+	}
+	notCompressed, compressed, err := serializeMessage(x, !cc.compression, cc.compression)
+	if err != nil {
+		return err
+	}
 
 	cc.ioMutex.Lock()
 	defer cc.ioMutex.Unlock()
 
-	if err := encoder.Encode(x); err != nil {
-		return err
+	if cc.compression {
+		_, err = cc.conn.Write(compressed.Bytes())
+	} else {
+		_, err = cc.conn.Write(notCompressed.Bytes())
 	}
-
-	return writer.Flush()
+	return err
 }
 
 func (cc *ClientConnection) writeRaw(p []byte) error {
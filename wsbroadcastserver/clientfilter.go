@@ -0,0 +1,23 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+// HTTPHeaderFeedFilter is sent by clients on the upgrade request to subscribe to a filtered
+// feed. Its format is defined by the server's ClientFilterParser.
+const HTTPHeaderFeedFilter = "Arbitrum-Feed-Filter"
+
+/* Protocol-specific subscription filtering can be injected using these types. */
+type ClientFilter interface {
+	// FilterMessage returns what a subscribed client should be sent instead of the prepared
+	// message, or false if the client should be sent nothing.
+	FilterMessage(prepared interface{}) (interface{}, bool)
+	// Key is the same for filters that select the same things, whose clients share a serialization.
+	Key() string
+}
+
+type ClientFilterParser func(filter string) (ClientFilter, error)
+
+// ClientFilterPreparer decodes a broadcast message once for all the filtered clients,
+// so the work each filter does is only the matching.
+type ClientFilterPreparer func(bm interface{}) interface{}
@@ -4,20 +4,16 @@
 package wsbroadcastserver
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"net"
 	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/offchainlabs/nitro/arbutil"
 	"github.com/offchainlabs/nitro/util/stopwaiter"
-	"github.com/pkg/errors"
 
-	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
-	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
 
@@ -32,14 +28,16 @@ type CatchupBuffer interface {
 type ClientManager struct {
 	stopwaiter.StopWaiter
 
-	clientPtrMap  map[*ClientConnection]bool
-	clientCount   int32
-	pool          *gopool.Pool
-	poller        netpoll.Poller
-	broadcastChan chan interface{}
-	clientAction  chan ClientConnectionAction
-	settings      BroadcasterConfig
-	catchupBuffer CatchupBuffer
+	clientPtrMap        map[*ClientConnection]bool
+	clientCount         int32
+	filteredClientCount int32
+	pool                *gopool.Pool
+	poller              netpoll.Poller
+	broadcastChan       chan interface{}
+	clientAction        chan ClientConnectionAction
+	settings            BroadcasterConfig
+	catchupBuffer       CatchupBuffer
+	filterPreparer      ClientFilterPreparer // if not nil, prepares broadcasts for filtered clients
 }
 
 type ClientConnectionAction struct {
@@ -72,11 +70,14 @@ func (cm *ClientManager) registerClient(ctx context.Context, clientConnection *C
 }
 
 // Register registers new connection as a Client.
-func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc) *ClientConnection {
+func (cm *ClientManager) Register(conn net.Conn, desc *netpoll.Desc, compression bool, requestedSeqNum arbutil.MessageIndex, filter ClientFilter) *ClientConnection {
 	createClient := ClientConnectionAction{
-		NewClientConnection(conn, desc, cm),
+		NewClientConnection(conn, desc, cm, compression, requestedSeqNum, filter),
 		true,
 	}
+	if filter != nil {
+		atomic.AddInt32(&cm.filteredClientCount, 1)
+	}
 
 	cm.clientAction <- createClient
 
@@ -105,6 +106,9 @@ func (cm *ClientManager) removeClientImpl(clientConnection *ClientConnection) {
 	}
 
 	atomic.AddInt32(&cm.clientCount, -1)
+	if clientConnection.filter != nil {
+		atomic.AddInt32(&cm.filteredClientCount, -1)
+	}
 }
 
 func (cm *ClientManager) removeClient(clientConnection *ClientConnection) {
@@ -128,6 +132,19 @@ func (cm *ClientManager) ClientCount() int32 {
 	return atomic.LoadInt32(&cm.clientCount)
 }
 
+// FilteredClientCount includes the filtered clients that are still being registered
+func (cm *ClientManager) FilteredClientCount() int32 {
+	return atomic.LoadInt32(&cm.filteredClientCount)
+}
+
+// prepareForFilters returns what the clients' filters are given for the broadcast message
+func (cm *ClientManager) prepareForFilters(bm interface{}) interface{} {
+	if cm.filterPreparer == nil {
+		return bm
+	}
+	return cm.filterPreparer(bm)
+}
+
 // Broadcast sends batch item to all clients.
 func (cm *ClientManager) Broadcast(bm interface{}) {
 	cm.broadcastChan <- bm
@@ -138,30 +155,87 @@ func (cm *ClientManager) doBroadcast(bm interface{}) ([]*ClientConnection, error
 		return nil, err
 	}
 
-	var buf bytes.Buffer
-	writer := wsutil.NewWriter(&buf, ws.StateServerSide, ws.OpText)
-	encoder := json.NewEncoder(writer)
-	if err := encoder.Encode(bm); err != nil {
-		return nil, errors.Wrap(err, "unable to encode message")
+	// Only serialize the forms some connected client actually needs
+	var anyNonCompressed, anyCompressed bool
+	for client := range cm.clientPtrMap {
+		if client.filter != nil {
+			// Filtered clients are sent their own serialization below
+			continue
+		}
+		if client.compression {
+			anyCompressed = true
+		} else {
+			anyNonCompressed = true
+		}
 	}
-	if err := writer.Flush(); err != nil {
-		return nil, errors.Wrap(err, "unable to flush message")
+	notCompressed, compressed, err := serializeMessage(bm, anyNonCompressed, anyCompressed)
+	if err != nil {
+		return nil, err
 	}
 
+	// The message is decoded once for all the filtered clients,
+	// and each distinct filter's result is only serialized once.
+	var prepared interface{}
+	var filteredCache map[filteredCacheKey]filteredResult
+
 	clientDeleteList := make([]*ClientConnection, 0, len(cm.clientPtrMap))
 	for client := range cm.clientPtrMap {
 		if len(client.out) == cm.settings.MaxSendQueue {
 			// Queue for client too backed up, disconnect instead of blocking on channel send
 			log.Info("disconnecting because send queue too large", "client", client.Name, "size", len(client.out))
 			clientDeleteList = append(clientDeleteList, client)
+		} else if client.filter != nil {
+			if filteredCache == nil {
+				prepared = cm.prepareForFilters(bm)
+				filteredCache = make(map[filteredCacheKey]filteredResult)
+			}
+			key := filteredCacheKey{client.filter.Key(), client.compression}
+			result, cached := filteredCache[key]
+			if !cached {
+				result = filterAndSerialize(client.filter, prepared, client.compression)
+				filteredCache[key] = result
+			}
+			if result.err != nil {
+				log.Warn("disconnecting because filtered message could not be serialized", "client", client.Name, "err", result.err)
+				clientDeleteList = append(clientDeleteList, client)
+			} else if result.data != nil {
+				client.out <- result.data
+			}
+		} else if client.compression {
+			client.out <- compressed.Bytes()
 		} else {
-			client.out <- buf.Bytes()
+			client.out <- notCompressed.Bytes()
 		}
 	}
 
 	return clientDeleteList, nil
 }
 
+type filteredCacheKey struct {
+	filter      string
+	compression bool
+}
+
+type filteredResult struct {
+	data []byte // nil if the filter selected nothing
+	err  error
+}
+
+func filterAndSerialize(filter ClientFilter, prepared interface{}, compression bool) filteredResult {
+	filtered, ok := filter.FilterMessage(prepared)
+	if !ok {
+		return filteredResult{}
+	}
+	notCompressed, compressed, err := serializeMessage(filtered, !compression, compression)
+	if err != nil {
+		return filteredResult{err: err}
+	}
+	if compression {
+		return filteredResult{data: compressed.Bytes()}
+	}
+	return filteredResult{data: notCompressed.Bytes()}
+}
+
 // verifyClients should be called every cm.settings.ClientPingInterval
 func (cm *ClientManager) verifyClients() []*ClientConnection {
 	clientConnectionCount := len(cm.clientPtrMap)
@@ -0,0 +1,87 @@
+// Copyright 2022, Offchain Labs, Inc.
+// For license information, see https://github.com/nitro/blob/master/LICENSE
+
+package wsbroadcastserver
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HTTPHeaderFeedRelayId is sent by relays on the upgrade request to identify themselves.
+const HTTPHeaderFeedRelayId = "Arbitrum-Feed-Relay-Id"
+
+// HTTPHeaderFeedPath is sent by servers on the upgrade response, listing the server's
+// relay id followed by the ids of every relay upstream of it.
+const HTTPHeaderFeedPath = "Arbitrum-Feed-Path"
+
+// FeedPath tracks which relays a feed passes through before reaching this one, so that
+// a relay can refuse to connect to, or serve, a relay that is already downstream of it.
+type FeedPath struct {
+	id string
+
+	mutex    sync.Mutex
+	upstream map[string][]string // upstream url -> feed path reported by that upstream
+}
+
+func NewFeedPath(id string) *FeedPath {
+	return &FeedPath{
+		id:       id,
+		upstream: make(map[string][]string),
+	}
+}
+
+func (p *FeedPath) ID() string {
+	return p.id
+}
+
+// SetUpstream records the feed path reported by the upstream at url
+func (p *FeedPath) SetUpstream(url string, path []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.upstream[url] = path
+}
+
+// Path returns this relay's id followed by the ids of all relays upstream of it
+func (p *FeedPath) Path() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	seen := map[string]bool{p.id: true}
+	var upstream []string
+	for _, path := range p.upstream {
+		for _, id := range path {
+			if !seen[id] {
+				seen[id] = true
+				upstream = append(upstream, id)
+			}
+		}
+	}
+	sort.Strings(upstream)
+	return append([]string{p.id}, upstream...)
+}
+
+// Contains reports whether id is this relay or any relay upstream of it
+func (p *FeedPath) Contains(id string) bool {
+	for _, pathId := range p.Path() {
+		if pathId == id {
+			return true
+		}
+	}
+	return false
+}
+
+func FormatFeedPath(path []string) string {
+	return strings.Join(path, ",")
+}
+
+func ParseFeedPath(value string) []string {
+	var path []string
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if id != "" {
+			path = append(path, id)
+		}
+	}
+	return path
+}
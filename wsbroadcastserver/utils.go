@@ -4,19 +4,28 @@
 package wsbroadcastserver
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
-	"errors"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
+	"github.com/pkg/errors"
 )
 
+// ErrMessageTooLarge is returned for a message longer than the reader's maximum message size,
+// which for compressed messages is checked after decompression.
+var ErrMessageTooLarge = errors.New("websocket message exceeds maximum message size")
+
 type chainedReader struct {
 	readers []io.Reader
 }
@@ -63,16 +72,76 @@ func (cr *chainedReader) add(r io.Reader) *chainedReader {
 	return cr
 }
 
-func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State) ([]byte, ws.OpCode, error) {
+// serializeMessage encodes bm as a websocket text frame, uncompressed and/or compressed with
+// per message deflate. Compressed frames don't use context takeover so they can be shared between clients.
+func serializeMessage(bm interface{}, enableNonCompressedOutput, enableCompressedOutput bool) (bytes.Buffer, bytes.Buffer, error) {
+	var notCompressed bytes.Buffer
+	var compressed bytes.Buffer
+	var writers []io.Writer
+
+	var notCompressedWriter *wsutil.Writer
+	if enableNonCompressedOutput {
+		notCompressedWriter = wsutil.NewWriter(&notCompressed, ws.StateServerSide, ws.OpText)
+		writers = append(writers, notCompressedWriter)
+	}
+
+	var compressedWriter *wsutil.Writer
+	var flateWriter *wsflate.Writer
+	if enableCompressedOutput {
+		compressedWriter = wsutil.NewWriter(&compressed, ws.StateServerSide, ws.OpText)
+		var msg wsflate.MessageState
+		msg.SetCompressed(true)
+		compressedWriter.SetExtensions(&msg)
+		flateWriter = wsflate.NewWriter(compressedWriter, func(w io.Writer) wsflate.Compressor {
+			f, err := flate.NewWriter(w, flate.DefaultCompression)
+			if err != nil {
+				// Only returned for an invalid compression level
+				panic(err)
+			}
+			return f
+		})
+		writers = append(writers, flateWriter)
+	}
 
+	encoder := json.NewEncoder(io.MultiWriter(writers...))
+	if err := encoder.Encode(bm); err != nil {
+		return notCompressed, compressed, errors.Wrap(err, "unable to encode message")
+	}
+
+	if notCompressedWriter != nil {
+		if err := notCompressedWriter.Flush(); err != nil {
+			return notCompressed, compressed, errors.Wrap(err, "unable to flush message")
+		}
+	}
+	if flateWriter != nil {
+		if err := flateWriter.Flush(); err != nil {
+			return notCompressed, compressed, errors.Wrap(err, "unable to flush flate writer")
+		}
+		if err := compressedWriter.Flush(); err != nil {
+			return notCompressed, compressed, errors.Wrap(err, "unable to flush compressed message")
+		}
+	}
+	return notCompressed, compressed, nil
+}
+
+// ReadData reads the next data message from conn. A maxMessageSize of 0 means there's no limit.
+func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idleTimeout time.Duration, state ws.State, compression bool, maxMessageSize int) ([]byte, ws.OpCode, error) {
+
+	if compression {
+		state = state.Set(ws.StateExtended)
+	}
 	controlHandler := wsutil.ControlFrameHandler(conn, state)
+	var msgState wsflate.MessageState
 	reader := wsutil.Reader{
 		Source:          (&chainedReader{}).add(earlyFrameData).add(conn),
 		State:           state,
-		CheckUTF8:       true,
+		CheckUTF8:       !compression, // compressed text is validated once decompressed instead
 		SkipHeaderCheck: false,
 		OnIntermediate:  controlHandler,
 	}
+	if compression {
+		reader.Extensions = []wsutil.RecvExtension{&msgState}
+	}
 
 	// Remove timeout when leaving this function
 	defer func(conn net.Conn) {
@@ -119,7 +188,23 @@ func ReadData(ctx context.Context, conn net.Conn, earlyFrameData io.Reader, idle
 			continue
 		}
 
-		data, err := ioutil.ReadAll(&reader)
+		var dataReader io.Reader = &reader
+		if msgState.IsCompressed() {
+			dataReader = wsflate.NewReader(&reader, func(r io.Reader) wsflate.Decompressor {
+				return flate.NewReader(r)
+			})
+		}
+		if maxMessageSize > 0 {
+			// A small compressed message can inflate to gigabytes, so stop reading one byte past the limit
+			dataReader = io.LimitReader(dataReader, int64(maxMessageSize)+1)
+		}
+		data, err := ioutil.ReadAll(dataReader)
+		if err == nil && maxMessageSize > 0 && len(data) > maxMessageSize {
+			return nil, header.OpCode, ErrMessageTooLarge
+		}
+		if err == nil && compression && header.OpCode == ws.OpText && !utf8.Valid(data) {
+			return nil, header.OpCode, wsutil.ErrInvalidUTF8
+		}
 
 		return data, header.OpCode, err
 	}
@@ -8,27 +8,43 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/gobwas/httphead"
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws-examples/src/gopool"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/mailru/easygo/netpoll"
 	flag "github.com/spf13/pflag"
+
+	"github.com/offchainlabs/nitro/arbutil"
 )
 
+// HTTPHeaderRequestedSequenceNumber is sent by clients on the upgrade request to ask the
+// server to only replay cached messages starting at the given sequence number.
+const HTTPHeaderRequestedSequenceNumber = "Arbitrum-Requested-Sequence-Number"
+
 type BroadcasterConfig struct {
-	Enable        bool          `koanf:"enable"`
-	Addr          string        `koanf:"addr"`
-	IOTimeout     time.Duration `koanf:"io-timeout"`
-	Port          string        `koanf:"port"`
-	Ping          time.Duration `koanf:"ping"`
-	ClientTimeout time.Duration `koanf:"client-timeout"`
-	Queue         int           `koanf:"queue"`
-	Workers       int           `koanf:"workers"`
-	MaxSendQueue  int           `koanf:"max-send-queue"`
+	Enable               bool                `koanf:"enable"`
+	Addr                 string              `koanf:"addr"`
+	IOTimeout            time.Duration       `koanf:"io-timeout"`
+	Port                 string              `koanf:"port"`
+	Ping                 time.Duration       `koanf:"ping"`
+	ClientTimeout        time.Duration       `koanf:"client-timeout"`
+	Queue                int                 `koanf:"queue"`
+	Workers              int                 `koanf:"workers"`
+	MaxSendQueue         int                 `koanf:"max-send-queue"`
+	SigningKey           string              `koanf:"signing-key"`
+	EnableCompression    bool                `koanf:"enable-compression"`
+	CatchupBuffer        CatchupBufferConfig `koanf:"catchup-buffer"`
+	EnableFilters        bool                `koanf:"enable-filters"`
+	MaxFilteredClients   int                 `koanf:"max-filtered-clients"`
+	MaxClientMessageSize int                 `koanf:"max-client-message-size"`
 }
 
 func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
@@ -41,41 +57,80 @@ func BroadcasterConfigAddOptions(prefix string, f *flag.FlagSet) {
 	f.Int(prefix+".queue", DefaultBroadcasterConfig.Queue, "queue size")
 	f.Int(prefix+".workers", DefaultBroadcasterConfig.Workers, "number of threads to reserve for HTTP to WS upgrade")
 	f.Int(prefix+".max-send-queue", DefaultBroadcasterConfig.MaxSendQueue, "maximum number of messages allowed to accumulate before client is disconnected")
+	f.String(prefix+".signing-key", DefaultBroadcasterConfig.SigningKey, "hex encoded private key used to sign feed messages, or a path to a file containing it (messages are unsigned if empty)")
+	f.Bool(prefix+".enable-compression", DefaultBroadcasterConfig.EnableCompression, "enable per message deflate compression for clients that negotiate it")
+	CatchupBufferConfigAddOptions(prefix+".catchup-buffer", f)
+	f.Bool(prefix+".enable-filters", DefaultBroadcasterConfig.EnableFilters, "allow clients to subscribe to only the transactions matching a filter (filtered messages are unsigned, since feed signatures cover whole messages)")
+	f.Int(prefix+".max-filtered-clients", DefaultBroadcasterConfig.MaxFilteredClients, "maximum number of clients subscribed to a filtered feed at once, since each costs broadcast time")
+	f.Int(prefix+".max-client-message-size", DefaultBroadcasterConfig.MaxClientMessageSize, "maximum size in bytes of a message read from a client, after decompression (0 for no limit)")
+}
+
+type CatchupBufferConfig struct {
+	Persistent bool          `koanf:"persistent"`
+	Directory  string        `koanf:"directory"`
+	Retention  time.Duration `koanf:"retention"`
+}
+
+func CatchupBufferConfigAddOptions(prefix string, f *flag.FlagSet) {
+	f.Bool(prefix+".persistent", DefaultCatchupBufferConfig.Persistent, "store the catchup buffer on disk so it survives restarts")
+	f.String(prefix+".directory", DefaultCatchupBufferConfig.Directory, "directory of the persistent catchup buffer database (relay only, nodes use their chain database)")
+	f.Duration(prefix+".retention", DefaultCatchupBufferConfig.Retention, "how long messages are kept in the persistent catchup buffer")
+}
+
+var DefaultCatchupBufferConfig = CatchupBufferConfig{
+	Persistent: false,
+	Directory:  "",
+	Retention:  6 * time.Hour,
 }
 
 var DefaultBroadcasterConfig = BroadcasterConfig{
-	Enable:        false,
-	Addr:          "",
-	IOTimeout:     5 * time.Second,
-	Port:          "9642",
-	Ping:          5 * time.Second,
-	ClientTimeout: 15 * time.Second,
-	Queue:         100,
-	Workers:       100,
-	MaxSendQueue:  4096,
+	Enable:               false,
+	Addr:                 "",
+	IOTimeout:            5 * time.Second,
+	Port:                 "9642",
+	Ping:                 5 * time.Second,
+	ClientTimeout:        15 * time.Second,
+	Queue:                100,
+	Workers:              100,
+	MaxSendQueue:         4096,
+	SigningKey:           "",
+	EnableCompression:    true,
+	CatchupBuffer:        DefaultCatchupBufferConfig,
+	EnableFilters:        false,
+	MaxFilteredClients:   64,
+	MaxClientMessageSize: 1024 * 1024,
 }
 
 var DefaultTestBroadcasterConfig = BroadcasterConfig{
-	Enable:        false,
-	Addr:          "0.0.0.0",
-	IOTimeout:     2 * time.Second,
-	Port:          "0",
-	Ping:          5 * time.Second,
-	ClientTimeout: 15 * time.Second,
-	Queue:         1,
-	Workers:       100,
-	MaxSendQueue:  4096,
+	Enable:               false,
+	Addr:                 "0.0.0.0",
+	IOTimeout:            2 * time.Second,
+	Port:                 "0",
+	Ping:                 5 * time.Second,
+	ClientTimeout:        15 * time.Second,
+	Queue:                1,
+	Workers:              100,
+	MaxSendQueue:         4096,
+	SigningKey:           "",
+	EnableCompression:    true,
+	CatchupBuffer:        DefaultCatchupBufferConfig,
+	EnableFilters:        false,
+	MaxFilteredClients:   64,
+	MaxClientMessageSize: 1024 * 1024,
 }
 
 type WSBroadcastServer struct {
-	startMutex    *sync.Mutex
-	poller        netpoll.Poller
-	acceptDesc    *netpoll.Desc
-	listener      net.Listener
-	settings      BroadcasterConfig
-	started       bool
-	clientManager *ClientManager
-	catchupBuffer CatchupBuffer
+	startMutex     *sync.Mutex
+	poller         netpoll.Poller
+	acceptDesc     *netpoll.Desc
+	listener       net.Listener
+	settings       BroadcasterConfig
+	started        bool
+	clientManager  *ClientManager
+	catchupBuffer  CatchupBuffer
+	feedPath       *FeedPath          // if not nil, relays already upstream of this server are refused
+	filterParser   ClientFilterParser // if not nil, clients may subscribe to a filtered feed
+	filterPreparer ClientFilterPreparer
 }
 
 func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffer) *WSBroadcastServer {
@@ -87,6 +142,17 @@ func NewWSBroadcastServer(settings BroadcasterConfig, catchupBuffer CatchupBuffe
 	}
 }
 
+// SetFeedPath enables feed loop detection, it must be called before Start
+func (s *WSBroadcastServer) SetFeedPath(feedPath *FeedPath) {
+	s.feedPath = feedPath
+}
+
+// SetClientFilterParser enables subscription filters, it must be called before Start
+func (s *WSBroadcastServer) SetClientFilterParser(filterParser ClientFilterParser, filterPreparer ClientFilterPreparer) {
+	s.filterParser = filterParser
+	s.filterPreparer = filterPreparer
+}
+
 func (s *WSBroadcastServer) Start(ctx context.Context) error {
 	s.startMutex.Lock()
 	defer s.startMutex.Unlock()
@@ -104,6 +170,7 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 	// Make pool of X size, Y sized work queue and one pre-spawned
 	// goroutine.
 	var clientManager = NewClientManager(s.poller, s.settings, s.catchupBuffer)
+	clientManager.filterPreparer = s.filterPreparer
 	clientManager.Start(ctx)
 
 	s.clientManager = clientManager // maintain the pointer in this instance... used for testing
@@ -117,15 +184,89 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 
 		safeConn := deadliner{conn, s.settings.IOTimeout}
 
+		var compress *wsflate.Extension
+		if s.settings.EnableCompression {
+			compress = &wsflate.Extension{
+				Parameters: wsflate.DefaultParameters,
+			}
+		}
+		var requestedSeqNum arbutil.MessageIndex
+		var filter ClientFilter
+		upgrader := ws.Upgrader{
+			Negotiate: func(opt httphead.Option) (httphead.Option, error) {
+				if compress == nil {
+					return httphead.Option{}, nil
+				}
+				return compress.Negotiate(opt)
+			},
+			OnHeader: func(key []byte, value []byte) error {
+				if strings.EqualFold(string(key), HTTPHeaderFeedRelayId) {
+					if s.feedPath != nil && s.feedPath.Contains(string(value)) {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusLoopDetected),
+							ws.RejectionReason(fmt.Sprintf("relay %s is upstream of this feed", value)),
+						)
+					}
+					return nil
+				}
+				if strings.EqualFold(string(key), HTTPHeaderFeedFilter) {
+					if s.filterParser == nil {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusNotImplemented),
+							ws.RejectionReason("feed subscription filters are not enabled"),
+						)
+					}
+					if int(clientManager.FilteredClientCount()) >= s.settings.MaxFilteredClients {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusServiceUnavailable),
+							ws.RejectionReason("too many filtered feed subscriptions"),
+						)
+					}
+					var err error
+					filter, err = s.filterParser(string(value))
+					if err != nil {
+						return ws.RejectConnectionError(
+							ws.RejectionStatus(http.StatusBadRequest),
+							ws.RejectionReason(fmt.Sprintf("invalid %s header: %v", HTTPHeaderFeedFilter, err)),
+						)
+					}
+					return nil
+				}
+				if !strings.EqualFold(string(key), HTTPHeaderRequestedSequenceNumber) {
+					return nil
+				}
+				num, err := strconv.ParseUint(string(value), 10, 64)
+				if err != nil {
+					return ws.RejectConnectionError(
+						ws.RejectionStatus(http.StatusBadRequest),
+						ws.RejectionReason(fmt.Sprintf("invalid %s header", HTTPHeaderRequestedSequenceNumber)),
+					)
+				}
+				requestedSeqNum = arbutil.MessageIndex(num)
+				return nil
+			},
+		}
+		if s.feedPath != nil {
+			upgrader.Header = ws.HandshakeHeaderHTTP(http.Header{
+				HTTPHeaderFeedPath: []string{FormatFeedPath(s.feedPath.Path())},
+			})
+		}
+
 		// Zero-copy upgrade to WebSocket connection.
-		hs, err := ws.Upgrade(safeConn)
+		hs, err := upgrader.Upgrade(safeConn)
 		if err != nil {
 			log.Warn("websocket upgrade error", "connection_name", nameConn(safeConn), "err", err)
 			_ = safeConn.Close()
 			return
 		}
 
-		log.Info(fmt.Sprintf("established websocket connection: %+v", hs), "connection-name", nameConn(safeConn))
+		// Clients that don't negotiate compression are sent uncompressed messages
+		compressionAccepted := false
+		if compress != nil {
+			_, compressionAccepted = compress.Accepted()
+		}
+
+		log.Info(fmt.Sprintf("established websocket connection: %+v", hs), "connection-name", nameConn(safeConn), "compression", compressionAccepted, "requestedSeqNum", requestedSeqNum, "filtered", filter != nil)
 
 		// Create netpoll event descriptor to handle only read events.
 		desc, err := netpoll.HandleRead(conn)
@@ -136,7 +277,7 @@ func (s *WSBroadcastServer) Start(ctx context.Context) error {
 		}
 
 		// Register incoming client in clientManager.
-		client := clientManager.Register(safeConn, desc)
+		client := clientManager.Register(safeConn, desc, compressionAccepted, requestedSeqNum, filter)
 
 		// Subscribe to events about conn.
 		err = s.poller.Start(desc, func(ev netpoll.Event) {